@@ -178,6 +178,12 @@ func (c *Cluster) deployK8sAddOns(ctx context.Context, data map[string]interface
 		log.Warnf(ctx, "Failed to deploy addon execute job [%s]: %v", IngressAddonResourceName, err)
 
 	}
+	if err := c.deployHardeningAddon(ctx); err != nil {
+		if err, ok := err.(*addonError); ok && err.isCritical {
+			return err
+		}
+		log.Warnf(ctx, "Failed to deploy addon execute job [%s]: %v", HardeningAddonResourceName, err)
+	}
 	return nil
 }
 
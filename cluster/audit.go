@@ -0,0 +1,444 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/client"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AuditCheckContainer = "rke-audit-checker"
+
+	AuditStatusPass   = "pass"
+	AuditStatusFail   = "fail"
+	AuditStatusManual = "manual"
+)
+
+// auditFilesScript prints the mode, the owner and the path of the certificate files and of the etcd data directory
+const auditFilesScript = `for f in /host$CERT_DIR*; do
+  [ -f "$f" ] && stat -c 'cert %a %u:%g %n' "$f"
+done
+if [ -n "$ETCD_DIR" ] && [ -d "/host$ETCD_DIR" ]; then
+  stat -c 'etcd %a %u:%g %n' "/host$ETCD_DIR"
+fi
+true`
+
+// cisAuditArgControls are the service arguments checked by the audit on top of the hardening profile ones, the profile doesn't set
+// them as rke already does
+var cisAuditArgControls = []HardeningControl{
+	{ID: "2.2", Service: services.EtcdContainerName, Arg: "client-cert-auth", Value: "true"},
+	{ID: "2.3", Service: services.EtcdContainerName, Arg: "auto-tls", Value: "false", Allowed: isNotTrue},
+	{ID: "2.5", Service: services.EtcdContainerName, Arg: "peer-client-cert-auth", Value: "true"},
+	{ID: "2.6", Service: services.EtcdContainerName, Arg: "peer-auto-tls", Value: "false", Allowed: isNotTrue},
+}
+
+func isNotTrue(value string) bool {
+	return value != "true"
+}
+
+// auditFileControl is a control of the benchmark on the mode or the owner of a certificate file
+type auditFileControl struct {
+	ID          string
+	Description string
+	// ControlOnly controls are only checked on the controlplane hosts
+	ControlOnly bool
+	// Match selects the certificate files of the control by name
+	Match func(name string) bool
+	// MaxMode is the most permissive mode of the files, their owner is checked instead when it's 0
+	MaxMode uint32
+}
+
+var cisAuditFileControls = []auditFileControl{
+	{ID: "1.1.19", Description: "Ensure that the certificate files are owned by root:root", ControlOnly: true, Match: func(string) bool { return true }},
+	{ID: "1.1.20", Description: "Ensure that the certificate file permissions are set to 600 or more restrictive", ControlOnly: true, MaxMode: 0600, Match: func(name string) bool {
+		return strings.HasSuffix(name, ".pem") && !strings.HasSuffix(name, "-key.pem")
+	}},
+	{ID: "1.1.21", Description: "Ensure that the certificate key file permissions are set to 600", ControlOnly: true, MaxMode: 0600, Match: func(name string) bool {
+		return strings.HasSuffix(name, "-key.pem")
+	}},
+	{ID: "4.1.3", Description: "Ensure that the proxy kubeconfig file permissions are set to 600 or more restrictive", MaxMode: 0600, Match: isAuditFile(pki.GetConfigPath(pki.KubeProxyCertName))},
+	{ID: "4.1.4", Description: "Ensure that the proxy kubeconfig file ownership is set to root:root", Match: isAuditFile(pki.GetConfigPath(pki.KubeProxyCertName))},
+	{ID: "4.1.5", Description: "Ensure that the kubelet kubeconfig file permissions are set to 600 or more restrictive", MaxMode: 0600, Match: isAuditFile(pki.GetConfigPath(pki.KubeNodeCertName))},
+	{ID: "4.1.6", Description: "Ensure that the kubelet kubeconfig file ownership is set to root:root", Match: isAuditFile(pki.GetConfigPath(pki.KubeNodeCertName))},
+	{ID: "4.1.7", Description: "Ensure that the certificate authorities file permissions are set to 600 or more restrictive", MaxMode: 0600, Match: isAuditFile(pki.GetCertPath(pki.CACertName))},
+	{ID: "4.1.8", Description: "Ensure that the client certificate authorities file ownership is set to root:root", Match: isAuditFile(pki.GetCertPath(pki.CACertName))},
+}
+
+// auditManualControl is a control of the benchmark that can't be checked automatically
+type auditManualControl struct {
+	ID          string
+	Description string
+	ControlOnly bool
+}
+
+var cisAuditManualControls = []auditManualControl{
+	{ID: "1.1.9", Description: "Ensure that the Container Network Interface file permissions are set to 600 or more restrictive"},
+	{ID: "1.2.9", Description: "Ensure that the admission control plugin EventRateLimit is set", ControlOnly: true},
+	{ID: "4.2.9", Description: "Ensure that the --event-qps argument is set to 0 or a level which ensures appropriate event capture"},
+}
+
+func isAuditFile(filePath string) func(string) bool {
+	fileName := path.Base(filePath)
+	return func(name string) bool {
+		return name == fileName
+	}
+}
+
+// auditFile is the mode and the owner of a file of a host
+type auditFile struct {
+	Name  string
+	Mode  uint32
+	Owner string
+}
+
+// AuditResult is the result of a control of the benchmark on a node
+type AuditResult struct {
+	Node        string `json:"node"`
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Message     string `json:"message,omitempty"`
+}
+
+// AuditReport holds the results of the controls on the nodes
+type AuditReport struct {
+	lock    sync.Mutex
+	Results []AuditResult `json:"results"`
+}
+
+func (r *AuditReport) add(node, id, description, status, message string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Results = append(r.Results, AuditResult{Node: node, ID: id, Description: description, Status: status, Message: message})
+}
+
+func (r *AuditReport) sort() {
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		if r.Results[i].Node != r.Results[j].Node {
+			return r.Results[i].Node < r.Results[j].Node
+		}
+		return lessBenchmarkID(r.Results[i].ID, r.Results[j].ID)
+	})
+}
+
+// lessBenchmarkID orders the benchmark IDs by their numbers, 1.2.9 comes before 1.2.10
+func lessBenchmarkID(a, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] == bParts[i] {
+			continue
+		}
+		aNumber, aErr := strconv.Atoi(aParts[i])
+		bNumber, bErr := strconv.Atoi(bParts[i])
+		if aErr != nil || bErr != nil {
+			return aParts[i] < bParts[i]
+		}
+		return aNumber < bNumber
+	}
+	return len(aParts) < len(bParts)
+}
+
+// Failed returns the failed controls
+func (r *AuditReport) Failed() []AuditResult {
+	var results []AuditResult
+	for _, result := range r.Results {
+		if result.Status == AuditStatusFail {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// WriteJSON writes the results as JSON
+func (r *AuditReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the results as JUnit XML, with a test suite per node. The manual controls are skipped tests.
+func (r *AuditReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{}
+	for _, result := range r.Results {
+		if len(suites.Suites) == 0 || suites.Suites[len(suites.Suites)-1].Name != result.Node {
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: result.Node})
+		}
+		suite := &suites.Suites[len(suites.Suites)-1]
+		testCase := junitTestCase{
+			Name:      fmt.Sprintf("%s %s", result.ID, result.Description),
+			ClassName: "cis." + result.Node,
+		}
+		switch result.Status {
+		case AuditStatusFail:
+			testCase.Failure = &junitMessage{Message: result.Message}
+			suite.Failures++
+		case AuditStatusManual:
+			testCase.Skipped = &junitMessage{Message: result.Message}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Err returns an error listing the failed controls, if any
+func (r *AuditReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, result := range failed {
+		messages = append(messages, fmt.Sprintf("[%s] on host [%s]", result.ID, result.Node))
+	}
+	return fmt.Errorf("[audit] %d control(s) failed: %s", len(failed), strings.Join(messages, ", "))
+}
+
+// RunCISAudit checks the nodes against the CIS Kubernetes benchmark: the arguments of the running containers and of the plan, and the
+// permissions of the certificates and of the etcd data directory. The hosts must be tunneled.
+func (c *Cluster) RunCISAudit(ctx context.Context, data map[string]interface{}) (*AuditReport, error) {
+	report := &AuditReport{}
+	svcOptionData := GetServiceOptionData(data)
+	log.Infof(ctx, "[audit] Running the CIS benchmark controls on the nodes")
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	err := runOnHosts(allHosts, WorkerThreads, func(host *hosts.Host) error {
+		svcOptions, err := c.GetKubernetesServicesOptions(host.DockerInfo.OSType, svcOptionData)
+		if err != nil {
+			return err
+		}
+		nodePlan := BuildRKEConfigNodePlan(ctx, c, host, svcOptions)
+		c.auditProcesses(ctx, host, nodePlan.Processes, report)
+		if !host.IsWindows() {
+			c.auditFiles(ctx, host, nodePlan.Processes[services.EtcdContainerName].User, report)
+		}
+		for _, control := range cisAuditManualControls {
+			if !control.ControlOnly || host.IsControl {
+				report.add(host.Address, control.ID, control.Description, AuditStatusManual, "review the configuration of the node")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.sort()
+	return report, nil
+}
+
+// auditProcesses checks the arguments of the service containers running on the host and of the processes of its plan
+func (c *Cluster) auditProcesses(ctx context.Context, host *hosts.Host, processes map[string]v3.Process, report *AuditReport) {
+	controls := append(append([]HardeningControl{}, CISHardeningControls...), cisAuditArgControls...)
+	for _, control := range controls {
+		process, ok := processes[control.Service]
+		if !ok || (control.LinuxOnly && host.IsWindows()) {
+			continue
+		}
+		description := fmt.Sprintf("Ensure that the --%s argument of %s is set to %s", control.Arg, control.Service, control.Value)
+		runningArgs, err := getRunningContainerArgs(ctx, host, control.Service)
+		if err != nil {
+			report.add(host.Address, control.ID, description, AuditStatusFail, err.Error())
+			continue
+		}
+		status, message := evaluateAuditArg(control, runningArgs, "running container")
+		if status == AuditStatusPass {
+			status, message = evaluateAuditArg(control, getProcessArgs(append(process.Command, process.Args...)), "plan")
+		}
+		report.add(host.Address, control.ID, description, status, message)
+	}
+}
+
+func getRunningContainerArgs(ctx context.Context, host *hosts.Host, containerName string) (map[string][]string, error) {
+	inspection, err := docker.InspectContainer(ctx, host.DClient, host.Address, containerName)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("container [%s] doesn't exist", containerName)
+		}
+		return nil, err
+	}
+	if inspection.State == nil || !inspection.State.Running {
+		return nil, fmt.Errorf("container [%s] isn't running", containerName)
+	}
+	return getProcessArgs(append(inspection.Config.Entrypoint, inspection.Config.Cmd...)), nil
+}
+
+// getProcessArgs returns the values of the --arg=value and --arg arguments of a command, the arguments without value are true
+func getProcessArgs(command []string) map[string][]string {
+	args := map[string][]string{}
+	for _, word := range command {
+		if !strings.HasPrefix(word, "--") {
+			continue
+		}
+		arg, value, ok := strings.Cut(strings.TrimPrefix(word, "--"), "=")
+		if !ok {
+			value = "true"
+		}
+		args[arg] = append(args[arg], value)
+	}
+	return args
+}
+
+func evaluateAuditArg(control HardeningControl, args map[string][]string, source string) (string, string) {
+	values, ok := args[control.Arg]
+	if !ok {
+		if control.IsSatisfiedBy("") {
+			return AuditStatusPass, fmt.Sprintf("--%s isn't set in the %s", control.Arg, source)
+		}
+		return AuditStatusFail, fmt.Sprintf("--%s isn't set in the %s", control.Arg, source)
+	}
+	for _, value := range values {
+		if !control.IsSatisfiedBy(value) {
+			return AuditStatusFail, fmt.Sprintf("--%s=%s in the %s", control.Arg, value, source)
+		}
+	}
+	return AuditStatusPass, fmt.Sprintf("--%s=%s", control.Arg, strings.Join(values, ","))
+}
+
+// auditFiles checks the mode and the owner of the certificates and of the etcd data directory of the host, etcdUser is the user of the
+// etcd process of the plan
+func (c *Cluster) auditFiles(ctx context.Context, host *hosts.Host, etcdUser string, report *AuditReport) {
+	env := []string{"CERT_DIR=" + path.Join(host.PrefixPath, pki.CertPathPrefix) + "/"}
+	if host.IsEtcd {
+		env = append(env, "ETCD_DIR="+path.Join(host.PrefixPath, "/var/lib/etcd"))
+	}
+	stdout, err := c.runInspectionContainer(ctx, host, AuditCheckContainer, "audit", auditFilesScript, env)
+	if err != nil {
+		for _, control := range cisAuditFileControls {
+			if !control.ControlOnly || host.IsControl {
+				report.add(host.Address, control.ID, control.Description, AuditStatusFail, fmt.Sprintf("failed to inspect the node: %v", err))
+			}
+		}
+		return
+	}
+	logrus.Debugf("[audit] Files of host [%s]: %s", host.Address, stdout)
+	certFiles, etcdDir := parseAuditFiles(stdout)
+	for _, control := range cisAuditFileControls {
+		if !control.ControlOnly || host.IsControl {
+			status, message := evaluateAuditFiles(control, certFiles)
+			report.add(host.Address, control.ID, control.Description, status, message)
+		}
+	}
+	if host.IsEtcd {
+		auditEtcdDataDir(host, etcdDir, etcdUser, report)
+	}
+}
+
+func parseAuditFiles(output string) ([]auditFile, *auditFile) {
+	var certFiles []auditFile
+	var etcdDir *auditFile
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		mode, err := strconv.ParseUint(fields[1], 8, 32)
+		if err != nil {
+			continue
+		}
+		file := auditFile{Name: path.Base(fields[3]), Mode: uint32(mode), Owner: fields[2]}
+		switch fields[0] {
+		case "cert":
+			certFiles = append(certFiles, file)
+		case "etcd":
+			etcdDir = &file
+		}
+	}
+	return certFiles, etcdDir
+}
+
+func evaluateAuditFiles(control auditFileControl, files []auditFile) (string, string) {
+	var checked, failed []string
+	for _, file := range files {
+		if !control.Match(file.Name) {
+			continue
+		}
+		checked = append(checked, file.Name)
+		if control.MaxMode == 0 && file.Owner != "0:0" {
+			failed = append(failed, fmt.Sprintf("%s is owned by %s", file.Name, file.Owner))
+		}
+		if control.MaxMode != 0 && file.Mode&^control.MaxMode != 0 {
+			failed = append(failed, fmt.Sprintf("%s has mode %o", file.Name, file.Mode))
+		}
+	}
+	if len(checked) == 0 {
+		return AuditStatusFail, fmt.Sprintf("no file found in [%s]", pki.CertPathPrefix)
+	}
+	if len(failed) > 0 {
+		return AuditStatusFail, strings.Join(failed, ", ")
+	}
+	return AuditStatusPass, fmt.Sprintf("%d file(s) checked", len(checked))
+}
+
+// auditEtcdDataDir checks the etcd data directory against the user the plan runs etcd as, which owns the directory
+func auditEtcdDataDir(host *hosts.Host, etcdDir *auditFile, etcdUser string, report *AuditReport) {
+	const modeID, modeDescription = "1.1.11", "Ensure that the etcd data directory permissions are set to 700 or more restrictive"
+	const ownerID, ownerDescription = "1.1.12", "Ensure that the etcd data directory ownership is set to etcd:etcd"
+	if etcdDir == nil {
+		message := fmt.Sprintf("etcd data directory [%s] not found", path.Join(host.PrefixPath, "/var/lib/etcd"))
+		report.add(host.Address, modeID, modeDescription, AuditStatusFail, message)
+		report.add(host.Address, ownerID, ownerDescription, AuditStatusFail, message)
+		return
+	}
+	if etcdDir.Mode&^0700 != 0 {
+		report.add(host.Address, modeID, modeDescription, AuditStatusFail, fmt.Sprintf("mode is %o", etcdDir.Mode))
+	} else {
+		report.add(host.Address, modeID, modeDescription, AuditStatusPass, fmt.Sprintf("mode is %o", etcdDir.Mode))
+	}
+	switch {
+	case etcdUser == "":
+		report.add(host.Address, ownerID, ownerDescription, AuditStatusFail, fmt.Sprintf("etcd runs as root, set the uid and the gid of %s", services.EtcdContainerName))
+	case etcdDir.Owner != etcdUser:
+		report.add(host.Address, ownerID, ownerDescription, AuditStatusFail, fmt.Sprintf("owner is %s instead of %s", etcdDir.Owner, etcdUser))
+	default:
+		report.add(host.Address, ownerID, ownerDescription, AuditStatusPass, fmt.Sprintf("owner is %s", etcdDir.Owner))
+	}
+}
@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/rancher/rke/docker/dockertest"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateAuditArg(t *testing.T) {
+	args := getProcessArgs([]string{"/opt/rke-tools/entrypoint.sh", "etcd", "--client-cert-auth", "--profiling=false", "--tls-cipher-suites=a,b", "--profiling=true"})
+	assert.Equal(t, []string{"true"}, args["client-cert-auth"])
+	assert.Equal(t, []string{"false", "true"}, args["profiling"])
+	assert.Equal(t, []string{"a,b"}, args["tls-cipher-suites"])
+
+	controls := map[string]HardeningControl{}
+	for _, control := range append(append([]HardeningControl{}, CISHardeningControls...), cisAuditArgControls...) {
+		controls[control.Service+" "+control.Arg] = control
+	}
+	status, _ := evaluateAuditArg(controls[services.EtcdContainerName+" client-cert-auth"], args, "plan")
+	assert.Equal(t, AuditStatusPass, status)
+	// every value of an argument repeated by extra_args_array is checked
+	status, message := evaluateAuditArg(controls[services.KubeAPIContainerName+" profiling"], args, "plan")
+	assert.Equal(t, AuditStatusFail, status)
+	assert.Equal(t, "--profiling=true in the plan", message)
+	// a missing argument passes when the default of the service satisfies the control
+	status, _ = evaluateAuditArg(controls[services.EtcdContainerName+" auto-tls"], args, "plan")
+	assert.Equal(t, AuditStatusPass, status)
+	status, message = evaluateAuditArg(controls[services.KubeletContainerName+" anonymous-auth"], args, "running container")
+	assert.Equal(t, AuditStatusFail, status)
+	assert.Equal(t, "--anonymous-auth isn't set in the running container", message)
+}
+
+func TestAuditFiles(t *testing.T) {
+	certFiles, etcdDir := parseAuditFiles(`cert 600 0:0 /host/etc/kubernetes/ssl/kube-ca.pem
+cert 644 0:0 /host/etc/kubernetes/ssl/kube-apiserver.pem
+cert 600 1000:1000 /host/etc/kubernetes/ssl/kube-apiserver-key.pem
+cert 600 0:0 /host/etc/kubernetes/ssl/kubecfg-kube-proxy.yaml
+etcd 700 52034:52034 /host/var/lib/etcd
+`)
+	assert.Len(t, certFiles, 4)
+	assert.Equal(t, &auditFile{Name: "etcd", Mode: 0700, Owner: "52034:52034"}, etcdDir)
+
+	controls := map[string]auditFileControl{}
+	for _, control := range cisAuditFileControls {
+		controls[control.ID] = control
+	}
+	status, message := evaluateAuditFiles(controls["1.1.19"], certFiles)
+	assert.Equal(t, AuditStatusFail, status)
+	assert.Equal(t, "kube-apiserver-key.pem is owned by 1000:1000", message)
+	status, message = evaluateAuditFiles(controls["1.1.20"], certFiles)
+	assert.Equal(t, AuditStatusFail, status)
+	assert.Equal(t, "kube-apiserver.pem has mode 644", message)
+	status, _ = evaluateAuditFiles(controls["1.1.21"], certFiles)
+	assert.Equal(t, AuditStatusPass, status)
+	status, _ = evaluateAuditFiles(controls["4.1.3"], certFiles)
+	assert.Equal(t, AuditStatusPass, status)
+	status, _ = evaluateAuditFiles(controls["4.1.5"], certFiles)
+	assert.Equal(t, AuditStatusFail, status)
+
+	host := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}}
+	report := &AuditReport{}
+	auditEtcdDataDir(host, etcdDir, "", report)
+	assert.Equal(t, AuditStatusPass, report.Results[0].Status)
+	assert.Equal(t, AuditStatusFail, report.Results[1].Status)
+	report = &AuditReport{}
+	auditEtcdDataDir(host, etcdDir, "52034:52034", report)
+	assert.Empty(t, report.Failed())
+}
+
+func TestAuditFilesContainer(t *testing.T) {
+	runtime := dockertest.NewRuntime(func(name string, c *dockertest.Container) {
+		assert.Equal(t, AuditCheckContainer, name)
+		assert.Contains(t, c.Config.Env, "CERT_DIR=/etc/kubernetes/ssl/")
+		c.Stdout = `cert 600 0:0 /host/etc/kubernetes/ssl/kube-ca.pem
+cert 600 0:0 /host/etc/kubernetes/ssl/kube-apiserver.pem
+cert 600 0:0 /host/etc/kubernetes/ssl/kube-apiserver-key.pem
+cert 600 0:0 /host/etc/kubernetes/ssl/kubecfg-kube-proxy.yaml
+cert 600 0:0 /host/etc/kubernetes/ssl/kubecfg-kube-node.yaml
+etcd 700 52034:52034 /host/var/lib/etcd
+`
+	})
+	c := &Cluster{}
+	c.SystemImages.Alpine = "rancher/rke-tools:v0.1.100"
+	host := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}, IsControl: true, IsEtcd: true, DClient: runtime}
+	report := &AuditReport{}
+	c.auditFiles(context.Background(), host, "52034:52034", report)
+	assert.Empty(t, report.Failed())
+	assert.Len(t, report.Results, len(cisAuditFileControls)+2)
+	assert.Empty(t, runtime.Containers())
+}
+
+func TestAuditReport(t *testing.T) {
+	report := &AuditReport{}
+	report.add("2.2.2.2", "1.2.10", "ten", AuditStatusPass, "")
+	report.add("1.1.1.1", "4.2.9", "qps", AuditStatusManual, "review")
+	report.add("2.2.2.2", "1.2.9", "nine", AuditStatusFail, "--profiling=true")
+	report.add("1.1.1.1", "1.1.19", "owner", AuditStatusPass, "")
+	report.sort()
+	var ids []string
+	for _, result := range report.Results {
+		ids = append(ids, result.Node+" "+result.ID)
+	}
+	assert.Equal(t, []string{"1.1.1.1 1.1.19", "1.1.1.1 4.2.9", "2.2.2.2 1.2.9", "2.2.2.2 1.2.10"}, ids)
+	assert.EqualError(t, report.Err(), "[audit] 1 control(s) failed: [1.2.9] on host [2.2.2.2]")
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteJUnit(&buf))
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	assert.Len(t, suites.Suites, 2)
+	assert.Equal(t, "1.1.1.1", suites.Suites[0].Name)
+	assert.Equal(t, 2, suites.Suites[0].Tests)
+	assert.Equal(t, 1, suites.Suites[0].Skipped)
+	assert.Equal(t, 1, suites.Suites[1].Failures)
+	assert.Equal(t, "1.2.9 nine", suites.Suites[1].Cases[0].Name)
+	assert.Equal(t, &junitMessage{Message: "--profiling=true"}, suites.Suites[1].Cases[0].Failure)
+}
@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/pki/cert"
+	v3 "github.com/rancher/rke/types"
+)
+
+const (
+	// CARotationPhaseTrust distributes a CA bundle trusting both the old and the new CA
+	CARotationPhaseTrust = "trust"
+	// CARotationPhaseRotate switches the certificates of the components to the new CA, the old CA is still trusted
+	CARotationPhaseRotate = "rotate"
+	// CARotationPhaseFinalize removes the old CA from the CA bundle
+	CARotationPhaseFinalize = "finalize"
+)
+
+var CARotationPhases = []string{CARotationPhaseTrust, CARotationPhaseRotate, CARotationPhaseFinalize}
+
+// CARotation records the progress of a staged CA rotation in the state file
+type CARotation struct {
+	Phase     string             `json:"phase"`
+	Completed bool               `json:"completed"`
+	OldCA     pki.CertificatePKI `json:"oldCA"`
+	NewCA     pki.CertificatePKI `json:"newCA"`
+}
+
+func (r *CARotation) transformPEMToObject() {
+	cas := pki.TransformPEMToObject(map[string]pki.CertificatePKI{"old": r.OldCA, "new": r.NewCA})
+	r.OldCA = cas["old"]
+	r.NewCA = cas["new"]
+}
+
+func getCARotationPhaseIndex(phase string) int {
+	for i, p := range CARotationPhases {
+		if p == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkCARotationPhase makes sure the phases run in order, a phase can be run again until the next one is started
+func checkCARotationPhase(rotation *CARotation, phase string) error {
+	index := getCARotationPhaseIndex(phase)
+	if index < 0 {
+		return fmt.Errorf("invalid CA rotation phase [%s], allowed values: %v", phase, CARotationPhases)
+	}
+	if rotation == nil {
+		if index != 0 {
+			return fmt.Errorf("no CA rotation in progress, start the rotation with the [%s] phase", CARotationPhaseTrust)
+		}
+		return nil
+	}
+	current := getCARotationPhaseIndex(rotation.Phase)
+	if index == current {
+		return nil
+	}
+	if index != current+1 {
+		return fmt.Errorf("CA rotation is in the [%s] phase, can't run the [%s] phase", rotation.Phase, phase)
+	}
+	if !rotation.Completed {
+		return fmt.Errorf("CA rotation phase [%s] didn't complete, run it again before the [%s] phase", rotation.Phase, phase)
+	}
+	return nil
+}
+
+// withTrustedCA returns the CA certificate also trusting the certificates of the other CA
+func withTrustedCA(ca, other pki.CertificatePKI) pki.CertificatePKI {
+	ca.ChainPEM += string(cert.EncodeCertPEM(other.Certificate)) + other.ChainPEM
+	return ca
+}
+
+// PrepareCARotationPhase updates the desired certificates bundle for a phase of the staged CA rotation and records the phase
+// in the state. The new CA is issued with the certificates configuration of rkeConfig when the rotation starts.
+func PrepareCARotationPhase(ctx context.Context, fullState *FullState, rkeConfig *v3.RancherKubernetesEngineConfig, flags ExternalFlags, phase string) error {
+	rotation := fullState.CARotation
+	if err := checkCARotationPhase(rotation, phase); err != nil {
+		return err
+	}
+	resume := rotation != nil && rotation.Phase == phase
+	certs := fullState.DesiredState.CertificatesBundle
+	switch phase {
+	case CARotationPhaseTrust:
+		if rotation == nil {
+			oldCA := certs[pki.CACertName]
+			if oldCA.Certificate == nil {
+				return fmt.Errorf("Failed to rotate CA certificate: can't find CA certificate")
+			}
+			newCerts := make(map[string]pki.CertificatePKI)
+			if err := pki.GenerateRKEMasterCACert(ctx, newCerts, *rkeConfig, flags.ClusterFilePath, flags.ConfigDir); err != nil {
+				return err
+			}
+			newCA := newCerts[pki.CACertName]
+			if newCA.Certificate.Equal(oldCA.Certificate) {
+				return fmt.Errorf("Failed to rotate CA certificate: the new CA certificate is the current CA certificate, update the certificates configuration to use a new CA")
+			}
+			rotation = &CARotation{OldCA: oldCA, NewCA: newCA}
+		}
+		log.Infof(ctx, "[certificates] Trusting the new CA certificate alongside the current CA certificate")
+		certs[pki.CACertName] = withTrustedCA(rotation.OldCA, rotation.NewCA)
+	case CARotationPhaseRotate:
+		log.Infof(ctx, "[certificates] Switching kubernetes certificates to the new CA certificate")
+		certs[pki.CACertName] = withTrustedCA(rotation.NewCA, rotation.OldCA)
+		if !resume {
+			if err := pki.GenerateRKEServicesCerts(ctx, certs, *rkeConfig, flags.ClusterFilePath, flags.ConfigDir, true); err != nil {
+				return err
+			}
+		}
+	case CARotationPhaseFinalize:
+		log.Infof(ctx, "[certificates] Removing the old CA certificate from the trusted CA certificates")
+		certs[pki.CACertName] = rotation.NewCA
+	}
+	rotation.Phase = phase
+	rotation.Completed = false
+	fullState.CARotation = rotation
+	return nil
+}
+
+// CompleteCARotationPhase records the completion of the current phase of the staged CA rotation, the rotation is removed from
+// the state once the old CA is no longer trusted
+func CompleteCARotationPhase(fullState *FullState) {
+	if fullState.CARotation == nil {
+		return
+	}
+	if fullState.CARotation.Phase == CARotationPhaseFinalize {
+		fullState.CARotation = nil
+		return
+	}
+	fullState.CARotation.Completed = true
+}
@@ -0,0 +1,113 @@
+package cluster
+
+import (
+	"context"
+	"crypto/x509"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/pki/cert"
+	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func getCARotationTestState(t *testing.T) (*FullState, *v3.RancherKubernetesEngineConfig) {
+	rkeConfig := &v3.RancherKubernetesEngineConfig{
+		Nodes: []v3.RKEConfigNode{
+			{
+				Address: "1.1.1.1",
+				Role:    []string{services.ControlRole, services.ETCDRole, services.WorkerRole},
+			},
+		},
+		Services: v3.RKEConfigServices{
+			KubeAPI: v3.KubeAPIService{ServiceClusterIPRange: "10.43.0.0/16"},
+			Kubelet: v3.KubeletService{ClusterDomain: "cluster.local"},
+		},
+	}
+	certs, err := pki.GenerateRKECerts(context.Background(), *rkeConfig, "", "")
+	assert.NoError(t, err)
+	return &FullState{DesiredState: State{RancherKubernetesEngineConfig: rkeConfig, CertificatesBundle: certs}}, rkeConfig
+}
+
+func verifyCertificate(crt *x509.Certificate, caPEM string) error {
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(caPEM))
+	_, err := crt.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	return err
+}
+
+func TestCARotationPhases(t *testing.T) {
+	ctx := context.Background()
+	fullState, rkeConfig := getCARotationTestState(t)
+	certs := fullState.DesiredState.CertificatesBundle
+	oldCA := certs[pki.CACertName].Certificate
+	oldAPICert := certs[pki.KubeAPICertName].Certificate
+	oldTokenKey := certs[pki.ServiceAccountTokenKeyName].KeyPEM
+
+	assert.Error(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseRotate))
+	assert.Error(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, "invalid"))
+
+	// trust: the old CA still signs the certificates, the new CA is trusted
+	assert.NoError(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseTrust))
+	newCA := fullState.CARotation.NewCA.Certificate
+	assert.False(t, newCA.Equal(oldCA))
+	assert.True(t, certs[pki.CACertName].Certificate.Equal(oldCA))
+	assert.True(t, certs[pki.KubeAPICertName].Certificate.Equal(oldAPICert))
+	caPEM := pki.GetCACertsPEM(certs)
+	assert.Equal(t, 2, strings.Count(caPEM, "-----BEGIN "+cert.CertificateBlockType))
+	assert.Contains(t, caPEM, string(cert.EncodeCertPEM(newCA)))
+
+	// the next phase requires the trust phase to complete, running it again reuses the new CA
+	assert.Error(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseRotate))
+	assert.NoError(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseTrust))
+	assert.True(t, fullState.CARotation.NewCA.Certificate.Equal(newCA))
+	CompleteCARotationPhase(fullState)
+	assert.Error(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseFinalize))
+
+	// rotate: the certificates are signed by the new CA, the old CA is still trusted
+	assert.NoError(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseRotate))
+	assert.True(t, certs[pki.CACertName].Certificate.Equal(newCA))
+	caPEM = pki.GetCACertsPEM(certs)
+	assert.Equal(t, 2, strings.Count(caPEM, "-----BEGIN "+cert.CertificateBlockType))
+	assert.NoError(t, verifyCertificate(oldAPICert, caPEM))
+	for _, name := range []string{pki.KubeAPICertName, pki.KubeAdminCertName, pki.KubeNodeCertName, "kube-etcd-1-1-1-1"} {
+		assert.NoError(t, certs[name].Certificate.CheckSignatureFrom(newCA), name)
+	}
+	// the pods keep their service account tokens
+	assert.Equal(t, oldTokenKey, certs[pki.ServiceAccountTokenKeyName].KeyPEM)
+	CompleteCARotationPhase(fullState)
+
+	// finalize: only the new CA is trusted
+	assert.NoError(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseFinalize))
+	caPEM = pki.GetCACertsPEM(certs)
+	assert.Equal(t, string(cert.EncodeCertPEM(newCA)), caPEM)
+	assert.Error(t, verifyCertificate(oldAPICert, caPEM))
+	CompleteCARotationPhase(fullState)
+	assert.Nil(t, fullState.CARotation)
+}
+
+func TestCARotationStateFile(t *testing.T) {
+	ctx := context.Background()
+	fullState, rkeConfig := getCARotationTestState(t)
+	assert.NoError(t, PrepareCARotationPhase(ctx, fullState, rkeConfig, ExternalFlags{}, CARotationPhaseTrust))
+
+	statePath := filepath.Join(t.TempDir(), "cluster.rkestate")
+	assert.NoError(t, fullState.WriteStateFile(ctx, statePath))
+	readState, err := ReadStateFile(ctx, statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, CARotationPhaseTrust, readState.CARotation.Phase)
+	assert.False(t, readState.CARotation.Completed)
+	assert.True(t, readState.CARotation.OldCA.Certificate.Equal(fullState.CARotation.OldCA.Certificate))
+	assert.True(t, readState.CARotation.NewCA.Certificate.Equal(fullState.CARotation.NewCA.Certificate))
+	assert.NotNil(t, readState.CARotation.NewCA.Key)
+	assert.Equal(t, pki.GetCACertsPEM(fullState.DesiredState.CertificatesBundle), pki.GetCACertsPEM(readState.DesiredState.CertificatesBundle))
+
+	// rke up keeps the rotation in progress
+	kubeCluster := &Cluster{RancherKubernetesEngineConfig: *rkeConfig}
+	newState, err := RebuildState(ctx, kubeCluster, readState, ExternalFlags{})
+	assert.NoError(t, err)
+	assert.Equal(t, readState.CARotation, newState.CARotation)
+}
@@ -0,0 +1,111 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+)
+
+const (
+	// DefaultCertExpiryWarningDays is the remaining validity under which certificates are reported as expiring
+	DefaultCertExpiryWarningDays = 30
+
+	CertificateSourceState = "state"
+	CertificateSourceNode  = "node"
+)
+
+// CertificateExpiry describes the validity of a cluster certificate. Host is only set for certificates issued to a single host.
+type CertificateExpiry struct {
+	Name          string    `json:"name"`
+	Host          string    `json:"host,omitempty"`
+	Source        string    `json:"source"`
+	CommonName    string    `json:"commonName"`
+	SANs          []string  `json:"sans,omitempty"`
+	NotAfter      time.Time `json:"notAfter"`
+	DaysRemaining int       `json:"daysRemaining"`
+}
+
+// GetCertificatesExpiry returns the validity of the certificates sorted by expiration date, certificateHosts maps the names of the
+// per-host certificates to their host
+func GetCertificatesExpiry(certs map[string]pki.CertificatePKI, certificateHosts map[string]string, source string, now time.Time) []CertificateExpiry {
+	var expiries []CertificateExpiry
+	for name, certPKI := range certs {
+		if certPKI.Certificate == nil {
+			continue
+		}
+		crt := certPKI.Certificate
+		sans := append([]string{}, crt.DNSNames...)
+		for _, ip := range crt.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		expiries = append(expiries, CertificateExpiry{
+			Name:          name,
+			Host:          certificateHosts[name],
+			Source:        source,
+			CommonName:    crt.Subject.CommonName,
+			SANs:          sans,
+			NotAfter:      crt.NotAfter,
+			DaysRemaining: int(math.Floor(crt.NotAfter.Sub(now).Hours() / 24)),
+		})
+	}
+	sort.Slice(expiries, func(i, j int) bool {
+		if !expiries[i].NotAfter.Equal(expiries[j].NotAfter) {
+			return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+		}
+		return expiries[i].Name < expiries[j].Name
+	})
+	return expiries
+}
+
+// GetExpiringCertificates returns the certificates valid for less than days
+func GetExpiringCertificates(expiries []CertificateExpiry, days int) []CertificateExpiry {
+	var expiring []CertificateExpiry
+	for _, expiry := range expiries {
+		if expiry.DaysRemaining < days {
+			expiring = append(expiring, expiry)
+		}
+	}
+	return expiring
+}
+
+// GetCertificateHosts maps the names of the certificates issued to a single host to the host address
+func (c *Cluster) GetCertificateHosts() map[string]string {
+	certificateHosts := map[string]string{}
+	for _, host := range c.EtcdHosts {
+		certificateHosts[pki.GetCrtNameForHost(host, pki.EtcdCertName)] = host.Address
+	}
+	for _, host := range hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts) {
+		certificateHosts[pki.GetCrtNameForHost(host, pki.KubeletCertName)] = host.Address
+	}
+	return certificateHosts
+}
+
+// WarnExpiringCertificates logs a warning for each cluster certificate valid for less than days, 0 disables the warnings
+func WarnExpiringCertificates(ctx context.Context, kubeCluster *Cluster, days int) []CertificateExpiry {
+	if days <= 0 {
+		return nil
+	}
+	expiries := GetCertificatesExpiry(kubeCluster.Certificates, kubeCluster.GetCertificateHosts(), CertificateSourceState, time.Now())
+	expiring := GetExpiringCertificates(expiries, days)
+	for _, expiry := range expiring {
+		target := expiry.Name
+		if expiry.Host != "" {
+			target = fmt.Sprintf("%s (%s)", expiry.Name, expiry.Host)
+		}
+		if expiry.DaysRemaining < 0 {
+			log.Warnf(ctx, "[certificates] Certificate [%s] expired on %s", target, expiry.NotAfter.Format(time.RFC3339))
+			continue
+		}
+		log.Warnf(ctx, "[certificates] Certificate [%s] expires in %d days on %s", target, expiry.DaysRemaining, expiry.NotAfter.Format(time.RFC3339))
+	}
+	if len(expiring) > 0 {
+		log.Warnf(ctx, "[certificates] %d certificates expire in less than %d days, rotate them with `rke cert rotate` or `rke up --rotate-expiring-certs`", len(expiring), days)
+	}
+	return expiring
+}
@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/pki"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCertificatesExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	certs := map[string]pki.CertificatePKI{
+		pki.CACertName: {
+			Certificate: &x509.Certificate{Subject: pkix.Name{CommonName: pki.CACertName}, NotAfter: now.AddDate(10, 0, 0)},
+		},
+		pki.KubeAPICertName: {
+			Certificate: &x509.Certificate{
+				Subject:     pkix.Name{CommonName: pki.KubeAPICertName},
+				DNSNames:    []string{"kubernetes"},
+				IPAddresses: []net.IP{net.ParseIP("10.43.0.1")},
+				NotAfter:    now.AddDate(0, 0, 20),
+			},
+		},
+		"kube-etcd-1-1-1-1": {
+			Certificate: &x509.Certificate{Subject: pkix.Name{CommonName: "kube-etcd-1-1-1-1"}, NotAfter: now.Add(-time.Hour)},
+		},
+		pki.ServiceAccountTokenKeyName: {},
+	}
+	expiries := GetCertificatesExpiry(certs, map[string]string{"kube-etcd-1-1-1-1": "1.1.1.1"}, CertificateSourceState, now)
+	assert.Len(t, expiries, 3)
+	// sorted by expiration date
+	assert.Equal(t, "kube-etcd-1-1-1-1", expiries[0].Name)
+	assert.Equal(t, "1.1.1.1", expiries[0].Host)
+	assert.Equal(t, -1, expiries[0].DaysRemaining)
+	assert.Equal(t, pki.KubeAPICertName, expiries[1].Name)
+	assert.Equal(t, []string{"kubernetes", "10.43.0.1"}, expiries[1].SANs)
+	assert.Equal(t, 20, expiries[1].DaysRemaining)
+	assert.Equal(t, pki.CACertName, expiries[2].Name)
+
+	expiring := GetExpiringCertificates(expiries, 30)
+	assert.Len(t, expiring, 2)
+	assert.Empty(t, GetExpiringCertificates(expiries, -1))
+}
+
+func TestGetCertificateHosts(t *testing.T) {
+	etcdHost := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}}
+	workerHost := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "2.2.2.2", InternalAddress: "10.0.0.2"}}
+	c := &Cluster{EtcdHosts: []*hosts.Host{etcdHost}, WorkerHosts: []*hosts.Host{workerHost}}
+	assert.Equal(t, map[string]string{
+		"kube-etcd-1-1-1-1":     "1.1.1.1",
+		"kube-kubelet-1-1-1-1":  "1.1.1.1",
+		"kube-kubelet-10-0-0-2": "2.2.2.2",
+	}, c.GetCertificateHosts())
+}
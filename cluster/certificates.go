@@ -2,7 +2,7 @@ package cluster
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"fmt"
 	"strings"
 
@@ -79,12 +79,16 @@ func GetClusterCertsFromKubernetes(ctx context.Context, kubeCluster *Cluster) (m
 		if len(secretCert) == 0 || secretKey == nil {
 			return nil, fmt.Errorf("certificate or key of %s is not found", certName)
 		}
+		secretSigner, ok := secretKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("Unsupported private key type %T of %s", secretKey, certName)
+		}
 		certificatePEM := string(cert.EncodeCertPEM(secretCert[0]))
-		keyPEM := string(cert.EncodePrivateKeyPEM(secretKey.(*rsa.PrivateKey)))
+		keyPEM := string(cert.EncodePrivateKeyPEM(secretSigner))
 
 		certMap[certName] = pki.CertificatePKI{
 			Certificate:    secretCert[0],
-			Key:            secretKey.(*rsa.PrivateKey),
+			Key:            secretSigner,
 			CertificatePEM: certificatePEM,
 			KeyPEM:         keyPEM,
 			Config:         secretConfig,
@@ -97,10 +101,13 @@ func GetClusterCertsFromKubernetes(ctx context.Context, kubeCluster *Cluster) (m
 		}
 	}
 	// Handle service account token key issue
-	kubeAPICert := certMap[pki.KubeAPICertName]
 	if certMap[pki.ServiceAccountTokenKeyName].Key == nil {
 		log.Infof(ctx, "[certificates] Creating service account token key")
-		certMap[pki.ServiceAccountTokenKeyName] = pki.ToCertObject(pki.ServiceAccountTokenKeyName, pki.ServiceAccountTokenKeyName, "", kubeAPICert.Certificate, kubeAPICert.Key, nil)
+		tokenCert, err := getServiceAccountTokenCert(certMap[pki.KubeAPICertName])
+		if err != nil {
+			return nil, err
+		}
+		certMap[pki.ServiceAccountTokenKeyName] = tokenCert
 	}
 	log.Infof(ctx, "[certificates] Successfully fetched Cluster certificates from Kubernetes")
 	return certMap, nil
@@ -135,7 +142,7 @@ func RotateRKECertificates(ctx context.Context, c *Cluster, flags ExternalFlags,
 	rotateFlags := c.RancherKubernetesEngineConfig.RotateCertificates
 	if rotateFlags.CACertificates {
 		// rotate CA cert and RequestHeader CA cert
-		if err := pki.GenerateRKECACerts(ctx, c.Certificates, flags.ClusterFilePath, flags.ConfigDir); err != nil {
+		if err := pki.GenerateRKECACerts(ctx, c.Certificates, c.RancherKubernetesEngineConfig, flags.ClusterFilePath, flags.ConfigDir); err != nil {
 			return err
 		}
 		rotateFlags.Services = nil
@@ -158,7 +165,7 @@ func RotateRKECertificates(ctx context.Context, c *Cluster, flags ExternalFlags,
 		}
 		// check for legacy clusters prior to requestheaderca
 		if c.Certificates[pki.RequestHeaderCACertName].Certificate == nil {
-			if err := pki.GenerateRKERequestHeaderCACert(ctx, c.Certificates, flags.ClusterFilePath, flags.ConfigDir); err != nil {
+			if err := pki.GenerateRKERequestHeaderCACert(ctx, c.Certificates, c.RancherKubernetesEngineConfig, flags.ClusterFilePath, flags.ConfigDir); err != nil {
 				return err
 			}
 		}
@@ -170,12 +177,16 @@ func RotateRKECertificates(ctx context.Context, c *Cluster, flags ExternalFlags,
 			if err != nil {
 				return err
 			}
+			privateSigner, ok := privateKey.(crypto.Signer)
+			if !ok {
+				return fmt.Errorf("Unsupported service account token key type %T", privateKey)
+			}
 			c.Certificates[pki.ServiceAccountTokenKeyName] = pki.ToCertObject(
 				pki.ServiceAccountTokenKeyName,
 				pki.ServiceAccountTokenKeyName,
 				"",
 				c.Certificates[pki.ServiceAccountTokenKeyName].Certificate,
-				privateKey.(*rsa.PrivateKey), nil)
+				privateSigner, nil)
 		}
 	}
 	clusterState.DesiredState.CertificatesBundle = c.Certificates
@@ -191,10 +202,13 @@ func GetClusterCertsFromNodes(ctx context.Context, kubeCluster *Cluster) (map[st
 		certificates, err = pki.FetchCertificatesFromHost(ctx, kubeCluster.EtcdHosts, host, kubeCluster.SystemImages.Alpine, kubeCluster.LocalKubeConfigPath, kubeCluster.PrivateRegistriesMap, kubeCluster.Version)
 		if certificates != nil {
 			// Handle service account token key issue
-			kubeAPICert := certificates[pki.KubeAPICertName]
 			if certificates[pki.ServiceAccountTokenKeyName].Key == nil {
 				log.Infof(ctx, "[certificates] Creating service account token key")
-				certificates[pki.ServiceAccountTokenKeyName] = pki.ToCertObject(pki.ServiceAccountTokenKeyName, pki.ServiceAccountTokenKeyName, "", kubeAPICert.Certificate, kubeAPICert.Key, nil)
+				tokenCert, err := getServiceAccountTokenCert(certificates[pki.KubeAPICertName])
+				if err != nil {
+					return nil, err
+				}
+				certificates[pki.ServiceAccountTokenKeyName] = tokenCert
 			}
 			return certificates, nil
 		}
@@ -203,6 +217,20 @@ func GetClusterCertsFromNodes(ctx context.Context, kubeCluster *Cluster) (map[st
 	return nil, err
 }
 
+// getServiceAccountTokenCert returns the service account token key of clusters without one, based on the kube-apiserver key that
+// signed the existing tokens
+func getServiceAccountTokenCert(kubeAPICert pki.CertificatePKI) (pki.CertificatePKI, error) {
+	tokenKey, err := pki.GetServiceAccountTokenKey(kubeAPICert.Key)
+	if err != nil {
+		return pki.CertificatePKI{}, err
+	}
+	tokenCrt := kubeAPICert.Certificate
+	if tokenKey != kubeAPICert.Key {
+		tokenCrt = nil
+	}
+	return pki.ToCertObject(pki.ServiceAccountTokenKeyName, pki.ServiceAccountTokenKeyName, "", tokenCrt, tokenKey, nil), nil
+}
+
 func compareCerts(ctx context.Context, kubeCluster, currentCluster *Cluster) {
 	// check if relevant certs were changed and if so set force deploy to true
 	// to deploy certs with new SANs
@@ -0,0 +1,203 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/services"
+	"github.com/sirupsen/logrus"
+)
+
+const checkpointFileExt = ".rkecheckpoint"
+
+// Phases of rke up that are recorded in the checkpoint journal and skipped when resuming
+const (
+	CheckpointPhaseCheckPorts       = "check-ports"
+	CheckpointPhaseSetupHosts       = "setup-hosts"
+	CheckpointPhasePullImages       = "pull-images"
+	CheckpointPhaseControlPlane     = "control-plane"
+	CheckpointPhaseWorkerPlane      = "worker-plane"
+	CheckpointPhaseNetworkMigration = "network-migration"
+)
+
+// CheckpointJournal records the phases and per-host outcomes of rke up for a desired state, so a failed run can be resumed
+// from the failure point. The journal is discarded as soon as the desired state changes.
+type CheckpointJournal struct {
+	DesiredStateChecksum string                      `json:"desiredStateChecksum"`
+	Phases               map[string]*PhaseCheckpoint `json:"phases,omitempty"`
+
+	path string
+	lock sync.Mutex
+}
+
+type PhaseCheckpoint struct {
+	CompletedAt *time.Time                `json:"completedAt,omitempty"`
+	Hosts       map[string]HostCheckpoint `json:"hosts,omitempty"`
+}
+
+type HostCheckpoint struct {
+	Completed bool   `json:"completed"`
+	Error     string `json:"error,omitempty"`
+}
+
+func GetCheckpointFilePath(configPath, configDir string) string {
+	statePath := GetStateFilePath(configPath, configDir)
+	return strings.TrimSuffix(statePath, stateFileExt) + checkpointFileExt
+}
+
+// GetDesiredStateChecksum returns the checksum of the desired state the checkpoints are valid for. Parallelism doesn't change
+// the deployed cluster, so a failed run can be resumed with other limits.
+func GetDesiredStateChecksum(fullState *FullState) (string, error) {
+	state := fullState.DesiredState
+	if state.RancherKubernetesEngineConfig != nil {
+		state.RancherKubernetesEngineConfig = state.RancherKubernetesEngineConfig.DeepCopy()
+		state.RancherKubernetesEngineConfig.Parallelism = nil
+	}
+	desiredState, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("[checkpoint] Failed to marshal desired state: %v", err)
+	}
+	sum := sha256.Sum256(desiredState)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LoadCheckpointJournal reads the journal at checkpointPath when resuming. A new journal is returned when not resuming, when there is
+// no journal yet or when it was written for another desired state.
+func LoadCheckpointJournal(ctx context.Context, checkpointPath, desiredStateChecksum string, resume bool) *CheckpointJournal {
+	journal := &CheckpointJournal{
+		DesiredStateChecksum: desiredStateChecksum,
+		Phases:               map[string]*PhaseCheckpoint{},
+		path:                 checkpointPath,
+	}
+	if !resume {
+		return journal
+	}
+	data, err := os.ReadFile(checkpointPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("[checkpoint] Failed to read checkpoint file [%s], starting from the beginning: %v", checkpointPath, err)
+		}
+		log.Infof(ctx, "[checkpoint] No checkpoint found to resume from, starting from the beginning")
+		return journal
+	}
+	saved := &CheckpointJournal{}
+	if err := json.Unmarshal(data, saved); err != nil {
+		logrus.Warnf("[checkpoint] Failed to parse checkpoint file [%s], starting from the beginning: %v", checkpointPath, err)
+		return journal
+	}
+	if saved.DesiredStateChecksum != desiredStateChecksum {
+		log.Infof(ctx, "[checkpoint] Cluster configuration changed since the checkpoint was written, starting from the beginning")
+		return journal
+	}
+	if saved.Phases != nil {
+		journal.Phases = saved.Phases
+	}
+	log.Infof(ctx, "[checkpoint] Resuming from checkpoint [%s]", checkpointPath)
+	return journal
+}
+
+// IsPhaseCompleted returns true if the phase completed for the desired state of the journal, a nil journal has no completed phase
+func (j *CheckpointJournal) IsPhaseCompleted(phase string) bool {
+	if j == nil {
+		return false
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	p, ok := j.Phases[phase]
+	return ok && p.CompletedAt != nil
+}
+
+// IsHostCompleted returns true if the phase completed on the host
+func (j *CheckpointJournal) IsHostCompleted(phase, address string) bool {
+	if j == nil {
+		return false
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	p, ok := j.Phases[phase]
+	return ok && p.Hosts[address].Completed
+}
+
+// CompletePhase marks the phase completed and saves the journal
+func (j *CheckpointJournal) CompletePhase(phase string) error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	now := time.Now().UTC()
+	j.getPhase(phase).CompletedAt = &now
+	return j.save()
+}
+
+// RecordHost records the outcome of the phase on the host and saves the journal
+func (j *CheckpointJournal) RecordHost(phase, address string, hostErr error) error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	hostCheckpoint := HostCheckpoint{Completed: hostErr == nil}
+	if hostErr != nil {
+		hostCheckpoint.Error = hostErr.Error()
+	}
+	j.getPhase(phase).Hosts[address] = hostCheckpoint
+	return j.save()
+}
+
+// HostRecorder returns the recorder passed to the services to record the outcome of the phase on each host
+func (j *CheckpointJournal) HostRecorder(phase string) services.HostRecorder {
+	return &phaseHostRecorder{journal: j, phase: phase}
+}
+
+// Remove deletes the journal once rke up succeeded, there is nothing left to resume
+func (j *CheckpointJournal) Remove() {
+	if j == nil {
+		return
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("[checkpoint] Failed to remove checkpoint file [%s]: %v", j.path, err)
+	}
+}
+
+func (j *CheckpointJournal) getPhase(phase string) *PhaseCheckpoint {
+	p, ok := j.Phases[phase]
+	if !ok {
+		p = &PhaseCheckpoint{}
+		j.Phases[phase] = p
+	}
+	if p.Hosts == nil {
+		p.Hosts = map[string]HostCheckpoint{}
+	}
+	return p
+}
+
+func (j *CheckpointJournal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("[checkpoint] Failed to marshal checkpoint journal: %v", err)
+	}
+	if err := os.WriteFile(j.path, data, 0600); err != nil {
+		return fmt.Errorf("[checkpoint] Failed to write checkpoint file: %v", err)
+	}
+	return nil
+}
+
+type phaseHostRecorder struct {
+	journal *CheckpointJournal
+	phase   string
+}
+
+func (r *phaseHostRecorder) RecordHost(address string, hostErr error) {
+	if err := r.journal.RecordHost(r.phase, address, hostErr); err != nil {
+		logrus.Warnf("%v", err)
+	}
+}
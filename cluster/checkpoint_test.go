@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointJournal(t *testing.T) {
+	ctx := context.Background()
+	checkpointPath := filepath.Join(t.TempDir(), "cluster"+checkpointFileExt)
+
+	journal := LoadCheckpointJournal(ctx, checkpointPath, "sum", true)
+	assert.False(t, journal.IsPhaseCompleted(CheckpointPhaseSetupHosts))
+	assert.NoError(t, journal.CompletePhase(CheckpointPhaseSetupHosts))
+	journal.HostRecorder(CheckpointPhaseWorkerPlane).RecordHost("1.1.1.1", nil)
+	journal.HostRecorder(CheckpointPhaseWorkerPlane).RecordHost("2.2.2.2", fmt.Errorf("node not ready"))
+
+	// resuming with the same desired state keeps the completed phases and hosts
+	resumed := LoadCheckpointJournal(ctx, checkpointPath, "sum", true)
+	assert.True(t, resumed.IsPhaseCompleted(CheckpointPhaseSetupHosts))
+	assert.False(t, resumed.IsPhaseCompleted(CheckpointPhaseWorkerPlane))
+	assert.True(t, resumed.IsHostCompleted(CheckpointPhaseWorkerPlane, "1.1.1.1"))
+	assert.False(t, resumed.IsHostCompleted(CheckpointPhaseWorkerPlane, "2.2.2.2"))
+	assert.Equal(t, "node not ready", resumed.Phases[CheckpointPhaseWorkerPlane].Hosts["2.2.2.2"].Error)
+
+	// the checkpoints are discarded when not resuming or when the desired state changed
+	assert.False(t, LoadCheckpointJournal(ctx, checkpointPath, "sum", false).IsPhaseCompleted(CheckpointPhaseSetupHosts))
+	changed := LoadCheckpointJournal(ctx, checkpointPath, "other-sum", true)
+	assert.False(t, changed.IsPhaseCompleted(CheckpointPhaseSetupHosts))
+	assert.False(t, changed.IsHostCompleted(CheckpointPhaseWorkerPlane, "1.1.1.1"))
+
+	resumed.Remove()
+	_, err := os.Stat(checkpointPath)
+	assert.True(t, os.IsNotExist(err))
+
+	var nilJournal *CheckpointJournal
+	assert.False(t, nilJournal.IsPhaseCompleted(CheckpointPhaseSetupHosts))
+	assert.NoError(t, nilJournal.CompletePhase(CheckpointPhaseSetupHosts))
+}
+
+func TestGetCheckpointFilePath(t *testing.T) {
+	assert.Equal(t, "/etc/rke/cluster.rkecheckpoint", GetCheckpointFilePath("/etc/rke/cluster.yml", ""))
+}
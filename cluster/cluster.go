@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"reflect"
 	"strings"
@@ -52,11 +53,14 @@ type Cluster struct {
 	ClusterDomain                    string
 	ClusterCIDR                      string
 	ClusterDNSServer                 string
+	CommandRunnerFactory             hosts.CommandRunnerFactory
 	DinD                             bool
 	DockerDialerFactory              hosts.DialerFactory
 	EtcdHosts                        []*hosts.Host
 	EtcdReadyHosts                   []*hosts.Host
 	ForceDeployCerts                 bool
+	HostKeyVerifier                  *hosts.HostKeyVerifier
+	AgentTunnelServer                *hosts.AgentTunnelServer
 	InactiveHosts                    []*hosts.Host
 	K8sWrapTransport                 transport.WrapperFunc
 	KubeClient                       *kubernetes.Clientset
@@ -73,6 +77,9 @@ type Cluster struct {
 	NewHosts                         map[string]bool
 	MaxUnavailableForWorkerNodes     int
 	MaxUnavailableForControlNodes    int
+	// Checkpoints records the progress of rke up, hosts it has already deployed the worker plane on are skipped
+	Checkpoints      *CheckpointJournal
+	registryThrottle *registryThrottle
 }
 
 type encryptionConfig struct {
@@ -139,6 +146,11 @@ func (c *Cluster) DeployControlPlane(ctx context.Context, svcOptionData map[stri
 		if err := services.RunEtcdPlane(ctx, c.EtcdHosts, etcdNodePlanMap, c.LocalConnDialerFactory, c.PrivateRegistriesMap, c.UpdateWorkersOnly, c.SystemImages.Alpine, c.Services.Etcd, c.Certificates, c.Version); err != nil {
 			return "", fmt.Errorf("[etcd] Failed to bring up Etcd Plane: %v", err)
 		}
+		if !c.UpdateWorkersOnly && c.Services.Etcd.Snapshot != nil && *c.Services.Etcd.Snapshot {
+			if err := c.SyncEtcdSnapshotsToBackend(ctx); err != nil {
+				log.Warnf(ctx, "%v", err)
+			}
+		}
 	}
 
 	// Deploy Control plane
@@ -254,7 +266,17 @@ func (c *Cluster) DeployWorkerPlane(ctx context.Context, svcOptionData map[strin
 	// Deploy Worker plane
 	workerNodePlanMap := make(map[string]v3.RKEConfigNodePlan)
 	// Build cp node plan map
-	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	var allHosts []*hosts.Host
+	for _, host := range hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts) {
+		if c.Checkpoints.IsHostCompleted(CheckpointPhaseWorkerPlane, host.Address) {
+			log.Infof(ctx, "[%s] Worker Plane already deployed on host [%s], skipping", services.WorkerRole, host.Address)
+			continue
+		}
+		allHosts = append(allHosts, host)
+	}
+	if c.Checkpoints != nil {
+		ctx = services.WithHostRecorder(ctx, c.Checkpoints.HostRecorder(CheckpointPhaseWorkerPlane))
+	}
 	for _, host := range allHosts {
 		svcOptions, err := c.GetKubernetesServicesOptions(host.DockerInfo.OSType, svcOptionData)
 		if err != nil {
@@ -758,6 +780,7 @@ func InitClusterObject(ctx context.Context, rkeConfig *v3.RancherKubernetesEngin
 		EncryptionConfig: encryptionConfig{
 			EncryptionProviderFile: encryptConfig,
 		},
+		registryThrottle: newRegistryThrottle(rkeConfig.Parallelism),
 	}
 	if metadata.K8sVersionToRKESystemImages == nil {
 		if err := metadata.InitMetadata(ctx); err != nil {
@@ -798,6 +821,10 @@ func InitClusterObject(ctx context.Context, rkeConfig *v3.RancherKubernetesEngin
 	if err := c.setCloudProvider(); err != nil {
 		return nil, fmt.Errorf("Failed to register cloud provider: %v", err)
 	}
+	if err := c.setHostKeyVerifier(); err != nil {
+		return nil, fmt.Errorf("Failed to set SSH host key verification: %v", err)
+	}
+	c.setAgentTunnelServer()
 	// set hosts groups
 	if err := c.InvertIndexHosts(); err != nil {
 		return nil, fmt.Errorf("Failed to classify hosts from config file: %v", err)
@@ -824,11 +851,22 @@ func (c *Cluster) setNetworkOptions() error {
 func (c *Cluster) SetupDialers(ctx context.Context, dailersOptions hosts.DialersOptions) error {
 	c.DockerDialerFactory = dailersOptions.DockerDialerFactory
 	c.LocalConnDialerFactory = dailersOptions.LocalConnDialerFactory
+	c.CommandRunnerFactory = dailersOptions.CommandRunnerFactory
 	c.K8sWrapTransport = dailersOptions.K8sWrapTransport
-	// Create k8s wrap transport for bastion host
-	if len(c.BastionHost.Address) > 0 {
+	// Create k8s wrap transport for bastion hosts
+	nodeBastionHosts := map[string]v3.BastionHost{}
+	nodeProxies := map[string]string{}
+	for _, node := range c.Nodes {
+		if node.BastionHost != nil {
+			nodeBastionHosts[node.Address] = *node.BastionHost
+		}
+		if len(node.Proxy) > 0 {
+			nodeProxies[node.Address] = node.Proxy
+		}
+	}
+	if len(c.BastionHost.Address) > 0 || len(nodeBastionHosts) > 0 || len(nodeProxies) > 0 {
 		var err error
-		c.K8sWrapTransport, err = hosts.BastionHostWrapTransport(c.BastionHost)
+		c.K8sWrapTransport, err = hosts.BastionHostWrapTransport(c.BastionHost, nodeBastionHosts, nodeProxies, c.HostKeyVerifier)
 		if err != nil {
 			return err
 		}
@@ -839,6 +877,20 @@ func (c *Cluster) SetupDialers(ctx context.Context, dailersOptions hosts.Dialers
 			}
 		}
 	}
+	// Create k8s wrap transport for hosts reached through their node agent
+	var agentHosts []*hosts.Host
+	for _, host := range hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts) {
+		if host.ConnectionType == hosts.ConnectionTypeAgent {
+			agentHosts = append(agentHosts, host)
+		}
+	}
+	if len(agentHosts) > 0 {
+		var err error
+		c.K8sWrapTransport, err = hosts.AgentWrapTransport(agentHosts, c.K8sWrapTransport)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -854,7 +906,7 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 	log.Infof(ctx, "[reconcile] Rebuilding and updating local kube config")
 	var workingConfig, newConfig string
 	currentKubeConfig := kubeCluster.Certificates[pki.KubeAdminCertName]
-	caCrt := kubeCluster.Certificates[pki.CACertName].Certificate
+	caData := pki.GetCACertsPEM(kubeCluster.Certificates)
 	for _, cpHost := range kubeCluster.ControlPlaneHosts {
 		if (currentKubeConfig == pki.CertificatePKI{}) {
 			log.Debugf(ctx, "[reconcile] Rebuilding and updating local kube config, creating new address")
@@ -862,8 +914,7 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 			newConfig = getLocalAdminConfigWithNewAddress(kubeCluster.LocalKubeConfigPath, cpHost.Address, kubeCluster.ClusterName)
 		} else {
 			log.Debugf(ctx, "[reconcile] Rebuilding and updating local kube config, creating new kubeconfig")
-			kubeURL := fmt.Sprintf("https://%s:6443", cpHost.Address)
-			caData := string(cert.EncodeCertPEM(caCrt))
+			kubeURL := "https://" + net.JoinHostPort(cpHost.Address, KubeAPIPort)
 			crtData := string(cert.EncodeCertPEM(currentKubeConfig.Certificate))
 			keyData := string(cert.EncodePrivateKeyPEM(currentKubeConfig.Key))
 			newConfig = pki.GetKubeConfigX509WithData(kubeURL, kubeCluster.ClusterName, pki.KubeAdminCertName, caData, crtData, keyData)
@@ -892,9 +943,12 @@ func getLocalConfigAddress(localConfigPath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	splittedAdress := strings.Split(config.Host, ":")
-	address := splittedAdress[1]
-	return address[2:], nil
+	// the host of the URL is unbracketed, IPv6 addresses contain colons
+	hostURL, err := url.Parse(config.Host)
+	if err != nil {
+		return "", err
+	}
+	return hostURL.Hostname(), nil
 }
 
 func getLocalAdminConfigWithNewAddress(localConfigPath, cpAddress string, clusterName string) string {
@@ -902,9 +956,9 @@ func getLocalAdminConfigWithNewAddress(localConfigPath, cpAddress string, cluste
 	if config == nil || config.BearerToken != "" {
 		return ""
 	}
-	config.Host = fmt.Sprintf("https://%s:6443", cpAddress)
+	config.Host = "https://" + net.JoinHostPort(cpAddress, KubeAPIPort)
 	return pki.GetKubeConfigX509WithData(
-		"https://"+cpAddress+":6443",
+		"https://"+net.JoinHostPort(cpAddress, KubeAPIPort),
 		clusterName,
 		pki.KubeAdminCertName,
 		string(config.CAData),
@@ -1044,27 +1098,21 @@ func setNodeAnnotationsLabelsTaints(k8sClient *kubernetes.Clientset, host *hosts
 
 func (c *Cluster) PrePullK8sImages(ctx context.Context) error {
 	log.Infof(ctx, "Pre-pulling kubernetes images")
-	var errgrp errgroup.Group
 	hostList := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
-	hostsQueue := util.GetObjectQueue(hostList)
 	imageList := []string{c.SystemImages.Kubernetes, c.Services.Kubelet.InfraContainerImage}
-	for w := 0; w < WorkerThreads; w++ {
-		errgrp.Go(func() error {
-			var errList []error
-			for host := range hostsQueue {
-				runHost := host.(*hosts.Host)
-				for _, image := range imageList {
-					err := docker.UseLocalOrPull(ctx, runHost.DClient, runHost.Address, image, "pre-deploy", c.PrivateRegistriesMap)
-					if err != nil {
-						errList = append(errList, err)
-					}
-				}
+	err := runOnHosts(hostList, c.hostWorkers(ParallelismPullImages), func(runHost *hosts.Host) error {
+		var errList []error
+		for _, image := range imageList {
+			release := c.registryThrottle.acquire(image)
+			err := docker.UseLocalOrPull(ctx, runHost.DClient, runHost.Address, image, "pre-deploy", c.PrivateRegistriesMap)
+			release()
+			if err != nil {
+				errList = append(errList, err)
 			}
-			return util.ErrList(errList)
-		})
-	}
-
-	if err := errgrp.Wait(); err != nil {
+		}
+		return util.ErrList(errList)
+	})
+	if err != nil {
 		return err
 	}
 	log.Infof(ctx, "Kubernetes images pulled successfully")
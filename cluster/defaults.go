@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/blang/semver"
@@ -74,6 +75,12 @@ const (
 
 	DefaultCanalFlexVolPluginDirectory = "/usr/libexec/kubernetes/kubelet-plugins/volume/exec/nodeagent~uds"
 
+	DefaultCiliumTunnelProtocol = "vxlan"
+	DefaultCiliumIPAMMode       = "kubernetes"
+	// the Cilium images are used until the metadata ships them for the cluster version
+	DefaultCiliumImage         = "rancher/mirrored-cilium-cilium:v1.15.5"
+	DefaultCiliumOperatorImage = "rancher/mirrored-cilium-operator-generic:v1.15.5"
+
 	DefaultAciApicRefreshTime                        = "1200"
 	DefaultAciOVSMemoryLimit                         = "1Gi"
 	DefaultAciOVSMemoryRequest                       = "128Mi"
@@ -193,16 +200,24 @@ var (
 )
 
 type ExternalFlags struct {
-	CertificateDir   string
-	ClusterFilePath  string
-	DinD             bool
-	ConfigDir        string
-	CustomCerts      bool
-	DisablePortCheck bool
-	GenerateCSR      bool
-	Local            bool
-	UpdateOnly       bool
-	UseLocalState    bool
+	// CertExpiryWarningDays is the remaining validity under which rke up warns about certificates, 0 disables the warnings
+	CertExpiryWarningDays int
+	CertificateDir        string
+	ClusterFilePath       string
+	DinD                  bool
+	ConfigDir             string
+	CustomCerts           bool
+	DisablePortCheck      bool
+	// ForceRestore restores etcd snapshots that failed verification
+	ForceRestore bool
+	GenerateCSR  bool
+	Local        bool
+	// Resume skips the phases and hosts recorded as completed in the checkpoint journal
+	Resume bool
+	// SkipPreflight skips the pre-flight node readiness checks run by rke up
+	SkipPreflight bool
+	UpdateOnly    bool
+	UseLocalState bool
 }
 
 func setDefaultIfEmptyMapValue(configMap map[string]string, key string, value string) {
@@ -217,6 +232,32 @@ func setDefaultIfEmpty(varName *string, defaultValue string) {
 	}
 }
 
+func (c *Cluster) setBastionHostDefaults(bastionHost *v3.BastionHost) {
+	if len(bastionHost.Port) == 0 {
+		bastionHost.Port = DefaultSSHPort
+	}
+	if len(bastionHost.SSHKeyPath) == 0 {
+		bastionHost.SSHKeyPath = c.SSHKeyPath
+	}
+	bastionHost.SSHAgentAuth = c.SSHAgentAuth
+	if len(bastionHost.SSHKeyPassphrase) == 0 && bastionHost.SSHKeyPath == c.SSHKeyPath {
+		bastionHost.SSHKeyPassphrase = c.SSHKeyPassphrase
+	}
+	for i := range bastionHost.Hops {
+		hop := &bastionHost.Hops[i]
+		if len(hop.Port) == 0 {
+			hop.Port = DefaultSSHPort
+		}
+		if len(hop.SSHKeyPath) == 0 {
+			hop.SSHKeyPath = c.SSHKeyPath
+		}
+		hop.SSHAgentAuth = c.SSHAgentAuth
+		if len(hop.SSHKeyPassphrase) == 0 && hop.SSHKeyPath == c.SSHKeyPath {
+			hop.SSHKeyPassphrase = c.SSHKeyPassphrase
+		}
+	}
+}
+
 func (c *Cluster) setClusterDefaults(ctx context.Context, flags ExternalFlags) error {
 	if len(c.SSHKeyPath) == 0 {
 		c.SSHKeyPath = DefaultClusterSSHKeyPath
@@ -227,16 +268,12 @@ func (c *Cluster) setClusterDefaults(ctx context.Context, flags ExternalFlags) e
 	}
 	// Set bastion/jump host defaults
 	if len(c.BastionHost.Address) > 0 {
-		if len(c.BastionHost.Port) == 0 {
-			c.BastionHost.Port = DefaultSSHPort
-		}
-		if len(c.BastionHost.SSHKeyPath) == 0 {
-			c.BastionHost.SSHKeyPath = c.SSHKeyPath
-		}
-		c.BastionHost.SSHAgentAuth = c.SSHAgentAuth
-
+		c.setBastionHostDefaults(&c.BastionHost)
 	}
 	for i, host := range c.Nodes {
+		if host.BastionHost != nil && len(host.BastionHost.Address) > 0 {
+			c.setBastionHostDefaults(c.Nodes[i].BastionHost)
+		}
 		if len(host.InternalAddress) == 0 {
 			c.Nodes[i].InternalAddress = c.Nodes[i].Address
 		}
@@ -247,6 +284,9 @@ func (c *Cluster) setClusterDefaults(ctx context.Context, flags ExternalFlags) e
 		if len(host.SSHKeyPath) == 0 {
 			c.Nodes[i].SSHKeyPath = c.SSHKeyPath
 		}
+		if len(host.SSHKeyPassphrase) == 0 && c.Nodes[i].SSHKeyPath == c.SSHKeyPath {
+			c.Nodes[i].SSHKeyPassphrase = c.SSHKeyPassphrase
+		}
 		if len(host.Port) == 0 {
 			c.Nodes[i].Port = DefaultSSHPort
 		}
@@ -372,6 +412,11 @@ func (c *Cluster) setClusterServicesDefaults() {
 		c.Services.Etcd.Snapshot = &defaultSnapshot
 	}
 
+	// the controller manager and the cluster DNS service follow a custom service cluster IP range, which may be IPv6 or dual-stack
+	if c.Services.KubeAPI.ServiceClusterIPRange != "" {
+		setDefaultIfEmpty(&c.Services.KubeController.ServiceClusterIPRange, c.Services.KubeAPI.ServiceClusterIPRange)
+		setDefaultIfEmpty(&c.Services.Kubelet.ClusterDNSServer, getClusterDNSServerFromRange(c.Services.KubeAPI.ServiceClusterIPRange))
+	}
 	serviceConfigDefaultsMap := map[*string]string{
 		&c.Services.KubeAPI.ServiceClusterIPRange:        DefaultServiceClusterIPRange,
 		&c.Services.KubeAPI.ServiceNodePortRange:         DefaultNodePortRange,
@@ -673,6 +718,8 @@ func (c *Cluster) setClusterImageDefaults() error {
 			break
 		}
 	}
+	setDefaultIfEmpty(&imageDefaults.Cilium, DefaultCiliumImage)
+	setDefaultIfEmpty(&imageDefaults.CiliumOperator, DefaultCiliumOperatorImage)
 	systemImagesDefaultsMap := map[*string]string{
 		&c.SystemImages.Alpine:                    d(imageDefaults.Alpine, privRegURL),
 		&c.SystemImages.NginxProxy:                d(imageDefaults.NginxProxy, privRegURL),
@@ -701,6 +748,8 @@ func (c *Cluster) setClusterImageDefaults() error {
 		&c.SystemImages.CanalFlexVol:              d(imageDefaults.CanalFlexVol, privRegURL),
 		&c.SystemImages.WeaveNode:                 d(imageDefaults.WeaveNode, privRegURL),
 		&c.SystemImages.WeaveCNI:                  d(imageDefaults.WeaveCNI, privRegURL),
+		&c.SystemImages.Cilium:                    d(imageDefaults.Cilium, privRegURL),
+		&c.SystemImages.CiliumOperator:            d(imageDefaults.CiliumOperator, privRegURL),
 		&c.SystemImages.Ingress:                   d(imageDefaults.Ingress, privRegURL),
 		&c.SystemImages.IngressBackend:            d(imageDefaults.IngressBackend, privRegURL),
 		&c.SystemImages.IngressWebhook:            d(imageDefaults.IngressWebhook, privRegURL),
@@ -786,6 +835,13 @@ func (c *Cluster) setClusterNetworkDefaults() {
 			CanalFlannelBackendVxLanNetworkIdentify: DefaultFlannelBackendVxLanVNI,
 			CanalFlexVolPluginDirectory:             DefaultCanalFlexVolPluginDirectory,
 		}
+	case CiliumNetworkPlugin:
+		networkPluginConfigDefaultsMap = map[string]string{
+			CiliumKubeProxyReplacement: "false",
+			CiliumTunnelProtocol:       DefaultCiliumTunnelProtocol,
+			CiliumIPAMMode:             DefaultCiliumIPAMMode,
+			CiliumEnableHubble:         "false",
+		}
 	case AciNetworkPlugin:
 		networkPluginConfigDefaultsMap = map[string]string{
 			AciOVSMemoryLimit:                    DefaultAciOVSMemoryLimit,
@@ -865,6 +921,14 @@ func (c *Cluster) setClusterNetworkDefaults() {
 	if c.Network.WeaveNetworkProvider != nil {
 		networkPluginConfigDefaultsMap[WeavePassword] = c.Network.WeaveNetworkProvider.Password
 	}
+	if c.Network.CiliumNetworkProvider != nil {
+		setDefaultIfEmpty(&c.Network.CiliumNetworkProvider.TunnelProtocol, DefaultCiliumTunnelProtocol)
+		setDefaultIfEmpty(&c.Network.CiliumNetworkProvider.IPAMMode, DefaultCiliumIPAMMode)
+		networkPluginConfigDefaultsMap[CiliumKubeProxyReplacement] = strconv.FormatBool(c.Network.CiliumNetworkProvider.KubeProxyReplacement)
+		networkPluginConfigDefaultsMap[CiliumTunnelProtocol] = c.Network.CiliumNetworkProvider.TunnelProtocol
+		networkPluginConfigDefaultsMap[CiliumIPAMMode] = c.Network.CiliumNetworkProvider.IPAMMode
+		networkPluginConfigDefaultsMap[CiliumEnableHubble] = strconv.FormatBool(c.Network.CiliumNetworkProvider.EnableHubble)
+	}
 	if c.Network.AciNetworkProvider != nil {
 		setDefaultIfEmpty(&c.Network.AciNetworkProvider.OVSMemoryLimit, DefaultAciOVSMemoryLimit)
 		setDefaultIfEmpty(&c.Network.AciNetworkProvider.OVSMemoryRequest, DefaultAciOVSMemoryRequest)
@@ -1121,12 +1185,13 @@ func (c *Cluster) setCloudProvider() error {
 
 func GetExternalFlags(local, updateOnly, disablePortCheck, useLocalState bool, configDir, clusterFilePath string) ExternalFlags {
 	return ExternalFlags{
-		Local:            local,
-		UpdateOnly:       updateOnly,
-		DisablePortCheck: disablePortCheck,
-		ConfigDir:        configDir,
-		ClusterFilePath:  clusterFilePath,
-		UseLocalState:    useLocalState,
+		Local:                 local,
+		UpdateOnly:            updateOnly,
+		DisablePortCheck:      disablePortCheck,
+		ConfigDir:             configDir,
+		ClusterFilePath:       clusterFilePath,
+		UseLocalState:         useLocalState,
+		CertExpiryWarningDays: DefaultCertExpiryWarningDays,
 	}
 }
 
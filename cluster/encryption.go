@@ -338,7 +338,7 @@ func (c *Cluster) updateEncryptionProvider(ctx context.Context, keys []*encrypti
 
 func (c *Cluster) DeployEncryptionProviderFile(ctx context.Context) error {
 	logrus.Debugf("[%s] Deploying Encryption Provider Configuration file on Control Plane nodes..", services.ControlRole)
-	return deployFile(ctx, c.ControlPlaneHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap, EncryptionProviderFilePath, c.EncryptionConfig.EncryptionProviderFile, c.Version)
+	return c.deployFile(ctx, c.ControlPlaneHosts, EncryptionProviderFilePath, c.EncryptionConfig.EncryptionProviderFile)
 }
 
 // ReconcileDesiredStateEncryptionConfig We do the rotation outside of the cluster reconcile logic. When we are done,
@@ -3,7 +3,9 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -25,50 +27,103 @@ func (c *Cluster) SnapshotEtcd(ctx context.Context, snapshotName string) error {
 		containerTimeout = c.Services.Etcd.BackupConfig.Timeout
 	}
 
+	backend, err := c.GetSnapshotBackend()
+	if err != nil {
+		return err
+	}
+
 	// store first error message
 	var snapshotErr error
 	snapshotFailures := 0
-	s3UploadFailures := 0
+	uploadFailures := 0
+	var snapshotHosts []*hosts.Host
 
 	for _, host := range c.EtcdHosts {
 		newCtx := context.WithValue(ctx, docker.WaitTimeoutContextKey, containerTimeout)
 		if err := services.RunEtcdSnapshotSave(newCtx, host, c.PrivateRegistriesMap, backupImage, snapshotName, true, c.Services.Etcd, c.Version); err != nil {
-			if strings.Contains(err.Error(), "failed to upload etcd snapshot file to s3 on host") {
-				s3UploadFailures++
+			if strings.Contains(err.Error(), "failed to upload etcd snapshot file to") {
+				uploadFailures++
 			} else {
 				if snapshotErr == nil {
 					snapshotErr = err
 				}
 				snapshotFailures++
 			}
+			continue
 		}
+		snapshotHosts = append(snapshotHosts, host)
 	}
 
 	if snapshotFailures == len(c.EtcdHosts) {
 		log.Warnf(ctx, "[etcd] Failed to take snapshot on all etcd hosts: %s", snapshotErr)
 		return fmt.Errorf("[etcd] Failed to take snapshot on all etcd hosts: %s", snapshotErr)
 	} else if snapshotFailures > 0 {
-		log.Warnf(ctx, "[etcd] Failed to take snapshot on %s etcd hosts", snapshotFailures)
+		log.Warnf(ctx, "[etcd] Failed to take snapshot on %d etcd hosts", snapshotFailures)
 	} else {
 		log.Infof(ctx, "[etcd] Finished saving snapshot [%s] on all etcd hosts", snapshotName)
 	}
 
-	if c.Services.Etcd.BackupConfig != nil && c.Services.Etcd.BackupConfig.S3BackupConfig == nil {
+	target := c.getSnapshotTargetName()
+	if c.Services.Etcd.BackupConfig != nil && target == "" {
 		return nil
 	}
+	// the snapshot backend only needs one copy of the snapshot
+	if backend != nil {
+		return c.uploadEtcdSnapshotToBackend(ctx, snapshotHosts, snapshotName, backend)
+	}
 
-	if s3UploadFailures >= len(c.EtcdHosts)-snapshotFailures {
-		log.Warnf(ctx, "[etcd] Failed to upload etcd snapshot file to s3 on all etcd hosts")
-		return fmt.Errorf("[etcd] Failed to upload etcd snapshot file to s3 on all etcd hosts")
-	} else if s3UploadFailures > 0 {
-		log.Warnf(ctx, "[etcd] Failed to upload etcd snapshot file to s3 on %s etcd hosts", s3UploadFailures)
+	if uploadFailures >= len(c.EtcdHosts)-snapshotFailures {
+		log.Warnf(ctx, "[etcd] Failed to upload etcd snapshot file to %s on all etcd hosts", target)
+		return fmt.Errorf("[etcd] Failed to upload etcd snapshot file to %s on all etcd hosts", target)
+	} else if uploadFailures > 0 {
+		log.Warnf(ctx, "[etcd] Failed to upload etcd snapshot file to %s on %d etcd hosts", target, uploadFailures)
 	} else {
-		log.Infof(ctx, "[etcd] Finished uploading etcd snapshot file to s3 on all etcd hosts")
+		log.Infof(ctx, "[etcd] Finished uploading etcd snapshot file to %s on all etcd hosts", target)
 	}
 
 	return nil
 }
 
+// uploadEtcdSnapshotToBackend uploads the snapshot from the first of the hosts holding it where the upload succeeds
+func (c *Cluster) uploadEtcdSnapshotToBackend(ctx context.Context, snapshotHosts []*hosts.Host, snapshotName string, backend services.SnapshotBackend) error {
+	var errors []error
+	for _, host := range snapshotHosts {
+		err := services.UploadEtcdSnapshotToBackend(ctx, host, c.PrivateRegistriesMap, c.getBackupImage(), snapshotName, backend, c.Version)
+		if err == nil {
+			log.Infof(ctx, "[etcd] Finished uploading etcd snapshot file to %s from host [%s]", backend.Name(), host.Address)
+			return nil
+		}
+		log.Warnf(ctx, "[etcd] %v", err)
+		errors = append(errors, err)
+	}
+	return fmt.Errorf("[etcd] Failed to upload etcd snapshot file to %s on all etcd hosts: %v", backend.Name(), errors)
+}
+
+// SyncEtcdSnapshotsToBackend ships the rolling snapshots of the first etcd host that can be reached to the snapshot backend, then
+// removes the rolling snapshots the backend holds past the retention. Each etcd host takes its own rolling snapshots, one host is
+// enough to keep the backend up to date.
+func (c *Cluster) SyncEtcdSnapshotsToBackend(ctx context.Context) error {
+	backend, err := c.GetSnapshotBackend()
+	if err != nil || backend == nil {
+		return err
+	}
+	var errors []error
+	synced := false
+	for _, host := range c.EtcdHosts {
+		if err := services.SyncEtcdSnapshotsToBackend(ctx, host, c.PrivateRegistriesMap, c.getBackupImage(), backend, c.Version); err != nil {
+			log.Warnf(ctx, "[etcd] Failed to ship rolling snapshots from host [%s] to %s backend: %v", host.Address, backend.Name(), err)
+			errors = append(errors, err)
+			continue
+		}
+		synced = true
+		break
+	}
+	if !synced {
+		return fmt.Errorf("[etcd] Failed to ship rolling snapshots to %s backend from all etcd hosts: %v", backend.Name(), errors)
+	}
+	return services.PruneEtcdSnapshotsOnBackend(ctx, backend, services.GetEtcdSnapshotRetention(c.Services.Etcd.BackupConfig))
+}
+
 func (c *Cluster) DeployRestoreCerts(ctx context.Context, clusterCerts map[string]pki.CertificatePKI) error {
 	var errgrp errgroup.Group
 	hostsQueue := util.GetObjectQueue(c.EtcdHosts)
@@ -134,7 +189,17 @@ func (c *Cluster) DeployStateFile(ctx context.Context, stateFilePath, snapshotNa
 
 func (c *Cluster) GetStateFileFromSnapshot(ctx context.Context, snapshotName string) (string, error) {
 	backupImage := c.getBackupImage()
+	backend, err := c.GetSnapshotBackend()
+	if err != nil {
+		return "", err
+	}
 	for _, host := range c.EtcdHosts {
+		if backend != nil {
+			if err := services.DownloadEtcdSnapshotFromBackend(ctx, host, c.PrivateRegistriesMap, backupImage, snapshotName, backend, c.Version); err != nil {
+				logrus.Infof("Could not download snapshot [%s] from %s backend on host [%s]: %v", snapshotName, backend.Name(), host.Address, err)
+				continue
+			}
+		}
 		stateFile, err := services.RunGetStateFileFromSnapshot(ctx, host, c.PrivateRegistriesMap, backupImage, snapshotName, c.Services.Etcd, c.Version)
 		if err != nil || stateFile == "" {
 			logrus.Infof("Could not extract state file from snapshot [%s] on host [%s]", snapshotName, host.Address)
@@ -152,8 +217,7 @@ func (c *Cluster) PrepareBackup(ctx context.Context, snapshotPath string) error
 	backupImage := c.getBackupImage()
 	var errors []error
 	// s3 backup case
-	if c.Services.Etcd.BackupConfig != nil &&
-		c.Services.Etcd.BackupConfig.S3BackupConfig != nil {
+	if services.IsS3HandledByRKETools(c.Services.Etcd.BackupConfig) {
 		log.Infof(ctx, "[etcd] etcd s3 backup configuration found, will use s3 as source")
 		downloadFailed := false
 		for _, host := range c.EtcdHosts {
@@ -165,9 +229,31 @@ func (c *Cluster) PrepareBackup(ctx context.Context, snapshotPath string) error
 		}
 		backupReady = !downloadFailed
 	}
+	// snapshot backend case, the snapshot archive only needs to be on the backup server host
+	backend, err := c.GetSnapshotBackend()
+	if err != nil {
+		return err
+	}
+	if backend != nil {
+		log.Infof(ctx, "[etcd] etcd %s backup configuration found, will use %s as source", backend.Name(), backend.Name())
+		for _, host := range c.EtcdHosts {
+			if err := services.DownloadEtcdSnapshotFromBackend(ctx, host, c.PrivateRegistriesMap, backupImage, snapshotPath, backend, c.Version); err != nil {
+				log.Warnf(ctx, "failed to download snapshot [%s] from %s backend on host [%s]: %v", snapshotPath, backend.Name(), host.Address, err)
+				errors = append(errors, err)
+				continue
+			}
+			backupServer = host
+			break
+		}
+		if backupServer == nil {
+			return fmt.Errorf("failed to download snapshot [%s] from %s backend on all etcd nodes: %v", snapshotPath, backend.Name(), errors)
+		}
+	}
 	// legacy rke local backup or rancher local backup
 	if !backupReady {
-		if c.Services.Etcd.BackupConfig == nil {
+		if backend != nil {
+			log.Infof(ctx, "[etcd] Snapshot [%s] downloaded on host [%s], will use it as source for the other etcd hosts", snapshotPath, backupServer.Address)
+		} else if c.Services.Etcd.BackupConfig == nil {
 			log.Infof(ctx, "[etcd] No etcd snapshot configuration found, will use local as source")
 		} else if c.Services.Etcd.BackupConfig.S3BackupConfig == nil {
 			log.Infof(ctx, "[etcd] etcd snapshot configuration found and no s3 backup configuration found, will use local as source")
@@ -175,10 +261,16 @@ func (c *Cluster) PrepareBackup(ctx context.Context, snapshotPath string) error
 			log.Warnf(ctx, "[etcd] etcd snapshot configuration found and s3 backup configuration failed, falling back to use local as source")
 		}
 		// stop etcd on all etcd nodes, we need this because we start the backup server on the same port
+		sourceHost := backupServer
+		backupServer = nil
 		for _, host := range c.EtcdHosts {
 			if err := docker.StopContainer(ctx, host.DClient, host.Address, services.EtcdContainerName); err != nil {
 				log.Warnf(ctx, "failed to stop etcd container on host [%s]: %v", host.Address, err)
 			}
+			// the snapshot downloaded from the snapshot backend is only present on the source host
+			if sourceHost != nil && host.Address != sourceHost.Address {
+				continue
+			}
 			// start the download server, only one node should have it!
 			if err := services.StartBackupServer(ctx, host, c.PrivateRegistriesMap, backupImage, snapshotPath, c.Version); err != nil {
 				log.Warnf(ctx, "failed to start backup server on host [%s]: %v", host.Address, err)
@@ -190,11 +282,7 @@ func (c *Cluster) PrepareBackup(ctx context.Context, snapshotPath string) error
 		}
 
 		if backupServer == nil { //failed to start the backupServer, I will cleanup and exit
-			for _, host := range c.EtcdHosts {
-				if err := docker.StartContainer(ctx, host.DClient, host.Address, services.EtcdContainerName); err != nil {
-					log.Warnf(ctx, "failed to start etcd container on host [%s]: %v", host.Address, err)
-				}
-			}
+			c.StartEtcdContainers(ctx)
 			return fmt.Errorf("failed to start backup server on all etcd nodes: %v", errors)
 		}
 		// start downloading the snapshot
@@ -223,6 +311,15 @@ func (c *Cluster) PrepareBackup(ctx context.Context, snapshotPath string) error
 	return nil
 }
 
+// StartEtcdContainers starts the etcd containers stopped to distribute a snapshot
+func (c *Cluster) StartEtcdContainers(ctx context.Context) {
+	for _, host := range c.EtcdHosts {
+		if err := docker.StartContainer(ctx, host.DClient, host.Address, services.EtcdContainerName); err != nil {
+			log.Warnf(ctx, "failed to start etcd container on host [%s]: %v", host.Address, err)
+		}
+	}
+}
+
 func (c *Cluster) RestoreEtcdSnapshot(ctx context.Context, snapshotPath string) error {
 	// Start restore process on all etcd hosts
 	initCluster := services.GetEtcdInitialCluster(c.EtcdHosts)
@@ -250,6 +347,32 @@ func (c *Cluster) RemoveEtcdSnapshot(ctx context.Context, snapshotName string) e
 			return err
 		}
 	}
+	return c.removeEtcdSnapshotFromBackend(ctx, snapshotName)
+}
+
+// GetSnapshotBackend returns the snapshot backend configured in the backup config of the cluster, or nil if there is none
+func (c *Cluster) GetSnapshotBackend() (services.SnapshotBackend, error) {
+	bc := c.Services.Etcd.BackupConfig
+	if bc == nil || bc.SFTPBackupConfig == nil {
+		return services.NewSnapshotBackend(bc, nil)
+	}
+	verifier, err := c.getSnapshotHostKeyVerifier()
+	if err != nil {
+		return nil, err
+	}
+	return services.NewSnapshotBackend(bc, verifier)
+}
+
+// removeEtcdSnapshotFromBackend removes the snapshot from the snapshot backend, rke-tools removes the snapshots it sent to S3 itself
+func (c *Cluster) removeEtcdSnapshotFromBackend(ctx context.Context, snapshotName string) error {
+	backend, err := c.GetSnapshotBackend()
+	if err != nil || backend == nil {
+		return err
+	}
+	log.Infof(ctx, "[etcd] Removing snapshot [%s] from %s backend", snapshotName, backend.Name())
+	if err := backend.Delete(ctx, services.GetEtcdSnapshotFileName(snapshotName)); err != nil {
+		return fmt.Errorf("failed to remove snapshot [%s] from %s backend: %v", snapshotName, backend.Name(), err)
+	}
 	return nil
 }
 
@@ -275,6 +398,22 @@ func (c *Cluster) etcdSnapshotChecksum(ctx context.Context, snapshotPath string)
 	return true
 }
 
+// getSnapshotTargetName returns the name of the remote target snapshots are uploaded to, or an empty string if snapshots are only kept on the etcd hosts
+func (c *Cluster) getSnapshotTargetName() string {
+	bc := c.Services.Etcd.BackupConfig
+	switch {
+	case bc == nil:
+		return ""
+	case bc.S3BackupConfig != nil:
+		return "s3"
+	case bc.SFTPBackupConfig != nil:
+		return services.SFTPSnapshotBackendName
+	case bc.LocalDirBackupConfig != nil:
+		return services.LocalDirSnapshotBackendName
+	}
+	return ""
+}
+
 func (c *Cluster) getBackupImage() string {
 	rkeToolsImage, err := util.GetDefaultRKETools(c.SystemImages.Alpine)
 	if err != nil {
@@ -316,3 +455,254 @@ func (c *Cluster) getRestoreImage() string {
 
 	return c.getBackupImage()
 }
+
+// EtcdSnapshot is a snapshot stored on an etcd host or on the remote snapshot target
+type EtcdSnapshot struct {
+	Name string `json:"name"`
+	// Location is the address of the etcd host or the name of the remote target holding the snapshot
+	Location          string    `json:"location"`
+	Remote            bool      `json:"remote"`
+	Size              int64     `json:"size"`
+	CreatedAt         time.Time `json:"createdAt"`
+	Checksum          string    `json:"checksum,omitempty"`
+	KubernetesVersion string    `json:"kubernetesVersion,omitempty"`
+}
+
+// EtcdSnapshotSourceError is an etcd host or remote snapshot target whose snapshots could not be listed
+type EtcdSnapshotSourceError struct {
+	Location string `json:"location"`
+	Remote   bool   `json:"remote"`
+	Error    string `json:"error"`
+}
+
+// ListEtcdSnapshots returns the snapshots stored on every etcd host and on the remote snapshot target, if any.
+// Sources that can not be listed are skipped with a warning and returned with their error, the snapshots of the other sources are
+// still returned.
+func (c *Cluster) ListEtcdSnapshots(ctx context.Context) ([]EtcdSnapshot, []EtcdSnapshotSourceError) {
+	var snapshots []EtcdSnapshot
+	var sourceErrors []EtcdSnapshotSourceError
+	backupImage := c.getBackupImage()
+	for _, host := range c.EtcdHosts {
+		hostSnapshots, err := services.GetEtcdSnapshotsOnHost(ctx, host, c.PrivateRegistriesMap, backupImage, c.Version)
+		if err != nil {
+			log.Warnf(ctx, "[etcd] Failed to list snapshots on host [%s]: %v", host.Address, err)
+			sourceErrors = append(sourceErrors, EtcdSnapshotSourceError{Location: host.Address, Error: err.Error()})
+			continue
+		}
+		snapshots = append(snapshots, getEtcdSnapshots(hostSnapshots, host.Address, false)...)
+	}
+	remoteSnapshots, err := c.listRemoteEtcdSnapshots(ctx)
+	if err != nil {
+		log.Warnf(ctx, "[etcd] Failed to list snapshots on %s target: %v", c.getSnapshotTargetName(), err)
+		sourceErrors = append(sourceErrors, EtcdSnapshotSourceError{Location: c.getSnapshotTargetName(), Remote: true, Error: err.Error()})
+		return snapshots, sourceErrors
+	}
+	snapshots = append(snapshots, getEtcdSnapshots(remoteSnapshots, c.getSnapshotTargetName(), true)...)
+	return snapshots, sourceErrors
+}
+
+func (c *Cluster) listRemoteEtcdSnapshots(ctx context.Context) ([]services.SnapshotInfo, error) {
+	if c.Services.Etcd.BackupConfig == nil {
+		return nil, nil
+	}
+	if services.IsS3HandledByRKETools(c.Services.Etcd.BackupConfig) {
+		return services.ListEtcdSnapshotsOnS3(ctx, c.Services.Etcd.BackupConfig.S3BackupConfig)
+	}
+	backend, err := c.GetSnapshotBackend()
+	if err != nil || backend == nil {
+		return nil, err
+	}
+	return backend.List(ctx)
+}
+
+func getEtcdSnapshots(snapshotInfos []services.SnapshotInfo, location string, remote bool) []EtcdSnapshot {
+	var snapshots []EtcdSnapshot
+	for _, snapshotInfo := range snapshotInfos {
+		snapshots = append(snapshots, EtcdSnapshot{
+			Name:              services.GetEtcdSnapshotName(snapshotInfo.FileName),
+			Location:          location,
+			Remote:            remote,
+			Size:              snapshotInfo.Size,
+			CreatedAt:         snapshotInfo.ModTime,
+			Checksum:          snapshotInfo.Checksum,
+			KubernetesVersion: snapshotInfo.KubernetesVersion,
+		})
+	}
+	return snapshots
+}
+
+// PruneEtcdSnapshots removes the snapshots selected by SelectEtcdSnapshotsToPrune from the etcd hosts and the remote snapshot target.
+// The names of the pruned snapshots are returned, nothing is removed when dryRun is set.
+func (c *Cluster) PruneEtcdSnapshots(ctx context.Context, keep int, olderThan time.Duration, dryRun bool) ([]string, error) {
+	snapshots, sourceErrors := c.ListEtcdSnapshots(ctx)
+	for _, sourceError := range sourceErrors {
+		// the snapshots only stored on the remote target would be missing from the retention
+		if sourceError.Remote {
+			return nil, fmt.Errorf("failed to list snapshots on %s target: %s", sourceError.Location, sourceError.Error)
+		}
+	}
+	toPrune := SelectEtcdSnapshotsToPrune(snapshots, keep, olderThan, time.Now())
+	if dryRun || len(c.EtcdHosts) == 0 {
+		return toPrune, nil
+	}
+	backupImage := c.getBackupImage()
+	for _, name := range toPrune {
+		log.Infof(ctx, "[etcd] Pruning snapshot [%s]", name)
+		for _, host := range c.getEtcdSnapshotHosts(snapshots, name) {
+			if err := services.RunEtcdSnapshotRemove(ctx, host, c.PrivateRegistriesMap, backupImage, name, false, c.Services.Etcd, c.Version); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.removeEtcdSnapshotFromBackend(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	return toPrune, nil
+}
+
+// getEtcdSnapshotHosts returns the etcd hosts holding the snapshot, or the first etcd host for snapshots only stored on the remote target
+// since removing a snapshot on a host also removes it from the S3 target of rke-tools.
+func (c *Cluster) getEtcdSnapshotHosts(snapshots []EtcdSnapshot, name string) []*hosts.Host {
+	var snapshotHosts []*hosts.Host
+	for _, host := range c.EtcdHosts {
+		for _, snapshot := range snapshots {
+			if snapshot.Name == name && !snapshot.Remote && snapshot.Location == host.Address {
+				snapshotHosts = append(snapshotHosts, host)
+				break
+			}
+		}
+	}
+	if len(snapshotHosts) == 0 {
+		return c.EtcdHosts[:1]
+	}
+	return snapshotHosts
+}
+
+// SelectEtcdSnapshotsToPrune returns the names of the snapshots to remove, newest first. The keep newest snapshots are always kept,
+// if olderThan is set only the remaining snapshots created more than olderThan before now are selected.
+func SelectEtcdSnapshotsToPrune(snapshots []EtcdSnapshot, keep int, olderThan time.Duration, now time.Time) []string {
+	// a snapshot stored in several locations is as old as its newest copy
+	createdAt := map[string]time.Time{}
+	for _, snapshot := range snapshots {
+		if current, ok := createdAt[snapshot.Name]; !ok || snapshot.CreatedAt.After(current) {
+			createdAt[snapshot.Name] = snapshot.CreatedAt
+		}
+	}
+	var names []string
+	for name := range createdAt {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if createdAt[names[i]].Equal(createdAt[names[j]]) {
+			return names[i] > names[j]
+		}
+		return createdAt[names[i]].After(createdAt[names[j]])
+	})
+	var toPrune []string
+	for i, name := range names {
+		if i < keep {
+			continue
+		}
+		if olderThan > 0 && now.Sub(createdAt[name]) <= olderThan {
+			continue
+		}
+		toPrune = append(toPrune, name)
+	}
+	return toPrune
+}
+
+// EtcdSnapshotVerification is the result of opening a snapshot on an etcd host
+type EtcdSnapshotVerification struct {
+	Host   string                       `json:"host"`
+	Status *services.EtcdSnapshotStatus `json:"status,omitempty"`
+	Error  string                       `json:"error,omitempty"`
+}
+
+// VerifyEtcdSnapshot opens the snapshot on every etcd host with etcdctl and returns an error if any copy is missing, truncated or corrupted
+func (c *Cluster) VerifyEtcdSnapshot(ctx context.Context, snapshotName string) ([]EtcdSnapshotVerification, error) {
+	backupImage := c.getBackupImage()
+	restoreImage := c.getRestoreImage()
+	var verifications []EtcdSnapshotVerification
+	var failedHosts []string
+	for _, host := range c.EtcdHosts {
+		verification := EtcdSnapshotVerification{Host: host.Address}
+		status, err := services.GetEtcdSnapshotStatus(ctx, host, c.PrivateRegistriesMap, backupImage, restoreImage, snapshotName, c.Version)
+		if err != nil {
+			log.Warnf(ctx, "[etcd] Failed to verify snapshot [%s] on host [%s]: %v", snapshotName, host.Address, err)
+			verification.Error = err.Error()
+			failedHosts = append(failedHosts, host.Address)
+		} else {
+			log.Infof(ctx, "[etcd] Snapshot [%s] on host [%s] is valid: revision [%d], keys [%d], hash [%d], size [%d]", snapshotName, host.Address, status.Revision, status.TotalKey, status.Hash, status.TotalSize)
+			verification.Status = status
+		}
+		verifications = append(verifications, verification)
+	}
+	if len(failedHosts) > 0 {
+		return verifications, fmt.Errorf("[etcd] snapshot [%s] is not a valid etcd database on hosts [%s]", snapshotName, strings.Join(failedHosts, ","))
+	}
+	return verifications, nil
+}
+
+// DownloadEtcdSnapshot fetches the snapshot from the remote snapshot target on every etcd host, it is a no-op if snapshots are only kept on the etcd hosts
+func (c *Cluster) DownloadEtcdSnapshot(ctx context.Context, snapshotName string) error {
+	if c.Services.Etcd.BackupConfig == nil {
+		return nil
+	}
+	backend, err := c.GetSnapshotBackend()
+	if err != nil {
+		return err
+	}
+	for _, host := range c.EtcdHosts {
+		if err := c.downloadEtcdSnapshotToHost(ctx, host, snapshotName, backend); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) downloadEtcdSnapshotToHost(ctx context.Context, host *hosts.Host, snapshotName string, backend services.SnapshotBackend) error {
+	if services.IsS3HandledByRKETools(c.Services.Etcd.BackupConfig) {
+		return services.DownloadEtcdSnapshotFromS3(ctx, host, c.PrivateRegistriesMap, c.getBackupImage(), snapshotName, c.Services.Etcd, c.Version)
+	}
+	if backend != nil {
+		return services.DownloadEtcdSnapshotFromBackend(ctx, host, c.PrivateRegistriesMap, c.getBackupImage(), snapshotName, backend, c.Version)
+	}
+	return nil
+}
+
+// GetFullStateKubernetesVersion returns the kubernetes version recorded in a cluster state, the current state takes precedence
+func GetFullStateKubernetesVersion(fullState *FullState) string {
+	if fullState == nil {
+		return ""
+	}
+	if fullState.CurrentState.RancherKubernetesEngineConfig != nil && fullState.CurrentState.RancherKubernetesEngineConfig.Version != "" {
+		return fullState.CurrentState.RancherKubernetesEngineConfig.Version
+	}
+	if fullState.DesiredState.RancherKubernetesEngineConfig != nil {
+		return fullState.DesiredState.RancherKubernetesEngineConfig.Version
+	}
+	return ""
+}
+
+// CheckEtcdSnapshotKubernetesVersion returns an error if a snapshot taken on snapshotVersion can't be restored on a cluster running clusterVersion.
+// Objects stored by a newer minor version may not be readable by an older kube-apiserver, and skipping a minor version skips its storage migrations.
+func CheckEtcdSnapshotKubernetesVersion(snapshotVersion, clusterVersion string) error {
+	if snapshotVersion == "" || clusterVersion == "" {
+		return nil
+	}
+	snapshotSemVer, err := util.StrToSemVer(snapshotVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse snapshot kubernetes version [%s]: %v", snapshotVersion, err)
+	}
+	clusterSemVer, err := util.StrToSemVer(clusterVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster kubernetes version [%s]: %v", clusterVersion, err)
+	}
+	if snapshotSemVer.Major != clusterSemVer.Major || snapshotSemVer.Minor > clusterSemVer.Minor {
+		return fmt.Errorf("snapshot was taken on kubernetes version [%s] which is newer than the cluster kubernetes version [%s]", snapshotVersion, clusterVersion)
+	}
+	if clusterSemVer.Minor-snapshotSemVer.Minor > 1 {
+		return fmt.Errorf("snapshot was taken on kubernetes version [%s] which is more than one minor version older than the cluster kubernetes version [%s]", snapshotVersion, clusterVersion)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/services"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	"k8s.io/apiserver/pkg/storage/value"
+	aestransformer "k8s.io/apiserver/pkg/storage/value/encrypt/aes"
+	"k8s.io/apiserver/pkg/storage/value/encrypt/secretbox"
+	"k8s.io/client-go/kubernetes/scheme"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const etcdEncryptedValuePrefix = "k8s:enc:"
+
+// EtcdSnapshotObjectFilter selects the objects to extract from a snapshot, Kind and Name are optional
+type EtcdSnapshotObjectFilter struct {
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+// EtcdSnapshotObject is a kubernetes object read from an etcd snapshot, Manifest is the object in YAML ready to be applied
+type EtcdSnapshotObject struct {
+	Key       string
+	Kind      string
+	Namespace string
+	Name      string
+	Manifest  []byte
+}
+
+// ExtractEtcdSnapshotObjects reads the objects matching the filter from the snapshot on the first etcd host, the snapshot is
+// downloaded from the remote snapshot target if one is configured. Encrypted values are decrypted with the keys in encryptionProviderFiles.
+func (c *Cluster) ExtractEtcdSnapshotObjects(ctx context.Context, snapshotName string, filter EtcdSnapshotObjectFilter, encryptionProviderFiles []string) ([]EtcdSnapshotObject, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	transformer, err := newEtcdValueTransformer(encryptionProviderFiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.EtcdHosts) == 0 {
+		return nil, fmt.Errorf("[etcd] no etcd hosts found to extract snapshot [%s]", snapshotName)
+	}
+	host := c.EtcdHosts[0]
+	backend, err := c.GetSnapshotBackend()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.downloadEtcdSnapshotToHost(ctx, host, snapshotName, backend); err != nil {
+		return nil, err
+	}
+	keyValues, err := services.ExtractEtcdSnapshotKeyValues(ctx, host, c.PrivateRegistriesMap, c.getBackupImage(), c.getRestoreImage(), snapshotName, EtcdPathPrefix, filter.keyRegex(), c.Version)
+	if err != nil {
+		return nil, err
+	}
+	var objects []EtcdSnapshotObject
+	for _, kv := range keyValues {
+		object, err := decodeEtcdSnapshotObject(ctx, kv, transformer)
+		if err != nil {
+			log.Warnf(ctx, "[etcd] Skipping key [%s] of snapshot [%s]: %v", kv.Key, snapshotName, err)
+			continue
+		}
+		if filter.matches(object) {
+			objects = append(objects, *object)
+		}
+	}
+	return objects, nil
+}
+
+func (f EtcdSnapshotObjectFilter) validate() error {
+	if len(f.Namespace) == 0 {
+		return fmt.Errorf("namespace is required to extract objects from a snapshot")
+	}
+	for _, v := range []string{f.Namespace, f.Kind, f.Name} {
+		if strings.ContainsAny(v, "/'") {
+			return fmt.Errorf("invalid object filter value [%s]", v)
+		}
+	}
+	return nil
+}
+
+// keyRegex matches the keys of the objects in the namespace and of the namespace itself, the kind is checked once the objects are decoded
+// since the resource name in the key can't be derived from the kind for custom resources
+func (f EtcdSnapshotObjectFilter) keyRegex() string {
+	namespace := regexp.QuoteMeta(f.Namespace)
+	name := "[^/]+"
+	if len(f.Name) > 0 {
+		name = regexp.QuoteMeta(f.Name)
+	}
+	return fmt.Sprintf("^%s/(.+/)?%s/%s$|^%s/namespaces/%s$", EtcdPathPrefix, namespace, name, EtcdPathPrefix, namespace)
+}
+
+func (f EtcdSnapshotObjectFilter) matches(object *EtcdSnapshotObject) bool {
+	if len(f.Kind) > 0 && !strings.EqualFold(object.Kind, f.Kind) {
+		return false
+	}
+	if len(f.Name) > 0 && object.Name != f.Name {
+		return false
+	}
+	if object.Namespace == f.Namespace {
+		return true
+	}
+	return object.Kind == "Namespace" && object.Name == f.Namespace
+}
+
+// newEtcdValueTransformer builds a transformer that decrypts values written with any of the keys in the encryption provider files
+func newEtcdValueTransformer(encryptionProviderFiles []string) (value.Transformer, error) {
+	var transformers []value.PrefixTransformer
+	for _, providerFile := range encryptionProviderFiles {
+		if len(providerFile) == 0 {
+			continue
+		}
+		config := apiserverv1.EncryptionConfiguration{}
+		if err := k8s.DecodeYamlResource(&config, providerFile); err != nil {
+			return nil, fmt.Errorf("failed to parse encryption provider config: %v", err)
+		}
+		for _, resource := range config.Resources {
+			for _, provider := range resource.Providers {
+				providerTransformers, err := getProviderTransformers(provider)
+				if err != nil {
+					return nil, err
+				}
+				transformers = append(transformers, providerTransformers...)
+			}
+		}
+	}
+	return value.NewPrefixTransformers(fmt.Errorf("no encryption key found to decrypt value"), transformers...), nil
+}
+
+func getProviderTransformers(provider apiserverv1.ProviderConfiguration) ([]value.PrefixTransformer, error) {
+	var transformers []value.PrefixTransformer
+	switch {
+	case provider.AESCBC != nil || provider.AESGCM != nil:
+		providerName, config := "aescbc", provider.AESCBC
+		if provider.AESGCM != nil {
+			providerName, config = "aesgcm", provider.AESGCM
+		}
+		for _, key := range config.Keys {
+			secret, err := base64.StdEncoding.DecodeString(key.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s key [%s]: %v", providerName, key.Name, err)
+			}
+			block, err := aes.NewCipher(secret)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s key [%s]: %v", providerName, key.Name, err)
+			}
+			transformer := aestransformer.NewCBCTransformer(block)
+			if provider.AESGCM != nil {
+				if transformer, err = aestransformer.NewGCMTransformer(block); err != nil {
+					return nil, fmt.Errorf("invalid %s key [%s]: %v", providerName, key.Name, err)
+				}
+			}
+			transformers = append(transformers, value.PrefixTransformer{
+				Prefix:      []byte(fmt.Sprintf("%s%s:v1:%s:", etcdEncryptedValuePrefix, providerName, key.Name)),
+				Transformer: transformer,
+			})
+		}
+	case provider.Secretbox != nil:
+		for _, key := range provider.Secretbox.Keys {
+			secret, err := base64.StdEncoding.DecodeString(key.Secret)
+			if err != nil || len(secret) != 32 {
+				return nil, fmt.Errorf("invalid secretbox key [%s]", key.Name)
+			}
+			var secretKey [32]byte
+			copy(secretKey[:], secret)
+			transformers = append(transformers, value.PrefixTransformer{
+				Prefix:      []byte(fmt.Sprintf("%ssecretbox:v1:%s:", etcdEncryptedValuePrefix, key.Name)),
+				Transformer: secretbox.NewSecretboxTransformer(secretKey),
+			})
+		}
+	}
+	return transformers, nil
+}
+
+// decodeEtcdSnapshotObject decrypts the value if needed and decodes it from protobuf, or JSON for custom resources, to YAML
+func decodeEtcdSnapshotObject(ctx context.Context, kv services.EtcdKeyValue, transformer value.Transformer) (*EtcdSnapshotObject, error) {
+	data := kv.Value
+	if bytes.HasPrefix(data, []byte(etcdEncryptedValuePrefix)) {
+		var err error
+		if data, _, err = transformer.TransformFromStorage(ctx, data, value.DefaultContext(kv.Key)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt value: %v", err)
+		}
+	}
+	obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		if !runtime.IsNotRegisteredError(err) {
+			return nil, fmt.Errorf("failed to decode value: %v", err)
+		}
+		// custom resources are stored as JSON
+		if obj, gvk, err = unstructured.UnstructuredJSONScheme.Decode(data, nil, nil); err != nil {
+			return nil, fmt.Errorf("failed to decode value: %v", err)
+		}
+	}
+	return newEtcdSnapshotObject(kv.Key, obj, gvk)
+}
+
+func newEtcdSnapshotObject(key string, obj runtime.Object, gvk *schema.GroupVersionKind) (*EtcdSnapshotObject, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	// the manifest is meant to be applied to a live cluster, drop the fields set by the apiserver that would make it fail
+	accessor.SetResourceVersion("")
+	accessor.SetManagedFields(nil)
+	obj.GetObjectKind().SetGroupVersionKind(*gvk)
+	jsonManifest, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := sigsyaml.JSONToYAML(jsonManifest)
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdSnapshotObject{
+		Key:       key,
+		Kind:      gvk.Kind,
+		Namespace: accessor.GetNamespace(),
+		Name:      accessor.GetName(),
+		Manifest:  manifest,
+	}, nil
+}
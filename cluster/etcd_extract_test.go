@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/rancher/rke/services"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestEtcdSnapshotObjectFilter(t *testing.T) {
+	filter := EtcdSnapshotObjectFilter{Namespace: "team-a"}
+	keyRegex := regexp.MustCompile(filter.keyRegex())
+	assert.True(t, keyRegex.MatchString("/registry/configmaps/team-a/settings"))
+	assert.True(t, keyRegex.MatchString("/registry/cert-manager.io/certificates/team-a/web"))
+	assert.True(t, keyRegex.MatchString("/registry/namespaces/team-a"))
+	assert.False(t, keyRegex.MatchString("/registry/configmaps/team-b/settings"))
+
+	filter = EtcdSnapshotObjectFilter{Namespace: "team-a", Kind: "secret", Name: "db"}
+	keyRegex = regexp.MustCompile(filter.keyRegex())
+	assert.True(t, keyRegex.MatchString("/registry/secrets/team-a/db"))
+	assert.False(t, keyRegex.MatchString("/registry/secrets/team-a/db-backup"))
+	assert.True(t, filter.matches(&EtcdSnapshotObject{Kind: "Secret", Namespace: "team-a", Name: "db"}))
+	assert.False(t, filter.matches(&EtcdSnapshotObject{Kind: "ConfigMap", Namespace: "team-a", Name: "db"}))
+	assert.False(t, filter.matches(&EtcdSnapshotObject{Kind: "Namespace", Name: "team-a"}))
+
+	filter = EtcdSnapshotObjectFilter{Namespace: "team-a"}
+	assert.True(t, filter.matches(&EtcdSnapshotObject{Kind: "Namespace", Name: "team-a"}))
+	assert.False(t, filter.matches(&EtcdSnapshotObject{Kind: "ClusterRole", Name: "team-a-admin"}))
+
+	assert.NotNil(t, EtcdSnapshotObjectFilter{}.validate())
+	assert.NotNil(t, EtcdSnapshotObjectFilter{Namespace: "team-a", Name: "x'; rm -rf /"}.validate())
+}
+
+func TestDecodeEtcdSnapshotObject(t *testing.T) {
+	ctx := context.Background()
+	secret := &v1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "team-a", ResourceVersion: "42"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}
+	var data bytes.Buffer
+	assert.Nil(t, protobuf.NewSerializer(scheme.Scheme, scheme.Scheme).Encode(secret, &data))
+
+	providerFile := `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+- resources:
+  - secrets
+  providers:
+  - aescbc:
+      keys:
+      - name: key1
+        secret: dGhpcyBpcyBhIDMyIGJ5dGUgc2VjcmV0IGtleSEhISE=
+  - identity: {}`
+	transformer, err := newEtcdValueTransformer([]string{providerFile})
+	assert.Nil(t, err)
+	key := "/registry/secrets/team-a/db"
+	encrypted, err := transformer.TransformToStorage(ctx, data.Bytes(), value.DefaultContext(key))
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, []byte("k8s:enc:aescbc:v1:key1:")))
+
+	object, err := decodeEtcdSnapshotObject(ctx, services.EtcdKeyValue{Key: key, Value: encrypted}, transformer)
+	assert.Nil(t, err)
+	assert.Equal(t, "Secret", object.Kind)
+	assert.Equal(t, "team-a", object.Namespace)
+	assert.Equal(t, "db", object.Name)
+	assert.Contains(t, string(object.Manifest), "apiVersion: v1")
+	assert.Contains(t, string(object.Manifest), "password: aHVudGVyMg==")
+	assert.NotContains(t, string(object.Manifest), "resourceVersion")
+
+	// values written before secrets encryption was enabled are stored as is
+	object, err = decodeEtcdSnapshotObject(ctx, services.EtcdKeyValue{Key: key, Value: data.Bytes()}, transformer)
+	assert.Nil(t, err)
+	assert.Equal(t, "db", object.Name)
+
+	noKeys, err := newEtcdValueTransformer(nil)
+	assert.Nil(t, err)
+	_, err = decodeEtcdSnapshotObject(ctx, services.EtcdKeyValue{Key: key, Value: encrypted}, noKeys)
+	assert.NotNil(t, err)
+
+	object, err = decodeEtcdSnapshotObject(ctx, services.EtcdKeyValue{
+		Key:   "/registry/example.com/widgets/team-a/w1",
+		Value: []byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w1","namespace":"team-a","resourceVersion":"7"},"spec":{"size":3}}`),
+	}, noKeys)
+	assert.Nil(t, err)
+	assert.Equal(t, "Widget", object.Kind)
+	assert.Contains(t, string(object.Manifest), "size: 3")
+}
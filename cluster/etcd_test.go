@@ -2,8 +2,13 @@ package cluster
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/rancher/rke/docker/dockertest"
+	"github.com/rancher/rke/hosts"
 	"github.com/rancher/rke/metadata"
 	"github.com/rancher/rke/types"
 	v3 "github.com/rancher/rke/types"
@@ -59,3 +64,55 @@ func TestGetRestoreImage(t *testing.T) {
 	assert.Equal(t, expectedRestoreImage, restoreImage,
 		"expected restoreImage is different when custom etcd image is used")
 }
+
+func TestSelectEtcdSnapshotsToPrune(t *testing.T) {
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	snapshots := []EtcdSnapshot{
+		{Name: "day-1", Location: "1.1.1.1", CreatedAt: now.Add(-24 * time.Hour)},
+		{Name: "day-1", Location: "s3", Remote: true, CreatedAt: now.Add(-23 * time.Hour)},
+		{Name: "day-2", Location: "1.1.1.1", CreatedAt: now.Add(-48 * time.Hour)},
+		{Name: "day-5", Location: "2.2.2.2", CreatedAt: now.Add(-120 * time.Hour)},
+		{Name: "day-9", Location: "s3", Remote: true, CreatedAt: now.Add(-216 * time.Hour)},
+	}
+
+	assert.Equal(t, []string{"day-5", "day-9"}, SelectEtcdSnapshotsToPrune(snapshots, 2, 0, now))
+	assert.Equal(t, []string{"day-9"}, SelectEtcdSnapshotsToPrune(snapshots, 0, 168*time.Hour, now))
+	assert.Equal(t, []string{"day-2", "day-5", "day-9"}, SelectEtcdSnapshotsToPrune(snapshots, 1, 36*time.Hour, now))
+	assert.Empty(t, SelectEtcdSnapshotsToPrune(snapshots, 10, 0, now))
+}
+
+func TestListEtcdSnapshotsSourceErrors(t *testing.T) {
+	runtime := dockertest.NewRuntime(func(name string, c *dockertest.Container) {
+		c.Stdout = "daily.zip|42|1717977600|abc123|v1.29.6-rancher1-1\n"
+	})
+	// the local dir target is a file, listing it fails
+	targetPath := filepath.Join(t.TempDir(), "snapshots")
+	assert.NoError(t, os.WriteFile(targetPath, nil, 0600))
+	c := &Cluster{}
+	c.Version = "v1.29.6-rancher1-1"
+	c.SystemImages.Alpine = "registry.example.com/rke-tools:v0.1.100"
+	c.Services.Etcd.BackupConfig = &v3.BackupConfig{LocalDirBackupConfig: &v3.LocalDirBackupConfig{Path: targetPath}}
+	c.EtcdHosts = []*hosts.Host{{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}, IsEtcd: true, DClient: runtime}}
+
+	snapshots, sourceErrors := c.ListEtcdSnapshots(context.Background())
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, "daily", snapshots[0].Name)
+	assert.Equal(t, "1.1.1.1", snapshots[0].Location)
+	assert.Len(t, sourceErrors, 1)
+	assert.Equal(t, "local-dir", sourceErrors[0].Location)
+	assert.True(t, sourceErrors[0].Remote)
+	assert.Contains(t, sourceErrors[0].Error, "not a directory")
+
+	// the remote snapshots are missing, nothing is pruned
+	_, err := c.PruneEtcdSnapshots(context.Background(), 0, time.Hour, true)
+	assert.ErrorContains(t, err, "failed to list snapshots on local-dir target")
+}
+
+func TestCheckEtcdSnapshotKubernetesVersion(t *testing.T) {
+	assert.Nil(t, CheckEtcdSnapshotKubernetesVersion("v1.29.5-rancher1-1", "v1.29.6-rancher1-1"))
+	assert.Nil(t, CheckEtcdSnapshotKubernetesVersion("v1.28.10-rancher1-1", "v1.29.6-rancher1-1"))
+	assert.Nil(t, CheckEtcdSnapshotKubernetesVersion("", "v1.29.6-rancher1-1"))
+	assert.NotNil(t, CheckEtcdSnapshotKubernetesVersion("v1.30.2-rancher1-1", "v1.29.6-rancher1-1"))
+	assert.NotNil(t, CheckEtcdSnapshotKubernetesVersion("v1.27.16-rancher1-1", "v1.29.6-rancher1-1"))
+	assert.NotNil(t, CheckEtcdSnapshotKubernetesVersion("not-a-version", "v1.29.6-rancher1-1"))
+}
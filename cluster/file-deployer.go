@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/rancher/rke/docker"
@@ -20,21 +21,17 @@ const (
 	ConfigEnv     = "FILE_DEPLOY"
 )
 
-func deployFile(ctx context.Context, uniqueHosts []*hosts.Host, alpineImage string, prsMap map[string]v3.PrivateRegistry, fileName, fileContents, k8sVersion string) error {
-	for _, host := range uniqueHosts {
+func (c *Cluster) deployFile(ctx context.Context, uniqueHosts []*hosts.Host, fileName, fileContents string) error {
+	return runOnHosts(uniqueHosts, c.hostWorkers(ParallelismDeployFiles), func(host *hosts.Host) error {
 		log.Infof(ctx, "[%s] Deploying file [%s] to node [%s]", ServiceName, fileName, host.Address)
-		if err := doDeployFile(ctx, host, fileName, fileContents, alpineImage, prsMap, k8sVersion); err != nil {
+		if err := doDeployFile(ctx, host, fileName, fileContents, c.SystemImages.Alpine, c.PrivateRegistriesMap, c.Version); err != nil {
 			return fmt.Errorf("[%s] Failed to deploy file [%s] on node [%s]: %v", ServiceName, fileName, host.Address, err)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func doDeployFile(ctx context.Context, host *hosts.Host, fileName, fileContents, alpineImage string, prsMap map[string]v3.PrivateRegistry, k8sVersion string) error {
-	// remove existing container. Only way it's still here is if previous deployment failed
-	if err := docker.DoRemoveContainer(ctx, host.DClient, ContainerName, host.Address); err != nil {
-		return err
-	}
 	var cmd, containerEnv []string
 
 	// fileContents determines if a file is placed or removed
@@ -54,6 +51,48 @@ func doDeployFile(ctx context.Context, host *hosts.Host, fileName, fileContents,
 		}
 	}
 
+	if err := doRunFileDeployer(ctx, host, cmd, containerEnv, alpineImage, prsMap, k8sVersion); err != nil {
+		return err
+	}
+	logrus.Debugf("[%s] Successfully deployed file [%s] on node [%s]", ServiceName, fileName, host.Address)
+	return nil
+}
+
+// restrictFilePermissions makes root the owner of the files of dirName and makes them readable by their owner only, the etcd files
+// of the etcd hosts are owned by the etcd user
+func (c *Cluster) restrictFilePermissions(ctx context.Context, uniqueHosts []*hosts.Host, dirName string, etcdFiles func(host *hosts.Host) []string) error {
+	return runOnHosts(uniqueHosts, c.hostWorkers(ParallelismDeployFiles), func(host *hosts.Host) error {
+		if host.IsWindows() {
+			return nil
+		}
+		cmd := []string{
+			"sh",
+			"-c",
+			c.getRestrictFilePermissionsScript(host, dirName, etcdFiles(host)),
+		}
+		log.Infof(ctx, "[%s] Restricting permissions of [%s] on node [%s]", ServiceName, dirName, host.Address)
+		if err := doRunFileDeployer(ctx, host, cmd, nil, c.SystemImages.Alpine, c.PrivateRegistriesMap, c.Version); err != nil {
+			return fmt.Errorf("[%s] Failed to restrict permissions of [%s] on node [%s]: %v", ServiceName, dirName, host.Address, err)
+		}
+		return nil
+	})
+}
+
+func (c *Cluster) getRestrictFilePermissionsScript(host *hosts.Host, dirName string, etcdFiles []string) string {
+	script := fmt.Sprintf("chown -R 0:0 %s && find %s -type f -exec chmod 600 {} +", dirName, dirName)
+	// etcd runs as the configured user, it must still be able to read its files
+	if host.IsEtcd && len(etcdFiles) > 0 && c.Services.Etcd.UID != 0 && c.Services.Etcd.GID != 0 {
+		script += fmt.Sprintf(" && chown %d:%d %s", c.Services.Etcd.UID, c.Services.Etcd.GID, strings.Join(etcdFiles, " "))
+	}
+	return script
+}
+
+// doRunFileDeployer runs cmd in a file deployer container with the /etc/kubernetes directory of the host mounted
+func doRunFileDeployer(ctx context.Context, host *hosts.Host, cmd, containerEnv []string, alpineImage string, prsMap map[string]v3.PrivateRegistry, k8sVersion string) error {
+	// remove existing container. Only way it's still here is if previous deployment failed
+	if err := docker.DoRemoveContainer(ctx, host.DClient, ContainerName, host.Address); err != nil {
+		return err
+	}
 	imageCfg := &container.Config{
 		Image: alpineImage,
 		Cmd:   cmd,
@@ -86,9 +125,5 @@ func doDeployFile(ctx context.Context, host *hosts.Host, fileName, fileContents,
 	if err := docker.DoRunOnetimeContainer(ctx, host.DClient, imageCfg, hostCfg, ContainerName, host.Address, ServiceName, prsMap); err != nil {
 		return err
 	}
-	if err := docker.DoRemoveContainer(ctx, host.DClient, ContainerName, host.Address); err != nil {
-		return err
-	}
-	logrus.Debugf("[%s] Successfully deployed file [%s] on node [%s]", ServiceName, fileName, host.Address)
-	return nil
+	return docker.DoRemoveContainer(ctx, host.DClient, ContainerName, host.Address)
 }
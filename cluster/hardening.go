@@ -0,0 +1,212 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/rancher/rke/addons"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	"github.com/rancher/rke/templates"
+	v3 "github.com/rancher/rke/types"
+)
+
+const (
+	HardeningAddonResourceName = "rke-hardening-addon"
+	HardeningAddonJobName      = HardeningAddonResourceName + "-deploy-job"
+)
+
+var hardeningProfileCISRegexp = regexp.MustCompile(`^cis-1\.[0-9]+$`)
+
+// HardeningControl is a control of the CIS Kubernetes benchmark enforced by a service argument
+type HardeningControl struct {
+	// ID of the control in the benchmark
+	ID string
+	// Service is the container name of the service the argument is passed to
+	Service string
+	Arg     string
+	// Value is the value the hardening profile sets
+	Value string
+	// Allowed reports whether a value satisfies the control, only Value does when it's nil
+	Allowed func(value string) bool
+	// LinuxOnly controls aren't applied on Windows hosts
+	LinuxOnly bool
+}
+
+// CISHardeningControls are the service arguments of the cis-1.x hardening profiles
+var CISHardeningControls = []HardeningControl{
+	{ID: "1.2.1", Service: services.KubeAPIContainerName, Arg: "anonymous-auth", Value: "false"},
+	{ID: "1.2.16", Service: services.KubeAPIContainerName, Arg: "profiling", Value: "false"},
+	{ID: "1.2.22", Service: services.KubeAPIContainerName, Arg: "service-account-lookup", Value: "true"},
+	{ID: "1.3.1", Service: services.KubeControllerContainerName, Arg: "terminated-pod-gc-threshold", Value: "1000", Allowed: isPositiveInteger},
+	{ID: "1.3.2", Service: services.KubeControllerContainerName, Arg: "profiling", Value: "false"},
+	{ID: "1.3.3", Service: services.KubeControllerContainerName, Arg: "use-service-account-credentials", Value: "true"},
+	{ID: "1.4.1", Service: services.SchedulerContainerName, Arg: "profiling", Value: "false"},
+	{ID: "4.2.1", Service: services.KubeletContainerName, Arg: "anonymous-auth", Value: "false"},
+	{ID: "4.2.2", Service: services.KubeletContainerName, Arg: "authorization-mode", Value: "Webhook", Allowed: func(value string) bool {
+		return value != "" && value != "AlwaysAllow"
+	}},
+	{ID: "4.2.4", Service: services.KubeletContainerName, Arg: "read-only-port", Value: "0"},
+	{ID: "4.2.5", Service: services.KubeletContainerName, Arg: "streaming-connection-idle-timeout", Value: "5m", Allowed: func(value string) bool {
+		timeout, err := time.ParseDuration(value)
+		return err == nil && timeout > 0
+	}},
+	{ID: "4.2.6", Service: services.KubeletContainerName, Arg: "protect-kernel-defaults", Value: "true", LinuxOnly: true},
+	{ID: "4.2.7", Service: services.KubeletContainerName, Arg: "make-iptables-util-chains", Value: "true", LinuxOnly: true},
+}
+
+// IsSatisfiedBy reports whether the argument value satisfies the control
+func (h HardeningControl) IsSatisfiedBy(value string) bool {
+	if h.Allowed != nil {
+		return h.Allowed(value)
+	}
+	return value == h.Value
+}
+
+func isPositiveInteger(value string) bool {
+	i, err := strconv.Atoi(value)
+	return err == nil && i > 0
+}
+
+// IsCISHardeningProfile reports whether profile is a cis-1.x hardening profile
+func IsCISHardeningProfile(profile string) bool {
+	return hardeningProfileCISRegexp.MatchString(profile)
+}
+
+// getHardeningControls returns the controls enforced by the hardening profile of the cluster
+func (c *Cluster) getHardeningControls() []HardeningControl {
+	if IsCISHardeningProfile(c.HardeningProfile) {
+		return CISHardeningControls
+	}
+	return nil
+}
+
+// applyHardeningProfile adds the arguments of the hardening profile to the service options, the options are copied as they are
+// shared by the clusters of the same version
+func (c *Cluster) applyHardeningProfile(osType string, serviceOptions v3.KubernetesServicesOptions) v3.KubernetesServicesOptions {
+	controls := c.getHardeningControls()
+	if len(controls) == 0 {
+		return serviceOptions
+	}
+	hardenedOptions := v3.KubernetesServicesOptions{}
+	for service, options := range map[string]struct {
+		from map[string]string
+		to   *map[string]string
+	}{
+		services.EtcdContainerName:           {serviceOptions.Etcd, &hardenedOptions.Etcd},
+		services.KubeAPIContainerName:        {serviceOptions.KubeAPI, &hardenedOptions.KubeAPI},
+		services.KubeletContainerName:        {serviceOptions.Kubelet, &hardenedOptions.Kubelet},
+		services.KubeproxyContainerName:      {serviceOptions.Kubeproxy, &hardenedOptions.Kubeproxy},
+		services.KubeControllerContainerName: {serviceOptions.KubeController, &hardenedOptions.KubeController},
+		services.SchedulerContainerName:      {serviceOptions.Scheduler, &hardenedOptions.Scheduler},
+	} {
+		args := map[string]string{}
+		for k, v := range options.from {
+			args[k] = v
+		}
+		for _, control := range controls {
+			if control.Service != service || (control.LinuxOnly && osType == "windows") {
+				continue
+			}
+			if !control.IsSatisfiedBy(args[control.Arg]) {
+				args[control.Arg] = control.Value
+			}
+		}
+		*options.to = args
+	}
+	return hardenedOptions
+}
+
+// getServiceExtraArgs returns the extra_args and the extra_args_array of the service named after its container
+func (c *Cluster) getServiceExtraArgs(service string) (map[string]string, map[string][]string) {
+	switch service {
+	case services.EtcdContainerName:
+		return c.Services.Etcd.ExtraArgs, c.Services.Etcd.ExtraArgsArray
+	case services.KubeAPIContainerName:
+		return c.Services.KubeAPI.ExtraArgs, c.Services.KubeAPI.ExtraArgsArray
+	case services.KubeletContainerName:
+		return c.Services.Kubelet.ExtraArgs, c.Services.Kubelet.ExtraArgsArray
+	case services.KubeproxyContainerName:
+		return c.Services.Kubeproxy.ExtraArgs, c.Services.Kubeproxy.ExtraArgsArray
+	case services.KubeControllerContainerName:
+		return c.Services.KubeController.ExtraArgs, c.Services.KubeController.ExtraArgsArray
+	case services.SchedulerContainerName:
+		return c.Services.Scheduler.ExtraArgs, c.Services.Scheduler.ExtraArgsArray
+	}
+	return nil, nil
+}
+
+// getWeakeningExtraArgs returns the user extra_args overriding an argument of the hardening profile with a value failing its control
+func (c *Cluster) getWeakeningExtraArgs() []string {
+	var weakening []string
+	for _, control := range c.getHardeningControls() {
+		extraArgs, extraArgsArray := c.getServiceExtraArgs(control.Service)
+		if value, ok := extraArgs[control.Arg]; ok && !control.IsSatisfiedBy(value) {
+			weakening = append(weakening, fmt.Sprintf("%s %s=%s (control %s)", control.Service, control.Arg, value, control.ID))
+		}
+		for _, value := range extraArgsArray[control.Arg] {
+			if !control.IsSatisfiedBy(value) {
+				weakening = append(weakening, fmt.Sprintf("%s %s=%s (control %s)", control.Service, control.Arg, value, control.ID))
+			}
+		}
+	}
+	return weakening
+}
+
+// getHardeningNetworkPolicyNamespaces returns the system namespaces isolated by the network policies of the hardening profile
+func (c *Cluster) getHardeningNetworkPolicyNamespaces() []string {
+	namespaces := []string{"kube-system"}
+	if c.Ingress.Provider != "none" {
+		namespaces = append(namespaces, NginxIngressAddonAppNamespace)
+	}
+	return namespaces
+}
+
+func (c *Cluster) deployHardeningAddon(ctx context.Context) error {
+	if c.HardeningProfile == "" {
+		addonJobExists, err := addons.AddonJobExists(HardeningAddonJobName, c.LocalKubeConfigPath, c.K8sWrapTransport)
+		if err != nil {
+			return nil
+		}
+		if addonJobExists {
+			log.Infof(ctx, "[hardening] Removing the network policies of the system namespaces")
+			if err := c.doAddonDelete(ctx, HardeningAddonResourceName, false); err != nil {
+				return err
+			}
+			log.Infof(ctx, "[hardening] Network policies of the system namespaces removed successfully")
+		}
+		return nil
+	}
+	log.Infof(ctx, "[hardening] Setting up the network policies of the system namespaces")
+	hardeningYaml, err := templates.CompileTemplateFromMap(templates.HardeningNetworkPolicyTemplate, map[string]interface{}{
+		"Namespaces": c.getHardeningNetworkPolicyNamespaces(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.doAddonDeploy(ctx, hardeningYaml, HardeningAddonResourceName, true); err != nil {
+		return err
+	}
+	log.Infof(ctx, "[hardening] Network policies of the system namespaces deployed successfully")
+	return nil
+}
+
+// restrictCertificatesPermissions makes the certificates, keys and kubeconfig files of the hosts readable by root only, except for
+// the etcd certificates when etcd runs as another user
+func (c *Cluster) restrictCertificatesPermissions(ctx context.Context, uniqueHosts []*hosts.Host) error {
+	if c.HardeningProfile == "" {
+		return nil
+	}
+	return c.restrictFilePermissions(ctx, uniqueHosts, pki.CertPathPrefix, getEtcdCertificateFiles)
+}
+
+// getEtcdCertificateFiles returns the certificate files etcd reads on the host
+func getEtcdCertificateFiles(host *hosts.Host) []string {
+	etcdCertName := pki.GetCrtNameForHost(host, pki.EtcdCertName)
+	return []string{pki.GetCertPath(pki.CACertName), pki.GetCertPath(etcdCertName), pki.GetKeyPath(etcdCertName)}
+}
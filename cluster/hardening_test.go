@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ghodssyaml "github.com/ghodss/yaml"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	"github.com/rancher/rke/templates"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestIsCISHardeningProfile(t *testing.T) {
+	assert.True(t, IsCISHardeningProfile("cis-1.24"))
+	assert.True(t, IsCISHardeningProfile("cis-1.6"))
+	assert.False(t, IsCISHardeningProfile("cis"))
+	assert.False(t, IsCISHardeningProfile("cis-2.0"))
+	assert.False(t, IsCISHardeningProfile(""))
+}
+
+func TestApplyHardeningProfile(t *testing.T) {
+	serviceOptions := v3.KubernetesServicesOptions{
+		KubeAPI: map[string]string{"profiling": "true", "secure-port": "6443"},
+		Kubelet: map[string]string{"authorization-mode": "Webhook", "streaming-connection-idle-timeout": "30m"},
+	}
+	c := &Cluster{}
+	assert.Equal(t, serviceOptions, c.applyHardeningProfile("linux", serviceOptions))
+
+	c.HardeningProfile = "cis-1.24"
+	hardenedOptions := c.applyHardeningProfile("linux", serviceOptions)
+	assert.Equal(t, "false", hardenedOptions.KubeAPI["profiling"])
+	assert.Equal(t, "6443", hardenedOptions.KubeAPI["secure-port"])
+	assert.Equal(t, "false", hardenedOptions.Scheduler["profiling"])
+	assert.Equal(t, "1000", hardenedOptions.KubeController["terminated-pod-gc-threshold"])
+	assert.Equal(t, "0", hardenedOptions.Kubelet["read-only-port"])
+	assert.Equal(t, "true", hardenedOptions.Kubelet["protect-kernel-defaults"])
+	// values satisfying the controls are kept
+	assert.Equal(t, "30m", hardenedOptions.Kubelet["streaming-connection-idle-timeout"])
+	// the options shared by the clusters of the version are unchanged
+	assert.Equal(t, "true", serviceOptions.KubeAPI["profiling"])
+	assert.NotContains(t, serviceOptions.Kubelet, "read-only-port")
+
+	// the etcd arguments are only audited
+	assert.Empty(t, hardenedOptions.Etcd)
+
+	hardenedOptions = c.applyHardeningProfile("windows", serviceOptions)
+	assert.Equal(t, "0", hardenedOptions.Kubelet["read-only-port"])
+	assert.NotContains(t, hardenedOptions.Kubelet, "protect-kernel-defaults")
+	assert.NotContains(t, hardenedOptions.Kubelet, "make-iptables-util-chains")
+}
+
+func TestValidateHardeningProfile(t *testing.T) {
+	ctx := context.Background()
+	c := &Cluster{}
+	c.Network.Plugin = CanalNetworkPlugin
+	assert.NoError(t, validateHardeningProfile(ctx, c))
+
+	c.HardeningProfile = "cis-2"
+	assert.ErrorContains(t, validateHardeningProfile(ctx, c), "hardening profile [cis-2] is not supported")
+
+	c.HardeningProfile = "cis-1.24"
+	c.Services.Kubelet.ExtraArgs = map[string]string{"streaming-connection-idle-timeout": "1h", "max-pods": "200"}
+	assert.NoError(t, validateHardeningProfile(ctx, c))
+
+	c.Services.KubeAPI.ExtraArgs = map[string]string{"anonymous-auth": "true"}
+	c.Services.Kubelet.ExtraArgsArray = map[string][]string{"read-only-port": {"10255"}}
+	err := validateHardeningProfile(ctx, c)
+	assert.ErrorContains(t, err, services.KubeAPIContainerName+" anonymous-auth=true (control 1.2.1)")
+	assert.ErrorContains(t, err, services.KubeletContainerName+" read-only-port=10255 (control 4.2.4)")
+}
+
+func TestHardeningNetworkPolicies(t *testing.T) {
+	c := &Cluster{}
+	c.Ingress.Provider = "nginx"
+	assert.Equal(t, []string{"kube-system", NginxIngressAddonAppNamespace}, c.getHardeningNetworkPolicyNamespaces())
+	manifest, err := templates.CompileTemplateFromMap(templates.HardeningNetworkPolicyTemplate, map[string]interface{}{
+		"Namespaces": c.getHardeningNetworkPolicyNamespaces(),
+	})
+	assert.NoError(t, err)
+	policies := map[string][]string{}
+	for _, doc := range strings.Split(manifest, "\n---\n") {
+		var policy networkingv1.NetworkPolicy
+		assert.NoError(t, ghodssyaml.Unmarshal([]byte(doc), &policy))
+		assert.Equal(t, "NetworkPolicy", policy.Kind)
+		policies[policy.Namespace] = append(policies[policy.Namespace], policy.Name)
+	}
+	assert.Equal(t, []string{"default-deny-ingress", "allow-same-namespace", "allow-dns", "allow-metrics-server"}, policies["kube-system"])
+	assert.Equal(t, []string{"default-deny-ingress", "allow-same-namespace", "allow-ingress-nginx"}, policies[NginxIngressAddonAppNamespace])
+
+	c.Ingress.Provider = "none"
+	assert.Equal(t, []string{"kube-system"}, c.getHardeningNetworkPolicyNamespaces())
+}
+
+func TestRestrictFilePermissionsScript(t *testing.T) {
+	c := &Cluster{}
+	host := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}, IsEtcd: true}
+	etcdFiles := getEtcdCertificateFiles(host)
+	assert.Equal(t, []string{"/etc/kubernetes/ssl/kube-ca.pem", "/etc/kubernetes/ssl/kube-etcd-1-1-1-1.pem", "/etc/kubernetes/ssl/kube-etcd-1-1-1-1-key.pem"}, etcdFiles)
+
+	restrict := "chown -R 0:0 /etc/kubernetes/ssl/ && find /etc/kubernetes/ssl/ -type f -exec chmod 600 {} +"
+	assert.Equal(t, restrict, c.getRestrictFilePermissionsScript(host, pki.CertPathPrefix, etcdFiles))
+
+	c.Services.Etcd.UID = 52034
+	c.Services.Etcd.GID = 52035
+	assert.Equal(t, restrict+" && chown 52034:52035 "+strings.Join(etcdFiles, " "), c.getRestrictFilePermissionsScript(host, pki.CertPathPrefix, etcdFiles))
+
+	host.IsEtcd = false
+	assert.Equal(t, restrict, c.getRestrictFilePermissionsScript(host, pki.CertPathPrefix, getEtcdCertificateFiles(host)))
+}
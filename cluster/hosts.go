@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/docker/docker/api/types"
 	"github.com/rancher/rke/hosts"
@@ -11,9 +12,7 @@ import (
 	"github.com/rancher/rke/pki"
 	"github.com/rancher/rke/services"
 	v3 "github.com/rancher/rke/types"
-	"github.com/rancher/rke/util"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
 	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
 	"sigs.k8s.io/yaml"
 )
@@ -35,22 +34,21 @@ func (c *Cluster) TunnelHosts(ctx context.Context, flags ExternalFlags) error {
 	}
 	c.InactiveHosts = make([]*hosts.Host, 0)
 	uniqueHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
-	var errgrp errgroup.Group
-	for _, uniqueHost := range uniqueHosts {
-		runHost := uniqueHost
-		errgrp.Go(func() error {
-			if err := runHost.TunnelUp(ctx, c.DockerDialerFactory, c.getPrefixPath(runHost.OS()), c.Version); err != nil {
-				// Unsupported Docker version is NOT a connectivity problem that we can recover! So we bail out on it
-				if strings.Contains(err.Error(), "Unsupported Docker version found") {
-					return err
-				}
-				log.Warnf(ctx, "Failed to set up SSH tunneling for host [%s]: %v", runHost.Address, err)
-				c.InactiveHosts = append(c.InactiveHosts, runHost)
+	var inactiveHostsLock sync.Mutex
+	err := runOnHosts(uniqueHosts, c.hostWorkers(ParallelismTunnelHosts), func(runHost *hosts.Host) error {
+		if err := runHost.TunnelUp(ctx, c.DockerDialerFactory, c.CommandRunnerFactory, c.getPrefixPath(runHost.OS()), c.Version); err != nil {
+			// Unsupported Docker version is NOT a connectivity problem that we can recover! So we bail out on it
+			if strings.Contains(err.Error(), "Unsupported Docker version found") {
+				return err
 			}
-			return nil
-		})
-	}
-	if err := errgrp.Wait(); err != nil {
+			log.Warnf(ctx, "Failed to set up SSH tunneling for host [%s]: %v", runHost.Address, err)
+			inactiveHostsLock.Lock()
+			c.InactiveHosts = append(c.InactiveHosts, runHost)
+			inactiveHostsLock.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 	for _, host := range c.InactiveHosts {
@@ -63,6 +61,20 @@ func (c *Cluster) TunnelHosts(ctx context.Context, flags ExternalFlags) error {
 	return ValidateHostCount(c)
 }
 
+// setAgentTunnelServer sets the server of the tunnels opened by the node agents of the nodes with connection_type agent
+func (c *Cluster) setAgentTunnelServer() {
+	var agentNodes []string
+	for _, node := range c.Nodes {
+		if node.ConnectionType == hosts.ConnectionTypeAgent {
+			agentNodes = append(agentNodes, node.Address)
+		}
+	}
+	if len(agentNodes) == 0 || c.AgentTunnel == nil {
+		return
+	}
+	c.AgentTunnelServer = hosts.GetAgentTunnelServer(*c.AgentTunnel, agentNodes)
+}
+
 func (c *Cluster) InvertIndexHosts() error {
 	c.EtcdHosts = make([]*hosts.Host, 0)
 	c.WorkerHosts = make([]*hosts.Host, 0)
@@ -84,10 +96,16 @@ func (c *Cluster) InvertIndexHosts() error {
 		if c.IgnoreDockerVersion != nil {
 			newHost.IgnoreDockerVersion = *c.IgnoreDockerVersion
 		}
-		if c.BastionHost.Address != "" {
+		if host.ConnectionType == hosts.ConnectionTypeAgent {
+			// the node agent opens the tunnel of the host, bastion hosts aren't used
+			newHost.AgentTunnel = c.AgentTunnelServer
+		} else if host.BastionHost != nil {
+			newHost.BastionHost = *host.BastionHost
+		} else if c.BastionHost.Address != "" {
 			// Add the bastion host information to each host object
 			newHost.BastionHost = c.BastionHost
 		}
+		newHost.HostKeyVerifier = c.HostKeyVerifier
 		for _, role := range host.Role {
 			logrus.Debugf("Host: " + host.Address + " has role: " + role)
 			switch role {
@@ -232,34 +250,27 @@ func (c *Cluster) SetUpHosts(ctx context.Context, flags ExternalFlags) error {
 	if c.AuthnStrategies[AuthnX509Provider] {
 		log.Infof(ctx, "[certificates] Deploying kubernetes certificates to Cluster nodes")
 		hostList := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
-		var errgrp errgroup.Group
-		hostsQueue := util.GetObjectQueue(hostList)
-		for w := 0; w < WorkerThreads; w++ {
-			errgrp.Go(func() error {
-				var errList []error
-				for host := range hostsQueue {
-					h := host.(*hosts.Host)
-					var env []string
-					if h.IsWindows() {
-						env = c.getWindowsEnv(h)
-					}
-					if err := pki.DeployCertificatesOnPlaneHost(
-						ctx,
-						h,
-						c.RancherKubernetesEngineConfig,
-						c.Certificates,
-						c.SystemImages.CertDownloader,
-						c.PrivateRegistriesMap,
-						c.ForceDeployCerts,
-						env,
-						c.Version); err != nil {
-						errList = append(errList, err)
-					}
-				}
-				return util.ErrList(errList)
-			})
+		err := runOnHosts(hostList, c.hostWorkers(ParallelismDeployCertificates), func(h *hosts.Host) error {
+			var env []string
+			if h.IsWindows() {
+				env = c.getWindowsEnv(h)
+			}
+			return pki.DeployCertificatesOnPlaneHost(
+				ctx,
+				h,
+				c.RancherKubernetesEngineConfig,
+				c.Certificates,
+				c.SystemImages.CertDownloader,
+				c.PrivateRegistriesMap,
+				c.ForceDeployCerts,
+				env,
+				c.Version)
+		})
+		if err != nil {
+			return err
 		}
-		if err := errgrp.Wait(); err != nil {
+
+		if err := c.restrictCertificatesPermissions(ctx, hostList); err != nil {
 			return err
 		}
 
@@ -268,14 +279,14 @@ func (c *Cluster) SetUpHosts(ctx context.Context, flags ExternalFlags) error {
 		}
 		log.Infof(ctx, "[certificates] Successfully deployed kubernetes certificates to Cluster nodes")
 		if c.CloudProvider.Name != "" {
-			if err := deployFile(ctx, hostList, c.SystemImages.Alpine, c.PrivateRegistriesMap, cloudConfigFileName, c.CloudConfigFile, c.Version); err != nil {
+			if err := c.deployFile(ctx, hostList, cloudConfigFileName, c.CloudConfigFile); err != nil {
 				return err
 			}
 			log.Infof(ctx, "[%s] Successfully deployed kubernetes cloud config to Cluster nodes", cloudConfigFileName)
 		}
 
 		if c.Authentication.Webhook != nil {
-			if err := deployFile(ctx, hostList, c.SystemImages.Alpine, c.PrivateRegistriesMap, authnWebhookFileName, c.Authentication.Webhook.ConfigFile, c.Version); err != nil {
+			if err := c.deployFile(ctx, hostList, authnWebhookFileName, c.Authentication.Webhook.ConfigFile); err != nil {
 				return err
 			}
 			log.Infof(ctx, "[%s] Successfully deployed authentication webhook config Cluster nodes", authnWebhookFileName)
@@ -296,7 +307,7 @@ func (c *Cluster) SetUpHosts(ctx context.Context, flags ExternalFlags) error {
 			if err != nil {
 				return err
 			}
-			err = deployFile(ctx, controlPlaneHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap, DefaultKubeAPIArgAdmissionControlConfigFileValue, string(bytes), c.Version)
+			err = c.deployFile(ctx, controlPlaneHosts, DefaultKubeAPIArgAdmissionControlConfigFileValue, string(bytes))
 			if err != nil {
 				return err
 			}
@@ -310,7 +321,7 @@ func (c *Cluster) SetUpHosts(ctx context.Context, flags ExternalFlags) error {
 				if err != nil {
 					return err
 				}
-				if err := deployFile(ctx, controlPlaneHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap, DefaultKubeAPIArgAuditPolicyFileValue, string(bytes), c.Version); err != nil {
+				if err := c.deployFile(ctx, controlPlaneHosts, DefaultKubeAPIArgAuditPolicyFileValue, string(bytes)); err != nil {
 					return err
 				}
 				log.Infof(ctx, "[%s] Successfully deployed audit policy file to Cluster control nodes", DefaultKubeAPIArgAuditPolicyFileValue)
@@ -36,6 +36,8 @@ const (
 	EtcdPort2        = "2380"
 	KubeletPort      = "10250"
 	FlannelVxLanPort = 8472
+	CiliumHealthPort = "4240"
+	CiliumHubblePort = "4244"
 
 	FlannelVxLanNetworkIdentify = 1
 
@@ -75,6 +77,18 @@ const (
 	WeaveNetworkAppName              = "weave-net"
 	WeaveNetPriorityClassNameKeyName = "weave_net_priority_class_name"
 
+	CiliumNetworkPlugin            = "cilium"
+	CiliumKubeProxyReplacement     = "cilium_kube_proxy_replacement"
+	CiliumTunnelProtocol           = "cilium_tunnel_protocol"
+	CiliumIPAMMode                 = "cilium_ipam_mode"
+	CiliumEnableHubble             = "cilium_enable_hubble"
+	CiliumPriorityClassNameKeyName = "cilium_priority_class_name"
+	CiliumTunnelProtocolVxLan      = "vxlan"
+	CiliumTunnelProtocolGeneve     = "geneve"
+	CiliumTunnelProtocolDisabled   = "disabled"
+	CiliumIPAMModeKubernetes       = "kubernetes"
+	CiliumIPAMModeClusterPool      = "cluster-pool"
+
 	AciNetworkPlugin                        = "aci"
 	AciOVSMemoryLimit                       = "aci_ovs_memory_limit"
 	AciOVSMemoryRequest                     = "aci_ovs_memory_request"
@@ -210,7 +224,9 @@ const (
 
 	KubeCfg = "KubeCfg"
 
-	ClusterCIDR = "ClusterCIDR"
+	ClusterCIDR     = "ClusterCIDR"
+	ClusterCIDRIPv4 = "ClusterCIDRIPv4"
+	ClusterCIDRIPv6 = "ClusterCIDRIPv6"
 	// Images key names
 
 	Image              = "Image"
@@ -220,6 +236,7 @@ const (
 	CanalFlannelImg    = "CanalFlannelImg"
 	FlexVolImg         = "FlexVolImg"
 	WeaveLoopbackImage = "WeaveLoopbackImage"
+	OperatorImage      = "OperatorImage"
 
 	Calicoctl = "Calicoctl"
 
@@ -233,6 +250,13 @@ const (
 	FlexVolPluginDir                       = "FlexVolPluginDir"
 	WeavePassword                          = "WeavePassword"
 	WeaveNetPriorityClassName              = "WeaveNetPriorityClassName"
+	CiliumPriorityClassName                = "CiliumPriorityClassName"
+	KubeProxyReplacement                   = "KubeProxyReplacement"
+	TunnelProtocol                         = "TunnelProtocol"
+	IPAMMode                               = "IPAMMode"
+	EnableHubble                           = "EnableHubble"
+	K8sServiceHost                         = "K8sServiceHost"
+	K8sServicePort                         = "K8sServicePort"
 	MTU                                    = "MTU"
 	RBACConfig                             = "RBACConfig"
 	ClusterVersion                         = "ClusterVersion"
@@ -401,8 +425,12 @@ var EtcdClientPortList = []string{
 	EtcdPort1,
 }
 
+var CiliumPortList = []string{
+	CiliumHealthPort,
+}
+
 var CalicoNetworkLabels = []string{CalicoNodeLabel, CalicoControllerLabel}
-var IPv6CompatibleNetworkPlugins = []string{CalicoNetworkPlugin, AciNetworkPlugin}
+var IPv6CompatibleNetworkPlugins = []string{CalicoNetworkPlugin, AciNetworkPlugin, CiliumNetworkPlugin}
 
 func (c *Cluster) deployNetworkPlugin(ctx context.Context, data map[string]interface{}) error {
 	log.Infof(ctx, "[network] Setting up network plugin: %s", c.Network.Plugin)
@@ -417,6 +445,8 @@ func (c *Cluster) deployNetworkPlugin(ctx context.Context, data map[string]inter
 		return c.doWeaveDeploy(ctx, data)
 	case AciNetworkPlugin:
 		return c.doAciDeploy(ctx, data)
+	case CiliumNetworkPlugin:
+		return c.doCiliumDeploy(ctx, data)
 	case NoNetworkPlugin:
 		log.Infof(ctx, "[network] Not deploying a cluster network, expecting custom CNI")
 		return nil
@@ -563,6 +593,57 @@ func (c *Cluster) doWeaveDeploy(ctx context.Context, data map[string]interface{}
 	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName, true)
 }
 
+func (c *Cluster) doCiliumDeploy(ctx context.Context, data map[string]interface{}) error {
+	pluginYaml, err := c.getNetworkPluginManifest(c.getCiliumConfig(), data)
+	if err != nil {
+		return err
+	}
+	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName, true)
+}
+
+func (c *Cluster) getCiliumConfig() map[string]interface{} {
+	ipv4CIDRs, ipv6CIDRs, _ := getCIDRsByFamily(c.ClusterCIDR)
+	return map[string]interface{}{
+		ClusterCIDR:          c.ClusterCIDR,
+		ClusterCIDRIPv4:      strings.Join(ipv4CIDRs, ","),
+		ClusterCIDRIPv6:      strings.Join(ipv6CIDRs, ","),
+		Image:                c.SystemImages.Cilium,
+		OperatorImage:        c.SystemImages.CiliumOperator,
+		KubeProxyReplacement: strconv.FormatBool(c.isKubeProxyReplaced()),
+		TunnelProtocol:       c.Network.Options[CiliumTunnelProtocol],
+		IPAMMode:             c.Network.Options[CiliumIPAMMode],
+		EnableHubble:         c.Network.Options[CiliumEnableHubble],
+		// the kube-apiserver on the control plane hosts and the nginx proxy on the other hosts listen on the local port
+		K8sServiceHost: "127.0.0.1",
+		K8sServicePort: KubeAPIPort,
+		RBACConfig:     c.Authorization.Mode,
+		NodeSelector:   c.Network.NodeSelector,
+		MTU:            c.Network.MTU,
+		UpdateStrategy: &appsv1.DaemonSetUpdateStrategy{
+			Type:          c.Network.UpdateStrategy.Strategy,
+			RollingUpdate: c.Network.UpdateStrategy.RollingUpdate,
+		},
+		CiliumPriorityClassName: c.Network.Options[CiliumPriorityClassNameKeyName],
+	}
+}
+
+// isKubeProxyReplaced returns true when the network plugin replaces kube-proxy, kube-proxy isn't deployed on the hosts
+func (c *Cluster) isKubeProxyReplaced() bool {
+	return c.Network.Plugin == CiliumNetworkPlugin && c.Network.Options[CiliumKubeProxyReplacement] == "true"
+}
+
+// getNetworkPluginPortList returns the ports the network plugin listens on the worker hosts
+func (c *Cluster) getNetworkPluginPortList() []string {
+	if c.Network.Plugin != CiliumNetworkPlugin {
+		return nil
+	}
+	portList := append([]string{}, CiliumPortList...)
+	if c.Network.Options[CiliumEnableHubble] == "true" {
+		portList = append(portList, CiliumHubblePort)
+	}
+	return portList
+}
+
 func (c *Cluster) doAciDeploy(ctx context.Context, data map[string]interface{}) error {
 	var podIPPool []IPPool
 	var podNetwork []PodIPNetwork
@@ -769,7 +850,7 @@ func (c *Cluster) doAciDeploy(ctx context.Context, data map[string]interface{})
 
 func (c *Cluster) getNetworkPluginManifest(pluginConfig, data map[string]interface{}) (string, error) {
 	switch c.Network.Plugin {
-	case CanalNetworkPlugin, FlannelNetworkPlugin, CalicoNetworkPlugin, WeaveNetworkPlugin, AciNetworkPlugin:
+	case CanalNetworkPlugin, FlannelNetworkPlugin, CalicoNetworkPlugin, WeaveNetworkPlugin, AciNetworkPlugin, CiliumNetworkPlugin:
 		tmplt, err := templates.GetVersionedTemplates(c.Network.Plugin, data, c.Version)
 		if err != nil {
 			return "", err
@@ -815,7 +896,7 @@ func (c *Cluster) checkKubeAPIPort(ctx context.Context) error {
 	log.Infof(ctx, "[network] Checking KubeAPI port Control Plane hosts")
 	for _, host := range c.ControlPlaneHosts {
 		logrus.Debugf("[network] Checking KubeAPI port [%s] on host: %s", KubeAPIPort, host.Address)
-		address := fmt.Sprintf("%s:%s", host.Address, KubeAPIPort)
+		address := net.JoinHostPort(host.Address, KubeAPIPort)
 		conn, err := net.Dial("tcp", address)
 		if err != nil {
 			return fmt.Errorf("[network] Can't access KubeAPI port [%s] on Control Plane host: %s", KubeAPIPort, host.Address)
@@ -839,7 +920,7 @@ func (c *Cluster) deployTCPPortListeners(ctx context.Context, currentCluster *Cl
 	}
 
 	// deploy worker listeners
-	if err := c.deployListenerOnPlane(ctx, WorkerPortList, c.WorkerHosts, WorkerPortListenContainer); err != nil {
+	if err := c.deployListenerOnPlane(ctx, append(c.getNetworkPluginPortList(), WorkerPortList...), c.WorkerHosts, WorkerPortListenContainer); err != nil {
 		return err
 	}
 	log.Infof(ctx, "[network] Port listener containers deployed successfully")
@@ -1006,6 +1087,28 @@ func (c *Cluster) runServicePortChecks(ctx context.Context) error {
 			return util.ErrList(errList)
 		})
 	}
+	if err := errgrp.Wait(); err != nil {
+		return err
+	}
+	// check workers -> workers for the network plugin
+	pluginPortList := c.getNetworkPluginPortList()
+	if len(pluginPortList) == 0 || len(c.WorkerHosts) < 2 {
+		return nil
+	}
+	log.Infof(ctx, "[network] Running workers -> workers %s port checks", c.Network.Plugin)
+	hostsQueue = util.GetObjectQueue(c.WorkerHosts)
+	for w := 0; w < WorkerThreads; w++ {
+		errgrp.Go(func() error {
+			var errList []error
+			for host := range hostsQueue {
+				err := checkPlaneTCPPortsFromHost(ctx, host.(*hosts.Host), pluginPortList, c.WorkerHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap)
+				if err != nil {
+					errList = append(errList, err)
+				}
+			}
+			return util.ErrList(errList)
+		})
+	}
 	return errgrp.Wait()
 }
 
@@ -1064,13 +1167,45 @@ func checkPlaneTCPPortsFromHost(ctx context.Context, host *hosts.Host, portList
 func getPortBindings(hostAddress string, portList []string) []nat.PortBinding {
 	portBindingList := []nat.PortBinding{}
 	for _, portNumber := range portList {
-		rawPort := fmt.Sprintf("%s:%s:1337/tcp", hostAddress, portNumber)
+		// IPv6 addresses are bracketed, nat.ParsePortSpec splits the spec on colons
+		rawPort := fmt.Sprintf("%s:1337/tcp", net.JoinHostPort(hostAddress, portNumber))
 		portMapping, _ := nat.ParsePortSpec(rawPort)
 		portBindingList = append(portBindingList, portMapping[0].Binding)
 	}
 	return portBindingList
 }
 
+// getCIDRsByFamily splits comma separated CIDRs into the IPv4 and the IPv6 CIDRs
+func getCIDRsByFamily(cidrs string) ([]string, []string, error) {
+	var ipv4CIDRs, ipv6CIDRs []string
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR [%s]: %v", cidr, err)
+		}
+		if ip.To4() != nil {
+			ipv4CIDRs = append(ipv4CIDRs, cidr)
+		} else {
+			ipv6CIDRs = append(ipv6CIDRs, cidr)
+		}
+	}
+	return ipv4CIDRs, ipv6CIDRs, nil
+}
+
+// getClusterDNSServerFromRange returns the tenth address of the first service cluster IP range, like 10.43.0.10 in the default range
+func getClusterDNSServerFromRange(serviceClusterIPRange string) string {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(strings.Split(serviceClusterIPRange, ",")[0]))
+	if err != nil {
+		return ""
+	}
+	ip, err := cidr.Host(ipNet, 10)
+	if err != nil {
+		return ""
+	}
+	return ip.String()
+}
+
 func atoiWithDefault(val string, defaultVal int) (int, error) {
 	if val == "" {
 		return defaultVal, nil
@@ -0,0 +1,403 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rancher/rke/addons"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/services"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	NetworkMigrationCleanerContainer = "rke-network-migration-cleaner"
+	NetworkMigrationCheckPodPrefix   = "rke-network-migration-check-"
+	NetworkMigrationCheckAppName     = "rke-network-migration-check"
+	// NetworkMigrationCheckRegistrySecret holds the credentials of the private registry of the check pod image
+	NetworkMigrationCheckRegistrySecret = "rke-network-migration-check-registry"
+
+	// networkMigrationCheckScript reaches the API server through the kubernetes service, IPv6 service hosts are bracketed, then pings
+	// the pod of another node when PROBE_POD_IP is set
+	networkMigrationCheckScript = `host="${KUBERNETES_SERVICE_HOST}"
+case "$host" in *:*) host="[$host]" ;; esac
+until curl -sk --max-time 10 -o /dev/null "https://${host}:${KUBERNETES_SERVICE_PORT}/healthz"; do sleep 5; done
+if [ -n "${PROBE_POD_IP}" ]; then
+  until ping -c 1 -W 5 "${PROBE_POD_IP}" >/dev/null; do sleep 5; done
+fi`
+
+	// networkMigrationCheckTimeout leaves time to the new network plugin to start on the host before the connectivity check fails
+	networkMigrationCheckTimeout = 300
+)
+
+// NetworkPluginMigration records a network plugin migration in the cluster state until every host runs the new plugin, so a failed
+// migration is completed by the next rke up
+type NetworkPluginMigration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Deployed is set once the addon resources of the old plugin are removed and the new plugin is deployed
+	Deployed bool `json:"deployed,omitempty"`
+}
+
+// networkMigrationProgress tracks the nodes being migrated and the migrated nodes, the connectivity of a migrated node is checked
+// against a pod of a node that isn't being migrated
+type networkMigrationProgress struct {
+	lock      sync.Mutex
+	migrating map[string]bool
+	migrated  map[string]bool
+}
+
+func newNetworkMigrationProgress() *networkMigrationProgress {
+	return &networkMigrationProgress{
+		migrating: map[string]bool{},
+		migrated:  map[string]bool{},
+	}
+}
+
+func (p *networkMigrationProgress) start(nodeName string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.migrating[nodeName] = true
+}
+
+func (p *networkMigrationProgress) done(nodeName string, migrated bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.migrating, nodeName)
+	p.migrated[nodeName] = migrated
+}
+
+// selectProbeTarget returns a running pod with its own IP on another node than nodeName that isn't being migrated, pods on nodes
+// that aren't migrated yet are preferred. It returns nil if there is none.
+func (p *networkMigrationProgress) selectProbeTarget(pods []v1.Pod, nodeName string) *v1.Pod {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var target *v1.Pod
+	for i, pod := range pods {
+		if pod.Spec.NodeName == nodeName || p.migrating[pod.Spec.NodeName] || pod.Spec.HostNetwork || len(pod.Status.PodIP) == 0 || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		if !p.migrated[pod.Spec.NodeName] {
+			return &pods[i]
+		}
+		if target == nil {
+			target = &pods[i]
+		}
+	}
+	return target
+}
+
+// MigratableNetworkPlugins are the network plugins a cluster can be migrated from and to
+var MigratableNetworkPlugins = []string{FlannelNetworkPlugin, CanalNetworkPlugin, CalicoNetworkPlugin, WeaveNetworkPlugin, CiliumNetworkPlugin}
+
+// networkPluginPodLabels select the pods of each network plugin that run on every host
+var networkPluginPodLabels = map[string]string{
+	FlannelNetworkPlugin: fmt.Sprintf("%s=%s", KubeAppLabel, FlannelNetworkPlugin),
+	CanalNetworkPlugin:   fmt.Sprintf("%s=%s", KubeAppLabel, CanalNetworkPlugin),
+	CalicoNetworkPlugin:  fmt.Sprintf("%s=%s", KubeAppLabel, CalicoNodeLabel),
+	WeaveNetworkPlugin:   fmt.Sprintf("%s=%s", NameLabel, WeaveNetworkAppName),
+	CiliumNetworkPlugin:  fmt.Sprintf("%s=%s", KubeAppLabel, CiliumNetworkPlugin),
+}
+
+// networkPluginHostFiles are the CNI configurations and the state each network plugin leaves on the hosts
+var networkPluginHostFiles = map[string][]string{
+	FlannelNetworkPlugin: {"/etc/cni/net.d/10-flannel.conflist"},
+	CanalNetworkPlugin:   {"/etc/cni/net.d/10-canal.conflist", "/etc/cni/net.d/calico-kubeconfig", "/run/calico", "/var/lib/calico"},
+	CalicoNetworkPlugin:  {"/etc/cni/net.d/10-calico.conflist", "/etc/cni/net.d/calico-kubeconfig", "/run/calico", "/var/lib/calico"},
+	WeaveNetworkPlugin:   {"/etc/cni/net.d/10-weave.conflist", "/var/lib/weave"},
+	CiliumNetworkPlugin:  {"/etc/cni/net.d/05-cilium.conflist", "/run/cilium"},
+}
+
+// networkPluginHostInterfaces are the network interfaces each network plugin creates on the hosts
+var networkPluginHostInterfaces = map[string][]string{
+	FlannelNetworkPlugin: {"flannel.1", "cni0"},
+	CanalNetworkPlugin:   {"flannel.1", "vxlan.calico"},
+	CalicoNetworkPlugin:  {"vxlan.calico"},
+	WeaveNetworkPlugin:   {"weave", "datapath", "vxlan-6784"},
+	CiliumNetworkPlugin:  {"cilium_host", "cilium_vxlan", "cilium_geneve"},
+}
+
+// SetNetworkPluginMigration records a migration to the network plugin of the cluster in the current state when the plugin changed
+// since the last rke up or when a previous migration didn't complete
+func (c *Cluster) SetNetworkPluginMigration(ctx context.Context, currentCluster *Cluster, fullState *FullState) error {
+	migration := fullState.CurrentState.NetworkPluginMigration
+	if migration == nil {
+		if currentCluster == nil || currentCluster.Network.Plugin == c.Network.Plugin {
+			return nil
+		}
+		migration = &NetworkPluginMigration{From: currentCluster.Network.Plugin}
+	}
+	if err := validateNetworkPluginMigration(migration.From, c.Network.Plugin); err != nil {
+		return err
+	}
+	for _, host := range hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts) {
+		if host.IsWindows() {
+			return fmt.Errorf("Network plugin can't be migrated in a cluster with Windows host [%s]", host.Address)
+		}
+	}
+	if migration.To != c.Network.Plugin {
+		// the plugin changed again before the previous migration completed, the last deployed plugin is replaced
+		migration.To = c.Network.Plugin
+		migration.Deployed = false
+	}
+	log.Infof(ctx, "[network] Network plugin will be migrated from [%s] to [%s]", migration.From, migration.To)
+	fullState.CurrentState.NetworkPluginMigration = migration
+	return nil
+}
+
+func validateNetworkPluginMigration(from, to string) error {
+	var fromSupported, toSupported bool
+	for _, plugin := range MigratableNetworkPlugins {
+		fromSupported = fromSupported || plugin == from
+		toSupported = toSupported || plugin == to
+	}
+	if !fromSupported || !toSupported {
+		return fmt.Errorf("Network plugin can't be migrated from [%s] to [%s], supported network plugins: %s", from, to, strings.Join(MigratableNetworkPlugins, ", "))
+	}
+	return nil
+}
+
+// MigrateNetworkPlugin replaces the network plugin recorded in the network plugin migration of the current state. The addon resources of the
+// old plugin are removed and the new plugin is deployed, then the hosts are drained and cleaned from the old plugin one batch at a time.
+// The pod connectivity is verified on every host of a batch before moving to the next one.
+func (c *Cluster) MigrateNetworkPlugin(ctx context.Context, fullState *FullState, data map[string]interface{}) error {
+	migration := fullState.CurrentState.NetworkPluginMigration
+	if migration == nil {
+		return nil
+	}
+	log.Infof(ctx, "[network] Migrating network plugin from [%s] to [%s]", migration.From, migration.To)
+	if !migration.Deployed {
+		addonJobExists, err := addons.AddonJobExists(NetworkPluginResourceName+"-deploy-job", c.LocalKubeConfigPath, c.K8sWrapTransport)
+		if err != nil {
+			return err
+		}
+		if addonJobExists {
+			log.Infof(ctx, "[network] Removing the resources of the previous network plugin")
+			if err := c.doAddonDelete(ctx, NetworkPluginResourceName, true); err != nil {
+				return err
+			}
+		}
+		if err := c.deployNetworkPlugin(ctx, data); err != nil {
+			return err
+		}
+		migration.Deployed = true
+		if err := fullState.WriteStateFile(ctx, c.StateFilePath); err != nil {
+			return err
+		}
+	}
+
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sWrapTransport)
+	if err != nil {
+		return fmt.Errorf("failed to initialize new kubernetes client: %v", err)
+	}
+	var controlAndEtcdHosts, workerOnlyHosts []*hosts.Host
+	for _, host := range hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts) {
+		if c.Checkpoints.IsHostCompleted(CheckpointPhaseNetworkMigration, host.Address) {
+			log.Infof(ctx, "[network] Network plugin already migrated on host [%s], skipping", host.Address)
+			continue
+		}
+		if host.IsControl || host.IsEtcd {
+			controlAndEtcdHosts = append(controlAndEtcdHosts, host)
+		} else {
+			workerOnlyHosts = append(workerOnlyHosts, host)
+		}
+	}
+	if c.Checkpoints != nil {
+		ctx = services.WithHostRecorder(ctx, c.Checkpoints.HostRecorder(CheckpointPhaseNetworkMigration))
+	}
+	pullSecrets, err := c.applyNetworkMigrationRegistrySecret(kubeClient)
+	if err != nil {
+		return err
+	}
+	progress := newNetworkMigrationProgress()
+	migrateHost := func(host *hosts.Host) error {
+		return c.migrateHostNetworkPlugin(ctx, kubeClient, host, progress, pullSecrets)
+	}
+	// hosts with the etcd or controlplane role are migrated one at a time, like during upgrades
+	if err := services.MigrateNetworkPlugin(ctx, kubeClient, controlAndEtcdHosts, 1, c.UpgradeStrategy, c.CloudProvider.Name, migrateHost); err != nil {
+		return err
+	}
+	if err := services.MigrateNetworkPlugin(ctx, kubeClient, workerOnlyHosts, c.MaxUnavailableForWorkerNodes, c.UpgradeStrategy, c.CloudProvider.Name, migrateHost); err != nil {
+		return err
+	}
+
+	if err := k8s.DeleteSecret(kubeClient, NetworkMigrationCheckRegistrySecret, metav1.NamespaceSystem); err != nil {
+		log.Warnf(ctx, "[network] Failed to delete secret [%s]: %v", NetworkMigrationCheckRegistrySecret, err)
+	}
+	log.Infof(ctx, "[network] Successfully migrated network plugin from [%s] to [%s]", migration.From, migration.To)
+	fullState.CurrentState.NetworkPluginMigration = nil
+	return fullState.WriteStateFile(ctx, c.StateFilePath)
+}
+
+// applyNetworkMigrationRegistrySecret stores the credentials of the private registry of the check pod image in a secret, it returns
+// the image pull secrets of the check pod
+func (c *Cluster) applyNetworkMigrationRegistrySecret(kubeClient *kubernetes.Clientset) ([]v1.LocalObjectReference, error) {
+	dockerConfig, err := docker.GetImageDockerConfig(c.SystemImages.Alpine, c.PrivateRegistriesMap)
+	if err != nil || len(dockerConfig) == 0 {
+		return nil, err
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      NetworkMigrationCheckRegistrySecret,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Type: v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{v1.DockerConfigJsonKey: []byte(dockerConfig)},
+	}
+	if err := k8s.ApplySecret(kubeClient, secret); err != nil {
+		return nil, fmt.Errorf("Failed to apply secret [%s]: %v", NetworkMigrationCheckRegistrySecret, err)
+	}
+	return []v1.LocalObjectReference{{Name: NetworkMigrationCheckRegistrySecret}}, nil
+}
+
+// migrateHostNetworkPlugin cleans the drained host from the old network plugin, restarts the new plugin on it and checks that a pod on the host
+// reaches the API server through the kubernetes service and a pod on another node
+func (c *Cluster) migrateHostNetworkPlugin(ctx context.Context, kubeClient *kubernetes.Clientset, host *hosts.Host, progress *networkMigrationProgress, pullSecrets []v1.LocalObjectReference) error {
+	if err := c.cleanHostNetworkPlugins(ctx, host); err != nil {
+		return err
+	}
+	node, err := k8s.GetNode(kubeClient, host.HostnameOverride, host.InternalAddress, c.CloudProvider.Name)
+	if err != nil {
+		return err
+	}
+	progress.start(node.Name)
+	err = c.checkHostNetworkPlugin(ctx, kubeClient, host, node.Name, progress, pullSecrets)
+	progress.done(node.Name, err == nil)
+	return err
+}
+
+func (c *Cluster) checkHostNetworkPlugin(ctx context.Context, kubeClient *kubernetes.Clientset, host *hosts.Host, nodeName string, progress *networkMigrationProgress, pullSecrets []v1.LocalObjectReference) error {
+	pods, err := k8s.ListPodsByLabel(kubeClient, networkPluginPodLabels[c.Network.Plugin])
+	if err != nil {
+		return err
+	}
+	nodePods := &v1.PodList{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == nodeName {
+			nodePods.Items = append(nodePods.Items, pod)
+		}
+	}
+	// the new plugin sets up the host again, it may have shared interfaces with the old plugin
+	log.Infof(ctx, "[network] Restarting network plugin [%s] on host [%s]", c.Network.Plugin, host.Address)
+	if err := k8s.DeletePods(kubeClient, nodePods); err != nil {
+		return err
+	}
+	runningPods, err := k8s.ListRunningPods(kubeClient)
+	if err != nil {
+		return err
+	}
+	var probeIP string
+	if target := progress.selectProbeTarget(runningPods.Items, nodeName); target != nil {
+		probeIP = target.Status.PodIP
+		log.Infof(ctx, "[network] Checking pod connectivity on host [%s] with pod [%s/%s] on node [%s]", host.Address, target.Namespace, target.Name, target.Spec.NodeName)
+	} else {
+		log.Warnf(ctx, "[network] No pod found on another node to check the pod connectivity of host [%s] with, only the kubernetes service is checked", host.Address)
+	}
+	if err := k8s.RunPodToCompletion(kubeClient, c.getNetworkMigrationCheckPod(nodeName, probeIP, pullSecrets), networkMigrationCheckTimeout); err != nil {
+		return fmt.Errorf("[network] Pod connectivity check failed on host [%s]: %v", host.Address, err)
+	}
+	return nil
+}
+
+// cleanHostNetworkPlugins removes the CNI configurations, the state and the interfaces of the other network plugins from the host
+func (c *Cluster) cleanHostNetworkPlugins(ctx context.Context, host *hosts.Host) error {
+	log.Infof(ctx, "[network] Cleaning up previous network plugins on host [%s]", host.Address)
+	imageCfg := &container.Config{
+		Image: c.SystemImages.Alpine,
+		Cmd:   []string{"sh", "-c", getNetworkPluginCleanupScript(c.Network.Plugin)},
+	}
+	hostCfg := &container.HostConfig{
+		// the interfaces are deleted from the network namespace of the host
+		NetworkMode: "host",
+		Privileged:  true,
+		Binds:       []string{"/:/host"},
+		SecurityOpt: []string{"label=disable"},
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+	if err := docker.DoRemoveContainer(ctx, host.DClient, NetworkMigrationCleanerContainer, host.Address); err != nil {
+		return err
+	}
+	if err := docker.DoRunContainer(ctx, host.DClient, imageCfg, hostCfg, NetworkMigrationCleanerContainer, host.Address, "network", c.PrivateRegistriesMap); err != nil {
+		return err
+	}
+	status, _, stderr, err := docker.GetContainerOutput(ctx, host.DClient, NetworkMigrationCleanerContainer, host.Address, false)
+	if removeErr := docker.RemoveContainer(ctx, host.DClient, host.Address, NetworkMigrationCleanerContainer); removeErr != nil {
+		log.Warnf(ctx, "[network] Failed to remove container [%s] on host [%s]: %v", NetworkMigrationCleanerContainer, host.Address, removeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("container [%s] exited with code [%d] on host [%s]: %s", NetworkMigrationCleanerContainer, status, host.Address, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// getNetworkPluginCleanupScript returns the script removing the files and the interfaces of every migratable network plugin except the ones
+// the given plugin uses. Everything is removed whatever the previous plugin was, so interrupted migrations are cleaned up as well.
+func getNetworkPluginCleanupScript(plugin string) string {
+	keep := map[string]bool{}
+	for _, file := range networkPluginHostFiles[plugin] {
+		keep[file] = true
+	}
+	for _, iface := range networkPluginHostInterfaces[plugin] {
+		keep[iface] = true
+	}
+	var files, ifaces []string
+	for _, other := range MigratableNetworkPlugins {
+		for _, file := range networkPluginHostFiles[other] {
+			if !keep[file] {
+				keep[file] = true
+				files = append(files, "/host"+file)
+			}
+		}
+		for _, iface := range networkPluginHostInterfaces[other] {
+			if !keep[iface] {
+				keep[iface] = true
+				ifaces = append(ifaces, iface)
+			}
+		}
+	}
+	script := fmt.Sprintf("rm -rf %s; for iface in %s; do ip link delete \"$iface\" 2>/dev/null || true; done", strings.Join(files, " "), strings.Join(ifaces, " "))
+	logrus.Debugf("[network] Network plugin cleanup script: %s", script)
+	return script
+}
+
+// getNetworkMigrationCheckPod returns a pod pinned to the node that retries reaching the API server through the kubernetes service and pinging the pod
+// with probeIP if set, it succeeds once the new network plugin gives pods on the node a working network
+func (c *Cluster) getNetworkMigrationCheckPod(nodeName, probeIP string, pullSecrets []v1.LocalObjectReference) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: NetworkMigrationCheckPodPrefix,
+			Namespace:    metav1.NamespaceSystem,
+			Labels:       map[string]string{AppLabel: NetworkMigrationCheckAppName},
+		},
+		Spec: v1.PodSpec{
+			// the node is cordoned, the scheduler is bypassed
+			NodeName:         nodeName,
+			RestartPolicy:    v1.RestartPolicyNever,
+			Tolerations:      []v1.Toleration{{Operator: v1.TolerationOpExists}},
+			ImagePullSecrets: pullSecrets,
+			Containers: []v1.Container{
+				{
+					Name:            "check",
+					Image:           c.SystemImages.Alpine,
+					ImagePullPolicy: v1.PullIfNotPresent,
+					Command:         []string{"sh", "-c", networkMigrationCheckScript},
+					Env:             []v1.EnvVar{{Name: "PROBE_POD_IP", Value: probeIP}},
+				},
+			},
+		},
+	}
+}
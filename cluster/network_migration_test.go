@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSetNetworkPluginMigration(t *testing.T) {
+	ctx := context.Background()
+	c := &Cluster{}
+	c.Network.Plugin = CalicoNetworkPlugin
+	fullState := &FullState{}
+
+	// new clusters and unchanged plugins are not migrated
+	assert.NoError(t, c.SetNetworkPluginMigration(ctx, nil, fullState))
+	assert.Nil(t, fullState.CurrentState.NetworkPluginMigration)
+	currentCluster := &Cluster{}
+	currentCluster.Network.Plugin = CalicoNetworkPlugin
+	assert.NoError(t, c.SetNetworkPluginMigration(ctx, currentCluster, fullState))
+	assert.Nil(t, fullState.CurrentState.NetworkPluginMigration)
+
+	currentCluster.Network.Plugin = CanalNetworkPlugin
+	assert.NoError(t, c.SetNetworkPluginMigration(ctx, currentCluster, fullState))
+	assert.Equal(t, &NetworkPluginMigration{From: CanalNetworkPlugin, To: CalicoNetworkPlugin}, fullState.CurrentState.NetworkPluginMigration)
+
+	// an interrupted migration is resumed once the current state has the new plugin
+	fullState.CurrentState.NetworkPluginMigration.Deployed = true
+	currentCluster.Network.Plugin = CalicoNetworkPlugin
+	assert.NoError(t, c.SetNetworkPluginMigration(ctx, currentCluster, fullState))
+	assert.Equal(t, &NetworkPluginMigration{From: CanalNetworkPlugin, To: CalicoNetworkPlugin, Deployed: true}, fullState.CurrentState.NetworkPluginMigration)
+
+	// the plugin deployed by an interrupted migration is replaced when the plugin changes again
+	c.Network.Plugin = CiliumNetworkPlugin
+	assert.NoError(t, c.SetNetworkPluginMigration(ctx, currentCluster, fullState))
+	assert.Equal(t, &NetworkPluginMigration{From: CanalNetworkPlugin, To: CiliumNetworkPlugin}, fullState.CurrentState.NetworkPluginMigration)
+
+	fullState = &FullState{}
+	c.Network.Plugin = NoNetworkPlugin
+	assert.ErrorContains(t, c.SetNetworkPluginMigration(ctx, currentCluster, fullState), "can't be migrated from [calico] to [none]")
+	c.Network.Plugin = CalicoNetworkPlugin
+	currentCluster.Network.Plugin = AciNetworkPlugin
+	assert.ErrorContains(t, c.SetNetworkPluginMigration(ctx, currentCluster, fullState), "can't be migrated from [aci] to [calico]")
+	assert.Nil(t, fullState.CurrentState.NetworkPluginMigration)
+}
+
+func TestGetNetworkPluginCleanupScript(t *testing.T) {
+	script := getNetworkPluginCleanupScript(CanalNetworkPlugin)
+	// the files and the interfaces canal shares with other plugins are kept
+	assert.NotContains(t, script, "/host/etc/cni/net.d/10-canal.conflist")
+	assert.NotContains(t, script, "calico-kubeconfig")
+	assert.NotContains(t, script, "/host/run/calico")
+	assert.NotContains(t, script, "flannel.1")
+	assert.NotContains(t, script, "vxlan.calico")
+	for _, removed := range []string{"/host/etc/cni/net.d/10-flannel.conflist", "/host/etc/cni/net.d/10-calico.conflist", "/host/etc/cni/net.d/05-cilium.conflist", "/host/var/lib/weave", " cni0 ", "cilium_host"} {
+		assert.Contains(t, script, removed)
+	}
+
+	script = getNetworkPluginCleanupScript(CiliumNetworkPlugin)
+	assert.NotContains(t, script, "cilium")
+	assert.Equal(t, 1, strings.Count(script, "/host/run/calico"))
+	assert.Equal(t, 1, strings.Count(script, "flannel.1"))
+}
+
+func TestGetNetworkMigrationCheckPod(t *testing.T) {
+	c := &Cluster{}
+	c.SystemImages = v3.RKESystemImages{Alpine: "rancher/rke-tools:v0.1.100"}
+	pullSecrets := []v1.LocalObjectReference{{Name: NetworkMigrationCheckRegistrySecret}}
+	pod := c.getNetworkMigrationCheckPod("node-1", "10.42.1.5", pullSecrets)
+	assert.Equal(t, "node-1", pod.Spec.NodeName)
+	assert.Equal(t, v1.RestartPolicyNever, pod.Spec.RestartPolicy)
+	assert.Equal(t, "rancher/rke-tools:v0.1.100", pod.Spec.Containers[0].Image)
+	assert.Equal(t, pullSecrets, pod.Spec.ImagePullSecrets)
+	assert.Equal(t, []v1.EnvVar{{Name: "PROBE_POD_IP", Value: "10.42.1.5"}}, pod.Spec.Containers[0].Env)
+	// IPv6 service hosts are bracketed in the API server URL
+	assert.Contains(t, pod.Spec.Containers[0].Command[2], `*:*) host="[$host]"`)
+	assert.Contains(t, pod.Spec.Containers[0].Command[2], `https://${host}:${KUBERNETES_SERVICE_PORT}/healthz`)
+	// the pod runs on hosts with the etcd and controlplane taints as well
+	assert.Equal(t, []v1.Toleration{{Operator: v1.TolerationOpExists}}, pod.Spec.Tolerations)
+}
+
+func TestSelectNetworkMigrationProbeTarget(t *testing.T) {
+	newPod := func(name, nodeName, podIP string, hostNetwork bool) v1.Pod {
+		pod := v1.Pod{}
+		pod.Name = name
+		pod.Spec.NodeName = nodeName
+		pod.Spec.HostNetwork = hostNetwork
+		pod.Status.PodIP = podIP
+		pod.Status.Phase = v1.PodRunning
+		return pod
+	}
+	pods := []v1.Pod{
+		newPod("local", "node-1", "10.42.0.5", false),
+		newPod("host-network", "node-2", "192.168.1.11", true),
+		newPod("migrated", "node-2", "10.42.1.5", false),
+		newPod("migrating", "node-3", "10.42.2.5", false),
+		newPod("pending", "node-4", "10.42.3.5", false),
+	}
+	progress := newNetworkMigrationProgress()
+	progress.start("node-1")
+	progress.start("node-2")
+	progress.done("node-2", true)
+	progress.start("node-3")
+
+	// the pods of the nodes that aren't migrated yet are preferred
+	assert.Equal(t, "pending", progress.selectProbeTarget(pods, "node-1").Name)
+	progress.start("node-4")
+	progress.done("node-4", true)
+	assert.Equal(t, "migrated", progress.selectProbeTarget(pods, "node-1").Name)
+	assert.Nil(t, progress.selectProbeTarget(pods[:2], "node-1"))
+}
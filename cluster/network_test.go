@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	ghodssyaml "github.com/ghodss/yaml"
+	"github.com/rancher/rke/templates"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func newCiliumTestCluster(provider *v3.CiliumNetworkProvider) *Cluster {
+	c := &Cluster{}
+	c.Network = v3.NetworkConfig{
+		Plugin:                CiliumNetworkPlugin,
+		CiliumNetworkProvider: provider,
+		UpdateStrategy:        &v3.DaemonSetUpdateStrategy{},
+	}
+	c.Authorization.Mode = DefaultAuthorizationMode
+	c.ClusterCIDR = "10.42.0.0/16"
+	c.SystemImages.Cilium = DefaultCiliumImage
+	c.SystemImages.CiliumOperator = DefaultCiliumOperatorImage
+	c.setClusterNetworkDefaults()
+	return c
+}
+
+// getCiliumManifestObjects compiles the default Cilium template and returns the objects of the manifest by kind
+func getCiliumManifestObjects(t *testing.T, c *Cluster) map[string][]string {
+	manifest, err := templates.CompileTemplateFromMap(templates.CiliumTemplate, c.getCiliumConfig())
+	assert.NoError(t, err)
+	objects := map[string][]string{}
+	for _, doc := range strings.Split(manifest, "\n---\n") {
+		var object struct {
+			Kind string `json:"kind"`
+		}
+		assert.NoError(t, ghodssyaml.Unmarshal([]byte(doc), &object))
+		objects[object.Kind] = append(objects[object.Kind], doc)
+	}
+	return objects
+}
+
+func TestCiliumNetworkPluginDefaults(t *testing.T) {
+	c := newCiliumTestCluster(nil)
+	assert.Equal(t, DefaultCiliumTunnelProtocol, c.Network.Options[CiliumTunnelProtocol])
+	assert.Equal(t, DefaultCiliumIPAMMode, c.Network.Options[CiliumIPAMMode])
+	assert.False(t, c.isKubeProxyReplaced())
+	assert.Equal(t, []string{CiliumHealthPort}, c.getNetworkPluginPortList())
+	assert.NoError(t, validateNetworkOptions(c))
+
+	c = newCiliumTestCluster(&v3.CiliumNetworkProvider{KubeProxyReplacement: true, EnableHubble: true, TunnelProtocol: CiliumTunnelProtocolDisabled})
+	assert.True(t, c.isKubeProxyReplaced())
+	assert.Equal(t, CiliumTunnelProtocolDisabled, c.Network.Options[CiliumTunnelProtocol])
+	assert.Equal(t, []string{CiliumHealthPort, CiliumHubblePort}, c.getNetworkPluginPortList())
+	assert.NoError(t, validateNetworkOptions(c))
+
+	// kube-proxy is only replaced by cilium
+	c.Network.Plugin = CanalNetworkPlugin
+	assert.False(t, c.isKubeProxyReplaced())
+	assert.Empty(t, c.getNetworkPluginPortList())
+
+	c = newCiliumTestCluster(&v3.CiliumNetworkProvider{TunnelProtocol: "gre"})
+	assert.ErrorContains(t, validateNetworkOptions(c), "tunnel protocol [gre]")
+	c = newCiliumTestCluster(&v3.CiliumNetworkProvider{IPAMMode: "eni"})
+	assert.ErrorContains(t, validateNetworkOptions(c), "IPAM mode [eni]")
+}
+
+func TestCiliumNetworkPluginManifest(t *testing.T) {
+	c := newCiliumTestCluster(nil)
+	objects := getCiliumManifestObjects(t, c)
+	assert.Len(t, objects["DaemonSet"], 1)
+	assert.Len(t, objects["Deployment"], 1)
+	assert.Len(t, objects["ClusterRole"], 2)
+
+	var config v1.ConfigMap
+	assert.NoError(t, ghodssyaml.Unmarshal([]byte(objects["ConfigMap"][0]), &config))
+	assert.Equal(t, "false", config.Data["kube-proxy-replacement"])
+	assert.Equal(t, "tunnel", config.Data["routing-mode"])
+	assert.Equal(t, "vxlan", config.Data["tunnel-protocol"])
+	assert.Equal(t, "kubernetes", config.Data["ipam"])
+	var daemonSet appsv1.DaemonSet
+	assert.NoError(t, ghodssyaml.Unmarshal([]byte(objects["DaemonSet"][0]), &daemonSet))
+	assert.Equal(t, DefaultCiliumImage, daemonSet.Spec.Template.Spec.Containers[0].Image)
+	for _, env := range daemonSet.Spec.Template.Spec.Containers[0].Env {
+		assert.NotEqual(t, "KUBERNETES_SERVICE_HOST", env.Name)
+	}
+
+	// with the kube-proxy replacement the API server is reached without the kubernetes service
+	c = newCiliumTestCluster(&v3.CiliumNetworkProvider{KubeProxyReplacement: true, TunnelProtocol: CiliumTunnelProtocolDisabled, IPAMMode: CiliumIPAMModeClusterPool})
+	objects = getCiliumManifestObjects(t, c)
+	config = v1.ConfigMap{}
+	assert.NoError(t, ghodssyaml.Unmarshal([]byte(objects["ConfigMap"][0]), &config))
+	assert.Equal(t, "true", config.Data["kube-proxy-replacement"])
+	assert.Equal(t, "native", config.Data["routing-mode"])
+	assert.Equal(t, c.ClusterCIDR, config.Data["ipv4-native-routing-cidr"])
+	assert.Equal(t, c.ClusterCIDR, config.Data["cluster-pool-ipv4-cidr"])
+	var deployment appsv1.Deployment
+	assert.NoError(t, ghodssyaml.Unmarshal([]byte(objects["Deployment"][0]), &deployment))
+	assert.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, v1.EnvVar{Name: "KUBERNETES_SERVICE_HOST", Value: "127.0.0.1"})
+	assert.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, v1.EnvVar{Name: "KUBERNETES_SERVICE_PORT", Value: KubeAPIPort})
+}
+
+func TestGetCIDRsByFamily(t *testing.T) {
+	ipv4, ipv6, err := getCIDRsByFamily("10.42.0.0/16, fd00:42::/56")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.42.0.0/16"}, ipv4)
+	assert.Equal(t, []string{"fd00:42::/56"}, ipv6)
+	ipv4, ipv6, err = getCIDRsByFamily("fd00:42::/56")
+	assert.NoError(t, err)
+	assert.Empty(t, ipv4)
+	assert.Equal(t, []string{"fd00:42::/56"}, ipv6)
+	_, _, err = getCIDRsByFamily("10.42.0.0")
+	assert.Error(t, err)
+
+	assert.Equal(t, "10.43.0.10", getClusterDNSServerFromRange("10.43.0.0/16"))
+	assert.Equal(t, "10.43.0.10", getClusterDNSServerFromRange("10.43.0.0/16,fd00:43::/112"))
+	assert.Equal(t, "fd00:43::a", getClusterDNSServerFromRange("fd00:43::/112,10.43.0.0/16"))
+}
+
+func TestValidateIPFamilies(t *testing.T) {
+	newCluster := func(serviceRange, clusterCIDR, dnsServer, address string) *Cluster {
+		c := &Cluster{}
+		c.Services.KubeAPI.ServiceClusterIPRange = serviceRange
+		c.Services.KubeController.ServiceClusterIPRange = serviceRange
+		c.Services.KubeController.ClusterCIDR = clusterCIDR
+		c.Services.Kubelet.ClusterDNSServer = dnsServer
+		c.Nodes = []v3.RKEConfigNode{{Address: address}}
+		return c
+	}
+	ipv4, ipv6, err := validateIPFamilies(newCluster("10.43.0.0/16", "10.42.0.0/16", "10.43.0.10", "192.168.1.10"))
+	assert.NoError(t, err)
+	assert.True(t, ipv4)
+	assert.False(t, ipv6)
+	ipv4, ipv6, err = validateIPFamilies(newCluster("10.43.0.0/16,fd00:43::/112", "10.42.0.0/16,fd00:42::/56", "10.43.0.10", "192.168.1.10"))
+	assert.NoError(t, err)
+	assert.True(t, ipv4)
+	assert.True(t, ipv6)
+	ipv4, ipv6, err = validateIPFamilies(newCluster("fd00:43::/112", "fd00:42::/56", "fd00:43::a", "fd00::10"))
+	assert.NoError(t, err)
+	assert.False(t, ipv4)
+	assert.True(t, ipv6)
+
+	_, _, err = validateIPFamilies(newCluster("10.43.0.0/16,10.44.0.0/16", "10.42.0.0/16", "10.43.0.10", "192.168.1.10"))
+	assert.ErrorContains(t, err, "at most one IPv4 and one IPv6 CIDR")
+	_, _, err = validateIPFamilies(newCluster("10.43.0.0/16,fd00:43::/112", "10.42.0.0/16", "10.43.0.10", "192.168.1.10"))
+	assert.ErrorContains(t, err, "must have the same IP families")
+	_, _, err = validateIPFamilies(newCluster("fd00:43::/112", "fd00:42::/56", "10.43.0.10", "fd00::10"))
+	assert.ErrorContains(t, err, "cluster_dns_server [10.43.0.10]")
+	_, _, err = validateIPFamilies(newCluster("fd00:43::/112", "fd00:42::/56", "fd00:43::a", "192.168.1.10"))
+	assert.ErrorContains(t, err, "IPv6-only cluster")
+
+	// IPv6 needs a network plugin supporting it
+	c := newCluster("fd00:43::/112", "fd00:42::/56", "fd00:43::a", "fd00::10")
+	c.Network.Plugin = FlannelNetworkPlugin
+	assert.ErrorContains(t, validateNetworkOptions(c), "does not support IPv6")
+}
+
+func TestCiliumNetworkPluginManifestDualStack(t *testing.T) {
+	c := newCiliumTestCluster(&v3.CiliumNetworkProvider{IPAMMode: CiliumIPAMModeClusterPool})
+	c.ClusterCIDR = "10.42.0.0/16,fd00:42::/56"
+	objects := getCiliumManifestObjects(t, c)
+	var config v1.ConfigMap
+	assert.NoError(t, ghodssyaml.Unmarshal([]byte(objects["ConfigMap"][0]), &config))
+	assert.Equal(t, "true", config.Data["enable-ipv4"])
+	assert.Equal(t, "true", config.Data["enable-ipv6"])
+	assert.Equal(t, "10.42.0.0/16", config.Data["cluster-pool-ipv4-cidr"])
+	assert.Equal(t, "fd00:42::/56", config.Data["cluster-pool-ipv6-cidr"])
+
+	c.ClusterCIDR = "fd00:42::/56"
+	objects = getCiliumManifestObjects(t, c)
+	config = v1.ConfigMap{}
+	assert.NoError(t, ghodssyaml.Unmarshal([]byte(objects["ConfigMap"][0]), &config))
+	assert.Equal(t, "false", config.Data["enable-ipv4"])
+	assert.Equal(t, "true", config.Data["enable-ipv6"])
+}
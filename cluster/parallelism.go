@@ -0,0 +1,113 @@
+package cluster
+
+import (
+	"sync"
+
+	ref "github.com/docker/distribution/reference"
+	"github.com/rancher/rke/hosts"
+	v3 "github.com/rancher/rke/types"
+	"github.com/rancher/rke/util"
+	"golang.org/x/sync/errgroup"
+)
+
+// Phases with their own limit in the parallelism section
+const (
+	ParallelismTunnelHosts        = "tunnel_hosts"
+	ParallelismDeployFiles        = "deploy_files"
+	ParallelismDeployCertificates = "deploy_certificates"
+	ParallelismPullImages         = "pull_images"
+	ParallelismCleanup            = "cleanup"
+)
+
+// hostWorkers returns the number of hosts the phase processes at the same time, the limit of the phase is capped by max_hosts
+func (c *Cluster) hostWorkers(phase string) int {
+	return getHostWorkers(c.Parallelism, phase)
+}
+
+func getHostWorkers(config *v3.ParallelismConfig, phase string) int {
+	workers := WorkerThreads
+	if config == nil {
+		return workers
+	}
+	if config.MaxHosts > 0 {
+		workers = config.MaxHosts
+	}
+	var phaseLimit int
+	switch phase {
+	case ParallelismTunnelHosts:
+		phaseLimit = config.TunnelHosts
+	case ParallelismDeployFiles:
+		phaseLimit = config.DeployFiles
+	case ParallelismDeployCertificates:
+		phaseLimit = config.DeployCertificates
+	case ParallelismPullImages:
+		phaseLimit = config.PullImages
+	case ParallelismCleanup:
+		phaseLimit = config.Cleanup
+	}
+	if phaseLimit > 0 && phaseLimit < workers {
+		return phaseLimit
+	}
+	return workers
+}
+
+// runOnHosts runs f on the hosts, processing at most workers hosts at the same time
+func runOnHosts(hostList []*hosts.Host, workers int, f func(host *hosts.Host) error) error {
+	var errgrp errgroup.Group
+	hostsQueue := util.GetObjectQueue(hostList)
+	for w := 0; w < workers; w++ {
+		errgrp.Go(func() error {
+			var errList []error
+			for host := range hostsQueue {
+				if err := f(host.(*hosts.Host)); err != nil {
+					errList = append(errList, err)
+				}
+			}
+			return util.ErrList(errList)
+		})
+	}
+	return errgrp.Wait()
+}
+
+// registryThrottle limits the number of images pulled at the same time from each registry, to stay under registry rate limits
+type registryThrottle struct {
+	limit      int
+	lock       sync.Mutex
+	registries map[string]chan struct{}
+}
+
+func newRegistryThrottle(config *v3.ParallelismConfig) *registryThrottle {
+	if config == nil || config.RegistryPulls <= 0 {
+		return nil
+	}
+	return &registryThrottle{
+		limit:      config.RegistryPulls,
+		registries: map[string]chan struct{}{},
+	}
+}
+
+// acquire waits until the image can be pulled from its registry and returns the function releasing the pull slot. A nil throttle
+// doesn't limit pulls.
+func (t *registryThrottle) acquire(image string) func() {
+	if t == nil {
+		return func() {}
+	}
+	registry := getImageRegistry(image)
+	t.lock.Lock()
+	slots, ok := t.registries[registry]
+	if !ok {
+		slots = make(chan struct{}, t.limit)
+		t.registries[registry] = slots
+	}
+	t.lock.Unlock()
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+func getImageRegistry(image string) string {
+	named, err := ref.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return ref.Domain(named)
+}
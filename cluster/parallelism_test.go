@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher/rke/hosts"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHostWorkers(t *testing.T) {
+	assert.Equal(t, WorkerThreads, getHostWorkers(nil, ParallelismTunnelHosts))
+	config := &v3.ParallelismConfig{MaxHosts: 20, TunnelHosts: 5, PullImages: 100}
+	assert.Equal(t, 5, getHostWorkers(config, ParallelismTunnelHosts))
+	// phase limits are capped by max_hosts
+	assert.Equal(t, 20, getHostWorkers(config, ParallelismPullImages))
+	assert.Equal(t, 20, getHostWorkers(config, ParallelismCleanup))
+	assert.Equal(t, 10, getHostWorkers(&v3.ParallelismConfig{DeployFiles: 10}, ParallelismDeployFiles))
+}
+
+func TestRunOnHosts(t *testing.T) {
+	var hostList []*hosts.Host
+	for i := 0; i < 10; i++ {
+		hostList = append(hostList, &hosts.Host{})
+	}
+	var running, maxRunning, processed int32
+	err := runOnHosts(hostList, 3, func(host *hosts.Host) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(10), processed)
+	assert.LessOrEqual(t, maxRunning, int32(3))
+}
+
+func TestRegistryThrottle(t *testing.T) {
+	assert.Nil(t, newRegistryThrottle(nil))
+	// a nil throttle doesn't limit pulls
+	var nilThrottle *registryThrottle
+	nilThrottle.acquire("rancher/hyperkube:v1.27.1")()
+
+	assert.Equal(t, "docker.io", getImageRegistry("rancher/hyperkube:v1.27.1"))
+	assert.Equal(t, "registry.example.com:5000", getImageRegistry("registry.example.com:5000/rancher/hyperkube:v1.27.1"))
+
+	throttle := newRegistryThrottle(&v3.ParallelismConfig{RegistryPulls: 1})
+	release := throttle.acquire("rancher/hyperkube:v1.27.1")
+	// other registries are not throttled
+	throttle.acquire("registry.example.com/rancher/pause:3.7")()
+
+	var wg sync.WaitGroup
+	var acquired int32
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		throttle.acquire("rancher/mirrored-pause:3.7")()
+		atomic.StoreInt32(&acquired, 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&acquired))
+	release()
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&acquired))
+}
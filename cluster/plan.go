@@ -122,9 +122,15 @@ func BuildRKEConfigNodePlan(ctx context.Context, myCluster *Cluster, host *hosts
 	// Everybody gets a sidecar and a kubelet..
 	processes[services.SidekickContainerName] = myCluster.BuildSidecarProcess(host)
 	processes[services.KubeletContainerName] = myCluster.BuildKubeletProcess(host, svcOptions)
-	processes[services.KubeproxyContainerName] = myCluster.BuildKubeProxyProcess(host, svcOptions)
+	// kube-proxy isn't deployed when the network plugin takes over the service load-balancing
+	if !myCluster.isKubeProxyReplaced() {
+		processes[services.KubeproxyContainerName] = myCluster.BuildKubeProxyProcess(host, svcOptions)
+	}
 
 	portChecks = append(portChecks, BuildPortChecksFromPortList(host, WorkerPortList, ProtocolTCP)...)
+	if host.IsWorker {
+		portChecks = append(portChecks, BuildPortChecksFromPortList(host, myCluster.getNetworkPluginPortList(), ProtocolTCP)...)
+	}
 	// Do we need an nginxProxy for this one ?
 	if !host.IsControl {
 		processes[services.NginxProxyContainerName] = myCluster.BuildProxyProcess(host)
@@ -520,7 +526,20 @@ func (c *Cluster) BuildKubeletProcess(host *hosts.Host, serviceOptions v3.Kubern
 
 	var Binds []string
 
-	if c.IsCRIDockerdEnabled() {
+	if host.IsContainerd() {
+		parsedVersion, err := getClusterVersion(c.Version)
+		if err != nil {
+			logrus.Debugf("Error while parsing cluster version: %s", err)
+		}
+		if parsedRangeBelow127(parsedVersion) {
+			CommandArgs["container-runtime"] = "remote"
+		}
+		containerdSocket := docker.ContainerdSocket
+		if len(host.DockerSocket) > 0 {
+			containerdSocket = host.DockerSocket
+		}
+		CommandArgs["container-runtime-endpoint"] = "unix://" + containerdSocket
+	} else if c.IsCRIDockerdEnabled() {
 		parsedVersion, err := getClusterVersion(c.Version)
 		if err != nil {
 			logrus.Debugf("Error while parsing cluster version: %s", err)
@@ -616,7 +635,7 @@ func (c *Cluster) BuildKubeletProcess(host *hosts.Host, serviceOptions v3.Kubern
 
 	Env := host.GetExtraEnv(kubelet.BaseService)
 
-	if c.IsCRIDockerdEnabled() {
+	if c.IsCRIDockerdEnabled() && !host.IsContainerd() {
 		Env = append(Env,
 			// Enable running cri-dockerd
 			fmt.Sprintf("%s=%s", KubeletCRIDockerdNameEnv, "true"))
@@ -1036,14 +1055,17 @@ func (c *Cluster) BuildEtcdProcess(host *hosts.Host, etcdHosts []*hosts.Host, se
 	listenAddress := host.InternalAddress
 	if host.Address == host.InternalAddress {
 		listenAddress = "0.0.0.0"
+		if netutils.IsIPv6String(host.InternalAddress) {
+			listenAddress = "::"
+		}
 	}
 
 	CommandArgs := map[string]string{
 		"name":                        "etcd-" + host.HostnameOverride,
 		"data-dir":                    services.EtcdDataDir,
-		"listen-client-urls":          "https://" + listenAddress + ":2379",
-		"initial-advertise-peer-urls": "https://" + host.InternalAddress + ":2380",
-		"listen-peer-urls":            "https://" + listenAddress + ":2380",
+		"listen-client-urls":          "https://" + net.JoinHostPort(listenAddress, "2379"),
+		"initial-advertise-peer-urls": "https://" + net.JoinHostPort(host.InternalAddress, "2380"),
+		"listen-peer-urls":            "https://" + net.JoinHostPort(listenAddress, "2380"),
 		"initial-cluster-token":       "etcd-cluster-1",
 		"initial-cluster":             initCluster,
 		"initial-cluster-state":       clusterState,
@@ -1076,10 +1098,10 @@ func (c *Cluster) BuildEtcdProcess(host *hosts.Host, etcdHosts []*hosts.Host, se
 	// We removed advertising port 4001 starting with k8s 1.19 (etcd v3.4.13 and up)
 	if etcdSemVer.LessThan(*maxEtcdPort4001Version) {
 		logrus.Debugf("etcd version [%s] is less than max version [%s] for advertising port 4001, going to advertise port 4001", etcdSemVer, maxEtcdPort4001Version)
-		CommandArgs["advertise-client-urls"] = "https://" + host.InternalAddress + ":2379,https://" + host.InternalAddress + ":4001"
+		CommandArgs["advertise-client-urls"] = "https://" + net.JoinHostPort(host.InternalAddress, "2379") + ",https://" + net.JoinHostPort(host.InternalAddress, "4001")
 	} else {
 		logrus.Debugf("etcd version [%s] is higher than max version [%s] for advertising port 4001, not going to advertise port 4001", etcdSemVer, maxEtcdPort4001Version)
-		CommandArgs["advertise-client-urls"] = "https://" + host.InternalAddress + ":2379"
+		CommandArgs["advertise-client-urls"] = "https://" + net.JoinHostPort(host.InternalAddress, "2379")
 	}
 
 	// Add in stricter TLS ciphter suites starting with etcd v3.4.15
@@ -1138,7 +1160,7 @@ func (c *Cluster) BuildEtcdProcess(host *hosts.Host, etcdHosts []*hosts.Host, se
 
 	Binds = append(Binds, c.Services.Etcd.ExtraBinds...)
 	healthCheck := v3.HealthCheck{
-		URL: fmt.Sprintf("https://%s:2379/health", host.InternalAddress),
+		URL: fmt.Sprintf("https://%s/health", net.JoinHostPort(host.InternalAddress, "2379")),
 	}
 	registryAuthConfig, _, _ := docker.GetImageRegistryConfig(c.Services.Etcd.Image, c.PrivateRegistriesMap)
 
@@ -1158,15 +1180,17 @@ func (c *Cluster) BuildEtcdProcess(host *hosts.Host, etcdHosts []*hosts.Host, se
 	// Apply old configuration to avoid replacing etcd container
 	if etcdSemVer.LessThan(*maxEtcdOldEnvSemVer) {
 		logrus.Debugf("Version [%s] is less than version [%s]", etcdSemVer, maxEtcdOldEnvSemVer)
-		Env = append(Env, fmt.Sprintf("ETCDCTL_ENDPOINT=https://%s:2379", listenAddress))
+		Env = append(Env, fmt.Sprintf("ETCDCTL_ENDPOINT=https://%s", net.JoinHostPort(listenAddress, "2379")))
 	} else {
 		logrus.Debugf("Version [%s] is equal or higher than version [%s]", etcdSemVer, maxEtcdOldEnvSemVer)
-		// Point etcdctl to localhost in case we have listen all (0.0.0.0) configured
+		// Point etcdctl to localhost in case we have listen all (0.0.0.0 or ::) configured
 		if listenAddress == "0.0.0.0" {
 			Env = append(Env, "ETCDCTL_ENDPOINTS=https://127.0.0.1:2379")
+		} else if listenAddress == "::" {
+			Env = append(Env, "ETCDCTL_ENDPOINTS=https://[::1]:2379")
 			// If internal address is configured, set endpoint to that address as well
 		} else {
-			Env = append(Env, fmt.Sprintf("ETCDCTL_ENDPOINTS=https://%s:2379", listenAddress))
+			Env = append(Env, fmt.Sprintf("ETCDCTL_ENDPOINTS=https://%s", net.JoinHostPort(listenAddress, "2379")))
 		}
 	}
 
@@ -1213,14 +1237,18 @@ func BuildPortChecksFromPortList(host *hosts.Host, portList []string, proto stri
 func (c *Cluster) GetKubernetesServicesOptions(osType string, data map[string]*v3.KubernetesServicesOptions) (v3.KubernetesServicesOptions, error) {
 	if osType == "windows" {
 		if svcOption, ok := data["k8s-windows-service-options"]; ok {
-			return *svcOption, nil
+			return c.applyHardeningProfile(osType, *svcOption), nil
 		}
 	} else {
 		if svcOption, ok := data["k8s-service-options"]; ok {
-			return *svcOption, nil
+			return c.applyHardeningProfile(osType, *svcOption), nil
 		}
 	}
-	return c.getDefaultKubernetesServicesOptions(osType)
+	serviceOptions, err := c.getDefaultKubernetesServicesOptions(osType)
+	if err != nil {
+		return serviceOptions, err
+	}
+	return c.applyHardeningProfile(osType, serviceOptions), nil
 }
 
 func (c *Cluster) getDefaultKubernetesServicesOptions(osType string) (v3.KubernetesServicesOptions, error) {
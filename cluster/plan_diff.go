@@ -0,0 +1,291 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	ProcessActionCreate   = "create"
+	ProcessActionRecreate = "recreate"
+	ProcessActionRemove   = "remove"
+)
+
+// PlanDiff describes the changes rke up would apply to move a cluster from its current state to its desired state
+type PlanDiff struct {
+	HostsToAdd               []string       `json:"hostsToAdd,omitempty"`
+	HostsToRemove            []string       `json:"hostsToRemove,omitempty"`
+	EtcdMembersToAdd         []string       `json:"etcdMembersToAdd,omitempty"`
+	EtcdMembersToDelete      []string       `json:"etcdMembersToDelete,omitempty"`
+	CertificatesToRegenerate []string       `json:"certificatesToRegenerate,omitempty"`
+	AddonsChanged            []AddonDiff    `json:"addonsChanged,omitempty"`
+	Nodes                    []NodePlanDiff `json:"nodes,omitempty"`
+}
+
+type NodePlanDiff struct {
+	Address   string        `json:"address"`
+	Processes []ProcessDiff `json:"processes"`
+}
+
+type ProcessDiff struct {
+	Name    string      `json:"name"`
+	Action  string      `json:"action"`
+	Changes []FieldDiff `json:"changes,omitempty"`
+}
+
+type FieldDiff struct {
+	Field   string   `json:"field"`
+	Old     string   `json:"old,omitempty"`
+	New     string   `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+type AddonDiff struct {
+	Name        string `json:"name"`
+	OldChecksum string `json:"oldChecksum,omitempty"`
+	NewChecksum string `json:"newChecksum,omitempty"`
+}
+
+// HasChanges returns true if applying the desired state would change anything on the cluster
+func (d *PlanDiff) HasChanges() bool {
+	return len(d.HostsToAdd) > 0 ||
+		len(d.HostsToRemove) > 0 ||
+		len(d.EtcdMembersToAdd) > 0 ||
+		len(d.EtcdMembersToDelete) > 0 ||
+		len(d.CertificatesToRegenerate) > 0 ||
+		len(d.AddonsChanged) > 0 ||
+		len(d.Nodes) > 0
+}
+
+// GeneratePlanDiff builds the plans of the current and desired states of the full state and compares them.
+// No connection is made to the nodes, host info is taken from hostsInfoMap when available.
+func GeneratePlanDiff(ctx context.Context, fullState *FullState, hostsInfoMap map[string]types.Info, data map[string]interface{}) (*PlanDiff, error) {
+	if fullState == nil {
+		return nil, ErrFullStateIsNil
+	}
+	if fullState.DesiredState.RancherKubernetesEngineConfig == nil {
+		return nil, fmt.Errorf("[plan] desired state is empty, can not generate plan")
+	}
+	diff := &PlanDiff{}
+	currentConfig := fullState.CurrentState.RancherKubernetesEngineConfig
+	desiredConfig := fullState.DesiredState.RancherKubernetesEngineConfig
+
+	desiredPlan, err := GeneratePlan(ctx, desiredConfig.DeepCopy(), hostsInfoMap, data)
+	if err != nil {
+		return nil, fmt.Errorf("[plan] failed to generate plan for desired state: %v", err)
+	}
+	currentPlan := v3.RKEPlan{}
+	if currentConfig != nil {
+		if currentPlan, err = GeneratePlan(ctx, currentConfig.DeepCopy(), hostsInfoMap, data); err != nil {
+			return nil, fmt.Errorf("[plan] failed to generate plan for current state: %v", err)
+		}
+	} else {
+		currentConfig = &v3.RancherKubernetesEngineConfig{}
+	}
+
+	diff.HostsToAdd, diff.HostsToRemove = diffNodeAddresses(currentConfig.Nodes, desiredConfig.Nodes, "")
+	if len(desiredConfig.Services.Etcd.ExternalURLs) == 0 {
+		diff.EtcdMembersToAdd, diff.EtcdMembersToDelete = diffNodeAddresses(currentConfig.Nodes, desiredConfig.Nodes, services.ETCDRole)
+	}
+	diff.CertificatesToRegenerate = diffCertificates(fullState.CurrentState.CertificatesBundle, fullState.DesiredState.CertificatesBundle)
+	diff.AddonsChanged = diffAddons(currentConfig, desiredConfig)
+	diff.Nodes = DiffPlans(currentPlan, desiredPlan)
+	return diff, nil
+}
+
+// DiffPlans compares two cluster plans node by node and returns the processes that will be created, recreated or removed
+func DiffPlans(current, desired v3.RKEPlan) []NodePlanDiff {
+	var nodeDiffs []NodePlanDiff
+	currentNodes := map[string]v3.RKEConfigNodePlan{}
+	for _, node := range current.Nodes {
+		currentNodes[node.Address] = node
+	}
+	desiredNodes := map[string]v3.RKEConfigNodePlan{}
+	for _, node := range desired.Nodes {
+		desiredNodes[node.Address] = node
+	}
+	addresses := sets.NewString()
+	for address := range currentNodes {
+		addresses.Insert(address)
+	}
+	for address := range desiredNodes {
+		addresses.Insert(address)
+	}
+	for _, address := range addresses.List() {
+		processDiffs := diffNodeProcesses(currentNodes[address].Processes, desiredNodes[address].Processes)
+		if len(processDiffs) == 0 {
+			continue
+		}
+		nodeDiffs = append(nodeDiffs, NodePlanDiff{
+			Address:   address,
+			Processes: processDiffs,
+		})
+	}
+	return nodeDiffs
+}
+
+func diffNodeProcesses(current, desired map[string]v3.Process) []ProcessDiff {
+	var processDiffs []ProcessDiff
+	names := sets.NewString()
+	for name := range current {
+		names.Insert(name)
+	}
+	for name := range desired {
+		names.Insert(name)
+	}
+	for _, name := range names.List() {
+		currentProcess, inCurrent := current[name]
+		desiredProcess, inDesired := desired[name]
+		switch {
+		case !inCurrent:
+			processDiffs = append(processDiffs, ProcessDiff{Name: name, Action: ProcessActionCreate})
+		case !inDesired:
+			processDiffs = append(processDiffs, ProcessDiff{Name: name, Action: ProcessActionRemove})
+		default:
+			if changes := diffProcess(currentProcess, desiredProcess); len(changes) > 0 {
+				processDiffs = append(processDiffs, ProcessDiff{Name: name, Action: ProcessActionRecreate, Changes: changes})
+			}
+		}
+	}
+	return processDiffs
+}
+
+// diffProcess compares the fields used to decide if a container is upgradable, see docker.IsContainerUpgradable
+func diffProcess(current, desired v3.Process) []FieldDiff {
+	var changes []FieldDiff
+	if current.Image != desired.Image {
+		changes = append(changes, FieldDiff{Field: "image", Old: current.Image, New: desired.Image})
+	}
+	for _, field := range []struct {
+		name             string
+		current, desired []string
+	}{
+		{"command", current.Command, desired.Command},
+		{"args", current.Args, desired.Args},
+		{"env", current.Env, desired.Env},
+		{"binds", current.Binds, desired.Binds},
+	} {
+		if change, changed := diffStringSlice(field.name, field.current, field.desired); changed {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func diffStringSlice(field string, current, desired []string) (FieldDiff, bool) {
+	currentSet := sets.NewString(current...)
+	desiredSet := sets.NewString(desired...)
+	if currentSet.Equal(desiredSet) {
+		return FieldDiff{}, false
+	}
+	return FieldDiff{
+		Field:   field,
+		Added:   desiredSet.Difference(currentSet).List(),
+		Removed: currentSet.Difference(desiredSet).List(),
+	}, true
+}
+
+// diffNodeAddresses returns the node addresses to add and remove, optionally limited to nodes with the given role
+func diffNodeAddresses(current, desired []v3.RKEConfigNode, role string) ([]string, []string) {
+	currentSet := getNodeAddressSet(current, role)
+	desiredSet := getNodeAddressSet(desired, role)
+	return desiredSet.Difference(currentSet).List(), currentSet.Difference(desiredSet).List()
+}
+
+func getNodeAddressSet(nodes []v3.RKEConfigNode, role string) sets.String {
+	addresses := sets.NewString()
+	for _, node := range nodes {
+		if role == "" || sets.NewString(node.Role...).Has(role) {
+			addresses.Insert(node.Address)
+		}
+	}
+	return addresses
+}
+
+func diffCertificates(current, desired map[string]pki.CertificatePKI) []string {
+	var toRegenerate []string
+	for name, desiredCert := range desired {
+		currentCert, ok := current[name]
+		if !ok || certificateChanged(currentCert, desiredCert) {
+			toRegenerate = append(toRegenerate, name)
+		}
+	}
+	sort.Strings(toRegenerate)
+	return toRegenerate
+}
+
+func certificateChanged(current, desired pki.CertificatePKI) bool {
+	if current.Certificate != nil && desired.Certificate != nil {
+		return !bytes.Equal(current.Certificate.Raw, desired.Certificate.Raw)
+	}
+	return current.CertificatePEM != desired.CertificatePEM
+}
+
+// diffAddons compares the checksums of the configuration rendered into each addon ConfigMap
+func diffAddons(current, desired *v3.RancherKubernetesEngineConfig) []AddonDiff {
+	var addonDiffs []AddonDiff
+	currentChecksums := getAddonConfigChecksums(current)
+	desiredChecksums := getAddonConfigChecksums(desired)
+	names := sets.NewString()
+	for name := range currentChecksums {
+		names.Insert(name)
+	}
+	for name := range desiredChecksums {
+		names.Insert(name)
+	}
+	for _, name := range names.List() {
+		if currentChecksums[name] == desiredChecksums[name] {
+			continue
+		}
+		addonDiffs = append(addonDiffs, AddonDiff{
+			Name:        name,
+			OldChecksum: currentChecksums[name],
+			NewChecksum: desiredChecksums[name],
+		})
+	}
+	return addonDiffs
+}
+
+func getAddonConfigChecksums(rkeConfig *v3.RancherKubernetesEngineConfig) map[string]string {
+	checksums := map[string]string{}
+	if rkeConfig == nil || len(rkeConfig.Nodes) == 0 {
+		return checksums
+	}
+	addonConfigs := map[string]interface{}{
+		NetworkPluginResourceName:      rkeConfig.Network,
+		IngressAddonResourceName:       rkeConfig.Ingress,
+		MetricsServerAddonResourceName: rkeConfig.Monitoring,
+	}
+	if rkeConfig.DNS != nil {
+		addonConfigs[getAddonResourceName(rkeConfig.DNS.Provider)] = rkeConfig.DNS
+	}
+	for name, addonConfig := range addonConfigs {
+		// system addons are rendered from version specific templates and images
+		checksums[name] = getAddonChecksum(rkeConfig.Version, rkeConfig.SystemImages, addonConfig)
+	}
+	if len(rkeConfig.Addons) > 0 {
+		checksums[UserAddonResourceName] = getStringChecksum(rkeConfig.Addons)
+	}
+	if len(rkeConfig.AddonsInclude) > 0 {
+		checksums[UserAddonsIncludeResourceName] = getAddonChecksum(rkeConfig.AddonsInclude)
+	}
+	return checksums
+}
+
+func getAddonChecksum(objs ...interface{}) string {
+	addonBytes, err := json.Marshal(objs)
+	if err != nil {
+		return ""
+	}
+	return getStringChecksum(string(addonBytes))
+}
@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPlans(t *testing.T) {
+	current := v3.RKEPlan{
+		Nodes: []v3.RKEConfigNodePlan{
+			{
+				Address: "1.1.1.1",
+				Processes: map[string]v3.Process{
+					services.KubeAPIContainerName: {
+						Image: "rancher/hyperkube:v1.29.0",
+						Args:  []string{"--a=1", "--b=2"},
+						Binds: []string{"/etc/kubernetes:/etc/kubernetes:z"},
+					},
+					services.NginxProxyContainerName: {Image: "rancher/rke-tools"},
+				},
+			},
+			{
+				Address: "2.2.2.2",
+				Processes: map[string]v3.Process{
+					services.KubeletContainerName: {Image: "rancher/hyperkube:v1.29.0"},
+				},
+			},
+		},
+	}
+	desired := v3.RKEPlan{
+		Nodes: []v3.RKEConfigNodePlan{
+			{
+				Address: "1.1.1.1",
+				Processes: map[string]v3.Process{
+					services.KubeAPIContainerName: {
+						Image: "rancher/hyperkube:v1.30.0",
+						Args:  []string{"--b=2", "--a=1", "--c=3"},
+						Binds: []string{"/etc/kubernetes:/etc/kubernetes:z"},
+					},
+					services.EtcdContainerName: {Image: "rancher/etcd"},
+				},
+			},
+			{
+				Address: "2.2.2.2",
+				Processes: map[string]v3.Process{
+					services.KubeletContainerName: {Image: "rancher/hyperkube:v1.29.0"},
+				},
+			},
+		},
+	}
+
+	nodeDiffs := DiffPlans(current, desired)
+	assert.Len(t, nodeDiffs, 1)
+	assert.Equal(t, "1.1.1.1", nodeDiffs[0].Address)
+	assert.Equal(t, []ProcessDiff{
+		{Name: services.EtcdContainerName, Action: ProcessActionCreate},
+		{
+			Name:   services.KubeAPIContainerName,
+			Action: ProcessActionRecreate,
+			Changes: []FieldDiff{
+				{Field: "image", Old: "rancher/hyperkube:v1.29.0", New: "rancher/hyperkube:v1.30.0"},
+				{Field: "args", Added: []string{"--c=3"}, Removed: []string{}},
+			},
+		},
+		{Name: services.NginxProxyContainerName, Action: ProcessActionRemove},
+	}, nodeDiffs[0].Processes)
+}
+
+func TestDiffNodeAddresses(t *testing.T) {
+	current := []v3.RKEConfigNode{
+		{Address: "1.1.1.1", Role: []string{services.ETCDRole, services.ControlRole}},
+		{Address: "2.2.2.2", Role: []string{services.WorkerRole}},
+	}
+	desired := []v3.RKEConfigNode{
+		{Address: "1.1.1.1", Role: []string{services.ControlRole}},
+		{Address: "3.3.3.3", Role: []string{services.ETCDRole}},
+	}
+
+	toAdd, toRemove := diffNodeAddresses(current, desired, "")
+	assert.Equal(t, []string{"3.3.3.3"}, toAdd)
+	assert.Equal(t, []string{"2.2.2.2"}, toRemove)
+
+	toAdd, toRemove = diffNodeAddresses(current, desired, services.ETCDRole)
+	assert.Equal(t, []string{"3.3.3.3"}, toAdd)
+	assert.Equal(t, []string{"1.1.1.1"}, toRemove)
+}
+
+func TestDiffAddons(t *testing.T) {
+	current := &v3.RancherKubernetesEngineConfig{
+		Nodes:   []v3.RKEConfigNode{{Address: "1.1.1.1"}},
+		Network: v3.NetworkConfig{Plugin: CanalNetworkPlugin},
+		Addons:  "apiVersion: v1",
+	}
+	desired := current.DeepCopy()
+	assert.Empty(t, diffAddons(current, desired))
+
+	desired.Network.Plugin = CalicoNetworkPlugin
+	desired.Addons = ""
+	addonDiffs := diffAddons(current, desired)
+	assert.Len(t, addonDiffs, 2)
+	assert.Equal(t, NetworkPluginResourceName, addonDiffs[0].Name)
+	assert.Equal(t, UserAddonResourceName, addonDiffs[1].Name)
+	assert.Empty(t, addonDiffs[1].NewChecksum)
+}
@@ -1,8 +1,13 @@
 package cluster
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,3 +55,114 @@ func Test_getUniqStringList(t *testing.T) {
 		})
 	}
 }
+
+// newPlanTestCluster returns a cluster of two nodes running all the roles, with the system images set since the
+// Kubernetes metadata isn't loaded
+func newPlanTestCluster(addresses []string, serviceCIDR, clusterCIDR, dnsServer string) *Cluster {
+	c := &Cluster{RancherKubernetesEngineConfig: v3.RancherKubernetesEngineConfig{
+		Version:      "v1.27.6-rancher1-1",
+		SystemImages: v3.RKESystemImages{Kubernetes: "rancher/hyperkube:v1.27.6-rancher1", Alpine: "rancher/rke-tools:v0.1.96"},
+		DNS:          &v3.DNSConfig{},
+		Services: v3.RKEConfigServices{
+			Etcd:           v3.ETCDService{BaseService: v3.BaseService{Image: "rancher/mirrored-coreos-etcd:v3.5.7"}},
+			KubeAPI:        v3.KubeAPIService{ServiceClusterIPRange: serviceCIDR},
+			KubeController: v3.KubeControllerService{ServiceClusterIPRange: serviceCIDR, ClusterCIDR: clusterCIDR},
+			Kubelet:        v3.KubeletService{ClusterDNSServer: dnsServer, ClusterDomain: "cluster.local"},
+		},
+	}}
+	for i, address := range addresses {
+		c.EtcdHosts = append(c.EtcdHosts, &hosts.Host{
+			RKEConfigNode: v3.RKEConfigNode{Address: address, InternalAddress: address, HostnameOverride: fmt.Sprintf("node%d", i+1)},
+			IsEtcd:        true,
+			IsControl:     true,
+			IsWorker:      true,
+		})
+	}
+	c.EtcdReadyHosts = c.EtcdHosts
+	c.ControlPlaneHosts = c.EtcdHosts
+	c.WorkerHosts = c.EtcdHosts
+	return c
+}
+
+func TestBuildRKEConfigNodePlanIPFamilies(t *testing.T) {
+	tests := []struct {
+		name         string
+		addresses    []string
+		serviceCIDR  string
+		clusterCIDR  string
+		dnsServer    string
+		listenAll    string
+		localEtcd    string
+		etcdEndpoint string
+		peerURLs     string
+	}{
+		{
+			name:         "ipv4",
+			addresses:    []string{"192.168.1.10", "192.168.1.11"},
+			serviceCIDR:  "10.43.0.0/16",
+			clusterCIDR:  "10.42.0.0/16",
+			dnsServer:    "10.43.0.10",
+			listenAll:    "0.0.0.0",
+			localEtcd:    "https://127.0.0.1:2379",
+			etcdEndpoint: "192.168.1.10:2379",
+			peerURLs:     "etcd-node1=https://192.168.1.10:2380,etcd-node2=https://192.168.1.11:2380",
+		},
+		{
+			name:         "ipv6 only",
+			addresses:    []string{"fd00::10", "fd00::11"},
+			serviceCIDR:  "fd00:43::/112",
+			clusterCIDR:  "fd00:42::/56",
+			dnsServer:    "fd00:43::a",
+			listenAll:    "[::]",
+			localEtcd:    "https://[::1]:2379",
+			etcdEndpoint: "[fd00::10]:2379",
+			peerURLs:     "etcd-node1=https://[fd00::10]:2380,etcd-node2=https://[fd00::11]:2380",
+		},
+		{
+			name:         "dual-stack",
+			addresses:    []string{"192.168.1.10", "192.168.1.11"},
+			serviceCIDR:  "10.43.0.0/16,fd00:43::/112",
+			clusterCIDR:  "10.42.0.0/16,fd00:42::/56",
+			dnsServer:    "10.43.0.10",
+			listenAll:    "0.0.0.0",
+			localEtcd:    "https://127.0.0.1:2379",
+			etcdEndpoint: "192.168.1.10:2379",
+			peerURLs:     "etcd-node1=https://192.168.1.10:2380,etcd-node2=https://192.168.1.11:2380",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPlanTestCluster(tt.addresses, tt.serviceCIDR, tt.clusterCIDR, tt.dnsServer)
+			assert.NoError(t, c.setNetworkOptions())
+			host := c.EtcdHosts[0]
+			plan := BuildRKEConfigNodePlan(context.Background(), c, host, v3.KubernetesServicesOptions{})
+			assert.Equal(t, tt.addresses[0], plan.Address)
+
+			etcd := c.BuildEtcdProcess(host, c.EtcdReadyHosts, v3.KubernetesServicesOptions{})
+			assert.Contains(t, plan.Processes, services.EtcdContainerName)
+			assert.Contains(t, etcd.Args, "--listen-client-urls=https://"+tt.listenAll+":2379")
+			assert.Contains(t, etcd.Args, "--listen-peer-urls=https://"+tt.listenAll+":2380")
+			assert.Contains(t, etcd.Args, "--advertise-client-urls=https://"+tt.etcdEndpoint)
+			assert.Contains(t, etcd.Args, "--initial-cluster="+tt.peerURLs)
+			assert.Contains(t, etcd.Env, "ETCDCTL_ENDPOINTS="+tt.localEtcd)
+			assert.Equal(t, "https://"+tt.etcdEndpoint+"/health", etcd.HealthCheck.URL)
+
+			kubeAPI := c.BuildKubeAPIProcess(host, v3.KubernetesServicesOptions{})
+			assert.Contains(t, plan.Processes, services.KubeAPIContainerName)
+			assert.Contains(t, kubeAPI.Command, "--advertise-address="+tt.addresses[0])
+			assert.Contains(t, kubeAPI.Command, "--service-cluster-ip-range="+tt.serviceCIDR)
+			assert.Contains(t, kubeAPI.Command, "--etcd-servers="+services.GetEtcdConnString(c.EtcdHosts, host.InternalAddress))
+			assert.Contains(t, services.GetEtcdConnString(c.EtcdHosts, host.InternalAddress), "https://"+tt.etcdEndpoint)
+
+			kubeProxy := c.BuildKubeProxyProcess(host, v3.KubernetesServicesOptions{})
+			assert.Contains(t, plan.Processes, services.KubeproxyContainerName)
+			assert.Contains(t, kubeProxy.Command, "--cluster-cidr="+tt.clusterCIDR)
+
+			assert.Contains(t, plan.Processes[services.KubeControllerContainerName].Command, "--cluster-cidr="+tt.clusterCIDR)
+			assert.Contains(t, plan.Processes[services.KubeletContainerName].Command, "--cluster-dns="+tt.dnsServer)
+			for _, portCheck := range plan.PortChecks {
+				assert.Equal(t, tt.addresses[0], portCheck.Address)
+			}
+		})
+	}
+}
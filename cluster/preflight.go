@@ -0,0 +1,554 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/services"
+	"github.com/rancher/rke/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PreflightCheckContainer = "rke-preflight-checker"
+
+	PreflightStatusPass = "pass"
+	PreflightStatusWarn = "warn"
+	PreflightStatusFail = "fail"
+
+	PreflightCheckDockerVersion = "docker-version"
+	PreflightCheckSwap          = "swap"
+	PreflightCheckKernelModules = "kernel-modules"
+	PreflightCheckSysctls       = "sysctls"
+	PreflightCheckEtcdDisk      = "etcd-disk"
+	PreflightCheckClockSkew     = "clock-skew"
+	PreflightCheckSELinux       = "selinux"
+	PreflightCheckPorts         = "ports"
+
+	// the etcd data directory needs room for the etcd database, its default quota is 2GiB
+	preflightEtcdDiskFailBytes = 2 << 30
+	preflightEtcdDiskWarnBytes = 10 << 30
+	// etcd warns about clock differences of more than 1s between members
+	preflightClockSkewWarn = 500 * time.Millisecond
+	preflightClockSkewFail = time.Second
+)
+
+// PreflightChecks is the catalog of the checks run by rke preflight, in order
+var PreflightChecks = []string{
+	PreflightCheckDockerVersion,
+	PreflightCheckSwap,
+	PreflightCheckKernelModules,
+	PreflightCheckSysctls,
+	PreflightCheckEtcdDisk,
+	PreflightCheckClockSkew,
+	PreflightCheckSELinux,
+	PreflightCheckPorts,
+}
+
+// preflightKernelModules are the kernel modules used by kube-proxy, the network plugins and the container runtime
+var preflightKernelModules = []string{
+	"br_netfilter",
+	"overlay",
+	"nf_conntrack",
+	"ip_tables",
+	"iptable_filter",
+	"iptable_nat",
+	"xt_conntrack",
+	"veth",
+}
+
+// preflightKernelDefaults are the sysctls the kubelet requires with protect-kernel-defaults
+var preflightKernelDefaults = map[string]string{
+	"vm.overcommit_memory":               "1",
+	"vm.panic_on_oom":                    "0",
+	"kernel.panic":                       "10",
+	"kernel.panic_on_oops":               "1",
+	"kernel.keys.root_maxkeys":           "1000000",
+	"kernel.keys.root_maxbytes":          "25000000",
+	"net.ipv4.ip_forward":                "1",
+	"net.bridge.bridge-nf-call-iptables": "1",
+}
+
+// preflightFactsScript prints the facts of the host as key=value lines, the root of the host is mounted on /host
+const preflightFactsScript = `echo "kernel=$(uname -r)"
+echo "swap=$(tail -n +2 /host/proc/swaps | wc -l)"
+for m in $MODULES; do
+  if grep -q "^$m " /host/proc/modules || grep -q "/$m.ko" /host/lib/modules/$(uname -r)/modules.builtin 2>/dev/null; then
+    echo "module.$m=loaded"
+  else
+    echo "module.$m=missing"
+  fi
+done
+for s in $SYSCTLS; do
+  f=/host/proc/sys/$(echo $s | tr . /)
+  if [ -f "$f" ]; then echo "sysctl.$s=$(cat $f)"; else echo "sysctl.$s="; fi
+done
+if [ -n "$ETCD_DIR" ]; then
+  d=/host$ETCD_DIR
+  while [ ! -d "$d" ]; do d=$(dirname "$d"); done
+  echo "disk.etcd=$(df -Pk "$d" | awk 'NR==2 {print $4}')"
+fi`
+
+// PreflightResult is the result of a check on a node
+type PreflightResult struct {
+	Node    string `json:"node"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// PreflightReport holds the results of the checks on the nodes
+type PreflightReport struct {
+	lock    sync.Mutex
+	Results []PreflightResult `json:"results"`
+}
+
+func (r *PreflightReport) add(node, check, status, message string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Results = append(r.Results, PreflightResult{Node: node, Check: check, Status: status, Message: message})
+}
+
+func (r *PreflightReport) sort() {
+	order := map[string]int{}
+	for i, check := range PreflightChecks {
+		order[check] = i
+	}
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		if r.Results[i].Node != r.Results[j].Node {
+			return r.Results[i].Node < r.Results[j].Node
+		}
+		return order[r.Results[i].Check] < order[r.Results[j].Check]
+	})
+}
+
+// Failed returns the failed checks
+func (r *PreflightReport) Failed() []PreflightResult {
+	return r.withStatus(PreflightStatusFail)
+}
+
+// Warnings returns the checks passed with warnings
+func (r *PreflightReport) Warnings() []PreflightResult {
+	return r.withStatus(PreflightStatusWarn)
+}
+
+func (r *PreflightReport) withStatus(status string) []PreflightResult {
+	var results []PreflightResult
+	for _, result := range r.Results {
+		if result.Status == status {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// WriteTable writes the results as a table
+func (r *PreflightReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tCHECK\tSTATUS\tMESSAGE")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Node, result.Check, strings.ToUpper(result.Status), result.Message)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the results as JSON
+func (r *PreflightReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Err returns an error listing the failed checks, if any
+func (r *PreflightReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, result := range failed {
+		messages = append(messages, fmt.Sprintf("[%s] on host [%s]: %s", result.Check, result.Node, result.Message))
+	}
+	return fmt.Errorf("[preflight] %d check(s) failed: %s", len(failed), strings.Join(messages, "; "))
+}
+
+// RunPreflightChecks runs the checks of the catalog on the nodes, skipping the checks in skip. The hosts must be tunneled.
+func (c *Cluster) RunPreflightChecks(ctx context.Context, skip []string) (*PreflightReport, error) {
+	report := &PreflightReport{}
+	enabled := map[string]bool{}
+	for _, check := range PreflightChecks {
+		enabled[check] = true
+	}
+	for _, check := range skip {
+		if !enabled[check] {
+			return nil, fmt.Errorf("[preflight] unknown check [%s], available checks: %v", check, PreflightChecks)
+		}
+		enabled[check] = false
+	}
+	log.Infof(ctx, "[preflight] Running pre-flight checks on the nodes")
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	err := runOnHosts(allHosts, WorkerThreads, func(host *hosts.Host) error {
+		if enabled[PreflightCheckDockerVersion] {
+			c.checkPreflightDockerVersion(host, report)
+		}
+		if enabled[PreflightCheckSwap] || enabled[PreflightCheckKernelModules] || enabled[PreflightCheckSysctls] || enabled[PreflightCheckEtcdDisk] {
+			c.runPreflightFactsChecks(ctx, host, enabled, report)
+		}
+		if enabled[PreflightCheckSELinux] {
+			c.checkPreflightSELinux(ctx, host, report)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if enabled[PreflightCheckClockSkew] {
+		checkPreflightClockSkew(c.EtcdHosts, measureClockOffsets(ctx, c.EtcdHosts), report)
+	}
+	if enabled[PreflightCheckPorts] {
+		if err := c.runPreflightPortChecks(ctx, report); err != nil {
+			return nil, err
+		}
+	}
+	report.sort()
+	return report, nil
+}
+
+func (c *Cluster) checkPreflightDockerVersion(host *hosts.Host, report *PreflightReport) {
+	err := hosts.CheckDockerVersion(host, c.Version)
+	switch {
+	case err == nil:
+		report.add(host.Address, PreflightCheckDockerVersion, PreflightStatusPass, fmt.Sprintf("%s %s", host.ContainerRuntime, host.DockerInfo.ServerVersion))
+	case c.IgnoreDockerVersion != nil && *c.IgnoreDockerVersion:
+		report.add(host.Address, PreflightCheckDockerVersion, PreflightStatusWarn, fmt.Sprintf("%v (ignored with ignore_docker_version)", err))
+	default:
+		report.add(host.Address, PreflightCheckDockerVersion, PreflightStatusFail, err.Error())
+	}
+}
+
+func (c *Cluster) runPreflightFactsChecks(ctx context.Context, host *hosts.Host, enabled map[string]bool, report *PreflightReport) {
+	if host.IsWindows() {
+		return
+	}
+	facts, err := c.getPreflightFacts(ctx, host)
+	if err != nil {
+		for _, check := range []string{PreflightCheckSwap, PreflightCheckKernelModules, PreflightCheckSysctls, PreflightCheckEtcdDisk} {
+			if enabled[check] {
+				report.add(host.Address, check, PreflightStatusFail, fmt.Sprintf("failed to inspect the node: %v", err))
+			}
+		}
+		return
+	}
+	if enabled[PreflightCheckSwap] {
+		status, message := c.evaluateSwap(facts)
+		report.add(host.Address, PreflightCheckSwap, status, message)
+	}
+	if enabled[PreflightCheckKernelModules] {
+		status, message := evaluateKernelModules(facts)
+		report.add(host.Address, PreflightCheckKernelModules, status, message)
+	}
+	if enabled[PreflightCheckSysctls] {
+		status, message := c.evaluateSysctls(facts)
+		report.add(host.Address, PreflightCheckSysctls, status, message)
+	}
+	if enabled[PreflightCheckEtcdDisk] && host.IsEtcd {
+		status, message := evaluateEtcdDisk(facts)
+		report.add(host.Address, PreflightCheckEtcdDisk, status, message)
+	}
+}
+
+// getPreflightFacts inspects the host in a one-time container
+func (c *Cluster) getPreflightFacts(ctx context.Context, host *hosts.Host) (map[string]string, error) {
+	sysctls := make([]string, 0, len(preflightKernelDefaults))
+	for sysctl := range preflightKernelDefaults {
+		sysctls = append(sysctls, sysctl)
+	}
+	sort.Strings(sysctls)
+	env := []string{
+		"MODULES=" + strings.Join(preflightKernelModules, " "),
+		"SYSCTLS=" + strings.Join(sysctls, " "),
+	}
+	if host.IsEtcd {
+		env = append(env, "ETCD_DIR="+path.Join(host.PrefixPath, "/var/lib/etcd"))
+	}
+	stdout, err := c.runInspectionContainer(ctx, host, PreflightCheckContainer, "preflight", preflightFactsScript, env)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("[preflight] Facts of host [%s]: %s", host.Address, stdout)
+	return parsePreflightFacts(stdout), nil
+}
+
+// runInspectionContainer runs script in a one-time container with the root filesystem of the host mounted read-only at /host and
+// returns its output
+func (c *Cluster) runInspectionContainer(ctx context.Context, host *hosts.Host, containerName, logPrefix, script string, env []string) (string, error) {
+	imageCfg := &container.Config{
+		Image: c.SystemImages.Alpine,
+		Cmd:   []string{"sh", "-c", script},
+		Env:   env,
+	}
+	hostCfg := &container.HostConfig{
+		// the sysctls of the network namespace of the host are read
+		NetworkMode: "host",
+		Binds:       []string{"/:/host:ro"},
+		SecurityOpt: []string{"label=disable"},
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+	if err := docker.DoRemoveContainer(ctx, host.DClient, containerName, host.Address); err != nil {
+		return "", err
+	}
+	if err := docker.DoRunContainer(ctx, host.DClient, imageCfg, hostCfg, containerName, host.Address, logPrefix, c.PrivateRegistriesMap); err != nil {
+		return "", err
+	}
+	status, _, stderr, err := docker.GetContainerOutput(ctx, host.DClient, containerName, host.Address, false)
+	var stdout string
+	if err == nil && status == 0 {
+		_, stdout, err = docker.GetContainerLogsStdoutStderr(ctx, host.DClient, containerName, "all", false)
+	}
+	if removeErr := docker.RemoveContainer(ctx, host.DClient, host.Address, containerName); removeErr != nil {
+		log.Warnf(ctx, "[%s] Failed to remove container [%s] on host [%s]: %v", logPrefix, containerName, host.Address, removeErr)
+	}
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		return "", fmt.Errorf("container [%s] exited with code [%d]: %s", containerName, status, strings.TrimSpace(stderr))
+	}
+	return stdout, nil
+}
+
+func parsePreflightFacts(output string) map[string]string {
+	facts := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			facts[key] = strings.TrimSpace(value)
+		}
+	}
+	return facts
+}
+
+func (c *Cluster) evaluateSwap(facts map[string]string) (string, string) {
+	swaps, err := strconv.Atoi(facts["swap"])
+	if err != nil {
+		return PreflightStatusWarn, "unable to determine if swap is enabled"
+	}
+	if swaps == 0 {
+		return PreflightStatusPass, "swap is disabled"
+	}
+	failSwapOn := c.Services.Kubelet.FailSwapOn
+	if value, ok := c.Services.Kubelet.ExtraArgs["fail-swap-on"]; ok {
+		failSwapOn = value == "true"
+	}
+	if failSwapOn {
+		return PreflightStatusFail, fmt.Sprintf("swap is enabled on %d device(s) and the kubelet runs with fail-swap-on", swaps)
+	}
+	return PreflightStatusWarn, fmt.Sprintf("swap is enabled on %d device(s), the memory of the pods may be swapped", swaps)
+}
+
+func evaluateKernelModules(facts map[string]string) (string, string) {
+	var missing []string
+	for _, module := range preflightKernelModules {
+		if facts["module."+module] != "loaded" {
+			missing = append(missing, module)
+		}
+	}
+	if len(missing) == 0 {
+		return PreflightStatusPass, "required kernel modules are loaded"
+	}
+	// the modules are loaded on demand when the kernel allows it
+	return PreflightStatusWarn, fmt.Sprintf("kernel modules not loaded: %s", strings.Join(missing, ", "))
+}
+
+// isKubeletProtectingKernelDefaults reports whether the kubelet is run with protect-kernel-defaults, set in the extra_args or by the
+// hardening profile
+func (c *Cluster) isKubeletProtectingKernelDefaults() bool {
+	if c.Services.Kubelet.ExtraArgs["protect-kernel-defaults"] == "true" {
+		return true
+	}
+	for _, control := range c.getHardeningControls() {
+		if control.Service == services.KubeletContainerName && control.Arg == "protect-kernel-defaults" {
+			return control.Value == "true"
+		}
+	}
+	return false
+}
+
+func (c *Cluster) evaluateSysctls(facts map[string]string) (string, string) {
+	var failures, warnings []string
+	if value := facts["sysctl.net.ipv4.ip_forward"]; value != "1" {
+		failures = append(failures, fmt.Sprintf("net.ipv4.ip_forward is [%s], expected [1]", value))
+	}
+	switch value := facts["sysctl.net.bridge.bridge-nf-call-iptables"]; value {
+	case "1":
+	case "":
+		warnings = append(warnings, "net.bridge.bridge-nf-call-iptables is not available, the br_netfilter module is not loaded")
+	default:
+		failures = append(failures, fmt.Sprintf("net.bridge.bridge-nf-call-iptables is [%s], expected [1]", value))
+	}
+	if c.isKubeletProtectingKernelDefaults() {
+		sysctls := make([]string, 0, len(preflightKernelDefaults))
+		for sysctl := range preflightKernelDefaults {
+			sysctls = append(sysctls, sysctl)
+		}
+		sort.Strings(sysctls)
+		for _, sysctl := range sysctls {
+			if strings.HasPrefix(sysctl, "net.") {
+				continue
+			}
+			if value := facts["sysctl."+sysctl]; value != preflightKernelDefaults[sysctl] {
+				failures = append(failures, fmt.Sprintf("%s is [%s], expected [%s] by the kubelet protect-kernel-defaults", sysctl, value, preflightKernelDefaults[sysctl]))
+			}
+		}
+	}
+	switch {
+	case len(failures) > 0:
+		return PreflightStatusFail, strings.Join(append(failures, warnings...), "; ")
+	case len(warnings) > 0:
+		return PreflightStatusWarn, strings.Join(warnings, "; ")
+	}
+	return PreflightStatusPass, "required sysctls are set"
+}
+
+func evaluateEtcdDisk(facts map[string]string) (string, string) {
+	availableKiB, err := strconv.ParseInt(facts["disk.etcd"], 10, 64)
+	if err != nil {
+		return PreflightStatusWarn, "unable to determine the available disk space of the etcd data directory"
+	}
+	available := availableKiB << 10
+	message := fmt.Sprintf("%.1f GiB available for the etcd data directory", float64(available)/(1<<30))
+	switch {
+	case available < preflightEtcdDiskFailBytes:
+		return PreflightStatusFail, fmt.Sprintf("%s, at least %d GiB are required", message, preflightEtcdDiskFailBytes>>30)
+	case available < preflightEtcdDiskWarnBytes:
+		return PreflightStatusWarn, fmt.Sprintf("%s, at least %d GiB are recommended", message, preflightEtcdDiskWarnBytes>>30)
+	}
+	return PreflightStatusPass, message
+}
+
+// measureClockOffsets returns the offset of the clocks of the hosts to the local clock, the time of the host is read from the
+// container runtime and compared to the middle of the request
+func measureClockOffsets(ctx context.Context, hostList []*hosts.Host) map[string]time.Duration {
+	offsets := map[string]time.Duration{}
+	for _, host := range hostList {
+		start := time.Now()
+		info, err := host.DClient.Info(ctx)
+		end := time.Now()
+		if err != nil || len(info.SystemTime) == 0 {
+			continue
+		}
+		hostTime, err := time.Parse(time.RFC3339Nano, info.SystemTime)
+		if err != nil {
+			continue
+		}
+		offsets[host.Address] = hostTime.Sub(start.Add(end.Sub(start) / 2))
+	}
+	return offsets
+}
+
+// checkPreflightClockSkew compares the clocks of the etcd hosts to their median
+func checkPreflightClockSkew(etcdHosts []*hosts.Host, offsets map[string]time.Duration, report *PreflightReport) {
+	var measured []time.Duration
+	for _, offset := range offsets {
+		measured = append(measured, offset)
+	}
+	sort.Slice(measured, func(i, j int) bool { return measured[i] < measured[j] })
+	for _, host := range etcdHosts {
+		offset, ok := offsets[host.Address]
+		if !ok {
+			report.add(host.Address, PreflightCheckClockSkew, PreflightStatusWarn, "unable to read the clock of the node")
+			continue
+		}
+		skew := offset - measured[len(measured)/2]
+		if skew < 0 {
+			skew = -skew
+		}
+		message := fmt.Sprintf("clock differs by %v from the other etcd nodes", skew.Round(time.Millisecond))
+		switch {
+		case skew > preflightClockSkewFail:
+			report.add(host.Address, PreflightCheckClockSkew, PreflightStatusFail, message+", please synchronize the clocks with NTP")
+		case skew > preflightClockSkewWarn:
+			report.add(host.Address, PreflightCheckClockSkew, PreflightStatusWarn, message)
+		default:
+			report.add(host.Address, PreflightCheckClockSkew, PreflightStatusPass, message)
+		}
+	}
+}
+
+func (c *Cluster) checkPreflightSELinux(ctx context.Context, host *hosts.Host, report *PreflightReport) {
+	if !hosts.IsDockerSELinuxEnabled(host) {
+		report.add(host.Address, PreflightCheckSELinux, PreflightStatusPass, "SELinux is not enabled in Docker")
+		return
+	}
+	matchedRange, err := util.SemVerMatchRange(c.Version, util.SemVerK8sVersion122OrHigher)
+	if err != nil || !matchedRange {
+		report.add(host.Address, PreflightCheckSELinux, PreflightStatusPass, "SELinux label is not required")
+		return
+	}
+	if err := checkSELinuxLabelOnHost(ctx, host, c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
+		report.add(host.Address, PreflightCheckSELinux, PreflightStatusFail, err.Error())
+		return
+	}
+	report.add(host.Address, PreflightCheckSELinux, PreflightStatusPass, fmt.Sprintf("SELinux label [%s] is recognized", SELinuxLabel))
+}
+
+// runPreflightPortChecks checks the connectivity between the planes like the port checks of rke up, reporting the results by node
+func (c *Cluster) runPreflightPortChecks(ctx context.Context, report *PreflightReport) error {
+	if err := c.deployTCPPortListeners(ctx, nil); err != nil {
+		return err
+	}
+	type portCheck struct {
+		ports  []string
+		target []*hosts.Host
+	}
+	checks := map[*hosts.Host][]portCheck{}
+	if len(c.EtcdHosts) > 1 {
+		for _, host := range c.EtcdHosts {
+			checks[host] = append(checks[host], portCheck{EtcdPortList, c.EtcdHosts})
+		}
+	}
+	for _, host := range c.ControlPlaneHosts {
+		checks[host] = append(checks[host], portCheck{EtcdClientPortList, c.EtcdHosts}, portCheck{WorkerPortList, c.WorkerHosts})
+	}
+	pluginPortList := c.getNetworkPluginPortList()
+	for _, host := range c.WorkerHosts {
+		checks[host] = append(checks[host], portCheck{ControlPlanePortList, c.ControlPlaneHosts})
+		if len(pluginPortList) > 0 && len(c.WorkerHosts) > 1 {
+			checks[host] = append(checks[host], portCheck{pluginPortList, c.WorkerHosts})
+		}
+	}
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	err := runOnHosts(allHosts, WorkerThreads, func(host *hosts.Host) error {
+		var errList []string
+		for _, check := range checks[host] {
+			if err := checkPlaneTCPPortsFromHost(ctx, host, check.ports, check.target, c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
+				errList = append(errList, err.Error())
+			}
+		}
+		if len(errList) > 0 {
+			report.add(host.Address, PreflightCheckPorts, PreflightStatusFail, strings.Join(errList, "; "))
+		} else {
+			report.add(host.Address, PreflightCheckPorts, PreflightStatusPass, "cluster ports are reachable")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.removeTCPPortListeners(ctx)
+}
@@ -0,0 +1,179 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/rke/docker/dockertest"
+	"github.com/rancher/rke/hosts"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePreflightFacts(t *testing.T) {
+	facts := parsePreflightFacts("kernel=5.15.0-91-generic\nswap=1\nmodule.overlay=loaded\nsysctl.net.bridge.bridge-nf-call-iptables=\n\nnoise\n")
+	assert.Equal(t, map[string]string{
+		"kernel":         "5.15.0-91-generic",
+		"swap":           "1",
+		"module.overlay": "loaded",
+		"sysctl.net.bridge.bridge-nf-call-iptables": "",
+	}, facts)
+}
+
+func TestEvaluatePreflightFacts(t *testing.T) {
+	c := &Cluster{}
+	status, _ := c.evaluateSwap(map[string]string{"swap": "0"})
+	assert.Equal(t, PreflightStatusPass, status)
+	status, _ = c.evaluateSwap(map[string]string{"swap": "1"})
+	assert.Equal(t, PreflightStatusWarn, status)
+	c.Services.Kubelet.FailSwapOn = true
+	status, _ = c.evaluateSwap(map[string]string{"swap": "1"})
+	assert.Equal(t, PreflightStatusFail, status)
+	c.Services.Kubelet.ExtraArgs = map[string]string{"fail-swap-on": "false"}
+	status, _ = c.evaluateSwap(map[string]string{"swap": "1"})
+	assert.Equal(t, PreflightStatusWarn, status)
+
+	facts := map[string]string{}
+	for _, module := range preflightKernelModules {
+		facts["module."+module] = "loaded"
+	}
+	status, _ = evaluateKernelModules(facts)
+	assert.Equal(t, PreflightStatusPass, status)
+	facts["module.br_netfilter"] = "missing"
+	status, message := evaluateKernelModules(facts)
+	assert.Equal(t, PreflightStatusWarn, status)
+	assert.Contains(t, message, "br_netfilter")
+
+	facts = map[string]string{
+		"sysctl.net.ipv4.ip_forward":                "1",
+		"sysctl.net.bridge.bridge-nf-call-iptables": "1",
+	}
+	status, _ = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusPass, status)
+	facts["sysctl.net.bridge.bridge-nf-call-iptables"] = ""
+	status, _ = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusWarn, status)
+	facts["sysctl.net.ipv4.ip_forward"] = "0"
+	status, message = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusFail, status)
+	assert.Contains(t, message, "net.ipv4.ip_forward")
+	assert.Contains(t, message, "bridge-nf-call-iptables")
+
+	// the kernel defaults are only checked with protect-kernel-defaults
+	facts = map[string]string{}
+	for sysctl, value := range preflightKernelDefaults {
+		facts["sysctl."+sysctl] = value
+	}
+	c.Services.Kubelet.ExtraArgs = map[string]string{"protect-kernel-defaults": "true"}
+	status, _ = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusPass, status)
+	facts["sysctl.vm.overcommit_memory"] = "0"
+	status, message = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusFail, status)
+	assert.Contains(t, message, "vm.overcommit_memory is [0], expected [1]")
+
+	// the hardening profile sets protect-kernel-defaults
+	c.Services.Kubelet.ExtraArgs = nil
+	status, _ = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusPass, status)
+	c.HardeningProfile = "cis-1.24"
+	status, _ = c.evaluateSysctls(facts)
+	assert.Equal(t, PreflightStatusFail, status)
+	c.HardeningProfile = ""
+
+	status, _ = evaluateEtcdDisk(map[string]string{"disk.etcd": "52428800"})
+	assert.Equal(t, PreflightStatusPass, status)
+	status, _ = evaluateEtcdDisk(map[string]string{"disk.etcd": "5242880"})
+	assert.Equal(t, PreflightStatusWarn, status)
+	status, _ = evaluateEtcdDisk(map[string]string{"disk.etcd": "1048576"})
+	assert.Equal(t, PreflightStatusFail, status)
+	status, _ = evaluateEtcdDisk(map[string]string{})
+	assert.Equal(t, PreflightStatusWarn, status)
+}
+
+func TestCheckPreflightClockSkew(t *testing.T) {
+	var etcdHosts []*hosts.Host
+	for _, address := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5"} {
+		etcdHosts = append(etcdHosts, &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: address}})
+	}
+	report := &PreflightReport{}
+	checkPreflightClockSkew(etcdHosts, map[string]time.Duration{
+		"1.1.1.1": 2 * time.Second,
+		"2.2.2.2": 2*time.Second + 100*time.Millisecond,
+		"3.3.3.3": 2*time.Second + 700*time.Millisecond,
+		"4.4.4.4": -time.Second,
+	}, report)
+	statuses := map[string]string{}
+	for _, result := range report.Results {
+		assert.Equal(t, PreflightCheckClockSkew, result.Check)
+		statuses[result.Node] = result.Status
+	}
+	assert.Equal(t, map[string]string{
+		"1.1.1.1": PreflightStatusPass,
+		"2.2.2.2": PreflightStatusPass,
+		"3.3.3.3": PreflightStatusWarn,
+		"4.4.4.4": PreflightStatusFail,
+		"5.5.5.5": PreflightStatusWarn,
+	}, statuses)
+}
+
+func TestPreflightReport(t *testing.T) {
+	report := &PreflightReport{}
+	report.add("2.2.2.2", PreflightCheckSwap, PreflightStatusPass, "swap is disabled")
+	report.add("1.1.1.1", PreflightCheckEtcdDisk, PreflightStatusFail, "1.0 GiB available")
+	report.add("1.1.1.1", PreflightCheckSwap, PreflightStatusWarn, "swap is enabled")
+	report.sort()
+	assert.Equal(t, "1.1.1.1", report.Results[0].Node)
+	assert.Equal(t, PreflightCheckSwap, report.Results[0].Check)
+	assert.Len(t, report.Failed(), 1)
+	assert.Len(t, report.Warnings(), 1)
+	assert.ErrorContains(t, report.Err(), "[etcd-disk] on host [1.1.1.1]")
+
+	var table bytes.Buffer
+	assert.NoError(t, report.WriteTable(&table))
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, []string{"NODE", "CHECK", "STATUS", "MESSAGE"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"1.1.1.1", "swap", "WARN", "swap", "is", "enabled"}, strings.Fields(lines[1]))
+
+	var out bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&out))
+	var decoded PreflightReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, report.Results, decoded.Results)
+
+	assert.NoError(t, (&PreflightReport{}).Err())
+	_, err := (&Cluster{}).RunPreflightChecks(context.Background(), []string{"unknown"})
+	assert.ErrorContains(t, err, "unknown check [unknown]")
+}
+
+func TestGetPreflightFacts(t *testing.T) {
+	runtime := dockertest.NewRuntime(func(name string, c *dockertest.Container) {
+		assert.Equal(t, PreflightCheckContainer, name)
+		assert.Contains(t, c.Config.Env, "ETCD_DIR=/var/lib/etcd")
+		c.Stdout = "kernel=5.15.0\nswap=0\nsysctl.net.ipv4.ip_forward=1\ndisk.etcd=1048576\n"
+		c.Stderr = "modprobe: not found\n"
+	})
+	c := &Cluster{}
+	c.SystemImages.Alpine = "rancher/rke-tools:v0.1.100"
+	host := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}, IsEtcd: true, DClient: runtime}
+	facts, err := c.getPreflightFacts(context.Background(), host)
+	assert.NoError(t, err)
+	// every line of the output is read, not only the last one or stderr
+	assert.Equal(t, "5.15.0", facts["kernel"])
+	assert.Equal(t, "1", facts["sysctl.net.ipv4.ip_forward"])
+	assert.Equal(t, "1048576", facts["disk.etcd"])
+	assert.Empty(t, runtime.Containers())
+
+	runtime.Run = func(name string, c *dockertest.Container) {
+		c.ExitCode = 1
+		c.Stderr = "sh: broken\n"
+	}
+	_, err = c.getPreflightFacts(context.Background(), host)
+	assert.ErrorContains(t, err, "exited with code [1]: sh: broken")
+	assert.Empty(t, runtime.Containers())
+}
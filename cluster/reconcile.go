@@ -132,7 +132,7 @@ func reconcileHost(ctx context.Context, toDeleteHost *hosts.Host, worker, etcd b
 	retries := 3
 	sleepSeconds := 3
 	for i := 0; i < retries; i++ {
-		if retryErr = toDeleteHost.TunnelUp(ctx, cluster.DockerDialerFactory, cluster.getPrefixPath(toDeleteHost.OS()), cluster.Version); retryErr != nil {
+		if retryErr = toDeleteHost.TunnelUp(ctx, cluster.DockerDialerFactory, cluster.CommandRunnerFactory, cluster.getPrefixPath(toDeleteHost.OS()), cluster.Version); retryErr != nil {
 			logrus.Debugf("Failed to dial the host %s trying again in %d seconds", toDeleteHost.Address, sleepSeconds)
 			time.Sleep(time.Second * time.Duration(sleepSeconds))
 			toDeleteHost.DClient = nil
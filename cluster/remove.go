@@ -9,8 +9,6 @@ import (
 	"github.com/rancher/rke/pki"
 	"github.com/rancher/rke/services"
 	v3 "github.com/rancher/rke/types"
-	"github.com/rancher/rke/util"
-	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -22,26 +20,13 @@ func (c *Cluster) ClusterRemove(ctx context.Context) error {
 	return nil
 }
 
-func cleanUpHosts(ctx context.Context, cpHosts, workerHosts, etcdHosts []*hosts.Host, cleanerImage string, prsMap map[string]v3.PrivateRegistry, externalEtcd bool, k8sVersion string) error {
+func cleanUpHosts(ctx context.Context, cpHosts, workerHosts, etcdHosts []*hosts.Host, cleanerImage string, prsMap map[string]v3.PrivateRegistry, externalEtcd bool, k8sVersion string, workers int) error {
 
 	uniqueHosts := hosts.GetUniqueHostList(cpHosts, workerHosts, etcdHosts)
 
-	var errgrp errgroup.Group
-	hostsQueue := util.GetObjectQueue(uniqueHosts)
-	for w := 0; w < WorkerThreads; w++ {
-		errgrp.Go(func() error {
-			var errList []error
-			for host := range hostsQueue {
-				runHost := host.(*hosts.Host)
-				if err := runHost.CleanUpAll(ctx, cleanerImage, prsMap, externalEtcd, k8sVersion); err != nil {
-					errList = append(errList, err)
-				}
-			}
-			return util.ErrList(errList)
-		})
-	}
-
-	return errgrp.Wait()
+	return runOnHosts(uniqueHosts, workers, func(runHost *hosts.Host) error {
+		return runHost.CleanUpAll(ctx, cleanerImage, prsMap, externalEtcd, k8sVersion)
+	})
 }
 
 func (c *Cluster) CleanupNodes(ctx context.Context) error {
@@ -66,7 +51,7 @@ func (c *Cluster) CleanupNodes(ctx context.Context) error {
 	}
 
 	// Clean up all hosts
-	return cleanUpHosts(ctx, c.ControlPlaneHosts, c.WorkerHosts, c.EtcdHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap, externalEtcd, c.Version)
+	return cleanUpHosts(ctx, c.ControlPlaneHosts, c.WorkerHosts, c.EtcdHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap, externalEtcd, c.Version, c.hostWorkers(ParallelismCleanup))
 }
 
 func (c *Cluster) CleanupFiles(ctx context.Context) error {
@@ -100,7 +85,7 @@ func (c *Cluster) RemoveOldNodes(ctx context.Context) error {
 				}
 			}
 			if err := k8s.DeleteNode(kubeClient, node.Name, nodeAddress, c.CloudProvider.Name); err != nil {
-				log.Warnf(ctx, "Failed to delete old node [%s] from kubernetes")
+				log.Warnf(ctx, "Failed to delete old node [%s] from kubernetes: %v", node.Name, err)
 			}
 		}
 	}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rancher/rke/hosts"
+)
+
+const sshHostKeysStateField = "sshHostKeys"
+
+// sshHostKeysLock serializes the updates of the host keys recorded in the state file
+var sshHostKeysLock sync.Mutex
+
+// setHostKeyVerifier sets the verifier of the SSH host keys of the hosts, host keys trusted on first use are recorded in the
+// state file as soon as the host is reached
+func (c *Cluster) setHostKeyVerifier() error {
+	var trusted map[string]string
+	if c.SSHHostKeyChecking == hosts.HostKeyCheckingTrustOnFirstUse {
+		var err error
+		if trusted, err = readSSHHostKeys(c.StateFilePath); err != nil {
+			return err
+		}
+	}
+	statePath := c.StateFilePath
+	verifier, err := hosts.NewHostKeyVerifier(c.SSHHostKeyChecking, c.SSHKnownHostsPath, trusted, func(address, fingerprint string) error {
+		return recordSSHHostKey(statePath, address, fingerprint)
+	})
+	if err != nil {
+		return err
+	}
+	c.HostKeyVerifier = verifier
+	return nil
+}
+
+// getSnapshotHostKeyVerifier returns the verifier of the host key of the sftp backup server. Unlike the nodes, the server
+// host key is always verified, it is trusted on first use unless host key checking is strict.
+func (c *Cluster) getSnapshotHostKeyVerifier() (*hosts.HostKeyVerifier, error) {
+	if c.SSHHostKeyChecking == hosts.HostKeyCheckingStrict || c.SSHHostKeyChecking == hosts.HostKeyCheckingTrustOnFirstUse {
+		if c.HostKeyVerifier != nil {
+			return c.HostKeyVerifier, nil
+		}
+	}
+	mode := c.SSHHostKeyChecking
+	if mode != hosts.HostKeyCheckingStrict {
+		mode = hosts.HostKeyCheckingTrustOnFirstUse
+	}
+	trusted, err := readSSHHostKeys(c.StateFilePath)
+	if err != nil {
+		return nil, err
+	}
+	statePath := c.StateFilePath
+	return hosts.NewHostKeyVerifier(mode, c.SSHKnownHostsPath, trusted, func(address, fingerprint string) error {
+		return recordSSHHostKey(statePath, address, fingerprint)
+	})
+}
+
+// readSSHHostKeys returns the fingerprints of the host keys recorded in the state file
+func readSSHHostKeys(statePath string) (map[string]string, error) {
+	buf, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("[state] failed to read state file: %v", err)
+	}
+	state := struct {
+		SSHHostKeys map[string]string `json:"sshHostKeys"`
+	}{}
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil, fmt.Errorf("[state] failed to unmarshal the state file: %v", err)
+	}
+	return state.SSHHostKeys, nil
+}
+
+// recordSSHHostKey adds the fingerprint of a host key to the state file, the rest of the state file is left untouched
+func recordSSHHostKey(statePath, address, fingerprint string) error {
+	sshHostKeysLock.Lock()
+	defer sshHostKeysLock.Unlock()
+	state := map[string]json.RawMessage{}
+	buf, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("[state] failed to read state file: %v", err)
+	}
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &state); err != nil {
+			return fmt.Errorf("[state] failed to unmarshal the state file: %v", err)
+		}
+	}
+	sshHostKeys := map[string]string{}
+	if raw, ok := state[sshHostKeysStateField]; ok {
+		if err := json.Unmarshal(raw, &sshHostKeys); err != nil {
+			return fmt.Errorf("[state] failed to unmarshal the SSH host keys of the state file: %v", err)
+		}
+	}
+	sshHostKeys[address] = fingerprint
+	raw, err := json.Marshal(sshHostKeys)
+	if err != nil {
+		return err
+	}
+	state[sshHostKeysStateField] = raw
+	stateFile, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("[state] Failed to Marshal state object: %v", err)
+	}
+	if err := os.WriteFile(statePath, stateFile, 0600); err != nil {
+		return fmt.Errorf("[state] Failed to write state file: %v", err)
+	}
+	return nil
+}
+
+// mergeSSHHostKeys adds the host keys recorded in the state file since the state was read, sshHostKeysLock must be held
+func (s *FullState) mergeSSHHostKeys(statePath string) {
+	recorded, err := readSSHHostKeys(statePath)
+	if err != nil {
+		return
+	}
+	for address, fingerprint := range recorded {
+		if s.SSHHostKeys == nil {
+			s.SSHHostKeys = map[string]string{}
+		}
+		if _, ok := s.SSHHostKeys[address]; !ok {
+			s.SSHHostKeys[address] = fingerprint
+		}
+	}
+}
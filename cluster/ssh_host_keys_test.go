@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRecordSSHHostKey(t *testing.T) {
+	ctx := context.Background()
+	statePath := filepath.Join(t.TempDir(), "cluster.rkestate")
+
+	// the host keys trusted before the state file is written are kept
+	assert.NoError(t, recordSSHHostKey(statePath, "1.1.1.1:22", "SHA256:first"))
+	fullState := &FullState{}
+	fullState.DesiredState.EncryptionConfig = "test"
+	assert.NoError(t, fullState.WriteStateFile(ctx, statePath))
+
+	assert.NoError(t, recordSSHHostKey(statePath, "2.2.2.2:22", "SHA256:second"))
+	readState, err := ReadStateFile(ctx, statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", readState.DesiredState.EncryptionConfig)
+	assert.Equal(t, map[string]string{"1.1.1.1:22": "SHA256:first", "2.2.2.2:22": "SHA256:second"}, readState.SSHHostKeys)
+
+	// a state read before a host key was recorded doesn't drop it
+	assert.NoError(t, recordSSHHostKey(statePath, "3.3.3.3:22", "SHA256:third"))
+	assert.NoError(t, readState.WriteStateFile(ctx, statePath))
+	trusted, err := readSSHHostKeys(statePath)
+	assert.NoError(t, err)
+	assert.Len(t, trusted, 3)
+
+	trusted, err = readSSHHostKeys(filepath.Join(t.TempDir(), "missing.rkestate"))
+	assert.NoError(t, err)
+	assert.Nil(t, trusted)
+
+	assert.NoError(t, os.WriteFile(statePath, []byte("invalid"), 0600))
+	assert.Error(t, recordSSHHostKey(statePath, "1.1.1.1:22", "SHA256:first"))
+}
+
+func TestGetSnapshotHostKeyVerifier(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.NoError(t, err)
+	statePath := filepath.Join(t.TempDir(), "cluster.rkestate")
+
+	// without host key checking, the sftp server host key is trusted on first use
+	c := &Cluster{StateFilePath: statePath}
+	verifier, err := c.getSnapshotHostKeyVerifier()
+	assert.NoError(t, err)
+	callback, err := verifier.HostKeyCallback("")
+	assert.NoError(t, err)
+	assert.NoError(t, callback("backup:22", nil, signer.PublicKey()))
+	trusted, err := readSSHHostKeys(statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"backup:22": ssh.FingerprintSHA256(signer.PublicKey())}, trusted)
+
+	c.SSHHostKeyChecking = hosts.HostKeyCheckingStrict
+	verifier, err = c.getSnapshotHostKeyVerifier()
+	assert.NoError(t, err)
+	callback, err = verifier.HostKeyCallback("")
+	assert.NoError(t, err)
+	assert.Error(t, callback("backup:22", nil, signer.PublicKey()))
+}
@@ -38,14 +38,18 @@ var (
 )
 
 type FullState struct {
-	DesiredState State `json:"desiredState,omitempty"`
-	CurrentState State `json:"currentState,omitempty"`
+	DesiredState State       `json:"desiredState,omitempty"`
+	CurrentState State       `json:"currentState,omitempty"`
+	CARotation   *CARotation `json:"caRotation,omitempty"`
+	// SSHHostKeys holds the fingerprints of the SSH host keys trusted on first use by host address
+	SSHHostKeys map[string]string `json:"sshHostKeys,omitempty"`
 }
 
 type State struct {
 	RancherKubernetesEngineConfig *v3.RancherKubernetesEngineConfig `json:"rkeConfig,omitempty"`
 	CertificatesBundle            map[string]pki.CertificatePKI     `json:"certificatesBundle,omitempty"`
 	EncryptionConfig              string                            `json:"encryptionConfig,omitempty"`
+	NetworkPluginMigration        *NetworkPluginMigration           `json:"networkPluginMigration,omitempty"`
 }
 
 func (c *Cluster) UpdateClusterCurrentState(ctx context.Context, fullState *FullState) error {
@@ -71,6 +75,7 @@ func (c *Cluster) GetClusterState(ctx context.Context, fullState *FullState) (*C
 	currentCluster.EncryptionConfig.EncryptionProviderFile = fullState.CurrentState.EncryptionConfig
 	// resetup dialers
 	dialerOptions := hosts.GetDialerOptions(c.DockerDialerFactory, c.LocalConnDialerFactory, c.K8sWrapTransport)
+	dialerOptions.CommandRunnerFactory = c.CommandRunnerFactory
 	if err := currentCluster.SetupDialers(ctx, dialerOptions); err != nil {
 		return nil, err
 	}
@@ -297,6 +302,8 @@ func RebuildState(ctx context.Context, kubeCluster *Cluster, oldState *FullState
 		}
 		newState.DesiredState.CertificatesBundle = certBundle
 		newState.CurrentState = oldState.CurrentState
+		newState.CARotation = oldState.CARotation
+		newState.SSHHostKeys = oldState.SSHHostKeys
 
 		err = updateEncryptionConfig(kubeCluster, oldState, newState)
 		if err != nil {
@@ -316,10 +323,15 @@ func RebuildState(ctx context.Context, kubeCluster *Cluster, oldState *FullState
 		}
 	}
 	newState.CurrentState = oldState.CurrentState
+	newState.CARotation = oldState.CARotation
+	newState.SSHHostKeys = oldState.SSHHostKeys
 	return newState, nil
 }
 
 func (s *FullState) WriteStateFile(ctx context.Context, statePath string) error {
+	sshHostKeysLock.Lock()
+	defer sshHostKeysLock.Unlock()
+	s.mergeSSHHostKeys(statePath)
 	stateFile, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return fmt.Errorf("[state] Failed to Marshal state object: %v", err)
@@ -370,6 +382,9 @@ func StringToFullState(ctx context.Context, stateFileContent string) (*FullState
 	}
 	rkeFullState.DesiredState.CertificatesBundle = pki.TransformPEMToObject(rkeFullState.DesiredState.CertificatesBundle)
 	rkeFullState.CurrentState.CertificatesBundle = pki.TransformPEMToObject(rkeFullState.CurrentState.CertificatesBundle)
+	if rkeFullState.CARotation != nil {
+		rkeFullState.CARotation.transformPEMToObject()
+	}
 	logrus.Tracef("rkeFullState: %+v", rkeFullState)
 
 	return rkeFullState, nil
@@ -395,6 +410,9 @@ func ReadStateFile(ctx context.Context, statePath string) (*FullState, error) {
 	}
 	rkeFullState.DesiredState.CertificatesBundle = pki.TransformPEMToObject(rkeFullState.DesiredState.CertificatesBundle)
 	rkeFullState.CurrentState.CertificatesBundle = pki.TransformPEMToObject(rkeFullState.CurrentState.CertificatesBundle)
+	if rkeFullState.CARotation != nil {
+		rkeFullState.CARotation.transformPEMToObject()
+	}
 	return rkeFullState, nil
 }
 
@@ -453,7 +471,7 @@ func rebuildExistingState(ctx context.Context, kubeCluster *Cluster, oldState, n
 	pkiCertBundle := oldState.DesiredState.CertificatesBundle
 	// check for legacy clusters prior to requestheaderca
 	if pkiCertBundle[pki.RequestHeaderCACertName].Certificate == nil {
-		if err := pki.GenerateRKERequestHeaderCACert(ctx, pkiCertBundle, flags.ClusterFilePath, flags.ConfigDir); err != nil {
+		if err := pki.GenerateRKERequestHeaderCACert(ctx, pkiCertBundle, *rkeConfig, flags.ClusterFilePath, flags.ConfigDir); err != nil {
 			return err
 		}
 	}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/blang/semver"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
 	"github.com/rancher/rke/log"
 	"github.com/rancher/rke/metadata"
 	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/pki/cert"
 	"github.com/rancher/rke/services"
+	v3 "github.com/rancher/rke/types"
 	"github.com/rancher/rke/util"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
@@ -34,6 +42,16 @@ func (c *Cluster) ValidateCluster(ctx context.Context) error {
 		return err
 	}
 
+	// validate SSH options
+	if err := validateSSHOptions(c); err != nil {
+		return err
+	}
+
+	// validate node agent connectivity
+	if err := validateAgentTunnel(c); err != nil {
+		return err
+	}
+
 	// validate Auth options
 	if err := validateAuthOptions(c); err != nil {
 		return err
@@ -59,6 +77,21 @@ func (c *Cluster) ValidateCluster(ctx context.Context) error {
 		return err
 	}
 
+	// validate hardening profile
+	if err := validateHardeningProfile(ctx, c); err != nil {
+		return err
+	}
+
+	// validate parallelism options
+	if err := validateParallelismOptions(c); err != nil {
+		return err
+	}
+
+	// validate certificates options
+	if err := validateCertificatesOptions(c); err != nil {
+		return err
+	}
+
 	// validate services options
 	return validateServicesOptions(c)
 }
@@ -207,7 +240,7 @@ func validateAciCloudOptionsDisabled(option string, value string) (string, strin
 }
 
 func validateNetworkOptions(c *Cluster) error {
-	if c.Network.Plugin != NoNetworkPlugin && c.Network.Plugin != FlannelNetworkPlugin && c.Network.Plugin != CalicoNetworkPlugin && c.Network.Plugin != CanalNetworkPlugin && c.Network.Plugin != WeaveNetworkPlugin && c.Network.Plugin != AciNetworkPlugin {
+	if c.Network.Plugin != NoNetworkPlugin && c.Network.Plugin != FlannelNetworkPlugin && c.Network.Plugin != CalicoNetworkPlugin && c.Network.Plugin != CanalNetworkPlugin && c.Network.Plugin != WeaveNetworkPlugin && c.Network.Plugin != AciNetworkPlugin && c.Network.Plugin != CiliumNetworkPlugin {
 		return fmt.Errorf("Network plugin [%s] is not supported", c.Network.Plugin)
 	}
 	if c.Network.Plugin == FlannelNetworkPlugin && c.Network.MTU != 0 {
@@ -230,18 +263,30 @@ func validateNetworkOptions(c *Cluster) error {
 		}
 	}
 
-	dualStack := false
-	serviceClusterRanges := strings.Split(c.Services.KubeAPI.ServiceClusterIPRange, ",")
-	if len(serviceClusterRanges) > 1 {
-		logrus.Debugf("Found more than 1 service cluster IP range, assuming dual stack")
-		dualStack = true
+	if c.Network.Plugin == CiliumNetworkPlugin {
+		switch c.Network.Options[CiliumTunnelProtocol] {
+		case CiliumTunnelProtocolVxLan, CiliumTunnelProtocolGeneve, CiliumTunnelProtocolDisabled:
+		default:
+			return fmt.Errorf("Network plugin [%s] does not support tunnel protocol [%s], supported protocols: %s, %s, %s", CiliumNetworkPlugin, c.Network.Options[CiliumTunnelProtocol], CiliumTunnelProtocolVxLan, CiliumTunnelProtocolGeneve, CiliumTunnelProtocolDisabled)
+		}
+		switch c.Network.Options[CiliumIPAMMode] {
+		case CiliumIPAMModeKubernetes, CiliumIPAMModeClusterPool:
+		default:
+			return fmt.Errorf("Network plugin [%s] does not support IPAM mode [%s], supported modes: %s, %s", CiliumNetworkPlugin, c.Network.Options[CiliumIPAMMode], CiliumIPAMModeKubernetes, CiliumIPAMModeClusterPool)
+		}
+		for _, option := range []string{CiliumKubeProxyReplacement, CiliumEnableHubble} {
+			if _, err := strconv.ParseBool(c.Network.Options[option]); err != nil {
+				return fmt.Errorf("Network plugin [%s] option [%s] must be true or false, got [%s]", CiliumNetworkPlugin, option, c.Network.Options[option])
+			}
+		}
 	}
-	clusterCIDRs := strings.Split(c.Services.KubeController.ClusterCIDR, ",")
-	if len(clusterCIDRs) > 1 {
-		logrus.Debugf("Found more than 1 cluster CIDR, assuming dual stack")
-		dualStack = true
+
+	ipv4, ipv6, err := validateIPFamilies(c)
+	if err != nil {
+		return err
 	}
-	if dualStack {
+	dualStack := ipv4 && ipv6
+	if ipv6 {
 		IPv6CompatibleNetworkPluginFound := false
 		for _, networkPlugin := range IPv6CompatibleNetworkPlugins {
 			if c.Network.Plugin == networkPlugin {
@@ -251,8 +296,13 @@ func validateNetworkOptions(c *Cluster) error {
 			}
 		}
 		if !IPv6CompatibleNetworkPluginFound {
-			return fmt.Errorf("Network plugin [%s] does not support IPv6 (dualstack)", c.Network.Plugin)
+			if dualStack {
+				return fmt.Errorf("Network plugin [%s] does not support IPv6 (dualstack)", c.Network.Plugin)
+			}
+			return fmt.Errorf("Network plugin [%s] does not support IPv6", c.Network.Plugin)
 		}
+	}
+	if dualStack {
 		if c.Network.Plugin == AciNetworkPlugin {
 			k8sVersion := c.RancherKubernetesEngineConfig.Version
 			toMatch, err := semver.Make(k8sVersion[1:])
@@ -318,6 +368,69 @@ func validateNetworkOptions(c *Cluster) error {
 	return nil
 }
 
+// validateIPFamilies checks that the service cluster IP ranges and the cluster CIDR have an IPv4 or an IPv6 CIDR, or one of each family for
+// dual-stack, all with the same families, and that the cluster DNS server is in one of them. The nodes of IPv6-only clusters need IPv6
+// addresses. It returns whether the cluster uses IPv4 and IPv6.
+func validateIPFamilies(c *Cluster) (bool, bool, error) {
+	serviceClusterIPRange := c.Services.KubeAPI.ServiceClusterIPRange
+	if serviceClusterIPRange == "" || c.Services.KubeController.ServiceClusterIPRange == "" || c.Services.KubeController.ClusterCIDR == "" {
+		// empty ranges are reported with the services options
+		return false, false, nil
+	}
+	ipv4, ipv6, err := getCIDRsIPFamilies("kube-api service_cluster_ip_range", serviceClusterIPRange)
+	if err != nil {
+		return false, false, err
+	}
+	for name, cidrs := range map[string]string{
+		"kube-controller service_cluster_ip_range": c.Services.KubeController.ServiceClusterIPRange,
+		"kube-controller cluster_cidr":             c.Services.KubeController.ClusterCIDR,
+	} {
+		cidrsIPv4, cidrsIPv6, err := getCIDRsIPFamilies(name, cidrs)
+		if err != nil {
+			return false, false, err
+		}
+		if cidrsIPv4 != ipv4 || cidrsIPv6 != ipv6 {
+			return false, false, fmt.Errorf("%s [%s] must have the same IP families as kube-api service_cluster_ip_range [%s]", name, cidrs, serviceClusterIPRange)
+		}
+	}
+	for _, dnsServer := range strings.Split(c.Services.Kubelet.ClusterDNSServer, ",") {
+		if dnsServer = strings.TrimSpace(dnsServer); dnsServer == "" {
+			continue
+		}
+		ip := net.ParseIP(dnsServer)
+		if ip == nil {
+			return false, false, fmt.Errorf("kubelet cluster_dns_server [%s] is not an IP address", dnsServer)
+		}
+		if (ip.To4() != nil && !ipv4) || (ip.To4() == nil && !ipv6) {
+			return false, false, fmt.Errorf("kubelet cluster_dns_server [%s] is not in the IP families of kube-api service_cluster_ip_range [%s]", dnsServer, serviceClusterIPRange)
+		}
+	}
+	if !ipv4 {
+		for _, node := range c.Nodes {
+			address := node.InternalAddress
+			if address == "" {
+				address = node.Address
+			}
+			if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+				return false, false, fmt.Errorf("Host [%s] address [%s] is IPv4, hosts of an IPv6-only cluster need IPv6 addresses", node.Address, address)
+			}
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// getCIDRsIPFamilies returns whether the comma separated CIDRs have an IPv4 and an IPv6 CIDR, at most one of each family
+func getCIDRsIPFamilies(name, cidrs string) (bool, bool, error) {
+	ipv4CIDRs, ipv6CIDRs, err := getCIDRsByFamily(cidrs)
+	if err != nil {
+		return false, false, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(ipv4CIDRs) > 1 || len(ipv6CIDRs) > 1 {
+		return false, false, fmt.Errorf("%s [%s] can have at most one IPv4 and one IPv6 CIDR", name, cidrs)
+	}
+	return len(ipv4CIDRs) == 1, len(ipv6CIDRs) == 1, nil
+}
+
 func validateHostsOptions(c *Cluster) error {
 	for i, host := range c.Nodes {
 		if len(host.Address) == 0 {
@@ -337,10 +450,135 @@ func validateHostsOptions(c *Cluster) error {
 				return fmt.Errorf("Role [%s] for host (%d) is not recognized", role, i+1)
 			}
 		}
+		if err := validateContainerRuntime(c, host.ContainerRuntime); err != nil {
+			return fmt.Errorf("Container_runtime for host (%d) is not valid: %v", i+1, err)
+		}
+		if _, _, err := hosts.ParseHostKeys(host.HostKey); err != nil {
+			return fmt.Errorf("Host_key for host (%d) is not valid: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateSSHOptions(c *Cluster) error {
+	switch c.SSHHostKeyChecking {
+	case "", hosts.HostKeyCheckingStrict, hosts.HostKeyCheckingTrustOnFirstUse:
+	default:
+		return fmt.Errorf("ssh_host_key_checking [%s] is not valid, allowed values: %v", c.SSHHostKeyChecking, hosts.HostKeyCheckingModes)
+	}
+	if err := validateBastionHost(c.BastionHost); err != nil {
+		return fmt.Errorf("Bastion_host is not valid: %v", err)
+	}
+	for i, host := range c.Nodes {
+		bastionAddress := c.BastionHost.Address
+		if host.BastionHost != nil {
+			if err := validateBastionHost(*host.BastionHost); err != nil {
+				return fmt.Errorf("Bastion_host for host (%d) is not valid: %v", i+1, err)
+			}
+			bastionAddress = host.BastionHost.Address
+		}
+		if len(host.Proxy) == 0 {
+			continue
+		}
+		if _, err := hosts.ParseProxyURL(host.Proxy); err != nil {
+			return fmt.Errorf("Proxy for host (%d) is not valid: %v", i+1, err)
+		}
+		if len(bastionAddress) > 0 {
+			return fmt.Errorf("Proxy for host (%d) is not used as the host is reached through bastion host [%s], set the proxy of the bastion host instead", i+1, bastionAddress)
+		}
+	}
+	return nil
+}
+
+func validateAgentTunnel(c *Cluster) error {
+	agentNodes := 0
+	for i, host := range c.Nodes {
+		switch host.ConnectionType {
+		case "", hosts.ConnectionTypeSSH:
+			continue
+		case hosts.ConnectionTypeAgent:
+		default:
+			return fmt.Errorf("Connection_type for host (%d) is not valid: [%s], allowed values: %v", i+1, host.ConnectionType, hosts.ConnectionTypes)
+		}
+		if host.BastionHost != nil && len(host.BastionHost.Address) > 0 {
+			return fmt.Errorf("Bastion_host for host (%d) can't be used with connection_type agent", i+1)
+		}
+		if len(host.Proxy) > 0 {
+			return fmt.Errorf("Proxy for host (%d) can't be used with connection_type agent, the node agent connects through the proxy environment variables of the node", i+1)
+		}
+		agentNodes++
+	}
+	if agentNodes == 0 {
+		return nil
+	}
+	if c.AgentTunnel == nil || len(c.AgentTunnel.Token) == 0 {
+		return fmt.Errorf("agent_tunnel token is required for hosts with connection_type agent")
+	}
+	if len(c.AgentTunnel.TLSCertPath) > 0 != (len(c.AgentTunnel.TLSKeyPath) > 0) {
+		return fmt.Errorf("agent_tunnel tls_cert_path and tls_key_path must be set together")
+	}
+	// without TLS, the node agents are only authenticated by the SSH host key they serve over the tunnel
+	if len(c.AgentTunnel.TLSCertPath) == 0 && c.SSHHostKeyChecking != hosts.HostKeyCheckingStrict && c.SSHHostKeyChecking != hosts.HostKeyCheckingTrustOnFirstUse {
+		return fmt.Errorf("agent_tunnel tls_cert_path or ssh_host_key_checking %v is required for hosts with connection_type agent", hosts.HostKeyCheckingModes)
+	}
+	if len(c.AgentTunnel.ListenAddress) > 0 {
+		if _, _, err := net.SplitHostPort(c.AgentTunnel.ListenAddress); err != nil {
+			return fmt.Errorf("agent_tunnel listen_address is not valid: %v", err)
+		}
+	}
+	if c.AgentTunnel.ConnectTimeout < 0 {
+		return fmt.Errorf("agent_tunnel connect_timeout can't be negative")
+	}
+	return nil
+}
+
+func validateBastionHost(bastionHost v3.BastionHost) error {
+	if len(bastionHost.Address) == 0 {
+		if len(bastionHost.Hops) > 0 {
+			return fmt.Errorf("address is required with hops")
+		}
+		if len(bastionHost.Proxy) > 0 {
+			return fmt.Errorf("address is required with proxy")
+		}
+		return nil
+	}
+	if _, _, err := hosts.ParseHostKeys(bastionHost.HostKey); err != nil {
+		return fmt.Errorf("host_key is not valid: %v", err)
+	}
+	if len(bastionHost.Proxy) > 0 {
+		if _, err := hosts.ParseProxyURL(bastionHost.Proxy); err != nil {
+			return fmt.Errorf("proxy is not valid: %v", err)
+		}
+	}
+	for i, hop := range bastionHost.Hops {
+		if len(hop.Address) == 0 {
+			return fmt.Errorf("address for hop (%d) is not provided", i+1)
+		}
+		if _, _, err := hosts.ParseHostKeys(hop.HostKey); err != nil {
+			return fmt.Errorf("host_key for hop (%d) is not valid: %v", i+1, err)
+		}
 	}
 	return nil
 }
 
+func validateContainerRuntime(c *Cluster, containerRuntime string) error {
+	switch containerRuntime {
+	case "", docker.RuntimeDocker:
+		return nil
+	case docker.RuntimeContainerd:
+		parsedVersion, err := getClusterVersion(c.Version)
+		if err != nil {
+			return err
+		}
+		// the kubelet talks to containerd through its CRI plugin, like it does to cri-dockerd
+		if !parsedRangeAtLeast124(parsedVersion) {
+			return fmt.Errorf("containerd is supported for cluster version 1.24 and higher, found [%s]", c.Version)
+		}
+		return nil
+	}
+	return fmt.Errorf("container runtime [%s] is not supported, supported runtimes are [%s, %s]", containerRuntime, docker.RuntimeDocker, docker.RuntimeContainerd)
+}
+
 func validateServicesOptions(c *Cluster) error {
 	servicesOptions := map[string]string{
 		"etcd_image":                               c.Services.Etcd.Image,
@@ -396,6 +634,63 @@ func validateEtcdBackupOptions(c *Cluster) error {
 				}
 			}
 		}
+		if err := validateEtcdSnapshotTargets(c.Services.Etcd.BackupConfig); err != nil {
+			return err
+		}
+		if err := validateEtcdSnapshotEncryption(c.Services.Etcd.BackupConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateEtcdSnapshotTargets(bc *v3.BackupConfig) error {
+	targets := 0
+	for _, configured := range []bool{bc.S3BackupConfig != nil, bc.SFTPBackupConfig != nil, bc.LocalDirBackupConfig != nil} {
+		if configured {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return errors.New("etcd backup config can only have one of s3, sftp or local dir backup backends")
+	}
+	if bc.SFTPBackupConfig != nil {
+		if len(bc.SFTPBackupConfig.Address) == 0 {
+			return errors.New("etcd sftp backup backend address can't be empty")
+		}
+		if _, _, err := net.SplitHostPort(bc.SFTPBackupConfig.Address); err != nil {
+			return fmt.Errorf("etcd sftp backup backend address [%s] must be in host:port format: %v", bc.SFTPBackupConfig.Address, err)
+		}
+		if len(bc.SFTPBackupConfig.User) == 0 {
+			return errors.New("etcd sftp backup backend user can't be empty")
+		}
+		if len(bc.SFTPBackupConfig.Password) == 0 && len(bc.SFTPBackupConfig.SSHKey) == 0 {
+			return errors.New("etcd sftp backup backend requires a password or an ssh key")
+		}
+		// only the keys are parsed, the server host key is verified when connecting
+		verifier, err := hosts.NewHostKeyVerifier(hosts.HostKeyCheckingStrict, "", nil, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := services.NewSFTPSnapshotBackend(bc.SFTPBackupConfig, verifier); err != nil {
+			return err
+		}
+	}
+	if bc.LocalDirBackupConfig != nil && !filepath.IsAbs(bc.LocalDirBackupConfig.Path) {
+		return fmt.Errorf("etcd local dir backup backend path [%s] must be an absolute path", bc.LocalDirBackupConfig.Path)
+	}
+	return nil
+}
+
+func validateEtcdSnapshotEncryption(bc *v3.BackupConfig) error {
+	if bc.Encryption == nil {
+		return nil
+	}
+	if bc.S3BackupConfig == nil && bc.SFTPBackupConfig == nil && bc.LocalDirBackupConfig == nil {
+		return errors.New("etcd backup encryption requires an s3, sftp or local dir backup backend")
+	}
+	if _, _, err := services.GetSnapshotEncryptionKeys(bc.Encryption); err != nil {
+		return fmt.Errorf("invalid etcd backup encryption: %v", err)
 	}
 	return nil
 }
@@ -569,6 +864,13 @@ func validateNetworkImages(c *Cluster) error {
 		if len(c.SystemImages.WeaveNode) == 0 {
 			return errors.New("weave image is not populated")
 		}
+	} else if c.Network.Plugin == CiliumNetworkPlugin {
+		if len(c.SystemImages.Cilium) == 0 {
+			return errors.New("cilium image is not populated")
+		}
+		if len(c.SystemImages.CiliumOperator) == 0 {
+			return errors.New("cilium operator image is not populated")
+		}
 	} else if c.Network.Plugin == AciNetworkPlugin {
 		if len(c.SystemImages.AciCniDeployContainer) == 0 {
 			return errors.New("aci cnideploy image is not populated")
@@ -715,6 +1017,100 @@ func validatePodSecurity(c *Cluster) error {
 	return nil
 }
 
+func validateHardeningProfile(ctx context.Context, c *Cluster) error {
+	if c.HardeningProfile == "" {
+		return nil
+	}
+	if !IsCISHardeningProfile(c.HardeningProfile) {
+		return fmt.Errorf("hardening profile [%s] is not supported, supported profiles are cis-1.x", c.HardeningProfile)
+	}
+	if weakening := c.getWeakeningExtraArgs(); len(weakening) > 0 {
+		return fmt.Errorf("extra_args [%s] weaken the hardening profile [%s]", strings.Join(weakening, ", "), c.HardeningProfile)
+	}
+	if c.Network.Plugin == NoNetworkPlugin || c.Network.Plugin == FlannelNetworkPlugin {
+		log.Warnf(ctx, "Network plugin [%s] doesn't enforce network policies, the system namespaces of the hardening profile [%s] aren't isolated", c.Network.Plugin, c.HardeningProfile)
+	}
+	return nil
+}
+
+func validateParallelismOptions(c *Cluster) error {
+	if c.Parallelism == nil {
+		return nil
+	}
+	for name, value := range map[string]int{
+		"max_hosts":                   c.Parallelism.MaxHosts,
+		ParallelismTunnelHosts:        c.Parallelism.TunnelHosts,
+		ParallelismDeployFiles:        c.Parallelism.DeployFiles,
+		ParallelismDeployCertificates: c.Parallelism.DeployCertificates,
+		ParallelismPullImages:         c.Parallelism.PullImages,
+		ParallelismCleanup:            c.Parallelism.Cleanup,
+		"registry_pulls":              c.Parallelism.RegistryPulls,
+	} {
+		if value < 0 {
+			return fmt.Errorf("parallelism %s can't be negative", name)
+		}
+	}
+	return nil
+}
+
+func validateCertificatesOptions(c *Cluster) error {
+	// Cluster.Certificates holds the certificates bundle
+	certificatesConfig := c.RancherKubernetesEngineConfig.Certificates
+	if certificatesConfig == nil {
+		return nil
+	}
+	if certificatesConfig.KeyAlgorithm != "" {
+		supported := false
+		for _, algorithm := range cert.KeyAlgorithms {
+			if certificatesConfig.KeyAlgorithm == algorithm {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("certificates key_algorithm [%s] is not supported, supported algorithms are: %s", certificatesConfig.KeyAlgorithm, strings.Join(cert.KeyAlgorithms, ", "))
+		}
+	}
+	caValidity, err := pki.ParseCertificateValidity(certificatesConfig.CAValidity)
+	if err != nil {
+		return fmt.Errorf("invalid certificates ca_validity [%s]: %v", certificatesConfig.CAValidity, err)
+	}
+	for _, option := range []struct {
+		name     string
+		validity string
+	}{
+		{"serving_validity", certificatesConfig.ServingValidity},
+		{"client_validity", certificatesConfig.ClientValidity},
+		{"etcd_validity", certificatesConfig.EtcdValidity},
+	} {
+		if option.validity == "" {
+			continue
+		}
+		validity, err := pki.ParseCertificateValidity(option.validity)
+		if err != nil {
+			return fmt.Errorf("invalid certificates %s [%s]: %v", option.name, option.validity, err)
+		}
+		if validity > caValidity {
+			return fmt.Errorf("certificates %s [%s] can't be longer than the CA validity [%s]", option.name, validity, caValidity)
+		}
+	}
+	if certificatesConfig.IntermediateCA != nil && certificatesConfig.Vault != nil {
+		return fmt.Errorf("certificates intermediate_ca and vault can't be used at the same time")
+	}
+	if certificatesConfig.IntermediateCA != nil {
+		if _, _, _, err := pki.ParseIntermediateCA(certificatesConfig.IntermediateCA); err != nil {
+			return fmt.Errorf("invalid certificates intermediate_ca: %v", err)
+		}
+	}
+	if certificatesConfig.Vault != nil {
+		vaultURL, err := url.Parse(certificatesConfig.Vault.Address)
+		if err != nil || vaultURL.Host == "" || (vaultURL.Scheme != "http" && vaultURL.Scheme != "https") {
+			return fmt.Errorf("certificates vault address [%s] must be an http or https URL", certificatesConfig.Vault.Address)
+		}
+	}
+	return nil
+}
+
 func getClusterVersion(version string) (semver.Version, error) {
 	var parsedVersion semver.Version
 	if len(version) <= 1 || !strings.HasPrefix(version, "v") {
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func AgentCommand() cli.Command {
+	agentFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "server",
+			Usage:  "ws:// or wss:// URL of the agent tunnel of the rke process, or of a relay forwarding to it",
+			EnvVar: "RKE_AGENT_SERVER",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "Token of the node, returned by rke util get-agent-token",
+			EnvVar: "RKE_AGENT_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "node-address",
+			Usage:  "Address of the node in the cluster configuration",
+			EnvVar: "RKE_AGENT_NODE_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:  "host-key-path",
+			Usage: "SSH host key of the agent, generated when missing",
+			Value: "/etc/rke/agent/ssh_host_ed25519_key",
+		},
+		cli.StringFlag{
+			Name:  "authorized-keys-path",
+			Usage: "SSH public keys rke authenticates with, in authorized_keys format",
+			Value: "/etc/rke/agent/authorized_keys",
+		},
+		cli.StringFlag{
+			Name:  "ca-cert",
+			Usage: "CA certificates verifying the TLS certificate of the agent tunnel, defaults to the system CAs",
+		},
+		cli.BoolFlag{
+			Name:  "insecure-skip-tls-verify",
+			Usage: "Don't verify the TLS certificate of the agent tunnel",
+		},
+	}
+	return cli.Command{
+		Name:   "agent",
+		Usage:  "Run the node agent opening the tunnel of a node with connection_type agent to rke",
+		Action: runNodeAgentFromCli,
+		Flags:  agentFlags,
+	}
+}
+
+func runNodeAgentFromCli(ctx *cli.Context) error {
+	config := hosts.NodeAgentConfig{
+		ServerURL:          ctx.String("server"),
+		Token:              ctx.String("token"),
+		NodeAddress:        ctx.String("node-address"),
+		HostKeyPath:        ctx.String("host-key-path"),
+		AuthorizedKeysPath: ctx.String("authorized-keys-path"),
+		CACertPath:         ctx.String("ca-cert"),
+		InsecureSkipVerify: ctx.Bool("insecure-skip-tls-verify"),
+	}
+	if len(config.ServerURL) == 0 || len(config.Token) == 0 || len(config.NodeAddress) == 0 {
+		return fmt.Errorf("--server, --token and --node-address are required")
+	}
+	runCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	logrus.Infof("Running RKE node agent version: %v", ctx.App.Version)
+	return hosts.RunNodeAgent(runCtx, config)
+}
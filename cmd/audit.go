@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/pki"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const outputFormatJUnit = "junit"
+
+func AuditCommand() cli.Command {
+	auditFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the report (allowed values: %s, %s)", outputFormatJSON, outputFormatJUnit),
+			Value: outputFormatJSON,
+		},
+	}
+
+	auditFlags = append(auditFlags, commonFlags...)
+
+	return cli.Command{
+		Name:  "audit",
+		Usage: "Audit the cluster nodes",
+		Subcommands: []cli.Command{
+			{
+				Name:   "cis",
+				Usage:  "Check the nodes against the CIS Kubernetes benchmark",
+				Flags:  auditFlags,
+				Action: auditCISFromCli,
+			},
+		},
+	}
+}
+
+func auditCISFromCli(ctx *cli.Context) error {
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	outputFormat := ctx.String("output")
+	if outputFormat != outputFormatJSON && outputFormat != outputFormatJUnit {
+		return fmt.Errorf("unsupported output format [%s], allowed values: %s, %s", outputFormat, outputFormatJSON, outputFormatJUnit)
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	runCtx := context.Background()
+	kubeCluster, err := cluster.InitClusterObject(runCtx, rkeConfig, flags, "")
+	if err != nil {
+		return err
+	}
+	if err := kubeCluster.SetupDialers(runCtx, hosts.DialersOptions{}); err != nil {
+		return err
+	}
+	if err := kubeCluster.TunnelHosts(runCtx, flags); err != nil {
+		return err
+	}
+	report, err := kubeCluster.RunCISAudit(runCtx, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if outputFormat == outputFormatJUnit {
+		err = report.WriteJUnit(os.Stdout)
+	} else {
+		err = report.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
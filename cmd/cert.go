@@ -3,7 +3,14 @@ package cmd
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/rancher/rke/cluster"
 	"github.com/rancher/rke/hosts"
@@ -40,8 +47,47 @@ func CertificateCommand() cli.Command {
 			Name:  "rotate-ca",
 			Usage: "Rotate all certificates including CA certs",
 		},
+		outputFlag,
 	}
 	rotateFlags = append(rotateFlags, commonFlags...)
+	checkExpiryFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.IntFlag{
+			Name:  "threshold",
+			Usage: "Exit with an error when a certificate expires in less than this number of days",
+			Value: cluster.DefaultCertExpiryWarningDays,
+		},
+		cli.BoolFlag{
+			Name:  "offline",
+			Usage: "Only check the certificates of the state file, without fetching the certificates deployed on the nodes",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the report, with %s the progress is written to stderr as newline-delimited JSON events (allowed values: %s, %s)", outputFormatJSON, outputFormatText, outputFormatJSON),
+			Value: outputFormatText,
+		},
+	}
+	checkExpiryFlags = append(checkExpiryFlags, commonFlags...)
+	rotateCAFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name: "phase",
+			Usage: fmt.Sprintf("Specify the CA rotation phase to run, in order (allowed values: %s)",
+				strings.Join(cluster.CARotationPhases, ", ")),
+		},
+		outputFlag,
+	}
+	rotateCAFlags = append(rotateCAFlags, commonFlags...)
 	return cli.Command{
 		Name:  "cert",
 		Usage: "Certificates management for RKE cluster",
@@ -52,6 +98,18 @@ func CertificateCommand() cli.Command {
 				Action: rotateRKECertificatesFromCli,
 				Flags:  rotateFlags,
 			},
+			cli.Command{
+				Name:   "rotate-ca",
+				Usage:  "Rotate the RKE cluster CA certificate in phases without restarting the cluster pods",
+				Action: rotateCACertificateFromCli,
+				Flags:  rotateCAFlags,
+			},
+			cli.Command{
+				Name:   "check-expiry",
+				Usage:  "Report the expiration of the RKE cluster certificates",
+				Action: checkCertificatesExpiryFromCli,
+				Flags:  checkExpiryFlags,
+			},
 			cli.Command{
 				Name:   "generate-csr",
 				Usage:  "Generate certificate sign requests for k8s components",
@@ -67,6 +125,7 @@ func CertificateCommand() cli.Command {
 						Name:  "cert-dir",
 						Usage: "Specify a certificate dir path",
 					},
+					outputFlag,
 				},
 			},
 		},
@@ -74,6 +133,10 @@ func CertificateCommand() cli.Command {
 }
 
 func rotateRKECertificatesFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
 	logrus.Infof("Running RKE version: %v", ctx.App.Version)
 	k8sComponents := ctx.StringSlice("service")
 	rotateCACerts := ctx.Bool("rotate-ca")
@@ -97,14 +160,112 @@ func rotateRKECertificatesFromCli(ctx *cli.Context) error {
 		CACertificates: rotateCACerts,
 		Services:       k8sComponents,
 	}
-	if err := ClusterInit(context.Background(), rkeConfig, hosts.DialersOptions{}, externalFlags); err != nil {
+	if err := ClusterInit(runCtx, rkeConfig, hosts.DialersOptions{}, externalFlags); err != nil {
 		return err
 	}
-	_, _, _, _, _, err = ClusterUp(context.Background(), hosts.DialersOptions{}, externalFlags, map[string]interface{}{})
+	_, _, _, _, _, err = ClusterUp(runCtx, hosts.DialersOptions{}, externalFlags, map[string]interface{}{})
 	return err
 }
 
+func rotateCACertificateFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	phase := ctx.String("phase")
+	if phase == "" {
+		return fmt.Errorf("--phase is required (allowed values: %s)", strings.Join(cluster.CARotationPhases, ", "))
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	externalFlags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	return RotateCACertificate(runCtx, rkeConfig, hosts.DialersOptions{}, externalFlags, phase)
+}
+
+// RotateCACertificate runs a phase of the staged CA rotation. The phases are recorded in the state file, a failed phase can be
+// run again. Only the certificates configuration of rkeConfig is used, it selects the new CA when the rotation starts.
+func RotateCACertificate(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, dialersOptions hosts.DialersOptions, flags cluster.ExternalFlags, phase string) error {
+	log.Infof(ctx, "Running CA rotation phase [%s]", phase)
+	stateFilePath := cluster.GetStateFilePath(flags.ClusterFilePath, flags.ConfigDir)
+	clusterState, err := cluster.ReadStateFile(ctx, stateFilePath)
+	if err != nil {
+		return err
+	}
+	if clusterState.DesiredState.RancherKubernetesEngineConfig == nil || len(clusterState.DesiredState.CertificatesBundle) == 0 {
+		return fmt.Errorf("Failed to rotate CA certificate: can't find the certificates of the cluster, run rke up first")
+	}
+	desiredConfig := clusterState.DesiredState.RancherKubernetesEngineConfig.DeepCopy()
+	desiredConfig.Certificates = rkeConfig.Certificates
+	kubeCluster, err := cluster.InitClusterObject(ctx, desiredConfig, flags, clusterState.DesiredState.EncryptionConfig)
+	if err != nil {
+		return err
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return err
+	}
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return err
+	}
+
+	if err := cluster.PrepareCARotationPhase(ctx, clusterState, &kubeCluster.RancherKubernetesEngineConfig, flags, phase); err != nil {
+		return err
+	}
+	clusterState.DesiredState.RancherKubernetesEngineConfig = kubeCluster.RancherKubernetesEngineConfig.DeepCopy()
+	// the phase is recorded before deploying, running it again after a failure reuses the new CA
+	if err := clusterState.WriteStateFile(ctx, stateFilePath); err != nil {
+		return err
+	}
+
+	if err := cluster.SetUpAuthentication(ctx, kubeCluster, nil, clusterState); err != nil {
+		return err
+	}
+	kubeCluster.ForceDeployCerts = true
+	if err := kubeCluster.SetUpHosts(ctx, flags); err != nil {
+		return err
+	}
+	if err := saveClusterState(ctx, kubeCluster, clusterState); err != nil {
+		return err
+	}
+
+	// Restarting Kubernetes components, the pods keep working as the service account token key doesn't change
+	if err := services.RestartEtcdPlane(ctx, kubeCluster.EtcdHosts); err != nil {
+		return err
+	}
+	if err := services.RestartControlPlane(ctx, kubeCluster.ControlPlaneHosts); err != nil {
+		return err
+	}
+	allHosts := hosts.GetUniqueHostList(kubeCluster.EtcdHosts, kubeCluster.ControlPlaneHosts, kubeCluster.WorkerHosts)
+	if err := services.RestartWorkerPlane(ctx, allHosts); err != nil {
+		return err
+	}
+
+	cluster.CompleteCARotationPhase(clusterState)
+	if err := saveClusterState(ctx, kubeCluster, clusterState); err != nil {
+		return err
+	}
+	log.Infof(ctx, "Finished CA rotation phase [%s]", phase)
+	return nil
+}
+
 func generateCSRFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
 	logrus.Infof("Running RKE version: %v", ctx.App.Version)
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
@@ -124,7 +285,132 @@ func generateCSRFromCli(ctx *cli.Context) error {
 	externalFlags.CertificateDir = ctx.String("cert-dir")
 	externalFlags.CustomCerts = ctx.Bool("custom-certs")
 
-	return GenerateRKECSRs(context.Background(), rkeConfig, externalFlags)
+	return GenerateRKECSRs(runCtx, rkeConfig, externalFlags)
+}
+
+func checkCertificatesExpiryFromCli(ctx *cli.Context) error {
+	// the report is written to stdout in the output format, progress events go to stderr
+	runCtx := context.Background()
+	if ctx.String("output") == outputFormatJSON {
+		runCtx = log.EnableJSONOutput(runCtx, os.Stderr)
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	outputFormat := ctx.String("output")
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	threshold := ctx.Int("threshold")
+	if threshold < 0 {
+		return fmt.Errorf("--threshold can not be negative")
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	expiries, err := CheckCertificatesExpiry(runCtx, rkeConfig, hosts.DialersOptions{}, flags, !ctx.Bool("offline"))
+	if err != nil {
+		return err
+	}
+	if err := writeCertificatesExpiry(os.Stdout, expiries, outputFormat); err != nil {
+		return err
+	}
+	if expiring := cluster.GetExpiringCertificates(expiries, threshold); len(expiring) > 0 {
+		return fmt.Errorf("%d certificates expire in less than %d days", len(expiring), threshold)
+	}
+	return nil
+}
+
+// CheckCertificatesExpiry returns the validity of the certificates of the state file and, with fromNodes, of the certificates
+// deployed on the nodes
+func CheckCertificatesExpiry(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, dialersOptions hosts.DialersOptions, flags cluster.ExternalFlags, fromNodes bool) ([]cluster.CertificateExpiry, error) {
+	log.Infof(ctx, "Checking Kubernetes cluster certificates expiration")
+	clusterState, err := cluster.ReadStateFile(ctx, cluster.GetStateFilePath(flags.ClusterFilePath, flags.ConfigDir))
+	if err != nil {
+		return nil, err
+	}
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, "")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	certificateHosts := kubeCluster.GetCertificateHosts()
+	expiries := cluster.GetCertificatesExpiry(clusterState.CurrentState.CertificatesBundle, certificateHosts, cluster.CertificateSourceState, now)
+	if !fromNodes {
+		return expiries, nil
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return nil, err
+	}
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return nil, err
+	}
+	nodeCertificates, err := cluster.GetClusterCertsFromNodes(ctx, kubeCluster)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch certificates from nodes: %v", err)
+	}
+	return append(expiries, cluster.GetCertificatesExpiry(nodeCertificates, certificateHosts, cluster.CertificateSourceNode, now)...), nil
+}
+
+func writeCertificatesExpiry(w io.Writer, expiries []cluster.CertificateExpiry, format string) error {
+	if format == outputFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if expiries == nil {
+			expiries = []cluster.CertificateExpiry{}
+		}
+		return encoder.Encode(expiries)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tHOST\tSOURCE\tEXPIRES\tDAYS REMAINING\tSANS")
+	for _, expiry := range expiries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			expiry.Name,
+			getValueOrDash(expiry.Host),
+			expiry.Source,
+			expiry.NotAfter.Format(time.RFC3339),
+			expiry.DaysRemaining,
+			getValueOrDash(strings.Join(expiry.SANs, ",")))
+	}
+	return tw.Flush()
+}
+
+// setRotateExpiringCertificates rotates the certificates during rke up when one of the deployed certificates expires soon. CA
+// certificates are only rotated on demand, rotating them restarts every pod of the cluster.
+func setRotateExpiringCertificates(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, flags cluster.ExternalFlags) error {
+	clusterState, err := cluster.ReadStateFile(ctx, cluster.GetStateFilePath(flags.ClusterFilePath, flags.ConfigDir))
+	if err != nil || len(clusterState.CurrentState.CertificatesBundle) == 0 {
+		logrus.Debugf("No deployed certificates found to rotate")
+		return nil
+	}
+	days := flags.CertExpiryWarningDays
+	if days <= 0 {
+		days = cluster.DefaultCertExpiryWarningDays
+	}
+	expiries := cluster.GetCertificatesExpiry(clusterState.CurrentState.CertificatesBundle, nil, cluster.CertificateSourceState, time.Now())
+	expiring := cluster.GetExpiringCertificates(expiries, days)
+	if len(expiring) == 0 {
+		return nil
+	}
+	for _, expiry := range expiring {
+		if expiry.Name == pki.CACertName || expiry.Name == pki.RequestHeaderCACertName {
+			log.Warnf(ctx, "[certificates] CA certificate [%s] expires in %d days, it is not rotated automatically, rotate it with `rke cert rotate --rotate-ca`", expiry.Name, expiry.DaysRemaining)
+		}
+	}
+	log.Infof(ctx, "[certificates] %d certificates expire in less than %d days, rotating cluster certificates", len(expiring), days)
+	rkeConfig.RotateCertificates = &v3.RotateCertificates{}
+	return nil
 }
 
 func rebuildClusterWithRotatedCertificates(ctx context.Context,
@@ -153,11 +439,11 @@ func rebuildClusterWithRotatedCertificates(ctx context.Context,
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 	if len(kubeCluster.ControlPlaneHosts) > 0 {
-		APIURL = fmt.Sprintf("https://%s:6443", kubeCluster.ControlPlaneHosts[0].Address)
+		APIURL = "https://" + net.JoinHostPort(kubeCluster.ControlPlaneHosts[0].Address, cluster.KubeAPIPort)
 	}
 	clientCert = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Certificate))
 	clientKey = string(cert.EncodePrivateKeyPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Key))
-	caCrt = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.CACertName].Certificate))
+	caCrt = pki.GetCACertsPEM(kubeCluster.Certificates)
 
 	if err := kubeCluster.SetUpHosts(ctx, flags); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
@@ -233,6 +519,9 @@ func rotateRKECertificates(ctx context.Context, kubeCluster *cluster.Cluster, fl
 		return nil, fmt.Errorf("Failed to rotate certificates: can't find old certificates")
 	}
 	currentCluster.RotateCertificates = kubeCluster.RotateCertificates
+	if rkeFullState.CARotation != nil && kubeCluster.RotateCertificates.CACertificates {
+		return nil, fmt.Errorf("Failed to rotate certificates: CA rotation is in the [%s] phase, finish it with rke cert rotate-ca", rkeFullState.CARotation.Phase)
+	}
 	if !kubeCluster.RotateCertificates.CACertificates {
 		caCertPKI, ok := rkeFullState.CurrentState.CertificatesBundle[pki.CACertName]
 		if !ok {
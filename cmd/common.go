@@ -27,6 +27,29 @@ var commonFlags = []cli.Flag{
 		Name:  "ignore-docker-version",
 		Usage: "Disable Docker version check",
 	},
+	cli.IntFlag{
+		Name:  "parallelism",
+		Usage: "Maximum number of hosts processed at the same time, overrides parallelism.max_hosts of the cluster file",
+	},
+}
+
+var outputFlag = cli.StringFlag{
+	Name:  "output,o",
+	Usage: fmt.Sprintf("Output format (allowed values: %s, %s), %s writes the progress as newline-delimited JSON events", outputFormatText, outputFormatJSON, outputFormatJSON),
+	Value: outputFormatText,
+}
+
+// newCommandContext returns the context a command runs with. With the json output format, logs and progress events are written
+// to w as newline-delimited JSON instead of text.
+func newCommandContext(ctx *cli.Context, w io.Writer) (context.Context, error) {
+	outputFormat := ctx.String("output")
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return nil, err
+	}
+	if outputFormat == outputFormatJSON {
+		return log.EnableJSONOutput(context.Background(), w), nil
+	}
+	return context.Background(), nil
 }
 
 func resolveClusterFile(ctx *cli.Context) (string, string, error) {
@@ -57,6 +80,16 @@ func setOptionsFromCLI(c *cli.Context, rkeConfig *v3.RancherKubernetesEngineConf
 	ignoreDockerVersion := c.Bool("ignore-docker-version")
 	rkeConfig.IgnoreDockerVersion = &ignoreDockerVersion
 
+	if parallelism := c.Int("parallelism"); parallelism != 0 {
+		if parallelism < 0 {
+			return nil, fmt.Errorf("parallelism can't be negative")
+		}
+		if rkeConfig.Parallelism == nil {
+			rkeConfig.Parallelism = &v3.ParallelismConfig{}
+		}
+		rkeConfig.Parallelism.MaxHosts = parallelism
+	}
+
 	if c.Bool("s3") {
 		if rkeConfig.Services.Etcd.BackupConfig == nil {
 			rkeConfig.Services.Etcd.BackupConfig = &v3.BackupConfig{}
@@ -108,6 +141,8 @@ func ClusterInit(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfi
 	rkeState := cluster.FullState{
 		DesiredState: fullState.DesiredState,
 		CurrentState: fullState.CurrentState,
+		CARotation:   fullState.CARotation,
+		SSHHostKeys:  fullState.SSHHostKeys,
 	}
 	return rkeState.WriteStateFile(ctx, stateFilePath)
 }
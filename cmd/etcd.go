@@ -3,8 +3,13 @@ package cmd
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,11 +25,7 @@ import (
 const s3Endpoint = "s3.amazonaws.com"
 
 func EtcdCommand() cli.Command {
-	snapshotFlags := []cli.Flag{
-		cli.StringFlag{
-			Name:  "name",
-			Usage: "Specify snapshot name",
-		},
+	snapshotTargetFlags := []cli.Flag{
 		cli.StringFlag{
 			Name:   "config",
 			Usage:  "Specify an alternate cluster YAML file",
@@ -66,7 +67,85 @@ func EtcdCommand() cli.Command {
 		},
 	}
 
-	snapshotSaveFlags := append(snapshotFlags, commonFlags...)
+	snapshotFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "Specify snapshot name",
+		},
+	}, snapshotTargetFlags...)
+
+	snapshotSaveFlags := append([]cli.Flag{outputFlag}, snapshotFlags...)
+	snapshotSaveFlags = append(snapshotSaveFlags, commonFlags...)
+
+	snapshotVerifyFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the verification report, with %s the progress is written to stderr as newline-delimited JSON events (allowed values: %s, %s)", outputFormatJSON, outputFormatText, outputFormatJSON),
+			Value: outputFormatText,
+		},
+	}, snapshotFlags...)
+	snapshotVerifyFlags = append(snapshotVerifyFlags, commonFlags...)
+
+	snapshotListFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the snapshot list, with %s the progress is written to stderr as newline-delimited JSON events (allowed values: %s, %s)", outputFormatJSON, outputFormatText, outputFormatJSON),
+			Value: outputFormatText,
+		},
+	}, snapshotTargetFlags...)
+	snapshotListFlags = append(snapshotListFlags, commonFlags...)
+
+	snapshotPruneFlags := append([]cli.Flag{
+		cli.IntFlag{
+			Name:  "keep",
+			Usage: "Number of newest snapshots to keep",
+		},
+		cli.DurationFlag{
+			Name:  "older-than",
+			Usage: "Only prune snapshots older than this duration (e.g. 168h)",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print the snapshots that would be pruned without removing them, as a JSON list with the json output format",
+		},
+		outputFlag,
+	}, snapshotTargetFlags...)
+	snapshotPruneFlags = append(snapshotPruneFlags, commonFlags...)
+
+	snapshotSyncFlags := append([]cli.Flag{
+		cli.BoolFlag{
+			Name:  "watch",
+			Usage: "Keep syncing the snapshots every interval_hours of the backup config",
+		},
+		outputFlag,
+	}, snapshotTargetFlags...)
+	snapshotSyncFlags = append(snapshotSyncFlags, commonFlags...)
+
+	snapshotExtractFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "snapshot",
+			Usage: "Specify snapshot name",
+		},
+		cli.StringFlag{
+			Name:  "namespace",
+			Usage: "Namespace of the objects to extract",
+		},
+		cli.StringFlag{
+			Name:  "kind",
+			Usage: "Only extract objects of this kind (e.g. ConfigMap)",
+		},
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "Only extract objects with this name",
+		},
+		cli.StringFlag{
+			Name:  "output-dir",
+			Usage: "Directory to write the extracted manifests to",
+			Value: "etcd-snapshot-extract",
+		},
+		outputFlag,
+	}, snapshotTargetFlags...)
+	snapshotExtractFlags = append(snapshotExtractFlags, commonFlags...)
 
 	snapshotRestoreFlags := []cli.Flag{
 		cli.StringFlag{
@@ -81,6 +160,11 @@ func EtcdCommand() cli.Command {
 			Name:  "use-local-state",
 			Usage: "Use local state file (do not check or use snapshot archive for state file)",
 		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Restore the snapshot even if it is corrupted or was taken on an incompatible Kubernetes version",
+		},
+		outputFlag,
 	}
 	snapshotRestoreFlags = append(append(snapshotFlags, snapshotRestoreFlags...), commonFlags...)
 
@@ -100,6 +184,36 @@ func EtcdCommand() cli.Command {
 				Flags:  snapshotRestoreFlags,
 				Action: RestoreEtcdSnapshotFromCli,
 			},
+			{
+				Name:   "snapshot-verify",
+				Usage:  "Verify that a snapshot is a valid etcd database compatible with the cluster",
+				Flags:  snapshotVerifyFlags,
+				Action: SnapshotVerifyEtcdHostsFromCli,
+			},
+			{
+				Name:   "snapshot-extract",
+				Usage:  "Extract the manifests of a namespace or of single objects from a snapshot without restoring it",
+				Flags:  snapshotExtractFlags,
+				Action: SnapshotExtractEtcdHostsFromCli,
+			},
+			{
+				Name:   "snapshot-list",
+				Usage:  "List snapshots on all etcd hosts and on the remote snapshot target",
+				Flags:  snapshotListFlags,
+				Action: SnapshotListEtcdHostsFromCli,
+			},
+			{
+				Name:   "snapshot-prune",
+				Usage:  "Remove old snapshots from all etcd hosts and from the remote snapshot target",
+				Flags:  snapshotPruneFlags,
+				Action: SnapshotPruneEtcdHostsFromCli,
+			},
+			{
+				Name:   "snapshot-sync",
+				Usage:  "Ship the rolling snapshots to the sftp, local dir or encrypted s3 snapshot target and remove the expired ones",
+				Flags:  snapshotSyncFlags,
+				Action: SnapshotSyncEtcdHostsFromCli,
+			},
 		},
 	}
 }
@@ -130,7 +244,10 @@ func SnapshotSaveEtcdHosts(
 		return err
 	}
 
-	if err := kubeCluster.SnapshotEtcd(ctx, snapshotName); err != nil {
+	phaseDone := log.StartPhase(ctx, "snapshot-save")
+	err = kubeCluster.SnapshotEtcd(ctx, snapshotName)
+	phaseDone(err)
+	if err != nil {
 		return err
 	}
 
@@ -201,6 +318,13 @@ func RestoreEtcdSnapshot(
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	if stateFileRetrieved {
+		snapshotVersion := cluster.GetFullStateKubernetesVersion(rkeFullState)
+		if err := checkRestoreVerification(ctx, flags, cluster.CheckEtcdSnapshotKubernetesVersion(snapshotVersion, kubeCluster.Version)); err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, err
+		}
+	}
+
 	// If we can't retrieve state file from snapshot, and we don't have local, we need to check for legacy cluster
 	if !stateFileRetrieved || flags.UseLocalState {
 		if err := checkLegacyCluster(ctx, kubeCluster, rkeFullState, flags); err != nil {
@@ -208,29 +332,45 @@ func RestoreEtcdSnapshot(
 		}
 	}
 
-	rkeFullState.CurrentState = cluster.State{}
-	if err := rkeFullState.WriteStateFile(ctx, stateFilePath); err != nil {
-		return APIURL, caCrt, clientCert, clientKey, nil, err
-	}
 	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
-	// if we fail after cleanup, we can't find the certs to do the download, we need to redeploy them
+	// the certs are needed to download the snapshot, they may be missing if a previous restore failed after cleanup
 	if err := kubeCluster.DeployRestoreCerts(ctx, rkeFullState.DesiredState.CertificatesBundle); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
-	// first download and check
-	if err := kubeCluster.PrepareBackup(ctx, snapshotName); err != nil {
+	// distribute the snapshot to every etcd host and check the copies are identical, then verify them before the state is wiped
+	phaseDone := log.StartPhase(ctx, "snapshot-download")
+	err = kubeCluster.PrepareBackup(ctx, snapshotName)
+	phaseDone(err)
+	if err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+	_, err = kubeCluster.VerifyEtcdSnapshot(ctx, snapshotName)
+	if err := checkRestoreVerification(ctx, flags, err); err != nil {
+		// distributing a local snapshot stops etcd, the cluster is left running when the restore is refused
+		kubeCluster.StartEtcdContainers(ctx)
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+
+	rkeFullState.CurrentState = cluster.State{}
+	if err := rkeFullState.WriteStateFile(ctx, stateFilePath); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 	log.Infof(ctx, "Cleaning old kubernetes cluster")
-	if err := kubeCluster.CleanupNodes(ctx); err != nil {
+	phaseDone = log.StartPhase(ctx, "cleanup-nodes")
+	err = kubeCluster.CleanupNodes(ctx)
+	phaseDone(err)
+	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
-	if err := kubeCluster.RestoreEtcdSnapshot(ctx, snapshotName); err != nil {
+	phaseDone = log.StartPhase(ctx, "snapshot-restore")
+	err = kubeCluster.RestoreEtcdSnapshot(ctx, snapshotName)
+	phaseDone(err)
+	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
@@ -294,6 +434,10 @@ func validateCerts(state cluster.State) error {
 }
 
 func SnapshotSaveEtcdHostsFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
 	logrus.Infof("Running RKE version: %v", ctx.App.Version)
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
@@ -318,10 +462,14 @@ func SnapshotSaveEtcdHostsFromCli(ctx *cli.Context) error {
 	// setting up the flags
 	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
 
-	return SnapshotSaveEtcdHosts(context.Background(), rkeConfig, hosts.DialersOptions{}, flags, etcdSnapshotName)
+	return SnapshotSaveEtcdHosts(runCtx, rkeConfig, hosts.DialersOptions{}, flags, etcdSnapshotName)
 }
 
 func RestoreEtcdSnapshotFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
 	logrus.Infof("Running RKE version: %v", ctx.App.Version)
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
@@ -353,8 +501,9 @@ func RestoreEtcdSnapshotFromCli(ctx *cli.Context) error {
 	// Custom certificates and certificate dir flags
 	flags.CertificateDir = ctx.String("cert-dir")
 	flags.CustomCerts = ctx.Bool("custom-certs")
+	flags.ForceRestore = ctx.Bool("force")
 
-	_, _, _, _, _, err = RestoreEtcdSnapshot(context.Background(), rkeConfig, hosts.DialersOptions{}, flags, map[string]interface{}{}, etcdSnapshotName)
+	_, _, _, _, _, err = RestoreEtcdSnapshot(runCtx, rkeConfig, hosts.DialersOptions{}, flags, map[string]interface{}{}, etcdSnapshotName)
 	return err
 }
 
@@ -384,3 +533,494 @@ func SnapshotRemoveFromEtcdHosts(
 	log.Infof(ctx, "Finished removing snapshot [%s] from all etcd hosts", snapshotName)
 	return nil
 }
+
+func SnapshotListEtcdHosts(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dialersOptions hosts.DialersOptions,
+	flags cluster.ExternalFlags) ([]cluster.EtcdSnapshot, []cluster.EtcdSnapshotSourceError, error) {
+
+	log.Infof(ctx, "Starting listing snapshots on etcd hosts")
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return nil, nil, err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return nil, nil, err
+	}
+
+	snapshots, sourceErrors := kubeCluster.ListEtcdSnapshots(ctx)
+	return snapshots, sourceErrors, nil
+}
+
+func SnapshotPruneEtcdHosts(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dialersOptions hosts.DialersOptions,
+	flags cluster.ExternalFlags, keep int, olderThan time.Duration, dryRun bool) ([]string, error) {
+
+	log.Infof(ctx, "Starting pruning snapshots on etcd hosts")
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return nil, err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return nil, err
+	}
+
+	pruned, err := kubeCluster.PruneEtcdSnapshots(ctx, keep, olderThan, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		log.Infof(ctx, "Finished pruning [%d] snapshots from all etcd hosts", len(pruned))
+	}
+	return pruned, nil
+}
+
+// SnapshotSyncEtcdHosts ships the rolling snapshots to the snapshot backend, the rolling snapshot container only keeps them on the
+// etcd hosts. With watch, the snapshots are synced every snapshot interval until the context is done.
+func SnapshotSyncEtcdHosts(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dialersOptions hosts.DialersOptions,
+	flags cluster.ExternalFlags, watch bool) error {
+
+	log.Infof(ctx, "Starting syncing snapshots from etcd hosts")
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, "")
+	if err != nil {
+		return err
+	}
+	backend, err := kubeCluster.GetSnapshotBackend()
+	if err != nil {
+		return err
+	}
+	if backend == nil {
+		return fmt.Errorf("no sftp, local dir or encrypted s3 snapshot target is configured in the etcd backup config")
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return err
+	}
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return err
+	}
+
+	interval := time.Duration(kubeCluster.Services.Etcd.BackupConfig.IntervalHours) * time.Hour
+	for {
+		err := kubeCluster.SyncEtcdSnapshotsToBackend(ctx)
+		if !watch {
+			return err
+		}
+		if err != nil {
+			log.Warnf(ctx, "%v", err)
+		} else {
+			log.Infof(ctx, "Finished syncing snapshots to %s, next sync in %s", backend.Name(), interval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func SnapshotListEtcdHostsFromCli(ctx *cli.Context) error {
+	// the report is written to stdout in the output format, progress events go to stderr
+	runCtx := context.Background()
+	if ctx.String("output") == outputFormatJSON {
+		runCtx = log.EnableJSONOutput(runCtx, os.Stderr)
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	outputFormat := ctx.String("output")
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	snapshots, sourceErrors, err := SnapshotListEtcdHosts(runCtx, rkeConfig, hosts.DialersOptions{}, flags)
+	if err != nil {
+		return err
+	}
+	if err := writeEtcdSnapshots(os.Stdout, snapshots, outputFormat); err != nil {
+		return err
+	}
+	// the snapshots of the other sources are written, the failed sources still fail the command
+	if len(sourceErrors) > 0 {
+		var locations []string
+		for _, sourceError := range sourceErrors {
+			locations = append(locations, sourceError.Location)
+		}
+		return fmt.Errorf("failed to list snapshots on [%s]", strings.Join(locations, ", "))
+	}
+	return nil
+}
+
+func SnapshotPruneEtcdHostsFromCli(ctx *cli.Context) error {
+	// with dry-run the snapshots that would be pruned are written to stdout, progress events go to stderr
+	eventsWriter := os.Stdout
+	if ctx.Bool("dry-run") {
+		eventsWriter = os.Stderr
+	}
+	runCtx, err := newCommandContext(ctx, eventsWriter)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	keep := ctx.Int("keep")
+	olderThan := ctx.Duration("older-than")
+	if keep < 0 || olderThan < 0 {
+		return fmt.Errorf("--keep and --older-than can not be negative")
+	}
+	if keep == 0 && olderThan == 0 {
+		return fmt.Errorf("you must specify --keep, --older-than or both")
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	dryRun := ctx.Bool("dry-run")
+	pruned, err := SnapshotPruneEtcdHosts(runCtx, rkeConfig, hosts.DialersOptions{}, flags, keep, olderThan, dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return writePrunedEtcdSnapshots(os.Stdout, pruned, ctx.String("output"))
+	}
+	return nil
+}
+
+func SnapshotSyncEtcdHostsFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	return SnapshotSyncEtcdHosts(runCtx, rkeConfig, hosts.DialersOptions{}, flags, ctx.Bool("watch"))
+}
+
+func writeEtcdSnapshots(w io.Writer, snapshots []cluster.EtcdSnapshot, format string) error {
+	if format == outputFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if snapshots == nil {
+			snapshots = []cluster.EtcdSnapshot{}
+		}
+		return encoder.Encode(snapshots)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLOCATION\tSIZE\tCREATED\tCHECKSUM\tKUBERNETES VERSION")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			snapshot.Name,
+			snapshot.Location,
+			snapshot.Size,
+			snapshot.CreatedAt.Format(time.RFC3339),
+			getValueOrDash(snapshot.Checksum),
+			getValueOrDash(snapshot.KubernetesVersion))
+	}
+	return tw.Flush()
+}
+
+func writePrunedEtcdSnapshots(w io.Writer, names []string, format string) error {
+	if format == outputFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if names == nil {
+			names = []string{}
+		}
+		return encoder.Encode(names)
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s\n", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getValueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// checkRestoreVerification turns a failed snapshot verification into a warning when the restore is forced
+func checkRestoreVerification(ctx context.Context, flags cluster.ExternalFlags, verifyErr error) error {
+	if verifyErr == nil {
+		return nil
+	}
+	if flags.ForceRestore {
+		log.Warnf(ctx, "[etcd] Snapshot verification failed, restoring anyway as requested: %v", verifyErr)
+		return nil
+	}
+	return fmt.Errorf("%v, use --force to restore the snapshot anyway", verifyErr)
+}
+
+// EtcdSnapshotVerifyReport is the result of rke etcd snapshot-verify
+type EtcdSnapshotVerifyReport struct {
+	Name string `json:"name"`
+	// KubernetesVersion is read from the state file bundled in the snapshot
+	KubernetesVersion string                             `json:"kubernetesVersion,omitempty"`
+	VersionError      string                             `json:"versionError,omitempty"`
+	Hosts             []cluster.EtcdSnapshotVerification `json:"hosts"`
+	Valid             bool                               `json:"valid"`
+}
+
+func SnapshotVerifyEtcdHosts(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dialersOptions hosts.DialersOptions,
+	flags cluster.ExternalFlags, snapshotName string) (*EtcdSnapshotVerifyReport, error) {
+
+	log.Infof(ctx, "Starting verifying snapshot [%s] on etcd hosts", snapshotName)
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return nil, err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return nil, err
+	}
+
+	report := &EtcdSnapshotVerifyReport{Name: snapshotName, Valid: true}
+	stateFile, err := kubeCluster.GetStateFileFromSnapshot(ctx, snapshotName)
+	if err != nil {
+		log.Warnf(ctx, "[etcd] Could not extract state file from snapshot [%s], skipping the kubernetes version check: %v", snapshotName, err)
+	} else {
+		snapshotState, err := cluster.StringToFullState(ctx, stateFile)
+		if err != nil {
+			return nil, err
+		}
+		report.KubernetesVersion = cluster.GetFullStateKubernetesVersion(snapshotState)
+		if err := cluster.CheckEtcdSnapshotKubernetesVersion(report.KubernetesVersion, kubeCluster.Version); err != nil {
+			report.VersionError = err.Error()
+			report.Valid = false
+		}
+	}
+
+	if err := kubeCluster.DownloadEtcdSnapshot(ctx, snapshotName); err != nil {
+		return nil, err
+	}
+	report.Hosts, err = kubeCluster.VerifyEtcdSnapshot(ctx, snapshotName)
+	if err != nil {
+		report.Valid = false
+	}
+	return report, nil
+}
+
+func SnapshotVerifyEtcdHostsFromCli(ctx *cli.Context) error {
+	// the report is written to stdout in the output format, progress events go to stderr
+	runCtx := context.Background()
+	if ctx.String("output") == outputFormatJSON {
+		runCtx = log.EnableJSONOutput(runCtx, os.Stderr)
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	outputFormat := ctx.String("output")
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	etcdSnapshotName := ctx.String("name")
+	if etcdSnapshotName == "" {
+		return fmt.Errorf("you must specify the snapshot name to verify")
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	report, err := SnapshotVerifyEtcdHosts(runCtx, rkeConfig, hosts.DialersOptions{}, flags, etcdSnapshotName)
+	if err != nil {
+		return err
+	}
+	if err := writeEtcdSnapshotVerifyReport(os.Stdout, report, outputFormat); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("snapshot [%s] failed verification", etcdSnapshotName)
+	}
+	return nil
+}
+
+func writeEtcdSnapshotVerifyReport(w io.Writer, report *EtcdSnapshotVerifyReport, format string) error {
+	if format == outputFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	fmt.Fprintf(w, "Snapshot: %s\n", report.Name)
+	fmt.Fprintf(w, "Kubernetes version: %s\n", getValueOrDash(report.KubernetesVersion))
+	if report.VersionError != "" {
+		fmt.Fprintf(w, "Version check: %s\n", report.VersionError)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tREVISION\tKEYS\tHASH\tSIZE\tERROR")
+	for _, host := range report.Hosts {
+		if host.Status == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t%s\n", host.Host, host.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t-\n", host.Host, host.Status.Revision, host.Status.TotalKey, host.Status.Hash, host.Status.TotalSize)
+	}
+	return tw.Flush()
+}
+
+func SnapshotExtractEtcdHosts(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dialersOptions hosts.DialersOptions,
+	flags cluster.ExternalFlags, snapshotName string, filter cluster.EtcdSnapshotObjectFilter) ([]cluster.EtcdSnapshotObject, error) {
+
+	log.Infof(ctx, "Starting extracting objects from snapshot [%s]", snapshotName)
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := kubeCluster.SetupDialers(ctx, dialersOptions); err != nil {
+		return nil, err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, flags); err != nil {
+		return nil, err
+	}
+
+	// secrets may have been written with a key that was rotated since, try the keys from the snapshot first
+	var encryptionProviderFiles []string
+	stateFile, err := kubeCluster.GetStateFileFromSnapshot(ctx, snapshotName)
+	if err != nil {
+		log.Warnf(ctx, "[etcd] Could not extract state file from snapshot [%s], only the local state file will be used to decrypt secrets: %v", snapshotName, err)
+	} else if snapshotState, err := cluster.StringToFullState(ctx, stateFile); err == nil && snapshotState.CurrentState.EncryptionConfig != "" {
+		encryptionProviderFiles = append(encryptionProviderFiles, snapshotState.CurrentState.EncryptionConfig)
+	}
+	rkeFullState, err := cluster.ReadStateFile(ctx, cluster.GetStateFilePath(flags.ClusterFilePath, flags.ConfigDir))
+	if err == nil && rkeFullState.CurrentState.EncryptionConfig != "" {
+		encryptionProviderFiles = append(encryptionProviderFiles, rkeFullState.CurrentState.EncryptionConfig)
+	}
+
+	return kubeCluster.ExtractEtcdSnapshotObjects(ctx, snapshotName, filter, encryptionProviderFiles)
+}
+
+func SnapshotExtractEtcdHostsFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	etcdSnapshotName := ctx.String("snapshot")
+	if etcdSnapshotName == "" {
+		return fmt.Errorf("you must specify the snapshot name to extract objects from")
+	}
+	filter := cluster.EtcdSnapshotObjectFilter{
+		Namespace: ctx.String("namespace"),
+		Kind:      ctx.String("kind"),
+		Name:      ctx.String("name"),
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	objects, err := SnapshotExtractEtcdHosts(runCtx, rkeConfig, hosts.DialersOptions{}, flags, etcdSnapshotName, filter)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects matching namespace [%s], kind [%s] and name [%s] found in snapshot [%s]", filter.Namespace, filter.Kind, filter.Name, etcdSnapshotName)
+	}
+	return writeEtcdSnapshotObjects(ctx.String("output-dir"), objects)
+}
+
+// writeEtcdSnapshotObjects writes one manifest per object, the manifests may contain secrets so they are only readable by the user
+func writeEtcdSnapshotObjects(outputDir string, objects []cluster.EtcdSnapshotObject) error {
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		return fmt.Errorf("failed to create output directory [%s]: %v", outputDir, err)
+	}
+	for _, object := range objects {
+		manifestPath := filepath.Join(outputDir, fmt.Sprintf("%s-%s.yaml", strings.ToLower(object.Kind), object.Name))
+		if err := os.WriteFile(manifestPath, object.Manifest, 0600); err != nil {
+			return fmt.Errorf("failed to write manifest [%s]: %v", manifestPath, err)
+		}
+		logrus.Infof("Extracted %s [%s] to [%s]", object.Kind, object.Name, manifestPath)
+	}
+	return nil
+}
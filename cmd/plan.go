@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	v3 "github.com/rancher/rke/types"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+func PlanCommand() cli.Command {
+	planFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "cert-dir",
+			Usage: "Specify a certificate dir path",
+		},
+		cli.BoolFlag{
+			Name:  "custom-certs",
+			Usage: "Use custom certificates from a cert dir",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the plan (allowed values: %s, %s)", outputFormatText, outputFormatJSON),
+			Value: outputFormatText,
+		},
+	}
+
+	planFlags = append(planFlags, commonFlags...)
+
+	return cli.Command{
+		Name:   "plan",
+		Usage:  "Show the changes rke up would apply to the cluster without touching the nodes",
+		Action: clusterPlanFromCli,
+		Flags:  planFlags,
+	}
+}
+
+// ClusterPlan compares the current state in the state file with the desired state built from rkeConfig.
+// The state file is not updated and no connection is made to the nodes.
+func ClusterPlan(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, flags cluster.ExternalFlags, data map[string]interface{}) (*cluster.PlanDiff, error) {
+	log.Infof(ctx, "Generating Kubernetes cluster plan")
+	stateFilePath := cluster.GetStateFilePath(flags.ClusterFilePath, flags.ConfigDir)
+	if len(flags.CertificateDir) == 0 {
+		flags.CertificateDir = cluster.GetCertificateDirPath(flags.ClusterFilePath, flags.ConfigDir)
+	}
+	rkeFullState, err := cluster.ReadStateFile(ctx, stateFilePath)
+	if err != nil {
+		logrus.Debugf("[plan] Failed to read state file [%s], planning a new cluster: %v", stateFilePath, err)
+	}
+	kubeCluster, err := cluster.InitClusterObject(ctx, rkeConfig, flags, rkeFullState.DesiredState.EncryptionConfig)
+	if err != nil {
+		return nil, err
+	}
+	desiredState, err := cluster.RebuildState(ctx, kubeCluster, rkeFullState, flags)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.GeneratePlanDiff(ctx, desiredState, map[string]types.Info{}, data)
+}
+
+func clusterPlanFromCli(ctx *cli.Context) error {
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	outputFormat := ctx.String("output")
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+	// Custom certificates and certificate dir flags
+	flags.CertificateDir = ctx.String("cert-dir")
+	flags.CustomCerts = ctx.Bool("custom-certs")
+
+	diff, err := ClusterPlan(context.Background(), rkeConfig, flags, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	return writePlanDiff(os.Stdout, diff, outputFormat)
+}
+
+func validateOutputFormat(format string) error {
+	if format != outputFormatText && format != outputFormatJSON {
+		return fmt.Errorf("unsupported output format [%s], allowed values: %s, %s", format, outputFormatText, outputFormatJSON)
+	}
+	return nil
+}
+
+func writePlanDiff(w io.Writer, diff *cluster.PlanDiff, format string) error {
+	if format == outputFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	if !diff.HasChanges() {
+		_, err := fmt.Fprintln(w, "No changes. The cluster matches the desired state.")
+		return err
+	}
+	var b strings.Builder
+	writeListSection(&b, "Hosts to add", diff.HostsToAdd)
+	writeListSection(&b, "Hosts to remove", diff.HostsToRemove)
+	writeListSection(&b, "Etcd members to add", diff.EtcdMembersToAdd)
+	writeListSection(&b, "Etcd members to delete", diff.EtcdMembersToDelete)
+	writeListSection(&b, "Certificates to regenerate", diff.CertificatesToRegenerate)
+	if len(diff.AddonsChanged) > 0 {
+		b.WriteString("Addons with changed configuration:\n")
+		for _, addon := range diff.AddonsChanged {
+			fmt.Fprintf(&b, "  ~ %s [%s] -> [%s]\n", addon.Name, addon.OldChecksum, addon.NewChecksum)
+		}
+	}
+	for _, node := range diff.Nodes {
+		fmt.Fprintf(&b, "Node [%s]:\n", node.Address)
+		for _, process := range node.Processes {
+			fmt.Fprintf(&b, "  %s %s (%s)\n", getProcessActionSymbol(process.Action), process.Name, process.Action)
+			for _, change := range process.Changes {
+				if change.Old != "" || change.New != "" {
+					fmt.Fprintf(&b, "      %s: %s -> %s\n", change.Field, change.Old, change.New)
+					continue
+				}
+				fmt.Fprintf(&b, "      %s:\n", change.Field)
+				for _, added := range change.Added {
+					fmt.Fprintf(&b, "        + %s\n", added)
+				}
+				for _, removed := range change.Removed {
+					fmt.Fprintf(&b, "        - %s\n", removed)
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeListSection(b *strings.Builder, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	for _, item := range items {
+		fmt.Fprintf(b, "  - %s\n", item)
+	}
+}
+
+func getProcessActionSymbol(action string) string {
+	switch action {
+	case cluster.ProcessActionCreate:
+		return "+"
+	case cluster.ProcessActionRemove:
+		return "-"
+	default:
+		return "~"
+	}
+}
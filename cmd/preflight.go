@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/pki"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const outputFormatTable = "table"
+
+func PreflightCommand() cli.Command {
+	preflightFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the report (allowed values: %s, %s)", outputFormatTable, outputFormatJSON),
+			Value: outputFormatTable,
+		},
+		cli.StringSliceFlag{
+			Name:  "skip",
+			Usage: fmt.Sprintf("Skip a check, can be repeated (checks: %v)", cluster.PreflightChecks),
+		},
+	}
+
+	preflightFlags = append(preflightFlags, commonFlags...)
+
+	return cli.Command{
+		Name:   "preflight",
+		Usage:  "Check that the nodes are ready to run the cluster",
+		Action: preflightFromCli,
+		Flags:  preflightFlags,
+	}
+}
+
+func preflightFromCli(ctx *cli.Context) error {
+	logrus.Infof("Running RKE version: %v", ctx.App.Version)
+	outputFormat := ctx.String("output")
+	if outputFormat != outputFormatTable && outputFormat != outputFormatJSON {
+		return fmt.Errorf("unsupported output format [%s], allowed values: %s, %s", outputFormat, outputFormatTable, outputFormatJSON)
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	rkeConfig, err = setOptionsFromCLI(ctx, rkeConfig)
+	if err != nil {
+		return err
+	}
+	// setting up the flags
+	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
+
+	runCtx := context.Background()
+	kubeCluster, err := cluster.InitClusterObject(runCtx, rkeConfig, flags, "")
+	if err != nil {
+		return err
+	}
+	if err := kubeCluster.SetupDialers(runCtx, hosts.DialersOptions{}); err != nil {
+		return err
+	}
+	// the Docker version is reported by the checks instead of failing the tunnel
+	for _, host := range hosts.GetUniqueHostList(kubeCluster.EtcdHosts, kubeCluster.ControlPlaneHosts, kubeCluster.WorkerHosts) {
+		host.IgnoreDockerVersion = true
+	}
+	if err := kubeCluster.TunnelHosts(runCtx, flags); err != nil {
+		return err
+	}
+	report, err := kubeCluster.RunPreflightChecks(runCtx, ctx.StringSlice("skip"))
+	if err != nil {
+		return err
+	}
+	if outputFormat == outputFormatJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
@@ -37,6 +37,7 @@ func RemoveCommand() cli.Command {
 			Name:  "dind",
 			Usage: "Remove Kubernetes cluster deployed in dind mode",
 		},
+		outputFlag,
 	}
 
 	removeFlags = append(removeFlags, commonFlags...)
@@ -71,7 +72,9 @@ func ClusterRemove(
 	}
 
 	logrus.Debugf("Starting Cluster removal")
+	phaseDone := log.StartPhase(ctx, "remove")
 	err = kubeCluster.ClusterRemove(ctx)
+	phaseDone(err)
 	if err != nil {
 		return err
 	}
@@ -81,15 +84,22 @@ func ClusterRemove(
 }
 
 func clusterRemoveFromCli(ctx *cli.Context) error {
+	runCtx, err := newCommandContext(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
 	logrus.Infof("Running RKE version: %v", ctx.App.Version)
 	if ctx.Bool("local") {
-		return clusterRemoveLocal(ctx)
+		return clusterRemoveLocal(runCtx, ctx)
 	}
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to resolve cluster file: %v", err)
 	}
 	force := ctx.Bool("force")
+	if !force && ctx.String("output") == outputFormatJSON {
+		return fmt.Errorf("--force is required with --output %s", outputFormatJSON)
+	}
 	if !force {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Printf("Are you sure you want to remove Kubernetes cluster [y/n]: ")
@@ -103,7 +113,7 @@ func clusterRemoveFromCli(ctx *cli.Context) error {
 		}
 	}
 	if ctx.Bool("dind") {
-		return clusterRemoveDind(ctx)
+		return clusterRemoveDind(runCtx, ctx)
 	}
 	rkeConfig, err := cluster.ParseConfig(clusterFile)
 	if err != nil {
@@ -118,14 +128,14 @@ func clusterRemoveFromCli(ctx *cli.Context) error {
 	// setting up the flags
 	flags := cluster.GetExternalFlags(false, false, false, false, "", filePath)
 
-	return ClusterRemove(context.Background(), rkeConfig, hosts.DialersOptions{}, flags)
+	return ClusterRemove(runCtx, rkeConfig, hosts.DialersOptions{}, flags)
 }
 
-func clusterRemoveLocal(ctx *cli.Context) error {
+func clusterRemoveLocal(runCtx context.Context, ctx *cli.Context) error {
 	var rkeConfig *v3.RancherKubernetesEngineConfig
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
-		log.Warnf(context.Background(), "Failed to resolve cluster file, using default cluster instead")
+		log.Warnf(runCtx, "Failed to resolve cluster file, using default cluster instead")
 		rkeConfig = cluster.GetLocalRKEConfig()
 	} else {
 		rkeConfig, err = cluster.ParseConfig(clusterFile)
@@ -142,10 +152,10 @@ func clusterRemoveLocal(ctx *cli.Context) error {
 	// setting up the flags
 	flags := cluster.GetExternalFlags(true, false, false, false, "", filePath)
 
-	return ClusterRemove(context.Background(), rkeConfig, hosts.DialersOptions{}, flags)
+	return ClusterRemove(runCtx, rkeConfig, hosts.DialersOptions{}, flags)
 }
 
-func clusterRemoveDind(ctx *cli.Context) error {
+func clusterRemoveDind(runCtx context.Context, ctx *cli.Context) error {
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to resolve cluster file: %v", err)
@@ -162,16 +172,16 @@ func clusterRemoveDind(ctx *cli.Context) error {
 	}
 
 	for _, node := range rkeConfig.Nodes {
-		if err = dind.RmoveDindContainer(context.Background(), node.Address); err != nil {
+		if err = dind.RmoveDindContainer(runCtx, node.Address); err != nil {
 			return err
 		}
 	}
 	// remove the kube config file
 	localKubeConfigPath := pki.GetLocalKubeConfig(filePath, "")
-	pki.RemoveAdminConfig(context.Background(), localKubeConfigPath)
+	pki.RemoveAdminConfig(runCtx, localKubeConfigPath)
 
 	// remove cluster state file
 	stateFilePath := cluster.GetStateFilePath(filePath, "")
-	cluster.RemoveStateFile(context.Background(), stateFilePath)
+	cluster.RemoveStateFile(runCtx, stateFilePath)
 	return err
 }
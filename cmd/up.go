@@ -3,6 +3,8 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
+	"os"
 	"strings"
 	"time"
 
@@ -54,6 +56,10 @@ func UpCommand() cli.Command {
 			Name:  "disable-port-check",
 			Usage: "Disable port check validation between nodes",
 		},
+		cli.BoolFlag{
+			Name:  "skip-preflight",
+			Usage: "Skip the pre-flight node readiness checks",
+		},
 		cli.BoolFlag{
 			Name:  "init",
 			Usage: "Initiate RKE cluster",
@@ -66,6 +72,28 @@ func UpCommand() cli.Command {
 			Name:  "custom-certs",
 			Usage: "Use custom certificates from a cert dir",
 		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Show the changes that would be applied to the cluster without touching the nodes",
+		},
+		cli.BoolFlag{
+			Name:  "resume",
+			Usage: "Resume a failed run from its checkpoint, skipping the phases and hosts already completed for the same cluster configuration",
+		},
+		cli.IntFlag{
+			Name:  "cert-expiry-warning-days",
+			Usage: "Warn about certificates expiring in less than this number of days, 0 disables the warnings",
+			Value: cluster.DefaultCertExpiryWarningDays,
+		},
+		cli.BoolFlag{
+			Name:  "rotate-expiring-certs",
+			Usage: "Rotate the cluster certificates when one of them expires in less than --cert-expiry-warning-days days",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: fmt.Sprintf("Output format of the dry run plan, or of the progress when deploying the cluster (allowed values: %s, %s)", outputFormatText, outputFormatJSON),
+			Value: outputFormatText,
+		},
 	}
 
 	upFlags = append(upFlags, commonFlags...)
@@ -113,12 +141,21 @@ func ClusterUp(ctx context.Context, dialersOptions hosts.DialersOptions, flags c
 		}
 	}
 
+	desiredStateChecksum, err := cluster.GetDesiredStateChecksum(clusterState)
+	if err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+	checkpoints := cluster.LoadCheckpointJournal(ctx, cluster.GetCheckpointFilePath(flags.ClusterFilePath, flags.ConfigDir), desiredStateChecksum, flags.Resume)
+	kubeCluster.Checkpoints = checkpoints
+
 	log.Infof(ctx, "Building Kubernetes cluster")
 	err = kubeCluster.SetupDialers(ctx, dialersOptions)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
+	phaseDone := log.StartPhase(ctx, "tunnel-hosts")
 	err = kubeCluster.TunnelHosts(ctx, flags)
+	phaseDone(err)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -126,34 +163,61 @@ func ClusterUp(ctx context.Context, dialersOptions hosts.DialersOptions, flags c
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
+	if err = kubeCluster.SetNetworkPluginMigration(ctx, currentCluster, clusterState); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
 	if !flags.DisablePortCheck {
-		if err = kubeCluster.CheckClusterPorts(ctx, currentCluster); err != nil {
+		_, err = runCheckpointPhase(ctx, checkpoints, cluster.CheckpointPhaseCheckPorts, func() (string, error) {
+			return "", kubeCluster.CheckClusterPorts(ctx, currentCluster)
+		})
+		if err != nil {
 			return APIURL, caCrt, clientCert, clientKey, nil, err
 		}
 	}
 
+	if !flags.SkipPreflight && !flags.Local && !flags.DinD {
+		// the ports and the SELinux label are checked on their own by rke up
+		report, err := kubeCluster.RunPreflightChecks(ctx, []string{cluster.PreflightCheckPorts, cluster.PreflightCheckSELinux})
+		if err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, err
+		}
+		for _, result := range report.Warnings() {
+			log.Warnf(ctx, "[preflight] Check [%s] on host [%s]: %s", result.Check, result.Node, result.Message)
+		}
+		if err = report.Err(); err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, fmt.Errorf("%v, run rke preflight for the full report or use --skip-preflight to skip the checks", err)
+		}
+	}
+
 	if err = kubeCluster.RunSELinuxCheck(ctx); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	phaseDone = log.StartPhase(ctx, "certificates")
 	err = cluster.SetUpAuthentication(ctx, kubeCluster, currentCluster, clusterState)
+	phaseDone(err)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
+	cluster.WarnExpiringCertificates(ctx, kubeCluster, flags.CertExpiryWarningDays)
 	if len(kubeCluster.ControlPlaneHosts) > 0 {
-		APIURL = fmt.Sprintf("https://%s:6443", kubeCluster.ControlPlaneHosts[0].Address)
+		APIURL = "https://" + net.JoinHostPort(kubeCluster.ControlPlaneHosts[0].Address, cluster.KubeAPIPort)
 	}
 	clientCert = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Certificate))
 	clientKey = string(cert.EncodePrivateKeyPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Key))
-	caCrt = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.CACertName].Certificate))
+	caCrt = pki.GetCACertsPEM(kubeCluster.Certificates)
 
 	// moved deploying certs before reconcile to remove all unneeded certs generation from reconcile
-	err = kubeCluster.SetUpHosts(ctx, flags)
+	_, err = runCheckpointPhase(ctx, checkpoints, cluster.CheckpointPhaseSetupHosts, func() (string, error) {
+		return "", kubeCluster.SetUpHosts(ctx, flags)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	phaseDone = log.StartPhase(ctx, "reconcile")
 	err = cluster.ReconcileCluster(ctx, kubeCluster, currentCluster, flags, svcOptionsData)
+	phaseDone(err)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -195,17 +259,22 @@ func ClusterUp(ctx context.Context, dialersOptions hosts.DialersOptions, flags c
 
 	// update APIURL after reconcile
 	if len(kubeCluster.ControlPlaneHosts) > 0 {
-		APIURL = fmt.Sprintf("https://%s:6443", kubeCluster.ControlPlaneHosts[0].Address)
+		APIURL = "https://" + net.JoinHostPort(kubeCluster.ControlPlaneHosts[0].Address, cluster.KubeAPIPort)
 	}
 	if err = cluster.ReconcileEncryptionProviderConfig(ctx, kubeCluster, currentCluster); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
-	if err := kubeCluster.PrePullK8sImages(ctx); err != nil {
+	_, err = runCheckpointPhase(ctx, checkpoints, cluster.CheckpointPhasePullImages, func() (string, error) {
+		return "", kubeCluster.PrePullK8sImages(ctx)
+	})
+	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
-	errMsgMaxUnavailableNotFailedCtrl, err := kubeCluster.DeployControlPlane(ctx, svcOptionsData, reconcileCluster)
+	errMsgMaxUnavailableNotFailedCtrl, err := runCheckpointPhase(ctx, checkpoints, cluster.CheckpointPhaseControlPlane, func() (string, error) {
+		return kubeCluster.DeployControlPlane(ctx, svcOptionsData, reconcileCluster)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -230,7 +299,9 @@ func ClusterUp(ctx context.Context, dialersOptions hosts.DialersOptions, flags c
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
-	errMsgMaxUnavailableNotFailedWrkr, err := kubeCluster.DeployWorkerPlane(ctx, svcOptionsData, reconcileCluster)
+	errMsgMaxUnavailableNotFailedWrkr, err := runCheckpointPhase(ctx, checkpoints, cluster.CheckpointPhaseWorkerPlane, func() (string, error) {
+		return kubeCluster.DeployWorkerPlane(ctx, svcOptionsData, reconcileCluster)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -244,7 +315,18 @@ func ClusterUp(ctx context.Context, dialersOptions hosts.DialersOptions, flags c
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	if clusterState.CurrentState.NetworkPluginMigration != nil {
+		_, err = runCheckpointPhase(ctx, checkpoints, cluster.CheckpointPhaseNetworkMigration, func() (string, error) {
+			return "", kubeCluster.MigrateNetworkPlugin(ctx, clusterState, data)
+		})
+		if err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, err
+		}
+	}
+
+	phaseDone = log.StartPhase(ctx, "addons")
 	err = cluster.ConfigureCluster(ctx, kubeCluster.RancherKubernetesEngineConfig, kubeCluster.Certificates, flags, dialersOptions, data, false)
+	phaseDone(err)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -261,10 +343,27 @@ func ClusterUp(ctx context.Context, dialersOptions hosts.DialersOptions, flags c
 	if errMsgMaxUnavailableNotFailedCtrl != "" || errMsgMaxUnavailableNotFailedWrkr != "" {
 		return APIURL, caCrt, clientCert, clientKey, nil, fmt.Errorf(errMsgMaxUnavailableNotFailedCtrl + errMsgMaxUnavailableNotFailedWrkr)
 	}
+	checkpoints.Remove()
 	log.Infof(ctx, "Finished building Kubernetes cluster successfully")
 	return APIURL, caCrt, clientCert, clientKey, kubeCluster.Certificates, nil
 }
 
+// runCheckpointPhase runs the phase unless it already completed for the desired state. The phase is recorded as completed in the
+// journal once it succeeded on every host, a phase that failed on less than max_unavailable hosts is run again when resuming.
+func runCheckpointPhase(ctx context.Context, checkpoints *cluster.CheckpointJournal, phase string, run func() (string, error)) (string, error) {
+	if checkpoints.IsPhaseCompleted(phase) {
+		log.Infof(ctx, "[checkpoint] Phase [%s] already completed, skipping", phase)
+		return "", nil
+	}
+	phaseDone := log.StartPhase(ctx, phase)
+	errMsgMaxUnavailableNotFailed, err := run()
+	phaseDone(err)
+	if err != nil || errMsgMaxUnavailableNotFailed != "" {
+		return errMsgMaxUnavailableNotFailed, err
+	}
+	return "", checkpoints.CompletePhase(phase)
+}
+
 func checkAllIncluded(cluster *cluster.Cluster) error {
 	if len(cluster.InactiveHosts) == 0 {
 		return nil
@@ -282,12 +381,23 @@ func checkAllIncluded(cluster *cluster.Cluster) error {
 }
 
 func clusterUpFromCli(ctx *cli.Context) error {
+	if ctx.Bool("dry-run") && (ctx.Bool("local") || ctx.Bool("dind")) {
+		return fmt.Errorf("--dry-run is not supported with --local or --dind")
+	}
+	// the dry run plan is written in the output format, progress events are only streamed when the cluster is deployed
+	runCtx := context.Background()
+	if !ctx.Bool("dry-run") {
+		var err error
+		if runCtx, err = newCommandContext(ctx, os.Stdout); err != nil {
+			return err
+		}
+	}
 	logrus.Infof("Running RKE version: %v", ctx.App.Version)
 	if ctx.Bool("local") {
-		return clusterUpLocal(ctx)
+		return clusterUpLocal(runCtx, ctx)
 	}
 	if ctx.Bool("dind") {
-		return clusterUpDind(ctx)
+		return clusterUpDind(runCtx, ctx)
 	}
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
@@ -310,22 +420,41 @@ func clusterUpFromCli(ctx *cli.Context) error {
 	// Custom certificates and certificate dir flags
 	flags.CertificateDir = ctx.String("cert-dir")
 	flags.CustomCerts = ctx.Bool("custom-certs")
+	flags.Resume = ctx.Bool("resume")
+	flags.SkipPreflight = ctx.Bool("skip-preflight")
+	flags.CertExpiryWarningDays = ctx.Int("cert-expiry-warning-days")
+	if ctx.Bool("dry-run") {
+		outputFormat := ctx.String("output")
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		diff, err := ClusterPlan(runCtx, rkeConfig, flags, map[string]interface{}{})
+		if err != nil {
+			return err
+		}
+		return writePlanDiff(os.Stdout, diff, outputFormat)
+	}
 	if ctx.Bool("init") {
-		return ClusterInit(context.Background(), rkeConfig, hosts.DialersOptions{}, flags)
+		return ClusterInit(runCtx, rkeConfig, hosts.DialersOptions{}, flags)
+	}
+	if ctx.Bool("rotate-expiring-certs") {
+		if err := setRotateExpiringCertificates(runCtx, rkeConfig, flags); err != nil {
+			return err
+		}
 	}
-	if err := ClusterInit(context.Background(), rkeConfig, hosts.DialersOptions{}, flags); err != nil {
+	if err := ClusterInit(runCtx, rkeConfig, hosts.DialersOptions{}, flags); err != nil {
 		return err
 	}
 
-	_, _, _, _, _, err = ClusterUp(context.Background(), hosts.DialersOptions{}, flags, map[string]interface{}{})
+	_, _, _, _, _, err = ClusterUp(runCtx, hosts.DialersOptions{}, flags, map[string]interface{}{})
 	return err
 }
 
-func clusterUpLocal(ctx *cli.Context) error {
+func clusterUpLocal(runCtx context.Context, ctx *cli.Context) error {
 	var rkeConfig *v3.RancherKubernetesEngineConfig
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
-		log.Infof(context.Background(), "Failed to resolve cluster file, using default cluster instead")
+		log.Infof(runCtx, "Failed to resolve cluster file, using default cluster instead")
 		rkeConfig = cluster.GetLocalRKEConfig()
 	} else {
 		rkeConfig, err = cluster.ParseConfig(clusterFile)
@@ -344,23 +473,23 @@ func clusterUpLocal(ctx *cli.Context) error {
 	flags := cluster.GetExternalFlags(true, false, false, false, "", filePath)
 
 	if ctx.Bool("init") {
-		return ClusterInit(context.Background(), rkeConfig, dialers, flags)
+		return ClusterInit(runCtx, rkeConfig, dialers, flags)
 	}
-	if err := ClusterInit(context.Background(), rkeConfig, dialers, flags); err != nil {
+	if err := ClusterInit(runCtx, rkeConfig, dialers, flags); err != nil {
 		return err
 	}
-	_, _, _, _, _, err = ClusterUp(context.Background(), dialers, flags, map[string]interface{}{})
+	_, _, _, _, _, err = ClusterUp(runCtx, dialers, flags, map[string]interface{}{})
 	return err
 }
 
-func clusterUpDind(ctx *cli.Context) error {
+func clusterUpDind(runCtx context.Context, ctx *cli.Context) error {
 	// get dind config
 	rkeConfig, disablePortCheck, dindStorageDriver, filePath, dindDNS, err := getDindConfig(ctx)
 	if err != nil {
 		return err
 	}
 	// setup dind environment
-	if err = createDINDEnv(context.Background(), rkeConfig, dindStorageDriver, dindDNS); err != nil {
+	if err = createDINDEnv(runCtx, rkeConfig, dindStorageDriver, dindDNS); err != nil {
 		return err
 	}
 
@@ -371,13 +500,13 @@ func clusterUpDind(ctx *cli.Context) error {
 	flags.DinD = true
 
 	if ctx.Bool("init") {
-		return ClusterInit(context.Background(), rkeConfig, dialers, flags)
+		return ClusterInit(runCtx, rkeConfig, dialers, flags)
 	}
-	if err := ClusterInit(context.Background(), rkeConfig, dialers, flags); err != nil {
+	if err := ClusterInit(runCtx, rkeConfig, dialers, flags); err != nil {
 		return err
 	}
 	// start cluster
-	_, _, _, _, _, err = ClusterUp(context.Background(), dialers, flags, map[string]interface{}{})
+	_, _, _, _, _, err = ClusterUp(runCtx, dialers, flags, map[string]interface{}{})
 	return err
 }
 
@@ -41,6 +41,17 @@ func UtilCommand() cli.Command {
 				Action: getKubeconfigFile,
 				Flags:  utilFlags,
 			},
+			cli.Command{
+				Name:   "get-agent-token",
+				Usage:  "Print the token the node agent of a node with connection_type agent authenticates with",
+				Action: getAgentToken,
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "node-address",
+						Usage: "Address of the node in the cluster configuration",
+					},
+				}, utilCfgFlags...),
+			},
 		},
 	}
 }
@@ -86,6 +97,31 @@ func getKubeconfigFile(ctx *cli.Context) error {
 	return cluster.RebuildKubeconfig(context.Background(), kubeCluster)
 }
 
+func getAgentToken(ctx *cli.Context) error {
+	nodeAddress := ctx.String("node-address")
+	if len(nodeAddress) == 0 {
+		return fmt.Errorf("--node-address is required")
+	}
+	clusterFile, _, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cluster file: %v", err)
+	}
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster file: %v", err)
+	}
+	if rkeConfig.AgentTunnel == nil || len(rkeConfig.AgentTunnel.Token) == 0 {
+		return fmt.Errorf("agent_tunnel token is not set in the cluster file")
+	}
+	for _, node := range rkeConfig.Nodes {
+		if node.Address == nodeAddress && node.ConnectionType == hosts.ConnectionTypeAgent {
+			fmt.Println(hosts.GetNodeAgentToken(rkeConfig.AgentTunnel.Token, nodeAddress))
+			return nil
+		}
+	}
+	return fmt.Errorf("node [%s] with connection_type agent not found in the cluster file", nodeAddress)
+}
+
 func getStateFile(ctx *cli.Context) error {
 	logrus.Infof("Retrieving state file from cluster")
 	// Check if we can successfully connect to the cluster using the existing kubeconfig file
@@ -0,0 +1,949 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/content"
+	cerrdefs "github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/platforms"
+	remotesdocker "github.com/containerd/containerd/remotes/docker"
+	"github.com/containerd/containerd/runtime/restart"
+	ref "github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	prototypes "github.com/gogo/protobuf/types"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/grpc"
+)
+
+const (
+	// ContainerdSocket is the default containerd socket on the hosts
+	ContainerdSocket = "/run/containerd/containerd.sock"
+	// ContainerdNamespace holds the containers and images managed by RKE, apart from the k8s.io namespace of the kubelet
+	ContainerdNamespace = "rke"
+	ContainerdRootDir   = "/var/lib/containerd"
+	ContainerdLogDir    = "/var/lib/rancher/rke/containerd/log"
+
+	containerdSnapshotter   = "overlayfs"
+	containerdTaskRootDir   = "/run/containerd/io.containerd.runtime.v2.task"
+	containerdConfigExt     = "io.rancher.rke.container.config"
+	containerdConfigTypeURL = "rke.cattle.io/docker.container.config"
+	containerdLogPathLabel  = "io.rancher.rke.container.log-path"
+	containerdLoggerPath    = "/var/lib/rancher/rke/containerd/bin/rke-logger"
+)
+
+// containerdLogger is the logging binary of the containers, the shim passes it the stdout of the container on fd 3 and its stderr
+// on fd 4, closing fd 5 tells the shim the logger is ready. The lines of both streams are appended to the same log file, prefixed
+// with their stream so they can be told apart when the logs are read.
+const containerdLogger = `#!/bin/sh
+PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+[ "$1" = log ] && [ -n "$2" ] || exit 1
+mkdir -p "$(dirname "$2")"
+exec 5>&-
+awk '{ print "stdout " $0; fflush() }' <&3 4<&- >>"$2" &
+awk '{ print "stderr " $0; fflush() }' <&4 3<&- >>"$2" &
+exec 3<&- 4<&-
+wait
+`
+
+// containerdRuntime runs the containers of the docker package with containerd. Containers are identified by their name, the docker
+// configuration they were created with is kept in an extension so they can be inspected and compared like docker containers.
+type containerdRuntime struct {
+	client   *containerd.Client
+	run      HostCommandRunner
+	platform string
+}
+
+type containerdConfig struct {
+	Config     *container.Config     `json:"config"`
+	HostConfig *container.HostConfig `json:"hostConfig"`
+}
+
+// NewContainerdRuntime returns the runtime managing the containers through the containerd gRPC connection. Container logs and files
+// are read and written on the host with run.
+func NewContainerdRuntime(ctx context.Context, conn *grpc.ClientConn, run HostCommandRunner) (ContainerRuntime, error) {
+	arch, err := runHostCommand(ctx, run, "uname -m")
+	if err != nil {
+		return nil, fmt.Errorf("Can't get host architecture: %v", err)
+	}
+	hostPlatform := platforms.Normalize(specs.Platform{OS: "linux", Architecture: strings.TrimSpace(arch)})
+	installCmd := fmt.Sprintf("mkdir -p %s && cat > %[2]s.tmp && chmod 0755 %[2]s.tmp && mv -f %[2]s.tmp %[2]s", shellQuote(path.Dir(containerdLoggerPath)), shellQuote(containerdLoggerPath))
+	if err := run(ctx, installCmd, strings.NewReader(containerdLogger), io.Discard); err != nil {
+		return nil, fmt.Errorf("Can't install the container logger: %v", err)
+	}
+	client, err := containerd.NewWithConn(conn,
+		containerd.WithDefaultNamespace(ContainerdNamespace),
+		containerd.WithDefaultPlatform(platforms.Only(hostPlatform)))
+	if err != nil {
+		return nil, err
+	}
+	return &containerdRuntime{
+		client:   client,
+		run:      run,
+		platform: platforms.Format(hostPlatform),
+	}, nil
+}
+
+func (c *containerdRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.ContainerCreateCreatedBody, error) {
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+	image, err := c.getImage(ctx, config.Image)
+	if err != nil {
+		return container.ContainerCreateCreatedBody{}, err
+	}
+	imageConfig, err := c.getImageConfig(ctx, image)
+	if err != nil {
+		return container.ContainerCreateCreatedBody{}, err
+	}
+	mounts, err := c.getMounts(ctx, hostConfig)
+	if err != nil {
+		return container.ContainerCreateCreatedBody{}, err
+	}
+	ext, err := json.Marshal(containerdConfig{Config: config, HostConfig: hostConfig})
+	if err != nil {
+		return container.ContainerCreateCreatedBody{}, err
+	}
+	labels := map[string]string{
+		containerdLogPathLabel: path.Join(ContainerdLogDir, containerName+".log"),
+	}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	_, err = c.client.NewContainer(ctx, containerName,
+		containerd.WithImage(image),
+		containerd.WithSnapshotter(containerdSnapshotter),
+		containerd.WithNewSnapshot(containerName, image),
+		containerd.WithNewSpec(getContainerdSpecOpts(c.platform, image, imageConfig, config, hostConfig, mounts)...),
+		containerd.WithContainerLabels(labels),
+		containerd.WithContainerExtension(containerdConfigExt, &prototypes.Any{TypeUrl: containerdConfigTypeURL, Value: ext}))
+	if err != nil {
+		return container.ContainerCreateCreatedBody{}, convertContainerdError(err)
+	}
+	return container.ContainerCreateCreatedBody{ID: containerName}, nil
+}
+
+func (c *containerdRuntime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return types.ContainerJSON{}, convertContainerdError(err)
+	}
+	info, err := cont.Info(ctx)
+	if err != nil {
+		return types.ContainerJSON{}, convertContainerdError(err)
+	}
+	config, err := getContainerdConfig(info)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	state, err := c.getContainerState(ctx, cont)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         info.ID,
+			Name:       "/" + info.ID,
+			Created:    info.CreatedAt.Format(time.RFC3339Nano),
+			Image:      info.Image,
+			State:      state,
+			HostConfig: config.HostConfig,
+			LogPath:    info.Labels[containerdLogPathLabel],
+		},
+		Config: config.Config,
+	}
+	for _, bind := range config.HostConfig.Binds {
+		m, err := parseBind(bind)
+		if err != nil {
+			continue
+		}
+		inspect.Mounts = append(inspect.Mounts, types.MountPoint{
+			Type:        "bind",
+			Source:      m.Source,
+			Destination: m.Destination,
+			RW:          !containsString(m.Options, "ro"),
+		})
+	}
+	return inspect, nil
+}
+
+func (c *containerdRuntime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	conts, err := c.client.Containers(ctx)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	var list []types.Container
+	for _, cont := range conts {
+		info, err := cont.Info(ctx)
+		if err != nil {
+			if cerrdefs.IsNotFound(err) {
+				continue
+			}
+			return nil, convertContainerdError(err)
+		}
+		state, err := c.getContainerState(ctx, cont)
+		if err != nil {
+			return nil, err
+		}
+		if !options.All && !state.Running {
+			continue
+		}
+		list = append(list, types.Container{
+			ID:      info.ID,
+			Names:   []string{"/" + info.ID},
+			Image:   info.Image,
+			Labels:  info.Labels,
+			Created: info.CreatedAt.Unix(),
+			State:   state.Status,
+			Status:  state.Status,
+		})
+	}
+	return list, nil
+}
+
+// ContainerLogs returns the last lines of the container log file on the host, split by stream. Followed logs end when the container
+// task exits.
+func (c *containerdRuntime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	labels, err := cont.Labels(ctx)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	tail := "+1"
+	if options.Tail != "" && options.Tail != "all" {
+		tail = options.Tail
+	}
+	cmd := fmt.Sprintf("tail -n %s %s", shellQuote(tail), shellQuote(labels[containerdLogPathLabel]))
+	if options.Follow {
+		state, err := c.getContainerState(ctx, cont)
+		if err != nil {
+			return nil, err
+		}
+		// tail reads the file one last time once the task process is gone
+		if state.Running {
+			cmd = fmt.Sprintf("tail -F --pid=%d -n %s %s", state.Pid, shellQuote(tail), shellQuote(labels[containerdLogPathLabel]))
+		}
+	}
+	return c.streamHostCommand(ctx, cmd, nil, func(w io.Writer) io.Writer { return newContainerdLogWriter(w) }), nil
+}
+
+func (c *containerdRuntime) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	if err := c.deleteTask(ctx, cont, options.Force); err != nil {
+		return err
+	}
+	labels, err := cont.Labels(ctx)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	if err := cont.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+		return convertContainerdError(err)
+	}
+	if logPath := labels[containerdLogPathLabel]; logPath != "" {
+		_, _ = runHostCommand(ctx, c.run, "rm -f "+shellQuote(logPath))
+	}
+	return nil
+}
+
+// ContainerRename moves the container record to the new name, containerd can't rename containers. The container must be stopped.
+func (c *containerdRuntime) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	state, err := c.getContainerState(ctx, cont)
+	if err != nil {
+		return err
+	}
+	if state.Running {
+		return fmt.Errorf("Can't rename running container [%s]", containerID)
+	}
+	if err := c.deleteTask(ctx, cont, false); err != nil {
+		return err
+	}
+	info, err := cont.Info(ctx)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	info.ID = newContainerName
+	if _, err := c.client.ContainerService().Create(ctx, info); err != nil {
+		return convertContainerdError(err)
+	}
+	return convertContainerdError(c.client.ContainerService().Delete(ctx, containerID))
+}
+
+func (c *containerdRuntime) ContainerRestart(ctx context.Context, containerID string, timeout *time.Duration) error {
+	if err := c.ContainerStop(ctx, containerID, timeout); err != nil {
+		return err
+	}
+	return c.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+func (c *containerdRuntime) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	task, err := c.getTask(ctx, cont)
+	if err != nil {
+		return err
+	}
+	if task != nil {
+		status, err := task.Status(ctx)
+		if err != nil {
+			return convertContainerdError(err)
+		}
+		switch status.Status {
+		case containerd.Running:
+			return nil
+		case containerd.Created:
+		default:
+			if _, err := task.Delete(ctx); err != nil {
+				return convertContainerdError(err)
+			}
+			task = nil
+		}
+	}
+	if task == nil {
+		if task, err = c.newTask(ctx, cont); err != nil {
+			return err
+		}
+	}
+	if err := task.Start(ctx); err != nil {
+		return convertContainerdError(err)
+	}
+	info, err := cont.Info(ctx)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	config, err := getContainerdConfig(info)
+	if err != nil {
+		return err
+	}
+	switch config.HostConfig.RestartPolicy.Name {
+	case "always", "unless-stopped":
+		logURI, err := getContainerdLogURI(info.Labels[containerdLogPathLabel])
+		if err != nil {
+			return err
+		}
+		return convertContainerdError(cont.Update(ctx,
+			restart.WithStatus(containerd.Running),
+			restart.WithLogURI(logURI)))
+	}
+	return nil
+}
+
+func (c *containerdRuntime) ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	labels, err := cont.Labels(ctx)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	// the restart monitor would start the container again
+	if _, ok := labels[restart.StatusLabel]; ok {
+		if err := cont.Update(ctx, restart.WithNoRestarts); err != nil {
+			return convertContainerdError(err)
+		}
+	}
+	task, err := c.getTask(ctx, cont)
+	if err != nil || task == nil {
+		return err
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	if status.Status != containerd.Running {
+		return nil
+	}
+	exitCh, err := task.Wait(ctx)
+	if err != nil {
+		return convertContainerdError(err)
+	}
+	if err := task.Kill(ctx, syscall.SIGTERM); err != nil {
+		return convertContainerdError(err)
+	}
+	stopTimeout := 10 * time.Second
+	if timeout != nil {
+		stopTimeout = *timeout
+	}
+	select {
+	case <-exitCh:
+		return nil
+	case <-time.After(stopTimeout):
+	}
+	if err := task.Kill(ctx, syscall.SIGKILL); err != nil && !cerrdefs.IsNotFound(err) {
+		return convertContainerdError(err)
+	}
+	<-exitCh
+	return nil
+}
+
+// CopyFromContainer returns a tar archive of the path, read on the host from the bind mount holding it or from the container rootfs
+func (c *containerdRuntime) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	hostPath, err := c.getHostPath(ctx, containerID, srcPath)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	stat := types.ContainerPathStat{Name: path.Base(srcPath)}
+	if _, err := runHostCommand(ctx, c.run, "test -e "+shellQuote(hostPath)); err != nil {
+		return nil, stat, errdefs.NotFound(fmt.Errorf("Could not find the file %s in container %s", srcPath, containerID))
+	}
+	cmd := fmt.Sprintf("tar -C %s -cf - %s", shellQuote(path.Dir(hostPath)), shellQuote(path.Base(hostPath)))
+	return c.streamHostCommand(ctx, cmd, nil, nil), stat, nil
+}
+
+func (c *containerdRuntime) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	hostPath, err := c.getHostPath(ctx, containerID, dstPath)
+	if err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("mkdir -p %[1]s && tar -C %[1]s -xf -", shellQuote(hostPath))
+	return c.run(ctx, cmd, content, io.Discard)
+}
+
+func (c *containerdRuntime) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	image, err := c.getImage(ctx, imageID)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	imageConfig, err := c.getImageConfig(ctx, image)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	raw, err := json.Marshal(imageConfig)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	config := imageConfig.Config
+	return types.ImageInspect{
+		ID:           image.Target().Digest.String(),
+		RepoTags:     []string{image.Name()},
+		Os:           imageConfig.OS,
+		Architecture: imageConfig.Architecture,
+		Config: &container.Config{
+			User:       config.User,
+			Env:        config.Env,
+			Cmd:        config.Cmd,
+			Entrypoint: config.Entrypoint,
+			Volumes:    config.Volumes,
+			WorkingDir: config.WorkingDir,
+			Labels:     config.Labels,
+		},
+	}, raw, nil
+}
+
+// ImagePull pulls and unpacks the image through the containerd socket, using the registry credentials of options.RegistryAuth
+func (c *containerdRuntime) ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	imageRef, err := normalizeImageRef(refStr)
+	if err != nil {
+		return nil, err
+	}
+	resolverOptions, err := getContainerdResolverOptions(options.RegistryAuth)
+	if err != nil {
+		return nil, err
+	}
+	image, err := c.client.Pull(ctx, imageRef,
+		containerd.WithResolver(remotesdocker.NewResolver(resolverOptions)),
+		containerd.WithPullUnpack,
+		containerd.WithPullSnapshotter(containerdSnapshotter))
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	status, _ := json.Marshal(map[string]string{"status": fmt.Sprintf("Downloaded image for %s@%s", image.Name(), image.Target().Digest)})
+	return io.NopCloser(bytes.NewReader(append(status, '\n'))), nil
+}
+
+// Info describes the host like the docker daemon does, only the fields used by RKE are set. The cgroup driver is the one the CRI
+// plugin of containerd configures runc with, the kubelet has to use the same.
+func (c *containerdRuntime) Info(ctx context.Context) (types.Info, error) {
+	// the host time is read first, it is compared to the time of the request. The host details are left unset if they can't be read.
+	out, _ := runHostCommand(ctx, c.run, strings.Join([]string{
+		"date -u +%Y-%m-%dT%H:%M:%S.%NZ;",
+		"uname -r;",
+		"hostname;",
+		"(. /etc/os-release && echo \"$PRETTY_NAME\");",
+		"containerd config dump 2>/dev/null | grep -q 'SystemdCgroup = true' && echo systemd || echo cgroupfs",
+	}, " "))
+	version, err := c.client.Version(ctx)
+	if err != nil {
+		return types.Info{}, convertContainerdError(err)
+	}
+	info := types.Info{
+		ServerVersion: version.Version,
+		OSType:        "linux",
+		Architecture:  strings.TrimPrefix(c.platform, "linux/"),
+		Driver:        containerdSnapshotter,
+		DockerRootDir: ContainerdRootDir,
+		CgroupDriver:  "cgroupfs",
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) == 5 {
+		info.SystemTime, info.KernelVersion, info.Name, info.OperatingSystem, info.CgroupDriver = lines[0], lines[1], lines[2], lines[3], lines[4]
+	}
+	return info, nil
+}
+
+func (c *containerdRuntime) getImage(ctx context.Context, imageName string) (containerd.Image, error) {
+	imageRef, err := normalizeImageRef(imageName)
+	if err != nil {
+		return nil, err
+	}
+	image, err := c.client.GetImage(ctx, imageRef)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	return image, nil
+}
+
+func (c *containerdRuntime) getImageConfig(ctx context.Context, image containerd.Image) (*specs.Image, error) {
+	desc, err := image.Config(ctx)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	data, err := content.ReadBlob(ctx, image.ContentStore(), desc)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	imageConfig := &specs.Image{}
+	if err := json.Unmarshal(data, imageConfig); err != nil {
+		return nil, fmt.Errorf("Failed to parse configuration of image [%s]: %v", image.Name(), err)
+	}
+	return imageConfig, nil
+}
+
+// getMounts returns the bind mounts of the container, with the binds and image volumes of the containers it takes volumes from.
+// Image volumes are bound from the rootfs of the other container, which is only mounted while it has a task.
+func (c *containerdRuntime) getMounts(ctx context.Context, hostConfig *container.HostConfig) ([]runtimespec.Mount, error) {
+	var mounts []runtimespec.Mount
+	for _, volumesFrom := range hostConfig.VolumesFrom {
+		name, mode, _ := strings.Cut(volumesFrom, ":")
+		cont, err := c.client.LoadContainer(ctx, name)
+		if err != nil {
+			return nil, convertContainerdError(err)
+		}
+		info, err := cont.Info(ctx)
+		if err != nil {
+			return nil, convertContainerdError(err)
+		}
+		config, err := getContainerdConfig(info)
+		if err != nil {
+			return nil, err
+		}
+		for _, bind := range config.HostConfig.Binds {
+			m, err := parseBind(bind)
+			if err != nil {
+				return nil, err
+			}
+			mounts = append(mounts, m)
+		}
+		if len(config.Config.Volumes) == 0 {
+			continue
+		}
+		if task, err := c.getTask(ctx, cont); err != nil {
+			return nil, err
+		} else if task == nil {
+			if _, err := c.newTask(ctx, cont); err != nil {
+				return nil, err
+			}
+		}
+		if mode == "" {
+			mode = "rw"
+		}
+		for volume := range config.Config.Volumes {
+			mounts = append(mounts, runtimespec.Mount{
+				Type:        "bind",
+				Source:      path.Join(containerdTaskRootDir, ContainerdNamespace, name, "rootfs", volume),
+				Destination: volume,
+				Options:     []string{"rbind", mode},
+			})
+		}
+	}
+	for _, bind := range hostConfig.Binds {
+		m, err := parseBind(bind)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	if hostConfig.Privileged {
+		mounts = append(mounts, runtimespec.Mount{Type: "bind", Source: "/dev", Destination: "/dev", Options: []string{"rbind", "rw"}})
+	}
+	return mounts, nil
+}
+
+// getHostPath maps a path of the container to the host, through the bind mount holding it or the rootfs of the container task
+func (c *containerdRuntime) getHostPath(ctx context.Context, containerID, containerPath string) (string, error) {
+	cont, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return "", convertContainerdError(err)
+	}
+	info, err := cont.Info(ctx)
+	if err != nil {
+		return "", convertContainerdError(err)
+	}
+	config, err := getContainerdConfig(info)
+	if err != nil {
+		return "", err
+	}
+	if hostPath, ok := getBindHostPath(config.HostConfig.Binds, containerPath); ok {
+		return hostPath, nil
+	}
+	task, err := c.getTask(ctx, cont)
+	if err != nil {
+		return "", err
+	}
+	if task == nil {
+		if _, err := c.newTask(ctx, cont); err != nil {
+			return "", err
+		}
+	}
+	return path.Join(containerdTaskRootDir, ContainerdNamespace, containerID, "rootfs", containerPath), nil
+}
+
+func (c *containerdRuntime) getTask(ctx context.Context, cont containerd.Container) (containerd.Task, error) {
+	task, err := cont.Task(ctx, nil)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, convertContainerdError(err)
+	}
+	return task, nil
+}
+
+func (c *containerdRuntime) newTask(ctx context.Context, cont containerd.Container) (containerd.Task, error) {
+	labels, err := cont.Labels(ctx)
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	logURI, err := getContainerdLogURI(labels[containerdLogPathLabel])
+	if err != nil {
+		return nil, err
+	}
+	task, err := cont.NewTask(ctx, cio.LogURI(logURI))
+	if err != nil {
+		return nil, convertContainerdError(err)
+	}
+	return task, nil
+}
+
+func (c *containerdRuntime) deleteTask(ctx context.Context, cont containerd.Container, force bool) error {
+	task, err := c.getTask(ctx, cont)
+	if err != nil || task == nil {
+		return err
+	}
+	var opts []containerd.ProcessDeleteOpts
+	if force {
+		opts = append(opts, containerd.WithProcessKill)
+	}
+	if _, err := task.Delete(ctx, opts...); err != nil && !cerrdefs.IsNotFound(err) {
+		return convertContainerdError(err)
+	}
+	return nil
+}
+
+func (c *containerdRuntime) getContainerState(ctx context.Context, cont containerd.Container) (*types.ContainerState, error) {
+	task, err := c.getTask(ctx, cont)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return &types.ContainerState{Status: "exited"}, nil
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return &types.ContainerState{Status: "exited"}, nil
+		}
+		return nil, convertContainerdError(err)
+	}
+	state := &types.ContainerState{
+		Pid: int(task.Pid()),
+	}
+	switch status.Status {
+	case containerd.Running:
+		state.Status = "running"
+		state.Running = true
+	case containerd.Paused, containerd.Pausing:
+		state.Status = "paused"
+		state.Paused = true
+	case containerd.Created:
+		state.Status = "created"
+	default:
+		state.Status = "exited"
+		state.ExitCode = int(status.ExitStatus)
+		if !status.ExitTime.IsZero() {
+			state.FinishedAt = status.ExitTime.Format(time.RFC3339Nano)
+		}
+	}
+	return state, nil
+}
+
+// streamHostCommand returns the output of the command run on the host, the command is stopped when the reader is closed
+func (c *containerdRuntime) streamHostCommand(ctx context.Context, cmd string, stdin io.Reader, wrap func(io.Writer) io.Writer) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	var out io.Writer = pw
+	if wrap != nil {
+		out = wrap(pw)
+	}
+	go func() {
+		pw.CloseWithError(c.run(ctx, cmd, stdin, out))
+	}()
+	return &cancelReadCloser{ReadCloser: pr, cancel: cancel}
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReadCloser) Close() error {
+	r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// containerdLogWriter frames the lines of the container log file for stdcopy, by the stream they are prefixed with. Lines without
+// prefix were written before the logger split the streams, they are framed as stdout.
+type containerdLogWriter struct {
+	stdout io.Writer
+	stderr io.Writer
+	buf    []byte
+}
+
+func newContainerdLogWriter(w io.Writer) *containerdLogWriter {
+	return &containerdLogWriter{
+		stdout: stdcopy.NewStdWriter(w, stdcopy.Stdout),
+		stderr: stdcopy.NewStdWriter(w, stdcopy.Stderr),
+	}
+}
+
+func (w *containerdLogWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.buf[:i+1]
+		out := w.stdout
+		if rest, ok := bytes.CutPrefix(line, []byte("stderr ")); ok {
+			out, line = w.stderr, rest
+		} else if rest, ok := bytes.CutPrefix(line, []byte("stdout ")); ok {
+			line = rest
+		}
+		if _, err := out.Write(line); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// getContainerdLogURI returns the URI of the logger writing the container streams to the log file
+func getContainerdLogURI(logPath string) (*url.URL, error) {
+	return cio.LogURIGenerator("binary", containerdLoggerPath, map[string]string{"log": logPath})
+}
+
+func runHostCommand(ctx context.Context, run HostCommandRunner, cmd string) (string, error) {
+	if run == nil {
+		return "", fmt.Errorf("Can't run [%s], no command runner for the host", cmd)
+	}
+	var out bytes.Buffer
+	err := run(ctx, cmd, nil, &out)
+	return out.String(), err
+}
+
+func getContainerdSpecOpts(platform string, image containerd.Image, imageConfig *specs.Image, config *container.Config, hostConfig *container.HostConfig, mounts []runtimespec.Mount) []oci.SpecOpts {
+	opts := []oci.SpecOpts{
+		oci.WithDefaultSpecForPlatform(platform),
+		oci.WithImageConfig(image),
+	}
+	entrypoint := imageConfig.Config.Entrypoint
+	cmd := imageConfig.Config.Cmd
+	if len(config.Entrypoint) > 0 {
+		entrypoint = config.Entrypoint
+		cmd = nil
+	}
+	if len(config.Cmd) > 0 {
+		cmd = config.Cmd
+	}
+	if args := append(append([]string{}, entrypoint...), cmd...); len(args) > 0 {
+		opts = append(opts, oci.WithProcessArgs(args...))
+	}
+	if len(config.Env) > 0 {
+		opts = append(opts, oci.WithEnv(config.Env))
+	}
+	if config.WorkingDir != "" {
+		opts = append(opts, oci.WithProcessCwd(config.WorkingDir))
+	}
+	if hostConfig.NetworkMode.IsHost() {
+		opts = append(opts,
+			oci.WithHostNamespace(runtimespec.NetworkNamespace),
+			oci.WithHostHostsFile,
+			oci.WithHostResolvconf)
+	}
+	if hostConfig.PidMode.IsHost() {
+		opts = append(opts, oci.WithHostNamespace(runtimespec.PIDNamespace))
+	}
+	if hostConfig.Privileged {
+		opts = append(opts,
+			oci.WithAllKnownCapabilities,
+			oci.WithMaskedPaths(nil),
+			oci.WithReadonlyPaths(nil),
+			oci.WithWriteableSysfs,
+			oci.WithWriteableCgroupfs,
+			oci.WithSelinuxLabel(""),
+			oci.WithApparmorProfile(""),
+			oci.WithSeccompUnconfined,
+			oci.WithAllDevicesAllowed)
+	}
+	if len(mounts) > 0 {
+		opts = append(opts, oci.WithMounts(mounts))
+	}
+	return opts
+}
+
+// parseBind converts a docker bind (source:destination[:options]) to a bind mount. SELinux relabeling options are ignored.
+func parseBind(bind string) (runtimespec.Mount, error) {
+	parts := strings.Split(bind, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return runtimespec.Mount{}, fmt.Errorf("Invalid bind [%s]", bind)
+	}
+	mode := "rw"
+	var propagation []string
+	if len(parts) == 3 {
+		for _, opt := range strings.Split(parts[2], ",") {
+			switch opt {
+			case "ro", "rw":
+				mode = opt
+			case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+				propagation = append(propagation, opt)
+			case "z", "Z", "":
+			default:
+				return runtimespec.Mount{}, fmt.Errorf("Invalid option [%s] for bind [%s]", opt, bind)
+			}
+		}
+	}
+	return runtimespec.Mount{
+		Type:        "bind",
+		Source:      parts[0],
+		Destination: parts[1],
+		Options:     append([]string{"rbind", mode}, propagation...),
+	}, nil
+}
+
+// getBindHostPath returns the host path of the container path when it is in a bind mount, the deepest bind wins
+func getBindHostPath(binds []string, containerPath string) (string, bool) {
+	var mounts []runtimespec.Mount
+	for _, bind := range binds {
+		if m, err := parseBind(bind); err == nil {
+			mounts = append(mounts, m)
+		}
+	}
+	sort.Slice(mounts, func(i, j int) bool { return len(mounts[i].Destination) > len(mounts[j].Destination) })
+	containerPath = path.Clean(containerPath)
+	for _, m := range mounts {
+		dst := path.Clean(m.Destination)
+		if containerPath == dst {
+			return m.Source, true
+		}
+		if strings.HasPrefix(containerPath, strings.TrimSuffix(dst, "/")+"/") {
+			return path.Join(m.Source, strings.TrimPrefix(containerPath, dst)), true
+		}
+	}
+	return "", false
+}
+
+func getContainerdConfig(info containers.Container) (*containerdConfig, error) {
+	config := &containerdConfig{}
+	if ext, ok := info.Extensions[containerdConfigExt]; ok {
+		if err := json.Unmarshal(ext.Value, config); err != nil {
+			return nil, fmt.Errorf("Failed to parse configuration of container [%s]: %v", info.ID, err)
+		}
+	}
+	if config.Config == nil {
+		config.Config = &container.Config{Image: info.Image, Labels: info.Labels}
+	}
+	if config.HostConfig == nil {
+		config.HostConfig = &container.HostConfig{}
+	}
+	return config, nil
+}
+
+func getContainerdResolverOptions(registryAuth string) (remotesdocker.ResolverOptions, error) {
+	options := remotesdocker.ResolverOptions{}
+	if registryAuth == "" {
+		return options, nil
+	}
+	data, err := base64.URLEncoding.DecodeString(registryAuth)
+	if err != nil {
+		return options, fmt.Errorf("Failed to decode registry credentials: %v", err)
+	}
+	authConfig := types.AuthConfig{}
+	if err := json.Unmarshal(data, &authConfig); err != nil {
+		return options, fmt.Errorf("Failed to parse registry credentials: %v", err)
+	}
+	authorizer := remotesdocker.NewDockerAuthorizer(remotesdocker.WithAuthCreds(func(string) (string, string, error) {
+		return authConfig.Username, authConfig.Password, nil
+	}))
+	options.Hosts = remotesdocker.ConfigureDefaultRegistries(remotesdocker.WithAuthorizer(authorizer))
+	return options, nil
+}
+
+func normalizeImageRef(image string) (string, error) {
+	named, err := ref.ParseDockerRef(image)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image [%s]: %v", image, err)
+	}
+	return named.String(), nil
+}
+
+// convertContainerdError converts not found errors so client.IsErrNotFound works for every runtime
+func convertContainerdError(err error) error {
+	if err != nil && cerrdefs.IsNotFound(err) {
+		return errdefs.NotFound(err)
+	}
+	return err
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cerrdefs "github.com/containerd/containerd/errdefs"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBind(t *testing.T) {
+	m, err := parseBind("/var/lib/kubelet:/var/lib/kubelet:shared,z")
+	assert.NoError(t, err)
+	assert.Equal(t, runtimespec.Mount{Type: "bind", Source: "/var/lib/kubelet", Destination: "/var/lib/kubelet", Options: []string{"rbind", "rw", "shared"}}, m)
+
+	m, err = parseBind("/usr:/host/usr:ro")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rbind", "ro"}, m.Options)
+
+	m, err = parseBind("/etc/resolv.conf:/etc/resolv.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rbind", "rw"}, m.Options)
+
+	_, err = parseBind("/etc/kubernetes")
+	assert.Error(t, err)
+	_, err = parseBind("/etc/kubernetes:/etc/kubernetes:nosuchoption")
+	assert.Error(t, err)
+}
+
+func TestGetBindHostPath(t *testing.T) {
+	binds := []string{
+		"/opt/rke/etc/kubernetes:/etc/kubernetes:z",
+		"/opt/rke/etc/kubernetes/ssl:/etc/kubernetes/ssl:ro",
+	}
+	hostPath, ok := getBindHostPath(binds, "/etc/kubernetes/ssl/kube-ca.pem")
+	assert.True(t, ok)
+	assert.Equal(t, "/opt/rke/etc/kubernetes/ssl/kube-ca.pem", hostPath)
+
+	hostPath, ok = getBindHostPath(binds, "/etc/kubernetes")
+	assert.True(t, ok)
+	assert.Equal(t, "/opt/rke/etc/kubernetes", hostPath)
+
+	_, ok = getBindHostPath(binds, "/etc/kubernetes-other/file")
+	assert.False(t, ok)
+}
+
+func TestConvertContainerdError(t *testing.T) {
+	assert.True(t, client.IsErrNotFound(convertContainerdError(fmt.Errorf("container etcd: %w", cerrdefs.ErrNotFound))))
+	assert.False(t, client.IsErrNotFound(convertContainerdError(cerrdefs.ErrAlreadyExists)))
+	assert.NoError(t, convertContainerdError(nil))
+}
+
+func TestNormalizeImageRef(t *testing.T) {
+	imageRef, err := normalizeImageRef("rancher/rke-tools:v0.1.96")
+	assert.NoError(t, err)
+	assert.Equal(t, "docker.io/rancher/rke-tools:v0.1.96", imageRef)
+
+	imageRef, err = normalizeImageRef("repo.com/rancher/hyperkube")
+	assert.NoError(t, err)
+	assert.Equal(t, "repo.com/rancher/hyperkube:latest", imageRef)
+}
+
+func TestContainerdLogWriter(t *testing.T) {
+	var framed bytes.Buffer
+	w := newContainerdLogWriter(&framed)
+	for _, chunk := range []string{"stdout started\nstderr warn", "ing: slow\nlegacy line\n", "stderr done\n"} {
+		n, err := w.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	var stdout, stderr bytes.Buffer
+	_, err := stdcopy.StdCopy(&stdout, &stderr, &framed)
+	assert.NoError(t, err)
+	assert.Equal(t, "started\nlegacy line\n", stdout.String())
+	assert.Equal(t, "warning: slow\ndone\n", stderr.String())
+}
+
+func TestGetContainerdLogURI(t *testing.T) {
+	uri, err := getContainerdLogURI("/var/lib/rancher/rke/containerd/log/etcd.log")
+	assert.NoError(t, err)
+	assert.Equal(t, "binary:///var/lib/rancher/rke/containerd/bin/rke-logger?log=%2Fvar%2Flib%2Francher%2Frke%2Fcontainerd%2Flog%2Fetcd.log", uri.String())
+	assert.Equal(t, "/var/lib/rancher/rke/containerd/log/etcd.log", uri.Query().Get("log"))
+}
+
+func TestContainerdLogger(t *testing.T) {
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk is not installed")
+	}
+	dir := t.TempDir()
+	logger := filepath.Join(dir, "rke-logger")
+	assert.NoError(t, os.WriteFile(logger, []byte(containerdLogger), 0755))
+	logPath := filepath.Join(dir, "log", "etcd.log")
+
+	// the pipes are passed like the shim does
+	stdoutR, stdoutW, err := os.Pipe()
+	assert.NoError(t, err)
+	stderrR, stderrW, err := os.Pipe()
+	assert.NoError(t, err)
+	readyR, readyW, err := os.Pipe()
+	assert.NoError(t, err)
+	cmd := exec.Command(logger, "log", logPath)
+	cmd.ExtraFiles = []*os.File{stdoutR, stderrR, readyW}
+	assert.NoError(t, cmd.Start())
+	stdoutR.Close()
+	stderrR.Close()
+	readyW.Close()
+	_, err = readyR.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+
+	_, err = stdoutW.WriteString("started\n")
+	assert.NoError(t, err)
+	stdoutW.Close()
+	_, err = stderrW.WriteString("warning: slow")
+	assert.NoError(t, err)
+	stderrW.Close()
+	assert.NoError(t, cmd.Wait())
+
+	log, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"stdout started", "stderr warning: slow"}, strings.Split(strings.TrimSpace(string(log)), "\n"))
+}
@@ -48,8 +48,9 @@ type dockerConfig struct {
 
 type authConfig types.AuthConfig
 
-func DoRunContainer(ctx context.Context, dClient *client.Client, imageCfg *container.Config, hostCfg *container.HostConfig,
+func DoRunContainer(ctx context.Context, dClient ContainerRuntime, imageCfg *container.Config, hostCfg *container.HostConfig,
 	containerName string, hostname string, plane string, prsMap map[string]v3.PrivateRegistry) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), plane)
 	if dClient == nil {
 		return fmt.Errorf("[%s] Failed to run container: docker client is nil for container [%s] on host [%s]",
 			plane, containerName, hostname)
@@ -70,6 +71,7 @@ func DoRunContainer(ctx context.Context, dClient *client.Client, imageCfg *conta
 			return fmt.Errorf("Failed to start [%s] container on host [%s]: %v", containerName, hostname, err)
 		}
 		log.Infof(ctx, "[%s] Successfully started [%s] container on host [%s]", plane, containerName, hostname)
+		log.ContainerEvent(ctx, hostname, containerName, log.ContainerActionStarted)
 		return nil
 	}
 	// Check for upgrades
@@ -99,10 +101,12 @@ func DoRunContainer(ctx context.Context, dClient *client.Client, imageCfg *conta
 		return fmt.Errorf("Failed to start [%s] container on host [%s]: %v", containerName, hostname, err)
 	}
 	log.Infof(ctx, "[%s] Successfully started [%s] container on host [%s]", plane, containerName, hostname)
+	log.ContainerEvent(ctx, hostname, containerName, log.ContainerActionStarted)
 	return nil
 }
 
-func DoRunOnetimeContainer(ctx context.Context, dClient *client.Client, imageCfg *container.Config, hostCfg *container.HostConfig, containerName string, hostname string, plane string, prsMap map[string]v3.PrivateRegistry) error {
+func DoRunOnetimeContainer(ctx context.Context, dClient ContainerRuntime, imageCfg *container.Config, hostCfg *container.HostConfig, containerName string, hostname string, plane string, prsMap map[string]v3.PrivateRegistry) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), plane)
 	if dClient == nil {
 		return fmt.Errorf("[%s] Failed to run container: docker client is nil for container [%s] on host [%s]", plane, containerName, hostname)
 	}
@@ -122,6 +126,7 @@ func DoRunOnetimeContainer(ctx context.Context, dClient *client.Client, imageCfg
 			return fmt.Errorf("Failed to start [%s] container on host [%s]: %v", containerName, hostname, err)
 		}
 		log.Infof(ctx, "Successfully started [%s] container on host [%s]", containerName, hostname)
+		log.ContainerEvent(ctx, hostname, containerName, log.ContainerActionStarted)
 		log.Infof(ctx, "Waiting for [%s] container to exit on host [%s]", containerName, hostname)
 		exitCode, err := WaitForContainer(ctx, dClient, hostname, containerName, true)
 		if err != nil {
@@ -141,7 +146,8 @@ func DoRunOnetimeContainer(ctx context.Context, dClient *client.Client, imageCfg
 	return err
 }
 
-func DoCopyToContainer(ctx context.Context, dClient *client.Client, plane, containerName, hostname, destinationDir string, tarFile io.Reader) error {
+func DoCopyToContainer(ctx context.Context, dClient ContainerRuntime, plane, containerName, hostname, destinationDir string, tarFile io.Reader) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), plane)
 	if dClient == nil {
 		return fmt.Errorf("[%s] Failed to run container: docker client is nil for container [%s] on host [%s]", plane, containerName, hostname)
 	}
@@ -158,7 +164,8 @@ func DoCopyToContainer(ctx context.Context, dClient *client.Client, plane, conta
 	return nil
 }
 
-func DoRollingUpdateContainer(ctx context.Context, dClient *client.Client, imageCfg *container.Config, hostCfg *container.HostConfig, containerName, hostname, plane string, prsMap map[string]v3.PrivateRegistry) error {
+func DoRollingUpdateContainer(ctx context.Context, dClient ContainerRuntime, imageCfg *container.Config, hostCfg *container.HostConfig, containerName, hostname, plane string, prsMap map[string]v3.PrivateRegistry) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), plane)
 	if dClient == nil {
 		return fmt.Errorf("[%s] Failed rolling update of container: docker client is nil for container [%s] on host [%s]", plane, containerName, hostname)
 	}
@@ -189,12 +196,14 @@ func DoRollingUpdateContainer(ctx context.Context, dClient *client.Client, image
 		return fmt.Errorf("Failed to start [%s] container on host [%s]: %v", containerName, hostname, err)
 	}
 	log.Infof(ctx, "[%s] Successfully updated [%s] container on host [%s]", plane, containerName, hostname)
+	log.ContainerEvent(ctx, hostname, containerName, log.ContainerActionUpdated)
 	logrus.Debugf("[%s] Removing old container", plane)
 	err = RemoveContainer(ctx, dClient, hostname, oldContainerName)
 	return err
 }
 
-func DoRemoveContainer(ctx context.Context, dClient *client.Client, containerName, hostname string) error {
+func DoRemoveContainer(ctx context.Context, dClient ContainerRuntime, containerName, hostname string) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), containerName)
 	if dClient == nil {
 		return fmt.Errorf("Failed to remove container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -213,10 +222,11 @@ func DoRemoveContainer(ctx context.Context, dClient *client.Client, containerNam
 		return err
 	}
 	log.Infof(ctx, "[remove/%s] Successfully removed container on host [%s]", containerName, hostname)
+	log.ContainerEvent(ctx, hostname, containerName, log.ContainerActionRemoved)
 	return nil
 }
 
-func FindContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string, all bool) (*types.Container, error) {
+func FindContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string, all bool) (*types.Container, error) {
 	if dClient == nil {
 		return nil, fmt.Errorf("Failed to find container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -242,7 +252,7 @@ func FindContainer(ctx context.Context, dClient *client.Client, hostname string,
 	return nil, nil
 }
 
-func DoesContainerExist(ctx context.Context, dClient *client.Client, hostname string, containerName string, all bool) (bool, error) {
+func DoesContainerExist(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string, all bool) (bool, error) {
 	if dClient == nil {
 		return false, fmt.Errorf("Failed to check if container exists: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -253,7 +263,7 @@ func DoesContainerExist(ctx context.Context, dClient *client.Client, hostname st
 	return container != nil, nil
 }
 
-func IsContainerRunning(ctx context.Context, dClient *client.Client, hostname string, containerName string, all bool) (bool, error) {
+func IsContainerRunning(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string, all bool) (bool, error) {
 	if dClient == nil {
 		return false, fmt.Errorf("Failed to check if container is running: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -264,7 +274,7 @@ func IsContainerRunning(ctx context.Context, dClient *client.Client, hostname st
 	return container != nil && container.State == "running", nil
 }
 
-func localImageExists(ctx context.Context, dClient *client.Client, hostname string, containerImage string) error {
+func localImageExists(ctx context.Context, dClient ContainerRuntime, hostname string, containerImage string) error {
 	var err error
 	for i := 1; i <= RetryCount; i++ {
 		logrus.Debugf("Checking if image [%s] exists on host [%s], try #%d", containerImage, hostname, i)
@@ -283,7 +293,7 @@ func localImageExists(ctx context.Context, dClient *client.Client, hostname stri
 	return fmt.Errorf("Error checking if image [%s] exists on host [%s]: %v", containerImage, hostname, err)
 }
 
-func pullImage(ctx context.Context, dClient *client.Client, hostname string, containerImage string,
+func pullImage(ctx context.Context, dClient ContainerRuntime, hostname string, containerImage string,
 	prsMap map[string]v3.PrivateRegistry) error {
 	var out io.ReadCloser
 	var err error
@@ -312,14 +322,16 @@ func pullImage(ctx context.Context, dClient *client.Client, hostname string, con
 		} else {
 			io.Copy(io.Discard, out)
 		}
+		log.ContainerEvent(ctx, hostname, containerImage, log.ContainerActionPulled)
 		return nil
 	}
 	// If the for loop does not return, return the error
 	return err
 }
 
-func UseLocalOrPull(ctx context.Context, dClient *client.Client, hostname string, containerImage string, plane string,
+func UseLocalOrPull(ctx context.Context, dClient ContainerRuntime, hostname string, containerImage string, plane string,
 	prsMap map[string]v3.PrivateRegistry) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), plane)
 	if dClient == nil {
 		return fmt.Errorf("[%s] Failed to use local image or pull: docker client is nil for container [%s] on host [%s]", plane, containerImage, hostname)
 	}
@@ -358,7 +370,7 @@ func UseLocalOrPull(ctx context.Context, dClient *client.Client, hostname string
 	return err
 }
 
-func RemoveContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string) error {
+func RemoveContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string) error {
 	if dClient == nil {
 		return fmt.Errorf("Failed to remove container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -376,7 +388,7 @@ func RemoveContainer(ctx context.Context, dClient *client.Client, hostname strin
 	return err
 }
 
-func RestartContainer(ctx context.Context, dClient *client.Client, hostname, containerName string) error {
+func RestartContainer(ctx context.Context, dClient ContainerRuntime, hostname, containerName string) error {
 	if dClient == nil {
 		return fmt.Errorf("Failed to restart container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -394,7 +406,7 @@ func RestartContainer(ctx context.Context, dClient *client.Client, hostname, con
 	}
 	return err
 }
-func StopContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string) error {
+func StopContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string) error {
 	if dClient == nil {
 		return fmt.Errorf("Failed to stop container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -414,7 +426,7 @@ func StopContainer(ctx context.Context, dClient *client.Client, hostname string,
 	return err
 }
 
-func RenameContainer(ctx context.Context, dClient *client.Client, hostname string, oldContainerName string, newContainerName string) error {
+func RenameContainer(ctx context.Context, dClient ContainerRuntime, hostname string, oldContainerName string, newContainerName string) error {
 	if dClient == nil {
 		return fmt.Errorf("Failed to rename container: docker client is nil for container [%s] on host [%s]", oldContainerName, hostname)
 	}
@@ -432,7 +444,7 @@ func RenameContainer(ctx context.Context, dClient *client.Client, hostname strin
 	return err
 }
 
-func StartContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string) error {
+func StartContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string) error {
 	if dClient == nil {
 		return fmt.Errorf("Failed to start container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -453,7 +465,7 @@ func StartContainer(ctx context.Context, dClient *client.Client, hostname string
 	return err
 }
 
-func CreateContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string, imageCfg *container.Config, hostCfg *container.HostConfig) (container.ContainerCreateCreatedBody, error) {
+func CreateContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string, imageCfg *container.Config, hostCfg *container.HostConfig) (container.ContainerCreateCreatedBody, error) {
 	if dClient == nil {
 		return container.ContainerCreateCreatedBody{}, fmt.Errorf("Failed to create container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -471,7 +483,7 @@ func CreateContainer(ctx context.Context, dClient *client.Client, hostname strin
 	return container.ContainerCreateCreatedBody{}, fmt.Errorf("Failed to create Docker container [%s] on host [%s]: %v", containerName, hostname, err)
 }
 
-func InspectContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string) (types.ContainerJSON, error) {
+func InspectContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string) (types.ContainerJSON, error) {
 	if dClient == nil {
 		return types.ContainerJSON{}, fmt.Errorf("Failed to inspect container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -492,7 +504,7 @@ func InspectContainer(ctx context.Context, dClient *client.Client, hostname stri
 	return types.ContainerJSON{}, fmt.Errorf("Failed to inspect Docker container [%s] on host [%s]: %v", containerName, hostname, err)
 }
 
-func StopRenameContainer(ctx context.Context, dClient *client.Client, hostname string, oldContainerName string, newContainerName string) error {
+func StopRenameContainer(ctx context.Context, dClient ContainerRuntime, hostname string, oldContainerName string, newContainerName string) error {
 	if dClient == nil {
 		return fmt.Errorf("Failed to stop and rename container: docker client is nil for container [%s] on host [%s]", oldContainerName, hostname)
 	}
@@ -516,7 +528,8 @@ func StopRenameContainer(ctx context.Context, dClient *client.Client, hostname s
 
 }
 
-func WaitForContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string, noisy bool) (int64, error) {
+func WaitForContainer(ctx context.Context, dClient ContainerRuntime, hostname string, containerName string, noisy bool) (int64, error) {
+	ctx = log.WithHost(ctx, hostname)
 	if dClient == nil {
 		return 1, fmt.Errorf("Failed waiting for container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -557,7 +570,7 @@ func WaitForContainer(ctx context.Context, dClient *client.Client, hostname stri
 	return 1, fmt.Errorf("Container [%s] did not exit in time on host [%s]: stderr: [%s], stdout: [%s]", containerName, hostname, stderr, stdout)
 }
 
-func IsContainerUpgradable(ctx context.Context, dClient *client.Client, imageCfg *container.Config, hostCfg *container.HostConfig, containerName string, hostname string, plane string) (bool, error) {
+func IsContainerUpgradable(ctx context.Context, dClient ContainerRuntime, imageCfg *container.Config, hostCfg *container.HostConfig, containerName string, hostname string, plane string) (bool, error) {
 	if dClient == nil {
 		return false, fmt.Errorf("[%s] Failed checking if container is upgradable: docker client is nil for container [%s] on host [%s]", plane, containerName, hostname)
 	}
@@ -633,7 +646,7 @@ func IsSupportedDockerVersion(info types.Info, K8sVersion string) (bool, error)
 	return false, nil
 }
 
-func ReadFileFromContainer(ctx context.Context, dClient *client.Client, hostname, container, filePath string) (string, error) {
+func ReadFileFromContainer(ctx context.Context, dClient ContainerRuntime, hostname, container, filePath string) (string, error) {
 	if dClient == nil {
 		return "", fmt.Errorf("Failed reading file from container: docker client is nil for container [%s] on host [%s]", container, hostname)
 	}
@@ -653,7 +666,25 @@ func ReadFileFromContainer(ctx context.Context, dClient *client.Client, hostname
 	return string(file), nil
 }
 
-func ReadContainerLogs(ctx context.Context, dClient *client.Client, containerName string, follow bool, tail string) (io.ReadCloser, error) {
+// CopyFileFromContainer streams a single file from the container to w, the container does not need to be running
+func CopyFileFromContainer(ctx context.Context, dClient ContainerRuntime, hostname, container, filePath string, w io.Writer) error {
+	if dClient == nil {
+		return fmt.Errorf("Failed copying file from container: docker client is nil for container [%s] on host [%s]", container, hostname)
+	}
+	reader, _, err := dClient.CopyFromContainer(ctx, container, filePath)
+	if err != nil {
+		return fmt.Errorf("Failed to copy file [%s] from container [%s] on host [%s]: %v", filePath, container, hostname, err)
+	}
+	defer reader.Close()
+	tarReader := tar.NewReader(reader)
+	if _, err := tarReader.Next(); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, tarReader)
+	return err
+}
+
+func ReadContainerLogs(ctx context.Context, dClient ContainerRuntime, containerName string, follow bool, tail string) (io.ReadCloser, error) {
 	if dClient == nil {
 		return nil, fmt.Errorf("Failed reading container logs: docker client is nil for container [%s]", containerName)
 	}
@@ -670,7 +701,7 @@ func ReadContainerLogs(ctx context.Context, dClient *client.Client, containerNam
 	return nil, err
 }
 
-func GetContainerLogsStdoutStderr(ctx context.Context, dClient *client.Client, containerName, tail string, follow bool) (string, string, error) {
+func GetContainerLogsStdoutStderr(ctx context.Context, dClient ContainerRuntime, containerName, tail string, follow bool) (string, string, error) {
 	if dClient == nil {
 		return "", "", fmt.Errorf("Failed to get container logs stdout and stderr: docker client is nil for container [%s]", containerName)
 	}
@@ -733,12 +764,24 @@ func GetImageRegistryConfig(image string, prsMap map[string]v3.PrivateRegistry)
 		- Example1: repo.com/foo/bar
 		- Exmaple2: repo.com
 	*/
+	pr, ok, err := getImagePrivateRegistry(image, prsMap)
+	if err != nil || !ok {
+		return "", "", err
+	}
+	logrus.Debugf("Found regURL %v", pr.URL)
+	// We do this if we have some docker.io login information
+	regAuth, err := getRegistryAuth(pr)
+	return regAuth, pr.URL, err
+}
+
+// getImagePrivateRegistry returns the private registry the image is pulled from
+func getImagePrivateRegistry(image string, prsMap map[string]v3.PrivateRegistry) (v3.PrivateRegistry, bool, error) {
 	namedImage, err := ref.ParseNormalizedNamed(image)
 	if err != nil {
-		return "", "", err
+		return v3.PrivateRegistry{}, false, err
 	}
 	if len(prsMap) == 0 {
-		return "", "", nil
+		return v3.PrivateRegistry{}, false, nil
 	}
 	regURL := ref.Domain(namedImage)
 	regPath := ref.Path(namedImage)
@@ -749,15 +792,8 @@ func GetImageRegistryConfig(image string, prsMap map[string]v3.PrivateRegistry)
 		regPath = strings.Join(splitPath, "/")
 		regURL = fmt.Sprintf("%s/%s", regURL, regPath)
 	}
-
-	if pr, ok := prsMap[regURL]; ok {
-		logrus.Debugf("Found regURL %v", regURL)
-		// We do this if we have some docker.io login information
-		regAuth, err := getRegistryAuth(pr)
-		return regAuth, pr.URL, err
-	}
-
-	return "", "", nil
+	pr, ok := prsMap[regURL]
+	return pr, ok, nil
 }
 
 func convertToSemver(version string) (*semver.Version, error) {
@@ -793,7 +829,18 @@ func GetKubeletDockerConfig(prsMap map[string]v3.PrivateRegistry) (string, error
 	return string(cfg), nil
 }
 
-func DoRestartContainer(ctx context.Context, dClient *client.Client, containerName, hostname string) error {
+// GetImageDockerConfig returns the docker config holding the credentials of the private registry of the image, it is empty
+// when the image isn't pulled from a private registry with a user
+func GetImageDockerConfig(image string, prsMap map[string]v3.PrivateRegistry) (string, error) {
+	pr, ok, err := getImagePrivateRegistry(image, prsMap)
+	if err != nil || !ok || pr.ECRCredentialPlugin != nil || len(pr.User) == 0 {
+		return "", err
+	}
+	return GetKubeletDockerConfig(map[string]v3.PrivateRegistry{pr.URL: pr})
+}
+
+func DoRestartContainer(ctx context.Context, dClient ContainerRuntime, containerName, hostname string) error {
+	ctx = log.WithComponent(log.WithHost(ctx, hostname), containerName)
 	if dClient == nil {
 		return fmt.Errorf("Failed to restart container: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
@@ -812,10 +859,11 @@ func DoRestartContainer(ctx context.Context, dClient *client.Client, containerNa
 		return err
 	}
 	log.Infof(ctx, "[restart/%s] Successfully restarted container on host [%s]", containerName, hostname)
+	log.ContainerEvent(ctx, hostname, containerName, log.ContainerActionRestarted)
 	return nil
 }
 
-func GetContainerOutput(ctx context.Context, dClient *client.Client, containerName, hostname string, noisy bool) (int64, string, string, error) {
+func GetContainerOutput(ctx context.Context, dClient ContainerRuntime, containerName, hostname string, noisy bool) (int64, string, string, error) {
 	if dClient == nil {
 		return 1, "", "", fmt.Errorf("Failed to get container output: docker client is nil for container [%s] on host [%s]", containerName, hostname)
 	}
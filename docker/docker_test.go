@@ -57,3 +57,20 @@ func TestGetKubeletDockerConfig(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, c, e)
 }
+
+func TestGetImageDockerConfig(t *testing.T) {
+	privateRegistries := map[string]v3.PrivateRegistry{
+		"registry.example.com": {URL: "registry.example.com", User: "user1", Password: "passw~rd"},
+		"ecr.example.com":      {URL: "ecr.example.com", ECRCredentialPlugin: &v3.ECRCredentialPlugin{}},
+		"mirror.example.com":   {URL: "mirror.example.com"},
+	}
+	c, err := GetImageDockerConfig("registry.example.com/rancher/rke-tools:v0.1.100", privateRegistries)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"auths\":{\"registry.example.com\":{\"auth\":\"dXNlcjE6cGFzc3d+cmQ=\"}}}", c)
+
+	for _, image := range []string{"ecr.example.com/rancher/rke-tools:v0.1.100", "mirror.example.com/rancher/rke-tools:v0.1.100", "rancher/rke-tools:v0.1.100"} {
+		c, err = GetImageDockerConfig(image, privateRegistries)
+		assert.Nil(t, err)
+		assert.Empty(t, c)
+	}
+}
@@ -0,0 +1,226 @@
+// Package dockertest provides a fake container runtime for the tests of the packages running containers on the hosts
+package dockertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rancher/rke/docker"
+)
+
+// Container is a container of Runtime, it exits as soon as it's started
+type Container struct {
+	Config   *container.Config
+	Running  bool
+	Started  bool
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	// Files are the files copied from the container by path
+	Files map[string][]byte
+}
+
+// Runtime is a container runtime running the containers with the Run function
+type Runtime struct {
+	lock       sync.Mutex
+	containers map[string]*Container
+	// Run sets the exit code, the output and the files of a started container
+	Run func(name string, c *Container)
+}
+
+var _ docker.ContainerRuntime = &Runtime{}
+
+func NewRuntime(run func(name string, c *Container)) *Runtime {
+	return &Runtime{containers: map[string]*Container{}, Run: run}
+}
+
+// Containers returns the names of the containers of the runtime
+func (f *Runtime) Containers() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var names []string
+	for name := range f.containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *Runtime) get(name string) (*Container, error) {
+	c, ok := f.containers[name]
+	if !ok {
+		return nil, errdefs.NotFound(fmt.Errorf("no such container: %s", name))
+	}
+	return c, nil
+}
+
+func (f *Runtime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.ContainerCreateCreatedBody, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.containers[containerName] = &Container{Config: config, Files: map[string][]byte{}}
+	return container.ContainerCreateCreatedBody{ID: containerName}, nil
+}
+
+func (f *Runtime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c, err := f.get(containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    containerID,
+			Name:  "/" + containerID,
+			State: &types.ContainerState{Running: c.Running, ExitCode: c.ExitCode},
+		},
+		Config: c.Config,
+	}, nil
+}
+
+func (f *Runtime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var containers []types.Container
+	for name := range f.containers {
+		containers = append(containers, types.Container{ID: name, Names: []string{"/" + name}})
+	}
+	return containers, nil
+}
+
+func (f *Runtime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c, err := f.get(containerID)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(tailLines(c.Stdout, options.Tail))); err != nil {
+		return nil, err
+	}
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(tailLines(c.Stderr, options.Tail))); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+// tailLines returns the last lines of output like the tail option of the container logs
+func tailLines(output, tail string) string {
+	n, err := strconv.Atoi(tail)
+	if err != nil || output == "" {
+		return output
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(output, "\n"), "\n")
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "") + "\n"
+}
+
+func (f *Runtime) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, err := f.get(containerID); err != nil {
+		return err
+	}
+	delete(f.containers, containerID)
+	return nil
+}
+
+func (f *Runtime) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c, err := f.get(containerID)
+	if err != nil {
+		return err
+	}
+	delete(f.containers, containerID)
+	f.containers[newContainerName] = c
+	return nil
+}
+
+func (f *Runtime) ContainerRestart(ctx context.Context, containerID string, timeout *time.Duration) error {
+	return f.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+func (f *Runtime) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c, err := f.get(containerID)
+	if err != nil {
+		return err
+	}
+	c.Started = true
+	if f.Run != nil {
+		f.Run(containerID, c)
+	}
+	return nil
+}
+
+func (f *Runtime) ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c, err := f.get(containerID)
+	if err != nil {
+		return err
+	}
+	c.Running = false
+	return nil
+}
+
+func (f *Runtime) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c, err := f.get(containerID)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	contents, ok := c.Files[srcPath]
+	if !ok {
+		return nil, types.ContainerPathStat{}, errdefs.NotFound(fmt.Errorf("no such file: %s", srcPath))
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: path.Base(srcPath), Mode: 0600, Size: int64(len(contents))}); err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	if _, err := tw.Write(contents); err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	return io.NopCloser(&buf), types.ContainerPathStat{Name: path.Base(srcPath), Size: int64(len(contents))}, nil
+}
+
+func (f *Runtime) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	return nil
+}
+
+func (f *Runtime) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	return types.ImageInspect{ID: imageID}, nil, nil
+}
+
+func (f *Runtime) ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (f *Runtime) Info(ctx context.Context) (types.Info, error) {
+	return types.Info{}, nil
+}
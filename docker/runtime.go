@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// RuntimeDocker runs the cluster containers with the Docker Engine API
+	RuntimeDocker = "docker"
+	// RuntimeContainerd runs the cluster containers with containerd
+	RuntimeContainerd = "containerd"
+)
+
+// ContainerRuntime is the subset of the Docker Engine API used to manage containers on a host. The docker client implements it,
+// other runtimes translate the calls so the docker package and the services work the same on every runtime.
+type ContainerRuntime interface {
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.ContainerCreateCreatedBody, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+	ContainerRename(ctx context.Context, containerID, newContainerName string) error
+	ContainerRestart(ctx context.Context, containerID string, timeout *time.Duration) error
+	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
+	ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
+	CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error)
+	Info(ctx context.Context) (types.Info, error)
+}
+
+// HostCommandRunner runs a shell command on the host, stdin is optional. Runtimes that can't stream container files and logs
+// through their socket use it.
+type HostCommandRunner func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error
+
+var _ ContainerRuntime = &client.Client{}
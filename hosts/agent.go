@@ -0,0 +1,376 @@
+package hosts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	v3 "github.com/rancher/rke/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/client-go/transport"
+)
+
+const (
+	// ConnectionTypeSSH reaches the node with SSH, it is the default
+	ConnectionTypeSSH = "ssh"
+	// ConnectionTypeAgent reaches the node through the tunnel opened by its node agent to the rke process
+	ConnectionTypeAgent = "agent"
+
+	DefaultAgentTunnelListenAddress  = "0.0.0.0:9443"
+	DefaultAgentTunnelConnectTimeout = 60
+
+	AgentConnectPath       = "/v3/connect"
+	AgentTokenHeader       = "X-RKE-Agent-Token"
+	AgentNodeAddressHeader = "X-RKE-Node-Address"
+)
+
+var ConnectionTypes = []string{ConnectionTypeSSH, ConnectionTypeAgent}
+
+var (
+	agentTunnelServersLock sync.Mutex
+	agentTunnelServers     = map[string]*AgentTunnelServer{}
+)
+
+// AgentTunnelServer accepts the tunnels opened by the node agents. The node agent serves SSH over its tunnel, the SSH
+// connection to the node is established over it like over a TCP connection so the node is reached like a SSH host.
+type AgentTunnelServer struct {
+	config    v3.AgentTunnelConfig
+	startOnce sync.Once
+	startErr  error
+	listener  net.Listener
+	server    *http.Server
+
+	lock     sync.Mutex
+	nodes    map[string]bool
+	sessions map[string]*agentSession
+	// registered is closed and replaced when a node agent connects
+	registered chan struct{}
+}
+
+// agentSession is the tunnel of a node agent, the SSH client is shared by the dialers of the node
+type agentSession struct {
+	conn   net.Conn
+	lock   sync.Mutex
+	client *ssh.Client
+}
+
+// GetNodeAgentToken returns the token the node agent of the node authenticates with, it is derived from the agent
+// tunnel token and bound to the node address so a node agent can't connect as another node
+func GetNodeAgentToken(token, nodeAddress string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(nodeAddress))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetAgentTunnelServer returns the tunnel server listening on the listen address of config, the node agents of
+// nodeAddresses are allowed to connect. The server is shared by the clusters of the process and starts listening when
+// a node is first dialed.
+func GetAgentTunnelServer(config v3.AgentTunnelConfig, nodeAddresses []string) *AgentTunnelServer {
+	if len(config.ListenAddress) == 0 {
+		config.ListenAddress = DefaultAgentTunnelListenAddress
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = DefaultAgentTunnelConnectTimeout
+	}
+	agentTunnelServersLock.Lock()
+	defer agentTunnelServersLock.Unlock()
+	s, ok := agentTunnelServers[config.ListenAddress]
+	if !ok {
+		s = &AgentTunnelServer{
+			config:     config,
+			nodes:      map[string]bool{},
+			sessions:   map[string]*agentSession{},
+			registered: make(chan struct{}),
+		}
+		agentTunnelServers[config.ListenAddress] = s
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, address := range nodeAddresses {
+		s.nodes[address] = true
+	}
+	return s
+}
+
+// Start starts listening for the tunnels of the node agents
+func (s *AgentTunnelServer) Start() error {
+	s.startOnce.Do(func() {
+		listener, err := net.Listen("tcp", s.config.ListenAddress)
+		if err != nil {
+			s.startErr = fmt.Errorf("Failed to listen for node agents on [%s]: %v", s.config.ListenAddress, err)
+			return
+		}
+		if len(s.config.TLSCertPath) > 0 {
+			cert, err := tls.LoadX509KeyPair(s.config.TLSCertPath, s.config.TLSKeyPath)
+			if err != nil {
+				listener.Close()
+				s.startErr = fmt.Errorf("Failed to load the TLS certificate of the agent tunnel: %v", err)
+				return
+			}
+			listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc(AgentConnectPath, s.handleConnect)
+		s.listener = listener
+		s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 30 * time.Second}
+		go s.server.Serve(listener)
+		logrus.Infof("Listening for node agents on [%s]", listener.Addr())
+	})
+	return s.startErr
+}
+
+// Addr returns the address the server listens on
+func (s *AgentTunnelServer) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close stops the server and closes the tunnels of the node agents
+func (s *AgentTunnelServer) Close() error {
+	agentTunnelServersLock.Lock()
+	if agentTunnelServers[s.config.ListenAddress] == s {
+		delete(agentTunnelServers, s.config.ListenAddress)
+	}
+	agentTunnelServersLock.Unlock()
+	s.lock.Lock()
+	for address, session := range s.sessions {
+		session.conn.Close()
+		delete(s.sessions, address)
+	}
+	s.lock.Unlock()
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *AgentTunnelServer) handleConnect(w http.ResponseWriter, r *http.Request) {
+	address := r.Header.Get(AgentNodeAddressHeader)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(AgentTokenHeader)), []byte(GetNodeAgentToken(s.config.Token, address))) != 1 {
+		logrus.Warnf("Rejecting node agent connection from [%s]: invalid token for node [%s]", r.RemoteAddr, address)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.lock.Lock()
+	allowed := s.nodes[address]
+	s.lock.Unlock()
+	if !allowed {
+		logrus.Warnf("Rejecting node agent connection from [%s]: node [%s] isn't a node of the cluster with connection_type agent", r.RemoteAddr, address)
+		http.Error(w, "unknown node", http.StatusForbidden)
+		return
+	}
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Warnf("Failed to upgrade the connection of the node agent of host [%s]: %v", address, err)
+		return
+	}
+	logrus.Infof("Node agent of host [%s] connected from [%s]", address, r.RemoteAddr)
+	s.register(address, newWebsocketConn(ws))
+}
+
+func (s *AgentTunnelServer) register(address string, conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if previous, ok := s.sessions[address]; ok {
+		previous.conn.Close()
+	}
+	s.sessions[address] = &agentSession{conn: conn}
+	close(s.registered)
+	s.registered = make(chan struct{})
+}
+
+func (s *AgentTunnelServer) unregister(address string, session *agentSession) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.sessions[address] == session {
+		delete(s.sessions, address)
+	}
+	session.conn.Close()
+}
+
+// waitSession waits for the node agent of the host to connect
+func (s *AgentTunnelServer) waitSession(address string) (*agentSession, error) {
+	timeout := time.NewTimer(time.Duration(s.config.ConnectTimeout) * time.Second)
+	defer timeout.Stop()
+	for {
+		s.lock.Lock()
+		session, ok := s.sessions[address]
+		registered := s.registered
+		s.lock.Unlock()
+		if ok {
+			return session, nil
+		}
+		select {
+		case <-registered:
+		case <-timeout.C:
+			return nil, fmt.Errorf("node agent of host [%s] didn't connect to [%s] within %d seconds, please check that the agent is running and can reach the rke process", address, s.config.ListenAddress, s.config.ConnectTimeout)
+		}
+	}
+}
+
+// getClient returns the SSH client of the node served by the node agent over its tunnel
+func (s *AgentTunnelServer) getClient(address, sshAddress string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	session, err := s.waitSession(address)
+	if err != nil {
+		return nil, err
+	}
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if session.client != nil {
+		return session.client, nil
+	}
+	clientConn, channels, sshRequest, err := ssh.NewClientConn(session.conn, sshAddress, cfg)
+	if err != nil {
+		s.unregister(address, session)
+		return nil, err
+	}
+	session.client = ssh.NewClient(clientConn, channels, sshRequest)
+	go func() {
+		session.client.Wait()
+		logrus.Debugf("Tunnel of the node agent of host [%s] closed", address)
+		s.unregister(address, session)
+	}()
+	return session.client, nil
+}
+
+// AgentFactory returns the dialer of the Docker socket of a host reached through its node agent
+func AgentFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
+	if h.AgentTunnel == nil {
+		return nil, fmt.Errorf("host [%s] isn't reached through a node agent", h.Address)
+	}
+	dialer, err := newDialer(h, "docker")
+	return dialer.Dial, err
+}
+
+// AgentLocalConnFactory returns the dialer of the local ports of a host reached through its node agent
+func AgentLocalConnFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
+	if h.AgentTunnel == nil {
+		return nil, fmt.Errorf("host [%s] isn't reached through a node agent", h.Address)
+	}
+	dialer, err := newDialer(h, "network")
+	return dialer.Dial, err
+}
+
+// AgentWrapTransport returns a wrapper of the Kubernetes API transport dialing the hosts reached through their node
+// agent over their tunnel, the other addresses are dialed by the transport wrapped by wrapTransport
+func AgentWrapTransport(agentHosts []*Host, wrapTransport transport.WrapperFunc) (transport.WrapperFunc, error) {
+	dialers := map[string]*dialer{}
+	for _, h := range agentHosts {
+		d, err := newDialer(h, "network")
+		if err != nil {
+			return nil, err
+		}
+		dialers[h.Address] = d
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if wrapTransport != nil {
+			rt = wrapTransport(rt)
+		}
+		if ht, ok := rt.(*http.Transport); ok {
+			dial, dialContext := ht.Dial, ht.DialContext
+			ht.DialContext = nil
+			ht.DialTLS = nil
+			ht.Dial = func(network, addr string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					host = addr
+				}
+				if agentDialer, ok := dialers[host]; ok {
+					return agentDialer.Dial(network, addr)
+				}
+				if dial != nil {
+					return dial(network, addr)
+				}
+				if dialContext != nil {
+					return dialContext(context.Background(), network, addr)
+				}
+				return net.Dial(network, addr)
+			}
+		}
+		return rt
+	}, nil
+}
+
+// websocketConn is a stream over the binary messages of a websocket
+type websocketConn struct {
+	ws        *websocket.Conn
+	reader    io.Reader
+	writeLock sync.Mutex
+}
+
+func newWebsocketConn(ws *websocket.Conn) net.Conn {
+	return &websocketConn{ws: ws}
+}
+
+func (c *websocketConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *websocketConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *websocketConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *websocketConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *websocketConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *websocketConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *websocketConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *websocketConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
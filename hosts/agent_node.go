@@ -0,0 +1,248 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const agentReconnectInterval = 5 * time.Second
+
+// NodeAgentConfig is the configuration of the node agent opening the tunnel of a node to the rke process
+type NodeAgentConfig struct {
+	// ServerURL is the ws:// or wss:// URL of the rke process or of a relay forwarding to it
+	ServerURL   string
+	Token       string
+	NodeAddress string
+	// HostKeyPath is the SSH host key of the agent, it is generated when missing
+	HostKeyPath string
+	// AuthorizedKeysPath holds the SSH keys rke authenticates with, in authorized_keys format
+	AuthorizedKeysPath string
+	// CACertPath holds the CA certificates verifying the TLS certificate of the server, the system CAs are used when empty
+	CACertPath         string
+	InsecureSkipVerify bool
+}
+
+// RunNodeAgent keeps the tunnel of the node open to the rke process until ctx is done. The agent serves SSH over the
+// tunnel, it forwards the Docker socket and the local ports of the node and runs commands.
+func RunNodeAgent(ctx context.Context, config NodeAgentConfig) error {
+	sshConfig, err := newNodeAgentSSHConfig(config)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if len(config.CACertPath) > 0 {
+		caCerts, err := os.ReadFile(config.CACertPath)
+		if err != nil {
+			return fmt.Errorf("Failed to read the CA certificates: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCerts) {
+			return fmt.Errorf("No CA certificate found in [%s]", config.CACertPath)
+		}
+	}
+	wsDialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 30 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+	header := http.Header{}
+	header.Set(AgentTokenHeader, config.Token)
+	header.Set(AgentNodeAddressHeader, config.NodeAddress)
+	for {
+		ws, resp, err := wsDialer.DialContext(ctx, config.ServerURL+AgentConnectPath, header)
+		if err == nil {
+			logrus.Infof("Connected to [%s]", config.ServerURL)
+			err = serveNodeAgent(newWebsocketConn(ws), sshConfig)
+			logrus.Infof("Disconnected from [%s]: %v", config.ServerURL, err)
+		} else if resp != nil {
+			logrus.Warnf("Failed to connect to [%s]: %v: %s", config.ServerURL, err, resp.Status)
+		} else {
+			logrus.Debugf("Failed to connect to [%s]: %v", config.ServerURL, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(agentReconnectInterval):
+		}
+	}
+}
+
+func newNodeAgentSSHConfig(config NodeAgentConfig) (*ssh.ServerConfig, error) {
+	hostKey, err := loadOrGenerateHostKey(config.HostKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Node agent host key: %s", bytes.TrimSpace(ssh.MarshalAuthorizedKey(hostKey.PublicKey())))
+	buf, err := os.ReadFile(config.AuthorizedKeysPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the authorized keys: %v", err)
+	}
+	var authorizedKeys []ssh.PublicKey
+	for len(bytes.TrimSpace(buf)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(buf)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the authorized keys: %v", err)
+		}
+		authorizedKeys = append(authorizedKeys, key)
+		buf = rest
+	}
+	sshConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if cert, ok := key.(*ssh.Certificate); ok {
+				key = cert.Key
+			}
+			if containsKey(authorizedKeys, key) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("key [%s] of user [%s] isn't authorized", ssh.FingerprintSHA256(key), conn.User())
+		},
+	}
+	sshConfig.AddHostKey(hostKey)
+	return sshConfig, nil
+}
+
+func loadOrGenerateHostKey(hostKeyPath string) (ssh.Signer, error) {
+	buf, err := os.ReadFile(hostKeyPath)
+	if os.IsNotExist(err) {
+		logrus.Infof("Generating node agent host key [%s]", hostKeyPath)
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		buf = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(hostKeyPath), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(hostKeyPath, buf, 0600); err != nil {
+			return nil, fmt.Errorf("Failed to write the node agent host key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read the node agent host key: %v", err)
+	}
+	return ssh.ParsePrivateKey(buf)
+}
+
+// serveNodeAgent serves the SSH connection of rke over the tunnel
+func serveNodeAgent(conn net.Conn, sshConfig *ssh.ServerConfig) error {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, sshConfig)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			var payload struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			go forwardChannel(newChannel, "tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+		case "direct-streamlocal@openssh.com":
+			var payload struct {
+				SocketPath string
+				Reserved0  string
+				Reserved1  uint32
+			}
+			if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			go forwardChannel(newChannel, "unix", payload.SocketPath)
+		case "session":
+			go serveSession(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, fmt.Sprintf("unsupported channel type [%s]", newChannel.ChannelType()))
+		}
+	}
+	return sshConn.Wait()
+}
+
+func forwardChannel(newChannel ssh.NewChannel, network, address string) {
+	target, err := net.Dial(network, address)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(channel, target)
+		channel.CloseWrite()
+	}()
+	io.Copy(target, channel)
+	target.Close()
+}
+
+// serveSession runs the exec requests of a session
+func serveSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct {
+			Command string
+		}
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go func() {
+			command := exec.Command("sh", "-c", payload.Command)
+			command.Stdin = channel
+			command.Stdout = channel
+			command.Stderr = channel.Stderr()
+			status := uint32(0)
+			if err := command.Run(); err != nil {
+				status = 255
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					status = uint32(exitErr.ExitCode())
+				} else {
+					fmt.Fprintln(channel.Stderr(), err)
+				}
+			}
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			channel.Close()
+		}()
+	}
+}
@@ -0,0 +1,179 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newEchoListener(t *testing.T, network, address string) net.Listener {
+	listener, err := net.Listen(network, address)
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	_, err := conn.Write([]byte("ping"))
+	assert.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+	conn.Close()
+}
+
+// startTestNodeAgent starts a tunnel server and the node agent of the host connecting to it with token
+func startTestNodeAgent(t *testing.T, token string) (*Host, *AgentTunnelServer) {
+	dir := t.TempDir()
+	keyPEM := newTestSSHKeyPEM(t)
+	signer, err := ssh.ParsePrivateKey([]byte(keyPEM))
+	assert.NoError(t, err)
+	authorizedKeysPath := filepath.Join(dir, "authorized_keys")
+	assert.NoError(t, os.WriteFile(authorizedKeysPath, ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600))
+
+	server := GetAgentTunnelServer(v3.AgentTunnelConfig{ListenAddress: "127.0.0.1:0", Token: "secret", ConnectTimeout: 2}, []string{"127.0.0.1"})
+	assert.NoError(t, server.Start())
+	t.Cleanup(func() { server.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	hostKeyPath := filepath.Join(dir, "agent", "host_key")
+	go RunNodeAgent(ctx, NodeAgentConfig{
+		ServerURL:          fmt.Sprintf("ws://%s", server.Addr()),
+		Token:              token,
+		NodeAddress:        "127.0.0.1",
+		HostKeyPath:        hostKeyPath,
+		AuthorizedKeysPath: authorizedKeysPath,
+	})
+
+	h := &Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address:        "127.0.0.1",
+			Port:           "22",
+			User:           "rke",
+			SSHKey:         keyPEM,
+			ConnectionType: ConnectionTypeAgent,
+			DockerSocket:   filepath.Join(dir, "docker.sock"),
+			// ignored by nodes reached through their node agent
+			BastionHost: &v3.BastionHost{Address: "127.0.0.1", Port: "1"},
+		},
+		AgentTunnel: server,
+	}
+	// the host key of the agent is generated on start
+	assert.Eventually(t, func() bool {
+		buf, err := os.ReadFile(hostKeyPath)
+		if err != nil {
+			return false
+		}
+		hostKey, err := ssh.ParsePrivateKey(buf)
+		if err != nil {
+			return false
+		}
+		h.HostKey = string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return h, server
+}
+
+func TestAgentTunnel(t *testing.T) {
+	h, _ := startTestNodeAgent(t, GetNodeAgentToken("secret", "127.0.0.1"))
+	dockerSocket := newEchoListener(t, "unix", h.DockerSocket)
+	localPort := newEchoListener(t, "tcp", "127.0.0.1:0")
+
+	// the Docker socket
+	dial, err := SSHFactory(h)
+	assert.NoError(t, err)
+	conn, err := dial("unix", "/var/run/docker.sock")
+	assert.NoError(t, err)
+	assertEcho(t, conn)
+	assert.NotNil(t, dockerSocket)
+
+	// the local ports
+	dial, err = LocalConnFactory(h)
+	assert.NoError(t, err)
+	conn, err = dial("tcp", localPort.Addr().String())
+	assert.NoError(t, err)
+	assertEcho(t, conn)
+
+	// the commands, the tunnel is kept open once the command ran
+	d, err := newDialer(h, "docker")
+	assert.NoError(t, err)
+	var stdout bytes.Buffer
+	assert.NoError(t, d.RunCommand(context.Background(), "cat; echo world", strings.NewReader("hello "), &stdout))
+	assert.Equal(t, "hello world\n", stdout.String())
+	assert.ErrorContains(t, d.RunCommand(context.Background(), "echo failed >&2; exit 3", nil, io.Discard), "failed")
+	conn, err = dial("tcp", localPort.Addr().String())
+	assert.NoError(t, err)
+	assertEcho(t, conn)
+}
+
+func TestAgentTunnelHostKey(t *testing.T) {
+	h, _ := startTestNodeAgent(t, GetNodeAgentToken("secret", "127.0.0.1"))
+	h.HostKey = authorizedKey(newTestSSHSigner(t).PublicKey())
+	d, err := newDialer(h, "network")
+	assert.NoError(t, err)
+	_, err = d.Dial("tcp", "127.0.0.1:6443")
+	assert.ErrorContains(t, err, "doesn't match the configured host_key")
+}
+
+func TestAgentTunnelInvalidToken(t *testing.T) {
+	// the node agents authenticate with the token of their node, not with the agent tunnel token
+	h, _ := startTestNodeAgent(t, "secret")
+	d, err := newDialer(h, "network")
+	assert.NoError(t, err)
+	_, err = d.Dial("tcp", "127.0.0.1:6443")
+	assert.ErrorContains(t, err, "didn't connect")
+	assert.NotEqual(t, GetNodeAgentToken("secret", "127.0.0.1"), GetNodeAgentToken("secret", "127.0.0.2"))
+
+	h.AgentTunnel = nil
+	_, err = AgentFactory(h)
+	assert.Error(t, err)
+}
+
+func TestAgentWrapTransport(t *testing.T) {
+	h, server := startTestNodeAgent(t, GetNodeAgentToken("secret", "127.0.0.1"))
+	apiServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go apiServer.Serve(listener)
+	defer apiServer.Close()
+
+	wrap, err := AgentWrapTransport([]*Host{h}, nil)
+	assert.NoError(t, err)
+	httpClient := &http.Client{Transport: wrap(&http.Transport{})}
+	resp, err := httpClient.Get("http://" + listener.Addr().String())
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "ok", string(body))
+	server.lock.Lock()
+	assert.NotNil(t, server.sessions["127.0.0.1"].client)
+	server.lock.Unlock()
+}
@@ -1,7 +1,10 @@
 package hosts
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -9,6 +12,7 @@ import (
 
 	"k8s.io/client-go/transport"
 
+	"github.com/rancher/rke/docker"
 	v3 "github.com/rancher/rke/types"
 	"golang.org/x/crypto/ssh"
 )
@@ -19,22 +23,36 @@ const (
 
 type DialerFactory func(h *Host) (func(network, address string) (net.Conn, error), error)
 
+// CommandRunnerFactory returns the function running shell commands on the host, the containerd runtime reads and writes the
+// container logs and files with it
+type CommandRunnerFactory func(h *Host) (docker.HostCommandRunner, error)
+
 type dialer struct {
-	signer          ssh.Signer
-	sshKeyString    string
-	sshCertString   string
-	sshAddress      string
-	username        string
-	netConn         string
-	dockerSocket    string
-	useSSHAgentAuth bool
-	bastionDialer   *dialer
+	signer           ssh.Signer
+	sshKeyString     string
+	sshKeyPassphrase string
+	sshCertString    string
+	sshAddress       string
+	username         string
+	netConn          string
+	dockerSocket     string
+	useSSHAgentAuth  bool
+	hostKeyCallback  ssh.HostKeyCallback
+	// proxyURL is the proxy used to reach the host when it is the first host of the connection
+	proxyURL string
+	// bastionDialers are the jump hosts to go through, in order, to reach the host
+	bastionDialers []*dialer
+	// agentTunnel serves the tunnel of the node agent of the host when it is reached through its node agent
+	agentTunnel *AgentTunnelServer
+	nodeAddress string
 }
 
 type DialersOptions struct {
 	DockerDialerFactory    DialerFactory
 	LocalConnDialerFactory DialerFactory
 	K8sWrapTransport       transport.WrapperFunc
+	// CommandRunnerFactory is required by containerd hosts when DockerDialerFactory is set, SSH is used otherwise
+	CommandRunnerFactory CommandRunnerFactory
 }
 
 func GetDialerOptions(d, l DialerFactory, w transport.WrapperFunc) DialersOptions {
@@ -45,47 +63,94 @@ func GetDialerOptions(d, l DialerFactory, w transport.WrapperFunc) DialersOption
 	}
 }
 
-func newDialer(h *Host, kind string) (*dialer, error) {
-	// Check for Bastion host connection
-	var bastionDialer *dialer
-	if len(h.BastionHost.Address) > 0 {
-		bastionDialer = &dialer{
-			sshAddress:      fmt.Sprintf("%s:%s", h.BastionHost.Address, h.BastionHost.Port),
-			username:        h.BastionHost.User,
-			sshKeyString:    h.BastionHost.SSHKey,
-			sshCertString:   h.BastionHost.SSHCert,
-			netConn:         "tcp",
-			useSSHAgentAuth: h.SSHAgentAuth,
+// newBastionDialers returns the dialers of the jump hosts leading to the host through the bastion host, the bastion host last
+func newBastionDialers(bastionHost v3.BastionHost, hostKeyVerifier *HostKeyVerifier) ([]*dialer, error) {
+	if len(bastionHost.Address) == 0 {
+		return nil, nil
+	}
+	hops := append([]v3.BastionHop{}, bastionHost.Hops...)
+	hops = append(hops, v3.BastionHop{
+		Address:          bastionHost.Address,
+		Port:             bastionHost.Port,
+		User:             bastionHost.User,
+		SSHAgentAuth:     bastionHost.SSHAgentAuth,
+		SSHKey:           bastionHost.SSHKey,
+		SSHKeyPath:       bastionHost.SSHKeyPath,
+		SSHCert:          bastionHost.SSHCert,
+		SSHCertPath:      bastionHost.SSHCertPath,
+		SSHKeyPassphrase: bastionHost.SSHKeyPassphrase,
+		HostKey:          bastionHost.HostKey,
+	})
+	bastionDialers := make([]*dialer, 0, len(hops))
+	for _, hop := range hops {
+		hostKeyCallback, err := hostKeyVerifier.HostKeyCallback(hop.HostKey)
+		if err != nil {
+			return nil, err
+		}
+		bastionDialer := &dialer{
+			sshAddress:       net.JoinHostPort(hop.Address, hop.Port),
+			username:         hop.User,
+			sshKeyString:     hop.SSHKey,
+			sshKeyPassphrase: hop.SSHKeyPassphrase,
+			sshCertString:    hop.SSHCert,
+			netConn:          "tcp",
+			useSSHAgentAuth:  hop.SSHAgentAuth,
+			hostKeyCallback:  hostKeyCallback,
 		}
 		if bastionDialer.sshKeyString == "" && !bastionDialer.useSSHAgentAuth {
-			var err error
-			bastionDialer.sshKeyString, err = privateKeyPath(h.BastionHost.SSHKeyPath)
+			bastionDialer.sshKeyString, err = privateKeyPath(hop.SSHKeyPath)
 			if err != nil {
 				return nil, err
 			}
-
-			if bastionDialer.sshCertString == "" && len(h.BastionHost.SSHCertPath) > 0 {
-				bastionDialer.sshCertString, err = certificatePath(h.BastionHost.SSHCertPath)
-				if err != nil {
-					return nil, err
-				}
+		}
+		if bastionDialer.sshCertString == "" && len(hop.SSHCertPath) > 0 {
+			bastionDialer.sshCertString, err = certificatePath(hop.SSHCertPath)
+			if err != nil {
+				return nil, err
 			}
 		}
+		bastionDialers = append(bastionDialers, bastionDialer)
 	}
+	bastionDialers[0].proxyURL = bastionHost.Proxy
+	return bastionDialers, nil
+}
 
+func newDialer(h *Host, kind string) (*dialer, error) {
+	var bastionDialers []*dialer
+	var err error
+	if h.ConnectionType == ConnectionTypeAgent {
+		if h.AgentTunnel == nil {
+			return nil, fmt.Errorf("host [%s] is reached through its node agent but the agent_tunnel isn't configured", h.Address)
+		}
+	} else if bastionDialers, err = newBastionDialers(h.BastionHost, h.HostKeyVerifier); err != nil {
+		// Check for Bastion host connection
+		return nil, err
+	}
+
+	hostKeyCallback, err := h.HostKeyVerifier.HostKeyCallback(h.HostKey)
+	if err != nil {
+		return nil, err
+	}
 	dialer := &dialer{
-		sshAddress:      fmt.Sprintf("%s:%s", h.Address, h.Port),
-		username:        h.User,
-		dockerSocket:    h.DockerSocket,
-		sshKeyString:    h.SSHKey,
-		sshCertString:   h.SSHCert,
-		netConn:         "unix",
-		useSSHAgentAuth: h.SSHAgentAuth,
-		bastionDialer:   bastionDialer,
+		sshAddress:       net.JoinHostPort(h.Address, h.Port),
+		username:         h.User,
+		dockerSocket:     h.DockerSocket,
+		sshKeyString:     h.SSHKey,
+		sshKeyPassphrase: h.SSHKeyPassphrase,
+		sshCertString:    h.SSHCert,
+		netConn:          "unix",
+		useSSHAgentAuth:  h.SSHAgentAuth,
+		hostKeyCallback:  hostKeyCallback,
+		proxyURL:         h.Proxy,
+		bastionDialers:   bastionDialers,
+		nodeAddress:      h.Address,
+	}
+	if h.ConnectionType == ConnectionTypeAgent {
+		dialer.agentTunnel = h.AgentTunnel
+		dialer.proxyURL = ""
 	}
 
 	if dialer.sshKeyString == "" && !dialer.useSSHAgentAuth {
-		var err error
 		dialer.sshKeyString, err = privateKeyPath(h.SSHKeyPath)
 		if err != nil {
 			return nil, err
@@ -106,17 +171,34 @@ func newDialer(h *Host, kind string) (*dialer, error) {
 
 	if len(dialer.dockerSocket) == 0 {
 		dialer.dockerSocket = "/var/run/docker.sock"
+		if h.IsContainerd() {
+			dialer.dockerSocket = docker.ContainerdSocket
+		}
 	}
 
 	return dialer, nil
 }
 
 func SSHFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
+	if h.ConnectionType == ConnectionTypeAgent {
+		return AgentFactory(h)
+	}
 	dialer, err := newDialer(h, "docker")
 	return dialer.Dial, err
 }
 
+func SSHCommandRunnerFactory(h *Host) (docker.HostCommandRunner, error) {
+	dialer, err := newDialer(h, "docker")
+	if err != nil {
+		return nil, err
+	}
+	return dialer.RunCommand, nil
+}
+
 func LocalConnFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
+	if h.ConnectionType == ConnectionTypeAgent {
+		return AgentLocalConnFactory(h)
+	}
 	dialer, err := newDialer(h, "network")
 	return dialer.Dial, err
 }
@@ -130,20 +212,19 @@ func (d *dialer) DialLocalConn(network, addr string) (net.Conn, error) {
 }
 
 func (d *dialer) Dial(network, addr string) (net.Conn, error) {
-	var conn *ssh.Client
-	var err error
-	if d.bastionDialer != nil {
-		conn, err = d.getBastionHostTunnelConn()
-	} else {
-		conn, err = d.getSSHTunnelConnection()
-	}
+	conn, err := d.getConn()
 	if err != nil {
+		if d.agentTunnel != nil {
+			return nil, fmt.Errorf("Unable to access node with address [%s] through its node agent: %v", d.nodeAddress, err)
+		}
 		if strings.Contains(err.Error(), "no key found") {
 			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Please check if the configured key or specified key file is a valid SSH Private Key. Error: %v", d.sshAddress, err)
 		} else if strings.Contains(err.Error(), "no supported methods remain") {
 			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Please check if you are able to SSH to the node using the specified SSH Private Key and if you have configured the correct SSH username. Error: %v", d.sshAddress, err)
-		} else if strings.Contains(err.Error(), "cannot decode encrypted private keys") {
-			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Using encrypted private keys is only supported using ssh-agent. Please configure the option `ssh_agent_auth: true` in the configuration file or use --ssh-agent-auth as a parameter when running RKE. This will use the `SSH_AUTH_SOCK` environment variable. Error: %v", d.sshAddress, err)
+		} else if strings.Contains(err.Error(), "cannot decode encrypted private keys") || strings.Contains(err.Error(), "passphrase protected") {
+			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. The SSH Private Key is encrypted, please configure its passphrase with the option `ssh_key_passphrase` or use ssh-agent with the option `ssh_agent_auth: true` in the configuration file or --ssh-agent-auth as a parameter when running RKE. Error: %v", d.sshAddress, err)
+		} else if strings.Contains(err.Error(), "decryption password incorrect") {
+			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Please check the `ssh_key_passphrase` of the SSH Private Key. Error: %v", d.sshAddress, err)
 		} else if strings.Contains(err.Error(), "operation timed out") {
 			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Please check if the node is up and is accepting SSH connections or check network policies and firewall rules. Error: %v", d.sshAddress, err)
 		}
@@ -168,13 +249,78 @@ func (d *dialer) Dial(network, addr string) (net.Conn, error) {
 	return remote, err
 }
 
+// RunCommand runs the command in a SSH session on the host, the session is closed when ctx is done
+func (d *dialer) RunCommand(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+	conn, err := d.getConn()
+	if err != nil {
+		return fmt.Errorf("Failed to dial ssh using address [%s]: %v", d.sshAddress, err)
+	}
+	if d.agentTunnel == nil {
+		// the SSH client of a node agent tunnel is shared by the dialers of the host
+		defer conn.Close()
+	}
+	session, err := conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("Failed to open ssh session on [%s]: %v", d.sshAddress, err)
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("Failed to run [%s] on [%s]: %v: %s", cmd, d.sshAddress, err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+}
+
+func (d *dialer) getConn() (*ssh.Client, error) {
+	if d.agentTunnel != nil {
+		cfg, err := getSSHConfig(d.username, d.sshKeyString, d.sshKeyPassphrase, d.sshCertString, d.useSSHAgentAuth, d.hostKeyCallback)
+		if err != nil {
+			return nil, fmt.Errorf("Error configuring SSH: %v", err)
+		}
+		return d.agentTunnel.getClient(d.nodeAddress, d.sshAddress, cfg)
+	}
+	if len(d.bastionDialers) > 0 {
+		return d.getBastionHostTunnelConn()
+	}
+	return d.getSSHTunnelConnection()
+}
+
 func (d *dialer) getSSHTunnelConnection() (*ssh.Client, error) {
-	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.sshCertString, d.useSSHAgentAuth)
+	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.sshKeyPassphrase, d.sshCertString, d.useSSHAgentAuth, d.hostKeyCallback)
 	if err != nil {
 		return nil, fmt.Errorf("Error configuring SSH: %v", err)
 	}
 	// Establish connection with SSH server
-	return ssh.Dial("tcp", d.sshAddress, cfg)
+	return d.dialSSH(cfg)
+}
+
+// dialSSH establishes the connection with the SSH server of the host, through its proxy if any
+func (d *dialer) dialSSH(cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(d.proxyURL) == 0 {
+		return ssh.Dial("tcp", d.sshAddress, cfg)
+	}
+	conn, err := dialProxy(d.proxyURL, d.sshAddress)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, channels, sshRequest, err := ssh.NewClientConn(conn, d.sshAddress, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, sshRequest), nil
 }
 
 func (h *Host) newHTTPClient(dialerFactory DialerFactory) (*http.Client, error) {
@@ -199,19 +345,33 @@ func (h *Host) newHTTPClient(dialerFactory DialerFactory) (*http.Client, error)
 }
 
 func (d *dialer) getBastionHostTunnelConn() (*ssh.Client, error) {
-	bastionCfg, err := getSSHConfig(d.bastionDialer.username, d.bastionDialer.sshKeyString, d.bastionDialer.sshCertString, d.bastionDialer.useSSHAgentAuth)
+	bastionDialer := d.bastionDialers[0]
+	bastionCfg, err := getSSHConfig(bastionDialer.username, bastionDialer.sshKeyString, bastionDialer.sshKeyPassphrase, bastionDialer.sshCertString, bastionDialer.useSSHAgentAuth, bastionDialer.hostKeyCallback)
 	if err != nil {
-		return nil, fmt.Errorf("Error configuring SSH for bastion host [%s]: %v", d.bastionDialer.sshAddress, err)
+		return nil, fmt.Errorf("Error configuring SSH for bastion host [%s]: %v", bastionDialer.sshAddress, err)
 	}
-	bastionClient, err := ssh.Dial("tcp", d.bastionDialer.sshAddress, bastionCfg)
+	client, err := bastionDialer.dialSSH(bastionCfg)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to connect to the bastion host [%s]: %v", d.bastionDialer.sshAddress, err)
+		return nil, fmt.Errorf("Failed to connect to the bastion host [%s]: %v", bastionDialer.sshAddress, err)
+	}
+	// each jump host is reached through the previous one
+	for _, next := range append(d.bastionDialers[1:], d) {
+		nextClient, err := next.getSSHTunnelConnectionThrough(client)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		client = nextClient
 	}
-	conn, err := bastionClient.Dial(d.bastionDialer.netConn, d.sshAddress)
+	return client, nil
+}
+
+func (d *dialer) getSSHTunnelConnectionThrough(client *ssh.Client) (*ssh.Client, error) {
+	conn, err := client.Dial("tcp", d.sshAddress)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to the host [%s]: %v", d.sshAddress, err)
 	}
-	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.sshCertString, d.useSSHAgentAuth)
+	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.sshKeyPassphrase, d.sshCertString, d.useSSHAgentAuth, d.hostKeyCallback)
 	if err != nil {
 		return nil, fmt.Errorf("Error configuring SSH for host [%s]: %v", d.sshAddress, err)
 	}
@@ -222,40 +382,59 @@ func (d *dialer) getBastionHostTunnelConn() (*ssh.Client, error) {
 	return ssh.NewClient(newClientConn, channels, sshRequest), nil
 }
 
-func BastionHostWrapTransport(bastionHost v3.BastionHost) (transport.WrapperFunc, error) {
-
-	bastionDialer := &dialer{
-		sshAddress:      fmt.Sprintf("%s:%s", bastionHost.Address, bastionHost.Port),
-		username:        bastionHost.User,
-		sshKeyString:    bastionHost.SSHKey,
-		sshCertString:   bastionHost.SSHCert,
-		netConn:         "tcp",
-		useSSHAgentAuth: bastionHost.SSHAgentAuth,
+// BastionHostWrapTransport returns a wrapper of the Kubernetes API transport dialing through the bastion host of the
+// control plane host reached, nodeBastionHosts holds the bastion hosts overriding bastionHost by host address and
+// nodeProxies the proxies of the hosts reached directly by host address
+func BastionHostWrapTransport(bastionHost v3.BastionHost, nodeBastionHosts map[string]v3.BastionHost, nodeProxies map[string]string, hostKeyVerifier *HostKeyVerifier) (transport.WrapperFunc, error) {
+	defaultDialer, err := newBastionTransportDialer(bastionHost, hostKeyVerifier)
+	if err != nil {
+		return nil, err
 	}
-
-	if bastionDialer.sshKeyString == "" && !bastionDialer.useSSHAgentAuth {
-		var err error
-		bastionDialer.sshKeyString, err = privateKeyPath(bastionHost.SSHKeyPath)
-		if err != nil {
+	nodeDialers := map[string]*dialer{}
+	for address, nodeBastionHost := range nodeBastionHosts {
+		if nodeDialers[address], err = newBastionTransportDialer(nodeBastionHost, hostKeyVerifier); err != nil {
 			return nil, err
 		}
-
 	}
-
-	if bastionDialer.sshCertString == "" && len(bastionHost.SSHCertPath) > 0 {
-		var err error
-		bastionDialer.sshCertString, err = certificatePath(bastionHost.SSHCertPath)
+	for address, proxyURL := range nodeProxies {
+		if _, err := ParseProxyURL(proxyURL); err != nil {
+			return nil, fmt.Errorf("Invalid proxy of host [%s]: %v", address, err)
+		}
+	}
+	dial := func(network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
 		if err != nil {
-			return nil, err
+			host = addr
 		}
-
+		bastionDialer, ok := nodeDialers[host]
+		if !ok {
+			bastionDialer = defaultDialer
+		}
+		if bastionDialer != nil {
+			return bastionDialer.Dial(network, addr)
+		}
+		if proxyURL := nodeProxies[host]; len(proxyURL) > 0 {
+			return dialProxy(proxyURL, addr)
+		}
+		return net.Dial(network, addr)
 	}
 	return func(rt http.RoundTripper) http.RoundTripper {
 		if ht, ok := rt.(*http.Transport); ok {
 			ht.DialContext = nil
 			ht.DialTLS = nil
-			ht.Dial = bastionDialer.Dial
+			ht.Dial = dial
 		}
 		return rt
 	}, nil
 }
+
+// newBastionTransportDialer returns a dialer connecting to addresses from the bastion host
+func newBastionTransportDialer(bastionHost v3.BastionHost, hostKeyVerifier *HostKeyVerifier) (*dialer, error) {
+	bastionDialers, err := newBastionDialers(bastionHost, hostKeyVerifier)
+	if err != nil || len(bastionDialers) == 0 {
+		return nil, err
+	}
+	bastionDialer := bastionDialers[len(bastionDialers)-1]
+	bastionDialer.bastionDialers = bastionDialers[:len(bastionDialers)-1]
+	return bastionDialer, nil
+}
@@ -0,0 +1,218 @@
+package hosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer is a SSH server forwarding direct-tcpip channels, it records the forwarded addresses
+type testSSHServer struct {
+	listener  net.Listener
+	hostKey   ssh.Signer
+	lock      sync.Mutex
+	forwarded []string
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &testSSHServer{listener: listener, hostKey: newTestSSHSigner(t)}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(s.hostKey)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		var payload struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		address := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+		s.lock.Lock()
+		s.forwarded = append(s.forwarded, address)
+		s.lock.Unlock()
+		target, err := net.Dial("tcp", address)
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			io.Copy(channel, target)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(target, channel)
+			target.Close()
+		}()
+	}
+}
+
+func (s *testSSHServer) getForwarded() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.forwarded...)
+}
+
+func (s *testSSHServer) hop(keyPEM string) v3.BastionHop {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return v3.BastionHop{
+		Address: host,
+		Port:    port,
+		User:    "rke",
+		SSHKey:  keyPEM,
+		HostKey: authorizedKey(s.hostKey.PublicKey()),
+	}
+}
+
+func (s *testSSHServer) bastionHost(keyPEM string, hops ...v3.BastionHop) v3.BastionHost {
+	hop := s.hop(keyPEM)
+	return v3.BastionHost{
+		Address: hop.Address,
+		Port:    hop.Port,
+		User:    hop.User,
+		SSHKey:  hop.SSHKey,
+		HostKey: hop.HostKey,
+		Hops:    hops,
+	}
+}
+
+func newTestSSHKeyPEM(t *testing.T) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestDialerBastionHops(t *testing.T) {
+	keyPEM := newTestSSHKeyPEM(t)
+	jumpHost := newTestSSHServer(t)
+	bastion := newTestSSHServer(t)
+	node := newTestSSHServer(t)
+	nodeHop := node.hop(keyPEM)
+
+	h := &Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address: nodeHop.Address,
+			Port:    nodeHop.Port,
+			User:    "rke",
+			SSHKey:  keyPEM,
+			HostKey: nodeHop.HostKey,
+		},
+		BastionHost: bastion.bastionHost(keyPEM, jumpHost.hop(keyPEM)),
+	}
+	d, err := newDialer(h, "network")
+	assert.NoError(t, err)
+	client, err := d.getConn()
+	assert.NoError(t, err)
+	client.Close()
+
+	// the jump host reaches the bastion host, which reaches the node
+	assert.Equal(t, []string{bastion.listener.Addr().String()}, jumpHost.getForwarded())
+	assert.Equal(t, []string{node.listener.Addr().String()}, bastion.getForwarded())
+
+	// host keys of the hops are verified
+	h.BastionHost.Hops[0].HostKey = authorizedKey(newTestSSHSigner(t).PublicKey())
+	d, err = newDialer(h, "network")
+	assert.NoError(t, err)
+	_, err = d.getConn()
+	assert.ErrorContains(t, err, "bastion host")
+}
+
+func TestDialerIPv6Addresses(t *testing.T) {
+	keyPEM := newTestSSHKeyPEM(t)
+	h := &Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address: "fd00::10",
+			Port:    "22",
+			User:    "rke",
+			SSHKey:  keyPEM,
+		},
+		BastionHost: v3.BastionHost{
+			Address: "fd00::1",
+			Port:    "2222",
+			User:    "rke",
+			SSHKey:  keyPEM,
+			Hops:    []v3.BastionHop{{Address: "2001:db8::1", Port: "22", User: "rke", SSHKey: keyPEM}},
+		},
+	}
+	d, err := newDialer(h, "network")
+	assert.NoError(t, err)
+	assert.Equal(t, "[fd00::10]:22", d.sshAddress)
+	assert.Len(t, d.bastionDialers, 2)
+	assert.Equal(t, "[2001:db8::1]:22", d.bastionDialers[0].sshAddress)
+	assert.Equal(t, "[fd00::1]:2222", d.bastionDialers[1].sshAddress)
+}
+
+func TestBastionHostWrapTransportNodeOverride(t *testing.T) {
+	keyPEM := newTestSSHKeyPEM(t)
+	clusterBastion := newTestSSHServer(t)
+	nodeBastion := newTestSSHServer(t)
+	apiServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go apiServer.Serve(listener)
+	defer apiServer.Close()
+
+	wrap, err := BastionHostWrapTransport(clusterBastion.bastionHost(keyPEM), map[string]v3.BastionHost{
+		"127.0.0.1": nodeBastion.bastionHost(keyPEM),
+	}, nil, nil)
+	assert.NoError(t, err)
+	httpClient := &http.Client{Transport: wrap(&http.Transport{})}
+	resp, err := httpClient.Get("http://" + listener.Addr().String())
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{listener.Addr().String()}, nodeBastion.getForwarded())
+	assert.Empty(t, clusterBastion.getForwarded())
+}
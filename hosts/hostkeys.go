@@ -0,0 +1,189 @@
+package hosts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// HostKeyCheckingStrict only accepts the host keys configured for the hosts or found in the known_hosts file
+	HostKeyCheckingStrict = "strict"
+	// HostKeyCheckingTrustOnFirstUse trusts the host keys of unknown hosts on first use and rejects them once they change
+	HostKeyCheckingTrustOnFirstUse = "trust-on-first-use"
+
+	certAuthorityMarker = "@cert-authority"
+)
+
+var HostKeyCheckingModes = []string{HostKeyCheckingStrict, HostKeyCheckingTrustOnFirstUse}
+
+// HostKeyVerifier verifies the SSH host keys of the nodes and of the bastion host. Host keys configured for a host are always
+// enforced, the mode selects how hosts without a configured or known host key are handled.
+type HostKeyVerifier struct {
+	mode       string
+	knownHosts ssh.HostKeyCallback
+	trustLock  sync.Mutex
+	// trusted holds the fingerprints of the host keys trusted on first use by host address
+	trusted map[string]string
+	onTrust func(address, fingerprint string) error
+}
+
+// NewHostKeyVerifier returns a host key verifier, trusted holds the fingerprints of the host keys already trusted on first use and
+// onTrust records the fingerprint of a newly trusted host key
+func NewHostKeyVerifier(mode, knownHostsPath string, trusted map[string]string, onTrust func(address, fingerprint string) error) (*HostKeyVerifier, error) {
+	v := &HostKeyVerifier{
+		mode:    mode,
+		trusted: map[string]string{},
+		onTrust: onTrust,
+	}
+	for address, fingerprint := range trusted {
+		v.trusted[address] = fingerprint
+	}
+	if len(knownHostsPath) > 0 {
+		if strings.HasPrefix(knownHostsPath, "~/") {
+			knownHostsPath = filepath.Join(userHome(), knownHostsPath[2:])
+		}
+		knownHosts, err := knownhosts.New(knownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error while reading SSH known hosts file: %v", err)
+		}
+		v.knownHosts = knownHosts
+	}
+	return v, nil
+}
+
+// HostKeyCallback returns the callback verifying the host key of a host, hostKey holds the host keys configured for the host
+func (v *HostKeyVerifier) HostKeyCallback(hostKey string) (ssh.HostKeyCallback, error) {
+	keys, authorities, err := ParseHostKeys(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil && len(keys) == 0 && len(authorities) == 0 {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if len(keys) > 0 || len(authorities) > 0 {
+			return checkHostKey(hostname, remote, key, keys, authorities)
+		}
+		if v == nil {
+			return nil
+		}
+		if v.knownHosts != nil {
+			err := v.checkKnownHosts(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if err == nil {
+				return nil
+			} else if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+				return fmt.Errorf("SSH host key of host [%s] doesn't match the known hosts file: %v", hostname, err)
+			}
+		}
+		return v.checkUnknownHostKey(hostname, key)
+	}, nil
+}
+
+func (v *HostKeyVerifier) checkKnownHosts(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := v.knownHosts(hostname, remote, key)
+	if cert, ok := key.(*ssh.Certificate); ok && err != nil {
+		// the known hosts file may only hold the key of the host certificate
+		if keyErr := v.knownHosts(hostname, remote, cert.Key); keyErr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (v *HostKeyVerifier) checkUnknownHostKey(hostname string, key ssh.PublicKey) error {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	switch v.mode {
+	case HostKeyCheckingStrict:
+		return fmt.Errorf("SSH host key [%s] of host [%s] is unknown, add it to the host_key of the host or to the ssh_known_hosts_path file", fingerprint, hostname)
+	case HostKeyCheckingTrustOnFirstUse:
+		v.trustLock.Lock()
+		defer v.trustLock.Unlock()
+		if trusted, ok := v.trusted[hostname]; ok {
+			if trusted != fingerprint {
+				return fmt.Errorf("SSH host key of host [%s] changed, trusted fingerprint is [%s] but the host presented [%s]. If the host was reinstalled, remove it from the sshHostKeys of the state file", hostname, trusted, fingerprint)
+			}
+			return nil
+		}
+		logrus.Infof("Trusting SSH host key [%s] of host [%s] on first use", fingerprint, hostname)
+		if v.onTrust != nil {
+			if err := v.onTrust(hostname, fingerprint); err != nil {
+				return fmt.Errorf("Failed to record SSH host key of host [%s]: %v", hostname, err)
+			}
+		}
+		v.trusted[hostname] = fingerprint
+		return nil
+	}
+	logrus.Debugf("Accepting SSH host key [%s] of host [%s] without verification", fingerprint, hostname)
+	return nil
+}
+
+// checkHostKey accepts the configured host keys and the host certificates issued by the configured authorities for the host
+func checkHostKey(hostname string, remote net.Addr, key ssh.PublicKey, keys, authorities []ssh.PublicKey) error {
+	hostKey := key
+	if cert, ok := key.(*ssh.Certificate); ok {
+		if len(authorities) > 0 {
+			checker := &ssh.CertChecker{
+				IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+					return containsKey(authorities, auth)
+				},
+			}
+			err := checker.CheckHostKey(hostname, remote, key)
+			if err == nil || len(keys) == 0 {
+				return err
+			}
+		}
+		hostKey = cert.Key
+	}
+	if containsKey(keys, hostKey) {
+		return nil
+	}
+	return fmt.Errorf("SSH host key [%s] of host [%s] doesn't match the configured host_key", ssh.FingerprintSHA256(hostKey), hostname)
+}
+
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseHostKeys parses host keys in authorized_keys format, one per line. Keys of host certificate authorities are
+// prefixed with @cert-authority.
+func ParseHostKeys(hostKey string) ([]ssh.PublicKey, []ssh.PublicKey, error) {
+	var keys, authorities []ssh.PublicKey
+	for _, line := range strings.Split(hostKey, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		isAuthority := strings.HasPrefix(line, certAuthorityMarker)
+		if isAuthority {
+			line = strings.TrimSpace(strings.TrimPrefix(line, certAuthorityMarker))
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to parse SSH host key [%s]: %v", line, err)
+		}
+		if isAuthority {
+			authorities = append(authorities, key)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	return keys, authorities, nil
+}
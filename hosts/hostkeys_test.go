@@ -0,0 +1,150 @@
+package hosts
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var testRemoteAddr = &net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 22}
+
+func newTestSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+	return signer
+}
+
+func newTestSSHCertificate(t *testing.T, key ssh.PublicKey, authority ssh.Signer, certType uint32, principals []string) *ssh.Certificate {
+	cert := &ssh.Certificate{
+		Key:             key,
+		KeyId:           "test",
+		CertType:        certType,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	assert.NoError(t, cert.SignCert(rand.Reader, authority))
+	return cert
+}
+
+func authorizedKey(key ssh.PublicKey) string {
+	return string(ssh.MarshalAuthorizedKey(key))
+}
+
+func TestHostKeyCallbackConfiguredHostKey(t *testing.T) {
+	hostKey := newTestSSHSigner(t).PublicKey()
+	otherKey := newTestSSHSigner(t).PublicKey()
+
+	// configured host keys are verified without a verifier
+	callback, err := (*HostKeyVerifier)(nil).HostKeyCallback(authorizedKey(hostKey))
+	assert.NoError(t, err)
+	assert.NoError(t, callback("1.1.1.1:22", testRemoteAddr, hostKey))
+	assert.Error(t, callback("1.1.1.1:22", testRemoteAddr, otherKey))
+
+	_, err = (*HostKeyVerifier)(nil).HostKeyCallback("ssh-ed25519 invalid")
+	assert.Error(t, err)
+}
+
+func TestHostKeyCallbackCertAuthority(t *testing.T) {
+	authority := newTestSSHSigner(t)
+	hostKey := newTestSSHSigner(t).PublicKey()
+	callback, err := (*HostKeyVerifier)(nil).HostKeyCallback(certAuthorityMarker + " " + authorizedKey(authority.PublicKey()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, callback("1.1.1.1:22", testRemoteAddr, newTestSSHCertificate(t, hostKey, authority, ssh.HostCert, []string{"1.1.1.1"})))
+	// the host certificate must be issued for the host
+	assert.Error(t, callback("1.1.1.1:22", testRemoteAddr, newTestSSHCertificate(t, hostKey, authority, ssh.HostCert, []string{"2.2.2.2"})))
+	assert.Error(t, callback("1.1.1.1:22", testRemoteAddr, newTestSSHCertificate(t, hostKey, newTestSSHSigner(t), ssh.HostCert, []string{"1.1.1.1"})))
+	assert.Error(t, callback("1.1.1.1:22", testRemoteAddr, hostKey))
+}
+
+func TestHostKeyVerifierKnownHosts(t *testing.T) {
+	hostKey := newTestSSHSigner(t).PublicKey()
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	assert.NoError(t, os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{"1.1.1.1"}, hostKey)+"\n"), 0600))
+
+	verifier, err := NewHostKeyVerifier(HostKeyCheckingStrict, knownHostsPath, nil, nil)
+	assert.NoError(t, err)
+	callback, err := verifier.HostKeyCallback("")
+	assert.NoError(t, err)
+	assert.NoError(t, callback("1.1.1.1:22", testRemoteAddr, hostKey))
+	assert.Error(t, callback("1.1.1.1:22", testRemoteAddr, newTestSSHSigner(t).PublicKey()))
+	// unknown hosts are rejected in strict mode
+	assert.Error(t, callback("2.2.2.2:22", testRemoteAddr, hostKey))
+
+	_, err = NewHostKeyVerifier(HostKeyCheckingStrict, filepath.Join(t.TempDir(), "missing"), nil, nil)
+	assert.Error(t, err)
+}
+
+func TestHostKeyVerifierTrustOnFirstUse(t *testing.T) {
+	hostKey := newTestSSHSigner(t).PublicKey()
+	recorded := map[string]string{}
+	verifier, err := NewHostKeyVerifier(HostKeyCheckingTrustOnFirstUse, "", map[string]string{"2.2.2.2:22": "SHA256:other"}, func(address, fingerprint string) error {
+		recorded[address] = fingerprint
+		return nil
+	})
+	assert.NoError(t, err)
+	callback, err := verifier.HostKeyCallback("")
+	assert.NoError(t, err)
+
+	assert.NoError(t, callback("1.1.1.1:22", testRemoteAddr, hostKey))
+	assert.Equal(t, map[string]string{"1.1.1.1:22": ssh.FingerprintSHA256(hostKey)}, recorded)
+	assert.NoError(t, callback("1.1.1.1:22", testRemoteAddr, hostKey))
+	assert.Error(t, callback("1.1.1.1:22", testRemoteAddr, newTestSSHSigner(t).PublicKey()))
+	// host keys trusted by a previous run
+	assert.Error(t, callback("2.2.2.2:22", testRemoteAddr, hostKey))
+}
+
+func TestParsePrivateKeyWithPassphrase(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	for _, key := range []interface{}{edKey, ecKey} {
+		block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("secret"))
+		assert.NoError(t, err)
+		keyPEM := string(pem.EncodeToMemory(block))
+
+		_, err = parsePrivateKey(keyPEM, "")
+		assert.ErrorContains(t, err, "passphrase protected")
+		_, err = parsePrivateKey(keyPEM, "invalid")
+		assert.Error(t, err)
+		signer, err := parsePrivateKey(keyPEM, "secret")
+		assert.NoError(t, err)
+		assert.NotNil(t, signer)
+	}
+}
+
+func TestGetSSHConfigCertificatePrincipals(t *testing.T) {
+	authority := newTestSSHSigner(t)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	assert.NoError(t, err)
+	keyPEM := string(pem.EncodeToMemory(block))
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+
+	userCert := authorizedKey(newTestSSHCertificate(t, signer.PublicKey(), authority, ssh.UserCert, []string{"rke"}))
+	_, err = getSSHConfig("rke", keyPEM, "", userCert, false, nil)
+	assert.NoError(t, err)
+	_, err = getSSHConfig("root", keyPEM, "", userCert, false, nil)
+	assert.ErrorContains(t, err, "not valid for user [root]")
+
+	hostCert := authorizedKey(newTestSSHCertificate(t, signer.PublicKey(), authority, ssh.HostCert, []string{"rke"}))
+	_, err = getSSHConfig("rke", keyPEM, "", hostCert, false, nil)
+	assert.Error(t, err)
+}
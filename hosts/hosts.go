@@ -10,7 +10,6 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/sirupsen/logrus"
 
-	"github.com/docker/docker/client"
 	"github.com/rancher/rke/docker"
 	"github.com/rancher/rke/k8s"
 	"github.com/rancher/rke/log"
@@ -22,7 +21,7 @@ import (
 
 type Host struct {
 	v3.RKEConfigNode
-	DClient             *client.Client
+	DClient             docker.ContainerRuntime
 	LocalConnPort       int
 	IsControl           bool
 	IsWorker            bool
@@ -39,6 +38,8 @@ type Host struct {
 	UpdateWorker        bool
 	PrefixPath          string
 	BastionHost         v3.BastionHost
+	HostKeyVerifier     *HostKeyVerifier
+	AgentTunnel         *AgentTunnelServer
 }
 
 const (
@@ -155,6 +156,11 @@ func (h *Host) OS() string {
 	return h.DockerInfo.OSType
 }
 
+// IsContainerd returns true if the containers of the host run with containerd instead of Docker
+func (h *Host) IsContainerd() bool {
+	return h.ContainerRuntime == docker.RuntimeContainerd
+}
+
 func (h *Host) IsWindows() bool {
 	return h.DockerInfo.OSType == "windows"
 }
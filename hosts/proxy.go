@@ -0,0 +1,129 @@
+package hosts
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProxySchemes are the schemes of the proxies supported to reach the hosts
+var ProxySchemes = []string{"socks5", "socks5h", "http", "https"}
+
+// ParseProxyURL parses the URL of the proxy used to reach a host, credentials of the proxy are passed as the user info of
+// the URL
+func ParseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse proxy URL: %v", err)
+	}
+	supported := false
+	for _, scheme := range ProxySchemes {
+		if u.Scheme == scheme {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("proxy [%s] scheme is not supported, supported schemes are %v", u.Redacted(), ProxySchemes)
+	}
+	if len(u.Hostname()) == 0 {
+		return nil, fmt.Errorf("proxy [%s] has no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// dialProxy connects to address through the proxy
+func dialProxy(proxyURL, address string) (net.Conn, error) {
+	u, err := ParseProxyURL(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	var proxyDialer proxy.Dialer
+	switch u.Scheme {
+	case "http", "https":
+		proxyDialer = &httpConnectDialer{proxyURL: u}
+	default:
+		if proxyDialer, err = proxy.FromURL(u, proxy.Direct); err != nil {
+			return nil, fmt.Errorf("Failed to configure proxy [%s]: %v", u.Redacted(), err)
+		}
+	}
+	conn, err := proxyDialer.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to [%s] through proxy [%s]: %v", address, u.Redacted(), err)
+	}
+	return conn, nil
+}
+
+// httpConnectDialer opens tunnels with the CONNECT method of a HTTP proxy
+type httpConnectDialer struct {
+	proxyURL *url.URL
+}
+
+func (d *httpConnectDialer) Dial(network, address string) (net.Conn, error) {
+	proxyAddress := d.proxyURL.Host
+	if len(d.proxyURL.Port()) == 0 {
+		port := "80"
+		if d.proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(d.proxyURL.Hostname(), port)
+	}
+	conn, err := net.Dial(network, proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+	if d.proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.proxyURL.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if user := d.proxyURL.User; user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused the connection: %s", resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		// the proxy may have sent data of the tunnel along with the response
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the data buffered while reading the response of the proxy before reading from the connection
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
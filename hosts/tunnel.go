@@ -1,11 +1,16 @@
 package hosts
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/rancher/rke/docker"
@@ -15,24 +20,33 @@ import (
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
-func (h *Host) TunnelUp(ctx context.Context, dialerFactory DialerFactory, clusterPrefixPath string, clusterVersion string) error {
+func (h *Host) TunnelUp(ctx context.Context, dialerFactory DialerFactory, runnerFactory CommandRunnerFactory, clusterPrefixPath string, clusterVersion string) error {
 	if h.DClient != nil {
 		return nil
 	}
 	log.Infof(ctx, "[dialer] Setup tunnel for host [%s]", h.Address)
-	httpClient, err := h.newHTTPClient(dialerFactory)
-	if err != nil {
-		return fmt.Errorf("Can't establish dialer connection: %v", err)
-	}
-	// set Docker client
-	logrus.Debugf("Connecting to Docker API for host [%s]", h.Address)
-	h.DClient, err = client.NewClientWithOpts(
-		client.WithAPIVersionNegotiation(),
-		client.WithHTTPClient(httpClient))
-	if err != nil {
-		return fmt.Errorf("Can't initiate NewClient: %v", err)
+	if h.IsContainerd() {
+		if err := h.newContainerdClient(ctx, dialerFactory, runnerFactory); err != nil {
+			return err
+		}
+	} else {
+		httpClient, err := h.newHTTPClient(dialerFactory)
+		if err != nil {
+			return fmt.Errorf("Can't establish dialer connection: %v", err)
+		}
+		// set Docker client
+		logrus.Debugf("Connecting to Docker API for host [%s]", h.Address)
+		dClient, err := client.NewClientWithOpts(
+			client.WithAPIVersionNegotiation(),
+			client.WithHTTPClient(httpClient))
+		if err != nil {
+			return fmt.Errorf("Can't initiate NewClient: %v", err)
+		}
+		h.DClient = dClient
 	}
 	if err := checkDockerVersion(ctx, h, clusterVersion); err != nil {
 		return err
@@ -42,19 +56,89 @@ func (h *Host) TunnelUp(ctx context.Context, dialerFactory DialerFactory, cluste
 }
 
 func (h *Host) TunnelUpLocal(ctx context.Context, clusterVersion string) error {
-	var err error
 	if h.DClient != nil {
 		return nil
 	}
+	if h.IsContainerd() {
+		logrus.Debugf("Connecting to containerd for host [%s]", h.Address)
+		conn, err := grpc.DialContext(ctx, "unix://"+h.getContainerdSocket(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return fmt.Errorf("Can't connect to containerd: %v", err)
+		}
+		dClient, err := docker.NewContainerdRuntime(ctx, conn, runLocalCommand)
+		if err != nil {
+			return fmt.Errorf("Can't initiate containerd client: %v", err)
+		}
+		h.DClient = dClient
+		return checkDockerVersion(ctx, h, clusterVersion)
+	}
 	// set Docker client
 	logrus.Debugf("Connecting to Docker API for host [%s]", h.Address)
-	h.DClient, err = client.NewEnvClient()
+	dClient, err := client.NewEnvClient()
 	if err != nil {
 		return fmt.Errorf("Can't initiate NewClient: %v", err)
 	}
+	h.DClient = dClient
 	return checkDockerVersion(ctx, h, clusterVersion)
 }
 
+// newContainerdClient connects to the containerd socket of the host through the dialer, files and logs of the containers are
+// accessed with the command runner. Both go through SSH unless a dialer factory is set.
+func (h *Host) newContainerdClient(ctx context.Context, dialerFactory DialerFactory, runnerFactory CommandRunnerFactory) error {
+	if dialerFactory == nil {
+		dialerFactory = SSHFactory
+		if runnerFactory == nil {
+			runnerFactory = SSHCommandRunnerFactory
+		}
+	}
+	if runnerFactory == nil {
+		return fmt.Errorf("Can't establish dialer connection: no command runner to access the container logs and files on containerd host [%s]", h.Address)
+	}
+	dial, err := dialerFactory(h)
+	if err != nil {
+		return fmt.Errorf("Can't establish dialer connection: %v", err)
+	}
+	run, err := runnerFactory(h)
+	if err != nil {
+		return fmt.Errorf("Can't establish dialer connection: %v", err)
+	}
+	logrus.Debugf("Connecting to containerd for host [%s]", h.Address)
+	socket := h.getContainerdSocket()
+	conn, err := grpc.DialContext(ctx, "unix://"+socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return dial("unix", socket)
+		}))
+	if err != nil {
+		return fmt.Errorf("Can't connect to containerd: %v", err)
+	}
+	dClient, err := docker.NewContainerdRuntime(ctx, conn, run)
+	if err != nil {
+		return fmt.Errorf("Can't initiate containerd client: %v", err)
+	}
+	h.DClient = dClient
+	return nil
+}
+
+func (h *Host) getContainerdSocket() string {
+	if len(h.DockerSocket) > 0 {
+		return h.DockerSocket
+	}
+	return docker.ContainerdSocket
+}
+
+func runLocalCommand(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	command := exec.CommandContext(ctx, "sh", "-c", cmd)
+	command.Stdin = stdin
+	command.Stdout = stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("Failed to run [%s]: %v: %s", cmd, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
 func checkDockerVersion(ctx context.Context, h *Host, clusterVersion string) error {
 	info, err := h.DClient.Info(ctx)
 	if err != nil {
@@ -65,6 +149,15 @@ func checkDockerVersion(ctx context.Context, h *Host, clusterVersion string) err
 	if h.IgnoreDockerVersion {
 		return nil
 	}
+	return CheckDockerVersion(h, clusterVersion)
+}
+
+// CheckDockerVersion checks that the Docker version of the host is supported by the Kubernetes version of the cluster
+func CheckDockerVersion(h *Host, clusterVersion string) error {
+	if h.IsContainerd() {
+		return nil
+	}
+	info := h.DockerInfo
 	K8sSemVer, err := util.StrToSemVer(clusterVersion)
 	if err != nil {
 		return fmt.Errorf("Error while parsing cluster version [%s]: %v", clusterVersion, err)
@@ -81,14 +174,20 @@ func checkDockerVersion(ctx context.Context, h *Host, clusterVersion string) err
 	return nil
 }
 
-func parsePrivateKey(keyBuff string) (ssh.Signer, error) {
+func parsePrivateKey(keyBuff, passphrase string) (ssh.Signer, error) {
+	if len(passphrase) > 0 {
+		return ssh.ParsePrivateKeyWithPassphrase([]byte(keyBuff), []byte(passphrase))
+	}
 	return ssh.ParsePrivateKey([]byte(keyBuff))
 }
 
-func getSSHConfig(username, sshPrivateKeyString string, sshCertificateString string, useAgentAuth bool) (*ssh.ClientConfig, error) {
+func getSSHConfig(username, sshPrivateKeyString, sshKeyPassphrase, sshCertificateString string, useAgentAuth bool, hostKeyCallback ssh.HostKeyCallback) (*ssh.ClientConfig, error) {
+	if hostKeyCallback == nil {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
 	config := &ssh.ClientConfig{
 		User:            username,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 	}
 
 	// Kind of a double check now.
@@ -106,7 +205,7 @@ func getSSHConfig(username, sshPrivateKeyString string, sshCertificateString str
 		}
 	}
 
-	signer, err := parsePrivateKey(sshPrivateKeyString)
+	signer, err := parsePrivateKey(sshPrivateKeyString, sshKeyPassphrase)
 	if err != nil {
 		return config, err
 	}
@@ -117,10 +216,14 @@ func getSSHConfig(username, sshPrivateKeyString string, sshCertificateString str
 			return config, fmt.Errorf("Unable to parse SSH certificate: %v", err)
 		}
 
-		if _, ok := key.(*ssh.Certificate); !ok {
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
 			return config, fmt.Errorf("Unable to cast public key to SSH Certificate")
 		}
-		signer, err = ssh.NewCertSigner(key.(*ssh.Certificate), signer)
+		if err := checkUserCertificate(cert, username); err != nil {
+			return config, err
+		}
+		signer, err = ssh.NewCertSigner(cert, signer)
 		if err != nil {
 			return config, err
 		}
@@ -131,6 +234,33 @@ func getSSHConfig(username, sshPrivateKeyString string, sshCertificateString str
 	return config, nil
 }
 
+// checkUserCertificate makes sure the SSH certificate can be used to log in as username
+func checkUserCertificate(cert *ssh.Certificate, username string) error {
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("SSH certificate [%s] is not a user certificate", cert.KeyId)
+	}
+	if len(cert.ValidPrincipals) > 0 {
+		var found bool
+		for _, principal := range cert.ValidPrincipals {
+			if principal == username {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("SSH certificate [%s] is not valid for user [%s], valid principals are %v", cert.KeyId, username, cert.ValidPrincipals)
+		}
+	}
+	now := uint64(time.Now().Unix())
+	if cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore {
+		return fmt.Errorf("SSH certificate [%s] expired at %s", cert.KeyId, time.Unix(int64(cert.ValidBefore), 0).UTC().Format(time.RFC3339))
+	}
+	if now < cert.ValidAfter {
+		return fmt.Errorf("SSH certificate [%s] is not valid before %s", cert.KeyId, time.Unix(int64(cert.ValidAfter), 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
 func privateKeyPath(sshKeyPath string) (string, error) {
 	if sshKeyPath[:2] == "~/" {
 		sshKeyPath = filepath.Join(userHome(), sshKeyPath[2:])
@@ -2,7 +2,9 @@ package k8s
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -25,3 +27,35 @@ func ListPodsByLabel(k8sClient *kubernetes.Clientset, label string) (*v1.PodList
 	}
 	return pods, nil
 }
+
+// ListRunningPods returns the running pods of every namespace
+func ListRunningPods(k8sClient *kubernetes.Clientset) (*v1.PodList, error) {
+	return k8sClient.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{FieldSelector: "status.phase=Running"})
+}
+
+// RunPodToCompletion creates the pod and waits up to timeout seconds for it to succeed, the pod is deleted afterwards
+func RunPodToCompletion(k8sClient *kubernetes.Clientset, pod *v1.Pod, timeout int) error {
+	created, err := k8sClient.CoreV1().Pods(pod.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := k8sClient.CoreV1().Pods(created.Namespace).Delete(context.TODO(), created.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			logrus.Warnf("[k8s] Failed to delete pod [%s] in namespace [%s]: %v", created.Name, created.Namespace, err)
+		}
+	}()
+	return retryToWithTimeout(ensurePodSucceeded, k8sClient, *created, timeout)
+}
+
+func ensurePodSucceeded(k8sClient *kubernetes.Clientset, p interface{}) error {
+	pod := p.(v1.Pod)
+	current, err := k8sClient.CoreV1().Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to get pod %s in namespace %s: %v", pod.Name, pod.Namespace, err)
+	}
+	if current.Status.Phase == v1.PodSucceeded {
+		logrus.Debugf("[k8s] Pod %s in namespace %s completed successfully", pod.Name, pod.Namespace)
+		return nil
+	}
+	return fmt.Errorf("Pod %s in namespace %s did not complete, phase: %s", pod.Name, pod.Namespace, current.Status.Phase)
+}
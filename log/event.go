@@ -0,0 +1,221 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type EventType string
+
+const (
+	EventPhaseStarted  EventType = "phase_started"
+	EventPhaseFinished EventType = "phase_finished"
+	EventContainer     EventType = "container"
+	EventMessage       EventType = "message"
+	EventError         EventType = "error"
+)
+
+// Container actions reported in container events
+const (
+	ContainerActionPulled    = "pulled"
+	ContainerActionStarted   = "started"
+	ContainerActionUpdated   = "updated"
+	ContainerActionRestarted = "restarted"
+	ContainerActionRemoved   = "removed"
+)
+
+// Event is a typed progress event, wrappers can follow the phases and containers deployed on each host without parsing log messages
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      EventType `json:"type"`
+	Level     string    `json:"level,omitempty"`
+	Phase     string    `json:"phase,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Component string    `json:"component,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// Duration is set on phase_finished events, in seconds
+	Duration float64 `json:"duration,omitempty"`
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case EventPhaseStarted:
+		return fmt.Sprintf("[%s] Phase started", e.Phase)
+	case EventPhaseFinished:
+		if e.Error != "" {
+			return fmt.Sprintf("[%s] Phase failed after %.3fs: %s", e.Phase, e.Duration, e.Error)
+		}
+		return fmt.Sprintf("[%s] Phase finished in %.3fs", e.Phase, e.Duration)
+	case EventContainer:
+		return fmt.Sprintf("[%s] Container %s on host [%s]", e.Component, e.Action, e.Host)
+	case EventError:
+		return e.Error
+	}
+	return e.Message
+}
+
+// eventLogger is implemented by loggers that handle typed events, events sent to other loggers are logged as debug messages
+type eventLogger interface {
+	logger
+	Event(event Event)
+}
+
+// WithHost returns a context whose messages are reported for the host
+func WithHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, hostKey, host)
+}
+
+// WithComponent returns a context whose messages are reported for the component, e.g. a plane or a container
+func WithComponent(ctx context.Context, component string) context.Context {
+	return context.WithValue(ctx, componentKey, component)
+}
+
+// logf sends the message to the logger of the context, as a message event with the host and the component of the context when
+// the logger handles events
+func logf(ctx context.Context, level logrus.Level, msg string, args ...interface{}) {
+	l := getLogger(ctx)
+	el, ok := l.(eventLogger)
+	if !ok {
+		switch level {
+		case logrus.DebugLevel:
+			l.Debugf(msg, args...)
+		case logrus.WarnLevel:
+			l.Warnf(msg, args...)
+		default:
+			l.Infof(msg, args...)
+		}
+		return
+	}
+	if level == logrus.DebugLevel && !logrus.IsLevelEnabled(level) {
+		return
+	}
+	event := newMessageEvent(time.Now().UTC(), level, fmt.Sprintf(msg, args...))
+	event.Host, _ = ctx.Value(hostKey).(string)
+	event.Component, _ = ctx.Value(componentKey).(string)
+	el.Event(event)
+}
+
+// Emit sends the event to the logger of the context
+func Emit(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	l := getLogger(ctx)
+	if el, ok := l.(eventLogger); ok {
+		el.Event(event)
+		return
+	}
+	l.Debugf("%s", event)
+}
+
+// StartPhase emits a phase_started event and returns the function emitting the matching phase_finished event
+func StartPhase(ctx context.Context, phase string) func(err error) {
+	start := time.Now()
+	Emit(ctx, Event{Type: EventPhaseStarted, Phase: phase})
+	return func(err error) {
+		event := Event{Type: EventPhaseFinished, Phase: phase, Duration: time.Since(start).Seconds()}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		Emit(ctx, event)
+	}
+}
+
+// ContainerEvent emits a container event for an action done on a container of a host
+func ContainerEvent(ctx context.Context, host, containerName, action string) {
+	Emit(ctx, Event{Type: EventContainer, Host: host, Component: containerName, Action: action})
+}
+
+// EnableJSONOutput writes newline-delimited JSON events to w, both for the logger of the returned context and for messages
+// logged directly with logrus
+func EnableJSONOutput(ctx context.Context, w io.Writer) context.Context {
+	out := &syncWriter{w: w}
+	logrus.SetFormatter(&JSONFormatter{})
+	logrus.SetOutput(out)
+	return SetLogger(ctx, NewJSONLogger(out))
+}
+
+// JSONLogger is a logger writing every message and event as a JSON object on its own line
+type JSONLogger struct {
+	w io.Writer
+}
+
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w}
+}
+
+func (l *JSONLogger) Debugf(msg string, args ...interface{}) {
+	if logrus.IsLevelEnabled(logrus.DebugLevel) {
+		l.Event(newMessageEvent(time.Now().UTC(), logrus.DebugLevel, fmt.Sprintf(msg, args...)))
+	}
+}
+
+func (l *JSONLogger) Infof(msg string, args ...interface{}) {
+	l.Event(newMessageEvent(time.Now().UTC(), logrus.InfoLevel, fmt.Sprintf(msg, args...)))
+}
+
+func (l *JSONLogger) Warnf(msg string, args ...interface{}) {
+	l.Event(newMessageEvent(time.Now().UTC(), logrus.WarnLevel, fmt.Sprintf(msg, args...)))
+}
+
+func (l *JSONLogger) Event(event Event) {
+	data, err := marshalEvent(event)
+	if err != nil {
+		return
+	}
+	l.w.Write(data)
+}
+
+// JSONFormatter formats logrus entries as message events, errors and fatal errors are formatted as error events. The host and the
+// component are taken from the host and component fields of the entry.
+type JSONFormatter struct{}
+
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	event := newMessageEvent(entry.Time.UTC(), entry.Level, entry.Message)
+	event.Host, _ = entry.Data["host"].(string)
+	event.Component, _ = entry.Data["component"].(string)
+	if entry.Level <= logrus.ErrorLevel {
+		event.Type = EventError
+		event.Error = entry.Message
+		event.Message = ""
+	}
+	return marshalEvent(event)
+}
+
+func newMessageEvent(t time.Time, level logrus.Level, message string) Event {
+	return Event{
+		Time:    t,
+		Type:    EventMessage,
+		Level:   level.String(),
+		Message: strings.TrimSpace(message),
+	}
+}
+
+func marshalEvent(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// syncWriter serializes the writes of the JSON logger and of logrus so events are never interleaved
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var out bytes.Buffer
+	ctx := SetLogger(context.Background(), NewJSONLogger(&out))
+
+	Infof(WithComponent(WithHost(ctx, "10.0.0.1"), "etcd"), "[etcd] Successfully started [etcd] container on host [10.0.0.1]")
+	// the host and the component are not guessed from the message
+	Infof(ctx, "[etcd] Successfully started [etcd] container on host [10.0.0.3]")
+	phaseDone := StartPhase(ctx, "control-plane")
+	ContainerEvent(ctx, "10.0.0.2", "kube-apiserver", ContainerActionStarted)
+	phaseDone(errors.New("timeout"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 5)
+	var events []Event
+	for _, line := range lines {
+		var event Event
+		assert.Nil(t, json.Unmarshal([]byte(line), &event))
+		assert.False(t, event.Time.IsZero())
+		events = append(events, event)
+	}
+	assert.Equal(t, EventMessage, events[0].Type)
+	assert.Equal(t, "info", events[0].Level)
+	assert.Equal(t, "etcd", events[0].Component)
+	assert.Equal(t, "10.0.0.1", events[0].Host)
+	assert.Empty(t, events[1].Component)
+	assert.Empty(t, events[1].Host)
+	events = append(events[:1], events[2:]...)
+
+	assert.Equal(t, EventPhaseStarted, events[1].Type)
+	assert.Equal(t, "control-plane", events[1].Phase)
+
+	assert.Equal(t, EventContainer, events[2].Type)
+	assert.Equal(t, "10.0.0.2", events[2].Host)
+	assert.Equal(t, "kube-apiserver", events[2].Component)
+	assert.Equal(t, ContainerActionStarted, events[2].Action)
+
+	assert.Equal(t, EventPhaseFinished, events[3].Type)
+	assert.Equal(t, "control-plane", events[3].Phase)
+	assert.Equal(t, "timeout", events[3].Error)
+}
+
+func TestJSONFormatter(t *testing.T) {
+	entry := logrus.WithFields(logrus.Fields{"host": "10.0.0.1", "component": "etcd"})
+	entry.Time = time.Now()
+	entry.Level = logrus.InfoLevel
+	entry.Message = "Successfully started [etcd] container"
+	data, err := (&JSONFormatter{}).Format(entry)
+	assert.Nil(t, err)
+	var event Event
+	assert.Nil(t, json.Unmarshal(data, &event))
+	assert.Equal(t, EventMessage, event.Type)
+	assert.Equal(t, "10.0.0.1", event.Host)
+	assert.Equal(t, "etcd", event.Component)
+}
@@ -9,7 +9,9 @@ import (
 type logKey string
 
 const (
-	key logKey = "rke-logger"
+	key          logKey = "rke-logger"
+	hostKey      logKey = "rke-logger-host"
+	componentKey logKey = "rke-logger-component"
 )
 
 type logger interface {
@@ -31,13 +33,13 @@ func getLogger(ctx context.Context) logger {
 }
 
 func Infof(ctx context.Context, msg string, args ...interface{}) {
-	getLogger(ctx).Infof(msg, args...)
+	logf(ctx, logrus.InfoLevel, msg, args...)
 }
 
 func Warnf(ctx context.Context, msg string, args ...interface{}) {
-	getLogger(ctx).Warnf(msg, args...)
+	logf(ctx, logrus.WarnLevel, msg, args...)
 }
 
 func Debugf(ctx context.Context, msg string, args ...interface{}) {
-	getLogger(ctx).Debugf(msg, args...)
+	logf(ctx, logrus.DebugLevel, msg, args...)
 }
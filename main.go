@@ -56,6 +56,7 @@ func mainErr() error {
 	app.Email = ""
 	app.Commands = []cli.Command{
 		cmd.UpCommand(),
+		cmd.PlanCommand(),
 		cmd.RemoveCommand(),
 		cmd.VersionCommand(),
 		cmd.ConfigCommand(),
@@ -63,6 +64,9 @@ func mainErr() error {
 		cmd.CertificateCommand(),
 		cmd.EncryptionCommand(),
 		cmd.UtilCommand(),
+		cmd.AgentCommand(),
+		cmd.PreflightCommand(),
+		cmd.AuditCommand(),
 	}
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
@@ -17,7 +17,9 @@ limitations under the License.
 package cert
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -41,7 +43,7 @@ const (
 )
 
 // EncodePublicKeyPEM returns PEM-encoded public data
-func EncodePublicKeyPEM(key *rsa.PublicKey) ([]byte, error) {
+func EncodePublicKeyPEM(key crypto.PublicKey) ([]byte, error) {
 	der, err := x509.MarshalPKIXPublicKey(key)
 	if err != nil {
 		return []byte{}, err
@@ -53,11 +55,36 @@ func EncodePublicKeyPEM(key *rsa.PublicKey) ([]byte, error) {
 	return pem.EncodeToMemory(&block), nil
 }
 
-// EncodePrivateKeyPEM returns PEM-encoded private key data
-func EncodePrivateKeyPEM(key *rsa.PrivateKey) []byte {
-	block := pem.Block{
-		Type:  RSAPrivateKeyBlockType,
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
+// EncodePrivateKeyPEM returns PEM-encoded private key data. RSA keys are encoded in PKCS#1 format, ECDSA keys in
+// ASN.1 format and Ed25519 keys in PKCS#8 format, nil is returned for unsupported keys
+func EncodePrivateKeyPEM(key crypto.Signer) []byte {
+	var block pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = pem.Block{
+			Type:  RSAPrivateKeyBlockType,
+			Bytes: x509.MarshalPKCS1PrivateKey(k),
+		}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil
+		}
+		block = pem.Block{
+			Type:  ECPrivateKeyBlockType,
+			Bytes: der,
+		}
+	case ed25519.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil
+		}
+		block = pem.Block{
+			Type:  PrivateKeyBlockType,
+			Bytes: der,
+		}
+	default:
+		return nil
 	}
 	return pem.EncodeToMemory(&block)
 }
@@ -93,7 +120,7 @@ func ParsePrivateKeyPEM(keyData []byte) (interface{}, error) {
 				return key, nil
 			}
 		case PrivateKeyBlockType:
-			// RSA or ECDSA Private Key in unencrypted PKCS#8 format
+			// RSA, ECDSA or Ed25519 Private Key in unencrypted PKCS#8 format
 			if key, err := x509.ParsePKCS8PrivateKey(privateKeyPemBlock.Bytes); err == nil {
 				return key, nil
 			}
@@ -104,7 +131,7 @@ func ParsePrivateKeyPEM(keyData []byte) (interface{}, error) {
 	}
 
 	// we read all the PEM blocks and didn't recognize one
-	return nil, fmt.Errorf("data does not contain a valid RSA or ECDSA private key")
+	return nil, fmt.Errorf("data does not contain a valid RSA, ECDSA or Ed25519 private key")
 }
 
 // ParsePublicKeysPEM is a helper function for reading an array of rsa.PublicKey or ecdsa.PublicKey from a PEM-encoded byte array.
@@ -136,6 +163,16 @@ func ParsePublicKeysPEM(keyData []byte) ([]interface{}, error) {
 			keys = append(keys, publicKey)
 			continue
 		}
+		if privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			if signer, ok := privateKey.(crypto.Signer); ok {
+				keys = append(keys, signer.Public())
+				continue
+			}
+		}
+		if publicKey, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+			keys = append(keys, publicKey)
+			continue
+		}
 
 		// tolerate non-key PEM blocks for backwards compatibility
 		// originally, only the first PEM block was parsed and expected to be a key block
@@ -37,4 +37,12 @@ const (
 	KubeAdminOrganizationName = "system:masters"
 	KubeAdminConfigPrefix     = "kube_config_"
 	duration365d              = time.Hour * 24 * 365
+
+	// default validity of the generated CA and leaf certificates
+	defaultCertificateValidity = duration365d * 10
+
+	certTypeCA      = "ca"
+	certTypeServing = "serving"
+	certTypeClient  = "client"
+	certTypeEtcd    = "etcd"
 )
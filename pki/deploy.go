@@ -2,7 +2,7 @@ package pki
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"fmt"
 	"os"
 	"path"
@@ -295,7 +295,11 @@ func FetchCertificatesFromHost(ctx context.Context, extraHosts []*hosts.Host, ho
 			return nil, err
 		}
 		certificate.Certificate = parsedCert[0]
-		certificate.Key = parsedKey.(*rsa.PrivateKey)
+		signer, ok := parsedKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T for certificate %s", parsedKey, certName)
+		}
+		certificate.Key = signer
 		tmpCerts[certName] = certificate
 		logrus.Debugf("[certificates] Recovered certificate: %s", certName)
 	}
@@ -0,0 +1,123 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/pki/cert"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func getKeyAlgorithmTestConfig(algorithm string) v3.RancherKubernetesEngineConfig {
+	return v3.RancherKubernetesEngineConfig{
+		Nodes: []v3.RKEConfigNode{
+			{
+				Address:         "1.1.1.1",
+				InternalAddress: "192.168.1.5",
+				Role:            []string{"controlplane", "etcd", "worker"},
+			},
+		},
+		Services: v3.RKEConfigServices{
+			KubeAPI: v3.KubeAPIService{ServiceClusterIPRange: FakeClusterCidr},
+			Kubelet: v3.KubeletService{ClusterDomain: FakeClusterDomain},
+		},
+		Certificates: &v3.CertificatesConfig{KeyAlgorithm: algorithm},
+	}
+}
+
+func TestGenerateRKECertsKeyAlgorithm(t *testing.T) {
+	for _, algorithm := range cert.KeyAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			rkeConfig := getKeyAlgorithmTestConfig(algorithm)
+			certs, err := GenerateRKECerts(context.Background(), rkeConfig, "", "")
+			assert.NoError(t, err)
+
+			roots := x509.NewCertPool()
+			roots.AddCert(certs[CACertName].Certificate)
+			for _, name := range []string{CACertName, KubeAPICertName, KubeAdminCertName, GetCrtNameForHost(hosts.NodesToHosts(rkeConfig.Nodes, "")[0], EtcdCertName)} {
+				assert.Equal(t, algorithm, cert.GetKeyAlgorithm(certs[name].Key), name)
+			}
+			_, err = certs[KubeAPICertName].Certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+			assert.NoError(t, err)
+
+			// service account tokens can only be signed with RSA or ECDSA keys
+			switch certs[ServiceAccountTokenKeyName].Key.(type) {
+			case *rsa.PrivateKey, *ecdsa.PrivateKey:
+			default:
+				t.Fatalf("unsupported service account token key type %T", certs[ServiceAccountTokenKeyName].Key)
+			}
+			if algorithm == cert.KeyAlgorithmEd25519 {
+				_, ok := certs[KubeAPICertName].Key.(ed25519.PrivateKey)
+				assert.True(t, ok)
+			}
+
+			// keys survive the state file serialization
+			decoded := TransformPEMToObject(certs)
+			for name, certPKI := range certs {
+				if certPKI.Key == nil {
+					continue
+				}
+				assert.Equal(t, certPKI.KeyPEM, string(cert.EncodePrivateKeyPEM(decoded[name].Key)), name)
+			}
+		})
+	}
+}
+
+func TestGenerateRKEServicesCertsKeepsExistingKeys(t *testing.T) {
+	certs, err := GenerateRKECerts(context.Background(), getKeyAlgorithmTestConfig(cert.KeyAlgorithmRSA), "", "")
+	assert.NoError(t, err)
+
+	// changing the algorithm doesn't replace the keys of existing certificates
+	rkeConfig := getKeyAlgorithmTestConfig(cert.KeyAlgorithmECDSAP256)
+	assert.NoError(t, GenerateRKEServicesCerts(context.Background(), certs, rkeConfig, "", "", false))
+	assert.Equal(t, cert.KeyAlgorithmRSA, cert.GetKeyAlgorithm(certs[KubeAPICertName].Key))
+
+	// rotation generates keys with the configured algorithm
+	assert.NoError(t, GenerateRKEServicesCerts(context.Background(), certs, rkeConfig, "", "", true))
+	assert.Equal(t, cert.KeyAlgorithmECDSAP256, cert.GetKeyAlgorithm(certs[KubeAPICertName].Key))
+	assert.Equal(t, cert.KeyAlgorithmRSA, cert.GetKeyAlgorithm(certs[CACertName].Key))
+}
+
+func TestGenerateRKECertsValidity(t *testing.T) {
+	rkeConfig := getKeyAlgorithmTestConfig(cert.KeyAlgorithmRSA)
+	rkeConfig.Certificates.CAValidity = "8760h"
+	rkeConfig.Certificates.ServingValidity = "720h"
+	rkeConfig.Certificates.ClientValidity = "24h"
+	certs, err := GenerateRKECerts(context.Background(), rkeConfig, "", "")
+	assert.NoError(t, err)
+
+	for name, validity := range map[string]time.Duration{
+		CACertName:              8760 * time.Hour,
+		RequestHeaderCACertName: 8760 * time.Hour,
+		KubeAPICertName:         720 * time.Hour,
+		KubeAdminCertName:       24 * time.Hour,
+		// leaf certificates without a validity don't outlive the CA
+		GetCrtNameForHost(hosts.NodesToHosts(rkeConfig.Nodes, "")[0], EtcdCertName): 8760 * time.Hour,
+	} {
+		notAfter := certs[name].Certificate.NotAfter
+		assert.WithinDuration(t, time.Now().Add(validity), notAfter, time.Minute, name)
+	}
+}
+
+func TestGetServiceAccountTokenKey(t *testing.T) {
+	for _, algorithm := range cert.KeyAlgorithms {
+		kubeAPIKey, err := cert.NewPrivateKeyWithAlgorithm(algorithm)
+		assert.NoError(t, err)
+		tokenKey, err := GetServiceAccountTokenKey(kubeAPIKey)
+		assert.NoError(t, err)
+		if algorithm == cert.KeyAlgorithmEd25519 {
+			// Ed25519 keys can't sign service account tokens
+			assert.Equal(t, cert.KeyAlgorithmECDSAP256, cert.GetKeyAlgorithm(tokenKey))
+			continue
+		}
+		// the existing tokens were signed with the kube-apiserver key
+		assert.Equal(t, kubeAPIKey, tokenKey, algorithm)
+	}
+}
@@ -2,7 +2,7 @@ package pki
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"fmt"
 	"net"
@@ -18,9 +18,10 @@ import (
 
 type CertificatePKI struct {
 	Certificate    *x509.Certificate        `json:"-"`
-	Key            *rsa.PrivateKey          `json:"-"`
+	Key            crypto.Signer            `json:"-"`
 	CSR            *x509.CertificateRequest `json:"-"`
 	CertificatePEM string                   `json:"certificatePEM"`
+	ChainPEM       string                   `json:"chainPEM,omitempty"`
 	KeyPEM         string                   `json:"keyPEM"`
 	CSRPEM         string                   `json:"-"`
 	Config         string                   `json:"config"`
@@ -48,7 +49,7 @@ const (
 func GenerateRKECerts(ctx context.Context, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string) (map[string]CertificatePKI, error) {
 	certs := make(map[string]CertificatePKI)
 	// generate RKE CA certificates
-	if err := GenerateRKECACerts(ctx, certs, configPath, configDir); err != nil {
+	if err := GenerateRKECACerts(ctx, certs, rkeConfig, configPath, configDir); err != nil {
 		return certs, err
 	}
 	// Generating certificates for kubernetes components
@@ -82,15 +83,22 @@ func RegenerateEtcdCertificate(
 	etcdHost *hosts.Host,
 	etcdHosts []*hosts.Host,
 	clusterDomain string,
-	KubernetesServiceIP []net.IP) (map[string]CertificatePKI, error) {
+	KubernetesServiceIP []net.IP,
+	rkeConfig *v3.RancherKubernetesEngineConfig) (map[string]CertificatePKI, error) {
 
 	etcdName := GetCrtNameForHost(etcdHost, EtcdCertName)
 	log.Infof(ctx, "[certificates] Regenerating new %s certificate and key", etcdName)
-	caCrt := crtMap[CACertName].Certificate
-	caKey := crtMap[CACertName].Key
+	signer, err := getCertificateSigner(crtMap, rkeConfig)
+	if err != nil {
+		return nil, err
+	}
 	etcdAltNames := GetAltNames(etcdHosts, clusterDomain, KubernetesServiceIP, []string{})
 
-	etcdCrt, etcdKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, EtcdCertName, etcdAltNames, nil, nil)
+	etcdKey, err := getServiceKey(nil, rkeConfig, true)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate private key for %s certificate: %v", etcdName, err)
+	}
+	etcdCrt, etcdKey, err := GenerateSignedCertAndKey(ctx, signer, true, EtcdCertName, etcdAltNames, etcdKey, nil, getCertificateValidity(rkeConfig, certTypeEtcd))
 	if err != nil {
 		return nil, err
 	}
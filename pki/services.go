@@ -2,8 +2,9 @@ package pki
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
@@ -17,10 +18,9 @@ import (
 
 func GenerateKubeAPICertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate API certificate and key
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	kubernetesServiceIP, err := GetKubernetesServiceIP(rkeConfig.Services.KubeAPI.ServiceClusterIPRange)
 	if err != nil {
@@ -36,11 +36,11 @@ func GenerateKubeAPICertificate(ctx context.Context, certs map[string]Certificat
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kubernetes API server certificates")
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[KubeAPICertName].Key
+	serviceKey, err := getServiceKey(certs[KubeAPICertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	kubeAPICrt, kubeAPIKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, KubeAPICertName, kubeAPIAltNames, serviceKey, nil)
+	kubeAPICrt, kubeAPIKey, err := GenerateSignedCertAndKey(ctx, signer, true, KubeAPICertName, kubeAPIAltNames, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeServing))
 	if err != nil {
 		return err
 	}
@@ -49,7 +49,15 @@ func GenerateKubeAPICertificate(ctx context.Context, certs map[string]Certificat
 	apiCert := certs[KubeAPICertName]
 	if certs[ServiceAccountTokenKeyName].Key == nil {
 		logrus.Info("[certificates] Generating Service account token key")
-		certs[ServiceAccountTokenKeyName] = ToCertObject(ServiceAccountTokenKeyName, ServiceAccountTokenKeyName, "", apiCert.Certificate, apiCert.Key, nil)
+		tokenKey, err := GetServiceAccountTokenKey(apiCert.Key)
+		if err != nil {
+			return err
+		}
+		tokenCrt := apiCert.Certificate
+		if tokenKey != apiCert.Key {
+			tokenCrt = nil
+		}
+		certs[ServiceAccountTokenKeyName] = ToCertObject(ServiceAccountTokenKeyName, ServiceAccountTokenKeyName, "", tokenCrt, tokenKey, nil)
 	}
 	return nil
 }
@@ -71,7 +79,11 @@ func GenerateKubeAPICSR(ctx context.Context, certs map[string]CertificatePKI, rk
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kubernetes API server csr")
-	kubeAPICSR, kubeAPIKey, err := GenerateCertSigningRequestAndKey(true, KubeAPICertName, kubeAPIAltNames, certs[KubeAPICertName].Key, nil)
+	csrKey, err := getServiceKey(certs[KubeAPICertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	kubeAPICSR, kubeAPIKey, err := GenerateCertSigningRequestAndKey(true, KubeAPICertName, kubeAPIAltNames, csrKey, nil)
 	if err != nil {
 		return err
 	}
@@ -81,20 +93,19 @@ func GenerateKubeAPICSR(ctx context.Context, certs map[string]CertificatePKI, rk
 
 func GenerateKubeControllerCertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate Kube controller-manager certificate and key
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	if certs[KubeControllerCertName].Certificate != nil && !rotate {
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kube Controller certificates")
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[KubeControllerCertName].Key
+	serviceKey, err := getServiceKey(certs[KubeControllerCertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	kubeControllerCrt, kubeControllerKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeControllerCertName), nil, serviceKey, nil)
+	kubeControllerCrt, kubeControllerKey, err := GenerateSignedCertAndKey(ctx, signer, false, getDefaultCN(KubeControllerCertName), nil, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return err
 	}
@@ -110,7 +121,11 @@ func GenerateKubeControllerCSR(ctx context.Context, certs map[string]Certificate
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kube Controller csr")
-	kubeControllerCSR, kubeControllerKey, err := GenerateCertSigningRequestAndKey(false, getDefaultCN(KubeControllerCertName), nil, certs[KubeControllerCertName].Key, nil)
+	csrKey, err := getServiceKey(certs[KubeControllerCertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	kubeControllerCSR, kubeControllerKey, err := GenerateCertSigningRequestAndKey(false, getDefaultCN(KubeControllerCertName), nil, csrKey, nil)
 	if err != nil {
 		return err
 	}
@@ -120,20 +135,19 @@ func GenerateKubeControllerCSR(ctx context.Context, certs map[string]Certificate
 
 func GenerateKubeSchedulerCertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate Kube scheduler certificate and key
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	if certs[KubeSchedulerCertName].Certificate != nil && !rotate {
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kube Scheduler certificates")
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[KubeSchedulerCertName].Key
+	serviceKey, err := getServiceKey(certs[KubeSchedulerCertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	kubeSchedulerCrt, kubeSchedulerKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeSchedulerCertName), nil, serviceKey, nil)
+	kubeSchedulerCrt, kubeSchedulerKey, err := GenerateSignedCertAndKey(ctx, signer, false, getDefaultCN(KubeSchedulerCertName), nil, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return err
 	}
@@ -149,7 +163,11 @@ func GenerateKubeSchedulerCSR(ctx context.Context, certs map[string]CertificateP
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kube Scheduler csr")
-	kubeSchedulerCSR, kubeSchedulerKey, err := GenerateCertSigningRequestAndKey(false, getDefaultCN(KubeSchedulerCertName), nil, certs[KubeSchedulerCertName].Key, nil)
+	csrKey, err := getServiceKey(certs[KubeSchedulerCertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	kubeSchedulerCSR, kubeSchedulerKey, err := GenerateCertSigningRequestAndKey(false, getDefaultCN(KubeSchedulerCertName), nil, csrKey, nil)
 	if err != nil {
 		return err
 	}
@@ -159,20 +177,19 @@ func GenerateKubeSchedulerCSR(ctx context.Context, certs map[string]CertificateP
 
 func GenerateKubeProxyCertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate Kube Proxy certificate and key
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	if certs[KubeProxyCertName].Certificate != nil && !rotate {
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kube Proxy certificates")
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[KubeProxyCertName].Key
+	serviceKey, err := getServiceKey(certs[KubeProxyCertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	kubeProxyCrt, kubeProxyKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeProxyCertName), nil, serviceKey, nil)
+	kubeProxyCrt, kubeProxyKey, err := GenerateSignedCertAndKey(ctx, signer, false, getDefaultCN(KubeProxyCertName), nil, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return err
 	}
@@ -188,7 +205,11 @@ func GenerateKubeProxyCSR(ctx context.Context, certs map[string]CertificatePKI,
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kube Proxy csr")
-	kubeProxyCSR, kubeProxyKey, err := GenerateCertSigningRequestAndKey(false, getDefaultCN(KubeProxyCertName), nil, certs[KubeProxyCertName].Key, nil)
+	csrKey, err := getServiceKey(certs[KubeProxyCertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	kubeProxyCSR, kubeProxyKey, err := GenerateCertSigningRequestAndKey(false, getDefaultCN(KubeProxyCertName), nil, csrKey, nil)
 	if err != nil {
 		return err
 	}
@@ -198,20 +219,19 @@ func GenerateKubeProxyCSR(ctx context.Context, certs map[string]CertificatePKI,
 
 func GenerateKubeNodeCertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate kubelet certificate
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	if certs[KubeNodeCertName].Certificate != nil && !rotate {
 		return nil
 	}
 	logrus.Info("[certificates] Generating Node certificate")
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[KubeProxyCertName].Key
+	serviceKey, err := getServiceKey(certs[KubeProxyCertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	nodeCrt, nodeKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, KubeNodeCommonName, nil, serviceKey, []string{KubeNodeOrganizationName})
+	nodeCrt, nodeKey, err := GenerateSignedCertAndKey(ctx, signer, false, KubeNodeCommonName, nil, serviceKey, []string{KubeNodeOrganizationName}, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return err
 	}
@@ -227,7 +247,11 @@ func GenerateKubeNodeCSR(ctx context.Context, certs map[string]CertificatePKI, r
 		return nil
 	}
 	logrus.Info("[certificates] Generating Node csr and key")
-	nodeCSR, nodeKey, err := GenerateCertSigningRequestAndKey(false, KubeNodeCommonName, nil, certs[KubeNodeCertName].Key, []string{KubeNodeOrganizationName})
+	csrKey, err := getServiceKey(certs[KubeNodeCertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	nodeCSR, nodeKey, err := GenerateCertSigningRequestAndKey(false, KubeNodeCommonName, nil, csrKey, []string{KubeNodeOrganizationName})
 	if err != nil {
 		return err
 	}
@@ -238,31 +262,30 @@ func GenerateKubeNodeCSR(ctx context.Context, certs map[string]CertificatePKI, r
 func GenerateKubeAdminCertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate Admin certificate and key
 	logrus.Info("[certificates] Generating admin certificates and kubeconfig")
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	cpHosts := hosts.NodesToHosts(rkeConfig.Nodes, controlRole)
 	if len(configPath) == 0 {
 		configPath = ClusterConfig
 	}
 	localKubeConfigPath := GetLocalKubeConfig(configPath, configDir)
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[KubeAdminCertName].Key
+	serviceKey, err := getServiceKey(certs[KubeAdminCertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	kubeAdminCrt, kubeAdminKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, KubeAdminCertName, nil, serviceKey, []string{KubeAdminOrganizationName})
+	kubeAdminCrt, kubeAdminKey, err := GenerateSignedCertAndKey(ctx, signer, false, KubeAdminCertName, nil, serviceKey, []string{KubeAdminOrganizationName}, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return err
 	}
 	kubeAdminCertObj := ToCertObject(KubeAdminCertName, KubeAdminCertName, KubeAdminOrganizationName, kubeAdminCrt, kubeAdminKey, nil)
 	if len(cpHosts) > 0 {
 		kubeAdminConfig := GetKubeConfigX509WithData(
-			"https://"+cpHosts[0].Address+":6443",
+			"https://"+net.JoinHostPort(cpHosts[0].Address, "6443"),
 			rkeConfig.ClusterName,
 			KubeAdminCertName,
-			string(cert.EncodeCertPEM(caCrt)),
+			GetCACertsPEM(certs),
 			string(cert.EncodeCertPEM(kubeAdminCrt)),
 			string(cert.EncodePrivateKeyPEM(kubeAdminKey)))
 		kubeAdminCertObj.Config = kubeAdminConfig
@@ -281,7 +304,11 @@ func GenerateKubeAdminCSR(ctx context.Context, certs map[string]CertificatePKI,
 	if kubeAdminCSRPEM != "" {
 		return nil
 	}
-	kubeAdminCSR, kubeAdminKey, err := GenerateCertSigningRequestAndKey(false, KubeAdminCertName, nil, certs[KubeAdminCertName].Key, []string{KubeAdminOrganizationName})
+	csrKey, err := getServiceKey(certs[KubeAdminCertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	kubeAdminCSR, kubeAdminKey, err := GenerateCertSigningRequestAndKey(false, KubeAdminCertName, nil, csrKey, []string{KubeAdminOrganizationName})
 	if err != nil {
 		return err
 	}
@@ -298,15 +325,16 @@ func GenerateAPIProxyClientCertificate(ctx context.Context, certs map[string]Cer
 	if caCrt == nil || caKey == nil {
 		return fmt.Errorf("Request Header CA Certificate or Key is empty")
 	}
+	signer := NewCASigner(caCrt, caKey)
 	if certs[APIProxyClientCertName].Certificate != nil && !rotate {
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kubernetes API server proxy client certificates")
-	var serviceKey *rsa.PrivateKey
-	if !rotate {
-		serviceKey = certs[APIProxyClientCertName].Key
+	serviceKey, err := getServiceKey(certs[APIProxyClientCertName].Key, &rkeConfig, rotate)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
 	}
-	apiserverProxyClientCrt, apiserverProxyClientKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, APIProxyClientCertName, nil, serviceKey, nil)
+	apiserverProxyClientCrt, apiserverProxyClientKey, err := GenerateSignedCertAndKey(ctx, signer, true, APIProxyClientCertName, nil, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return err
 	}
@@ -322,7 +350,11 @@ func GenerateAPIProxyClientCSR(ctx context.Context, certs map[string]Certificate
 		return nil
 	}
 	logrus.Info("[certificates] Generating Kubernetes API server proxy client csr")
-	apiserverProxyClientCSR, apiserverProxyClientKey, err := GenerateCertSigningRequestAndKey(true, APIProxyClientCertName, nil, certs[APIProxyClientCertName].Key, nil)
+	csrKey, err := getServiceKey(certs[APIProxyClientCertName].Key, &rkeConfig, false)
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key: %v", err)
+	}
+	apiserverProxyClientCSR, apiserverProxyClientKey, err := GenerateCertSigningRequestAndKey(true, APIProxyClientCertName, nil, csrKey, nil)
 	if err != nil {
 		return err
 	}
@@ -339,7 +371,11 @@ func GenerateExternalEtcdCertificates(ctx context.Context, certs map[string]Cert
 	if err != nil {
 		return err
 	}
-	certs[EtcdClientCertName] = ToCertObject(EtcdClientCertName, "", "", clientCert[0], clientKey.(*rsa.PrivateKey), nil)
+	clientSigner, ok := clientKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported external etcd key type %T", clientKey)
+	}
+	certs[EtcdClientCertName] = ToCertObject(EtcdClientCertName, "", "", clientCert[0], clientSigner, nil)
 
 	caCert, err := cert.ParseCertsPEM([]byte(rkeConfig.Services.Etcd.CACert))
 	if err != nil {
@@ -350,10 +386,9 @@ func GenerateExternalEtcdCertificates(ctx context.Context, certs map[string]Cert
 }
 
 func GenerateEtcdCertificates(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	kubernetesServiceIP, err := GetKubernetesServiceIP(rkeConfig.Services.KubeAPI.ServiceClusterIPRange)
 	if err != nil {
@@ -393,12 +428,12 @@ func GenerateEtcdCertificates(ctx context.Context, certs map[string]CertificateP
 				}
 			}
 		}
-		var serviceKey *rsa.PrivateKey
-		if !rotate {
-			serviceKey = certs[etcdName].Key
+		serviceKey, err := getServiceKey(certs[etcdName].Key, &rkeConfig, rotate)
+		if err != nil {
+			return fmt.Errorf("Failed to generate private key: %v", err)
 		}
 		logrus.Infof("[certificates] Generating %s certificate and key", etcdName)
-		etcdCrt, etcdKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, EtcdCertName, etcdAltNames, serviceKey, nil)
+		etcdCrt, etcdKey, err := GenerateSignedCertAndKey(ctx, signer, true, EtcdCertName, etcdAltNames, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeEtcd))
 		if err != nil {
 			return err
 		}
@@ -427,7 +462,11 @@ func GenerateEtcdCSRs(ctx context.Context, certs map[string]CertificatePKI, rkeC
 			}
 		}
 		logrus.Infof("[certificates] Generating etcd-%s csr and key", host.InternalAddress)
-		etcdCSR, etcdKey, err := GenerateCertSigningRequestAndKey(true, EtcdCertName, etcdAltNames, certs[etcdName].Key, nil)
+		csrKey, err := getServiceKey(certs[etcdName].Key, &rkeConfig, false)
+		if err != nil {
+			return fmt.Errorf("Failed to generate private key: %v", err)
+		}
+		etcdCSR, etcdKey, err := GenerateCertSigningRequestAndKey(true, EtcdCertName, etcdAltNames, csrKey, nil)
 		if err != nil {
 			return err
 		}
@@ -439,19 +478,22 @@ func GenerateEtcdCSRs(ctx context.Context, certs map[string]CertificatePKI, rkeC
 func GenerateServiceTokenKey(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate service account token key
 	privateAPIKey := certs[ServiceAccountTokenKeyName].Key
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	if certs[ServiceAccountTokenKeyName].Certificate != nil {
 		return nil
 	}
 	// handle rotation on old clusters
 	if certs[ServiceAccountTokenKeyName].Key == nil {
-		privateAPIKey = certs[KubeAPICertName].Key
+		tokenKey, err := GetServiceAccountTokenKey(certs[KubeAPICertName].Key)
+		if err != nil {
+			return err
+		}
+		privateAPIKey = tokenKey
 	}
-	tokenCrt, tokenKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, ServiceAccountTokenKeyName, nil, privateAPIKey, nil)
+	tokenCrt, tokenKey, err := GenerateSignedCertAndKey(ctx, signer, false, ServiceAccountTokenKeyName, nil, privateAPIKey, nil, getCertificateValidity(&rkeConfig, certTypeClient))
 	if err != nil {
 		return fmt.Errorf("Failed to generate private key for service account token: %v", err)
 	}
@@ -459,18 +501,43 @@ func GenerateServiceTokenKey(ctx context.Context, certs map[string]CertificatePK
 	return nil
 }
 
-func GenerateRKECACerts(ctx context.Context, certs map[string]CertificatePKI, configPath, configDir string) error {
-	if err := GenerateRKEMasterCACert(ctx, certs, configPath, configDir); err != nil {
+func GenerateRKECACerts(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string) error {
+	if err := GenerateRKEMasterCACert(ctx, certs, rkeConfig, configPath, configDir); err != nil {
 		return err
 	}
-	return GenerateRKERequestHeaderCACert(ctx, certs, configPath, configDir)
+	return GenerateRKERequestHeaderCACert(ctx, certs, rkeConfig, configPath, configDir)
 }
 
-func GenerateRKEMasterCACert(ctx context.Context, certs map[string]CertificatePKI, configPath, configDir string) error {
+func GenerateRKEMasterCACert(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string) error {
+	if rkeConfig.Certificates != nil && rkeConfig.Certificates.IntermediateCA != nil {
+		logrus.Info("[certificates] Using intermediate CA as CA kubernetes certificates")
+		caCrt, chain, caKey, err := ParseIntermediateCA(rkeConfig.Certificates.IntermediateCA)
+		if err != nil {
+			return err
+		}
+		caCert := ToCertObject(CACertName, "", "", caCrt, caKey, nil)
+		caCert.ChainPEM = encodeCertsPEM(chain)
+		certs[CACertName] = caCert
+		return nil
+	}
+	if rkeConfig.Certificates != nil && rkeConfig.Certificates.Vault != nil {
+		logrus.Info("[certificates] Getting CA kubernetes certificates from Vault")
+		chain, err := GetVaultCAChain(ctx, rkeConfig.Certificates.Vault)
+		if err != nil {
+			return err
+		}
+		caCert := ToCertObject(CACertName, "", "", chain[0], nil, nil)
+		caCert.ChainPEM = encodeCertsPEM(chain[1:])
+		certs[CACertName] = caCert
+		return nil
+	}
 	// generate kubernetes CA certificate and key
 	logrus.Info("[certificates] Generating CA kubernetes certificates")
-
-	caCrt, caKey, err := GenerateCACertAndKey(CACertName, nil)
+	caKey, err := cert.NewPrivateKeyWithAlgorithm(getKeyAlgorithm(&rkeConfig))
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key for CA certificate: %v", err)
+	}
+	caCrt, caKey, err := GenerateCACertAndKey(CACertName, caKey, getCertificateValidity(&rkeConfig, certTypeCA))
 	if err != nil {
 		return err
 	}
@@ -478,10 +545,14 @@ func GenerateRKEMasterCACert(ctx context.Context, certs map[string]CertificatePK
 	return nil
 }
 
-func GenerateRKERequestHeaderCACert(ctx context.Context, certs map[string]CertificatePKI, configPath, configDir string) error {
+func GenerateRKERequestHeaderCACert(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string) error {
 	// generate request header client CA certificate and key
 	logrus.Info("[certificates] Generating Kubernetes API server aggregation layer requestheader client CA certificates")
-	requestHeaderCACrt, requestHeaderCAKey, err := GenerateCACertAndKey(RequestHeaderCACertName, nil)
+	requestHeaderCAKey, err := cert.NewPrivateKeyWithAlgorithm(getKeyAlgorithm(&rkeConfig))
+	if err != nil {
+		return fmt.Errorf("Failed to generate private key for CA certificate: %v", err)
+	}
+	requestHeaderCACrt, requestHeaderCAKey, err := GenerateCACertAndKey(RequestHeaderCACertName, requestHeaderCAKey, getCertificateValidity(&rkeConfig, certTypeCA))
 	if err != nil {
 		return err
 	}
@@ -491,10 +562,9 @@ func GenerateRKERequestHeaderCACert(ctx context.Context, certs map[string]Certif
 
 func GenerateKubeletCertificate(ctx context.Context, certs map[string]CertificatePKI, rkeConfig v3.RancherKubernetesEngineConfig, configPath, configDir string, rotate bool) error {
 	// generate kubelet certificate and key
-	caCrt := certs[CACertName].Certificate
-	caKey := certs[CACertName].Key
-	if caCrt == nil || caKey == nil {
-		return fmt.Errorf("CA Certificate or Key is empty")
+	signer, err := getCertificateSigner(certs, &rkeConfig)
+	if err != nil {
+		return err
 	}
 	log.Debugf(ctx, "[certificates] Generating Kubernetes Kubelet certificates")
 	allHosts := hosts.NodesToHosts(rkeConfig.Nodes, "")
@@ -510,12 +580,12 @@ func GenerateKubeletCertificate(ctx context.Context, certs map[string]Certificat
 			DeepEqualIPsAltNames(kubeletAltNames.IPs, kubeletCert.IPAddresses) && !rotate {
 			continue
 		}
-		var serviceKey *rsa.PrivateKey
-		if !rotate {
-			serviceKey = certs[kubeletName].Key
+		serviceKey, err := getServiceKey(certs[kubeletName].Key, &rkeConfig, rotate)
+		if err != nil {
+			return fmt.Errorf("Failed to generate private key: %v", err)
 		}
 		log.Debugf(ctx, "[certificates] Generating %s certificate and key", kubeletName)
-		kubeletCrt, kubeletKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, kubeletName, kubeletAltNames, serviceKey, nil)
+		kubeletCrt, kubeletKey, err := GenerateSignedCertAndKey(ctx, signer, true, kubeletName, kubeletAltNames, serviceKey, nil, getCertificateValidity(&rkeConfig, certTypeServing))
 		if err != nil {
 			return err
 		}
@@ -538,7 +608,11 @@ func GenerateKubeletCSR(ctx context.Context, certs map[string]CertificatePKI, rk
 			continue
 		}
 		logrus.Infof("[certificates] Generating %s Kubernetes Kubelet csr", kubeletName)
-		kubeletCSR, kubeletKey, err := GenerateCertSigningRequestAndKey(true, kubeletName, kubeletAltNames, certs[kubeletName].Key, nil)
+		csrKey, err := getServiceKey(certs[kubeletName].Key, &rkeConfig, false)
+		if err != nil {
+			return fmt.Errorf("Failed to generate private key: %v", err)
+		}
+		kubeletCSR, kubeletKey, err := GenerateCertSigningRequestAndKey(true, kubeletName, kubeletAltNames, csrKey, nil)
 		if err != nil {
 			return err
 		}
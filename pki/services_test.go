@@ -2,6 +2,7 @@ package pki
 
 import (
 	"context"
+	"net"
 	"reflect"
 	"testing"
 
@@ -141,3 +142,14 @@ func TestDeleteUnusedCerts(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAltNamesIPv6(t *testing.T) {
+	cpHosts := []*hosts.Host{{RKEConfigNode: v3.RKEConfigNode{Address: "192.168.1.10", InternalAddress: "192.168.1.10"}}}
+	altNames := GetAltNames(cpHosts, "cluster.local", []net.IP{net.ParseIP("10.43.0.1")}, nil)
+	assert.NotContains(t, altNames.IPs, net.IPv6loopback)
+
+	cpHosts[0].Address, cpHosts[0].InternalAddress = "fd00::10", "fd00::10"
+	altNames = GetAltNames(cpHosts, "cluster.local", []net.IP{net.ParseIP("fd00:43::1")}, nil)
+	assert.Contains(t, altNames.IPs, net.IPv6loopback)
+	assert.Contains(t, altNames.IPs, net.ParseIP("fd00::10"))
+}
@@ -0,0 +1,266 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/rke/pki/cert"
+	v3 "github.com/rancher/rke/types"
+)
+
+const (
+	DefaultVaultMount = "pki"
+	vaultTokenEnv     = "VAULT_TOKEN"
+	vaultTimeout      = 30 * time.Second
+)
+
+// Signer issues the certificates of the cluster components
+type Signer interface {
+	// Sign returns a certificate for the public key of key issued with the given configuration
+	Sign(ctx context.Context, cfg cert.Config, key crypto.Signer) (*x509.Certificate, error)
+}
+
+type caSigner struct {
+	caCert *x509.Certificate
+	caKey  crypto.Signer
+}
+
+// NewCASigner returns a signer issuing certificates with a CA certificate and key held by RKE
+func NewCASigner(caCert *x509.Certificate, caKey crypto.Signer) Signer {
+	return &caSigner{caCert: caCert, caKey: caKey}
+}
+
+func (s *caSigner) Sign(ctx context.Context, cfg cert.Config, key crypto.Signer) (*x509.Certificate, error) {
+	return newSignedCert(cfg, key, s.caCert, s.caKey)
+}
+
+type vaultSigner struct {
+	config v3.VaultSignerConfig
+	caCert *x509.Certificate
+	client *http.Client
+}
+
+// NewVaultSigner returns a signer issuing certificates with the sign-verbatim endpoint of a Vault PKI secrets engine,
+// the certificates must be issued by caCert
+func NewVaultSigner(config *v3.VaultSignerConfig, caCert *x509.Certificate) (Signer, error) {
+	client, err := newVaultClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultSigner{config: *config, caCert: caCert, client: client}, nil
+}
+
+func (s *vaultSigner) Sign(ctx context.Context, cfg cert.Config, key crypto.Signer) (*x509.Certificate, error) {
+	csrDER, err := x509.CreateCertificateRequest(cryptorand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   cfg.CommonName,
+			Organization: cfg.Organization,
+		},
+		DNSNames:    cfg.AltNames.DNSNames,
+		IPAddresses: cfg.AltNames.IPs,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate csr for %s certificate: %v", cfg.CommonName, err)
+	}
+	keyUsages := []string{"DigitalSignature"}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		keyUsages = append(keyUsages, "KeyEncipherment")
+	}
+	extKeyUsages := []string{}
+	for _, usage := range cfg.Usages {
+		switch usage {
+		case x509.ExtKeyUsageServerAuth:
+			extKeyUsages = append(extKeyUsages, "ServerAuth")
+		case x509.ExtKeyUsageClientAuth:
+			extKeyUsages = append(extKeyUsages, "ClientAuth")
+		}
+	}
+	request := map[string]interface{}{
+		"csr":           string(pem.EncodeToMemory(&pem.Block{Type: cert.CertificateRequestBlockType, Bytes: csrDER})),
+		"format":        "pem",
+		"key_usage":     keyUsages,
+		"ext_key_usage": extKeyUsages,
+	}
+	if cfg.Validity > 0 {
+		request["ttl"] = cfg.Validity.String()
+	}
+	signPath := "sign-verbatim"
+	if s.config.Role != "" {
+		signPath = "sign-verbatim/" + s.config.Role
+	}
+	var response struct {
+		Data struct {
+			Certificate string `json:"certificate"`
+		} `json:"data"`
+	}
+	if err := doVaultRequest(ctx, s.client, &s.config, http.MethodPost, signPath, request, &response); err != nil {
+		return nil, fmt.Errorf("failed to sign %s certificate with Vault: %v", cfg.CommonName, err)
+	}
+	certs, err := cert.ParseCertsPEM([]byte(response.Data.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s certificate signed by Vault: %v", cfg.CommonName, err)
+	}
+	if err := certs[0].CheckSignatureFrom(s.caCert); err != nil {
+		return nil, fmt.Errorf("%s certificate signed by Vault is not issued by the cluster CA, rotate the CA certificates to switch the cluster CA to Vault: %v", cfg.CommonName, err)
+	}
+	return certs[0], nil
+}
+
+// GetVaultCAChain returns the CA chain of a Vault PKI secrets engine, the issuing CA first
+func GetVaultCAChain(ctx context.Context, config *v3.VaultSignerConfig) ([]*x509.Certificate, error) {
+	client, err := newVaultClient(config)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Data struct {
+			CAChain     string `json:"ca_chain"`
+			Certificate string `json:"certificate"`
+		} `json:"data"`
+	}
+	if err := doVaultRequest(ctx, client, config, http.MethodGet, "cert/ca_chain", nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to get CA chain from Vault: %v", err)
+	}
+	chainPEM := response.Data.CAChain
+	if chainPEM == "" {
+		chainPEM = response.Data.Certificate
+	}
+	chain, err := cert.ParseCertsPEM([]byte(chainPEM))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA chain from Vault: %v", err)
+	}
+	return chain, nil
+}
+
+func newVaultClient(config *v3.VaultSignerConfig) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+	if config.CACert != "" {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM([]byte(config.CACert)) {
+			return nil, fmt.Errorf("failed to parse Vault CA certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+	return &http.Client{Transport: transport, Timeout: vaultTimeout}, nil
+}
+
+func doVaultRequest(ctx context.Context, client *http.Client, config *v3.VaultSignerConfig, method, path string, request, response interface{}) error {
+	mount := config.Mount
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s", strings.TrimSuffix(config.Address, "/"), strings.Trim(mount, "/"), path)
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	token := config.Token
+	if token == "" {
+		token = os.Getenv(vaultTokenEnv)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", config.Namespace)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(data, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("%s %s returned %d: %s", method, url, resp.StatusCode, strings.Join(vaultErr.Errors, ", "))
+		}
+		return fmt.Errorf("%s %s returned %d", method, url, resp.StatusCode)
+	}
+	return json.Unmarshal(data, response)
+}
+
+// ParseIntermediateCA returns the intermediate CA certificate, the certificates of its issuers and its private key
+func ParseIntermediateCA(config *v3.IntermediateCAConfig) (*x509.Certificate, []*x509.Certificate, crypto.Signer, error) {
+	certs, err := cert.ParseCertsPEM([]byte(config.Certificate))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse intermediate CA certificate: %v", err)
+	}
+	if !certs[0].IsCA {
+		return nil, nil, nil, fmt.Errorf("intermediate CA certificate [%s] is not a CA certificate", certs[0].Subject.CommonName)
+	}
+	parsedKey, err := cert.ParsePrivateKeyPEM([]byte(config.Key))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse intermediate CA key: %v", err)
+	}
+	key, ok := parsedKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported intermediate CA key type %T", parsedKey)
+	}
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certs[0].PublicKey) {
+		return nil, nil, nil, fmt.Errorf("intermediate CA key doesn't match the intermediate CA certificate")
+	}
+	for i := 1; i < len(certs); i++ {
+		if err := certs[i-1].CheckSignatureFrom(certs[i]); err != nil {
+			return nil, nil, nil, fmt.Errorf("intermediate CA chain is invalid, certificate [%s] is not issued by [%s]: %v", certs[i-1].Subject.CommonName, certs[i].Subject.CommonName, err)
+		}
+	}
+	return certs[0], certs[1:], key, nil
+}
+
+func encodeCertsPEM(certs []*x509.Certificate) string {
+	var certsPEM string
+	for _, crt := range certs {
+		certsPEM += string(cert.EncodeCertPEM(crt))
+	}
+	return certsPEM
+}
+
+// getCertificateSigner returns the signer of the certificates issued by the cluster CA
+func getCertificateSigner(certs map[string]CertificatePKI, rkeConfig *v3.RancherKubernetesEngineConfig) (Signer, error) {
+	caCrt := certs[CACertName].Certificate
+	caKey := certs[CACertName].Key
+	if rkeConfig.Certificates != nil && rkeConfig.Certificates.Vault != nil {
+		if caCrt == nil {
+			return nil, fmt.Errorf("CA Certificate is empty")
+		}
+		return NewVaultSigner(rkeConfig.Certificates.Vault, caCrt)
+	}
+	if caCrt == nil || caKey == nil {
+		return nil, fmt.Errorf("CA Certificate or Key is empty")
+	}
+	return NewCASigner(caCrt, caKey), nil
+}
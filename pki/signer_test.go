@@ -0,0 +1,210 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/rke/pki/cert"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeVaultToken = "s.fake"
+
+func newTestIntermediateCA(t *testing.T, rootCrt *x509.Certificate, rootKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := cert.NewPrivateKeyWithAlgorithm(cert.KeyAlgorithmECDSAP256)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(duration365d),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, tmpl, rootCrt, key.Public(), rootKey)
+	assert.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return crt, key
+}
+
+// newFakeVault returns a server implementing the ca_chain and sign-verbatim endpoints of a Vault PKI secrets engine
+func newFakeVault(t *testing.T, caChain []*x509.Certificate, caKey crypto.Signer) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != fakeVaultToken {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/pki/cert/ca_chain":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ca_chain": encodeCertsPEM(caChain)}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/pki/sign-verbatim/rke":
+			var request struct {
+				CSR          string   `json:"csr"`
+				TTL          string   `json:"ttl"`
+				ExtKeyUsages []string `json:"ext_key_usage"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			block, _ := pem.Decode([]byte(request.CSR))
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			assert.NoError(t, err)
+			cfg := cert.Config{
+				CommonName:   csr.Subject.CommonName,
+				Organization: csr.Subject.Organization,
+				AltNames:     cert.AltNames{DNSNames: csr.DNSNames, IPs: csr.IPAddresses},
+			}
+			cfg.Validity, _ = time.ParseDuration(request.TTL)
+			for _, usage := range request.ExtKeyUsages {
+				if usage == "ServerAuth" {
+					cfg.Usages = append(cfg.Usages, x509.ExtKeyUsageServerAuth)
+				} else if usage == "ClientAuth" {
+					cfg.Usages = append(cfg.Usages, x509.ExtKeyUsageClientAuth)
+				}
+			}
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      csr.Subject,
+				DNSNames:     cfg.AltNames.DNSNames,
+				IPAddresses:  cfg.AltNames.IPs,
+				NotBefore:    time.Now(),
+				NotAfter:     time.Now().Add(cfg.Validity),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  cfg.Usages,
+			}
+			der, err := x509.CreateCertificate(cryptorand.Reader, tmpl, caChain[0], csr.PublicKey, caKey)
+			assert.NoError(t, err)
+			crt, _ := x509.ParseCertificate(der)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"certificate": string(cert.EncodeCertPEM(crt))}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGenerateRKECertsIntermediateCA(t *testing.T) {
+	rootCrt, rootKey, err := GenerateCACertAndKey("root-ca", nil, 0)
+	assert.NoError(t, err)
+	intermediateCrt, intermediateKey := newTestIntermediateCA(t, rootCrt, rootKey)
+
+	rkeConfig := getKeyAlgorithmTestConfig(cert.KeyAlgorithmRSA)
+	rkeConfig.Certificates.IntermediateCA = &v3.IntermediateCAConfig{
+		Certificate: encodeCertsPEM([]*x509.Certificate{intermediateCrt, rootCrt}),
+		Key:         string(cert.EncodePrivateKeyPEM(intermediateKey)),
+	}
+	certs, err := GenerateRKECerts(context.Background(), rkeConfig, "", "")
+	assert.NoError(t, err)
+	assert.True(t, certs[CACertName].Certificate.Equal(intermediateCrt))
+	assert.Equal(t, string(cert.EncodeCertPEM(rootCrt)), certs[CACertName].ChainPEM)
+	// the full chain is distributed to the nodes
+	caCert := certs[CACertName]
+	caEnv := caCert.CertToEnv()
+	assert.Equal(t, 2, strings.Count(caEnv, "-----BEGIN "+cert.CertificateBlockType))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCrt)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediateCrt)
+	_, err = certs[KubeAPICertName].Certificate.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	assert.NoError(t, err)
+}
+
+func TestParseIntermediateCA(t *testing.T) {
+	rootCrt, rootKey, err := GenerateCACertAndKey("root-ca", nil, 0)
+	assert.NoError(t, err)
+	intermediateCrt, intermediateKey := newTestIntermediateCA(t, rootCrt, rootKey)
+
+	_, _, _, err = ParseIntermediateCA(&v3.IntermediateCAConfig{
+		Certificate: string(cert.EncodeCertPEM(intermediateCrt)),
+		Key:         string(cert.EncodePrivateKeyPEM(rootKey)),
+	})
+	assert.EqualError(t, err, "intermediate CA key doesn't match the intermediate CA certificate")
+
+	// the chain must be ordered from the intermediate CA to the root CA
+	_, _, _, err = ParseIntermediateCA(&v3.IntermediateCAConfig{
+		Certificate: encodeCertsPEM([]*x509.Certificate{rootCrt, intermediateCrt}),
+		Key:         string(cert.EncodePrivateKeyPEM(rootKey)),
+	})
+	assert.Error(t, err)
+
+	crt, chain, key, err := ParseIntermediateCA(&v3.IntermediateCAConfig{
+		Certificate: encodeCertsPEM([]*x509.Certificate{intermediateCrt, rootCrt}),
+		Key:         string(cert.EncodePrivateKeyPEM(intermediateKey)),
+	})
+	assert.NoError(t, err)
+	assert.True(t, crt.Equal(intermediateCrt))
+	assert.Len(t, chain, 1)
+	assert.NotNil(t, key)
+}
+
+func TestGenerateRKECertsVault(t *testing.T) {
+	rootCrt, rootKey, err := GenerateCACertAndKey("root-ca", nil, 0)
+	assert.NoError(t, err)
+	issuingCrt, issuingKey := newTestIntermediateCA(t, rootCrt, rootKey)
+	vault := newFakeVault(t, []*x509.Certificate{issuingCrt, rootCrt}, issuingKey)
+	defer vault.Close()
+
+	rkeConfig := getKeyAlgorithmTestConfig(cert.KeyAlgorithmECDSAP256)
+	rkeConfig.Certificates.ClientValidity = "24h"
+	rkeConfig.Certificates.Vault = &v3.VaultSignerConfig{Address: vault.URL, Role: "rke", Token: fakeVaultToken}
+	certs, err := GenerateRKECerts(context.Background(), rkeConfig, "", "")
+	assert.NoError(t, err)
+
+	// the CA key stays in Vault
+	assert.True(t, certs[CACertName].Certificate.Equal(issuingCrt))
+	assert.Nil(t, certs[CACertName].Key)
+	assert.Equal(t, string(cert.EncodeCertPEM(rootCrt)), certs[CACertName].ChainPEM)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(issuingCrt)
+	for _, name := range []string{KubeAPICertName, KubeAdminCertName, KubeNodeCertName} {
+		_, err := certs[name].Certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		assert.NoError(t, err, name)
+	}
+	assert.Equal(t, []string{KubeAdminOrganizationName}, certs[KubeAdminCertName].Certificate.Subject.Organization)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), certs[KubeAdminCertName].Certificate.NotAfter, time.Minute)
+	// the request header CA is still managed by RKE
+	assert.NotNil(t, certs[RequestHeaderCACertName].Key)
+
+	// certificates of new nodes are signed by Vault
+	rkeConfig.Nodes = append(rkeConfig.Nodes, v3.RKEConfigNode{Address: "2.2.2.2", Role: []string{"etcd"}})
+	assert.NoError(t, GenerateRKEServicesCerts(context.Background(), certs, rkeConfig, "", "", false))
+	etcdCert := certs["kube-etcd-2-2-2-2"].Certificate
+	assert.NotNil(t, etcdCert)
+	assert.NoError(t, etcdCert.CheckSignatureFrom(issuingCrt))
+}
+
+func TestVaultSignerRequiresClusterCA(t *testing.T) {
+	rootCrt, rootKey, err := GenerateCACertAndKey("root-ca", nil, 0)
+	assert.NoError(t, err)
+	vault := newFakeVault(t, []*x509.Certificate{rootCrt}, rootKey)
+	defer vault.Close()
+	otherCrt, _, err := GenerateCACertAndKey("other-ca", nil, 0)
+	assert.NoError(t, err)
+	key, err := cert.NewPrivateKeyWithAlgorithm(cert.KeyAlgorithmECDSAP256)
+	assert.NoError(t, err)
+	cfg := cert.Config{CommonName: "test", Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+
+	signer, err := NewVaultSigner(&v3.VaultSignerConfig{Address: vault.URL, Role: "rke", Token: fakeVaultToken}, otherCrt)
+	assert.NoError(t, err)
+	_, err = signer.Sign(context.Background(), cfg, key)
+	assert.Error(t, err)
+
+	signer, err = NewVaultSigner(&v3.VaultSignerConfig{Address: vault.URL, Role: "rke", Token: "invalid"}, rootCrt)
+	assert.NoError(t, err)
+	_, err = signer.Sign(context.Background(), cfg, key)
+	assert.ErrorContains(t, err, "permission denied")
+}
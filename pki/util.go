@@ -1,6 +1,10 @@
 package pki
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	cryptorand "crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -15,6 +19,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,19 +36,20 @@ var (
 )
 
 func GenerateSignedCertAndKey(
-	caCrt *x509.Certificate,
-	caKey *rsa.PrivateKey,
+	ctx context.Context,
+	signer Signer,
 	serverCrt bool,
 	commonName string,
 	altNames *cert.AltNames,
-	reusedKey *rsa.PrivateKey,
-	orgs []string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	reusedKey crypto.Signer,
+	orgs []string,
+	validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
 	// Generate a generic signed certificate
-	var rootKey *rsa.PrivateKey
+	var rootKey crypto.Signer
 	var err error
 	rootKey = reusedKey
 	if reusedKey == nil {
-		rootKey, err = cert.NewPrivateKey()
+		rootKey, err = cert.NewPrivateKeyWithAlgorithm(cert.KeyAlgorithmRSA)
 		if err != nil {
 			return nil, nil, fmt.Errorf("Failed to generate private key for %s certificate: %v", commonName, err)
 		}
@@ -60,8 +66,9 @@ func GenerateSignedCertAndKey(
 		Organization: orgs,
 		Usages:       usages,
 		AltNames:     *altNames,
+		Validity:     validity,
 	}
-	clientCert, err := newSignedCert(caConfig, rootKey, caCrt, caKey)
+	clientCert, err := signer.Sign(ctx, caConfig, rootKey)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to generate %s certificate: %v", commonName, err)
 	}
@@ -72,14 +79,14 @@ func GenerateCertSigningRequestAndKey(
 	serverCrt bool,
 	commonName string,
 	altNames *cert.AltNames,
-	reusedKey *rsa.PrivateKey,
-	orgs []string) ([]byte, *rsa.PrivateKey, error) {
+	reusedKey crypto.Signer,
+	orgs []string) ([]byte, crypto.Signer, error) {
 	// Generate a generic signed certificate
-	var rootKey *rsa.PrivateKey
+	var rootKey crypto.Signer
 	var err error
 	rootKey = reusedKey
 	if reusedKey == nil {
-		rootKey, err = cert.NewPrivateKey()
+		rootKey, err = cert.NewPrivateKeyWithAlgorithm(cert.KeyAlgorithmRSA)
 		if err != nil {
 			return nil, nil, fmt.Errorf("Failed to generate private key for %s certificate: %v", commonName, err)
 		}
@@ -114,17 +121,18 @@ func GenerateCertSigningRequestAndKey(
 	return clientCSR, rootKey, nil
 }
 
-func GenerateCACertAndKey(commonName string, privateKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+func GenerateCACertAndKey(commonName string, privateKey crypto.Signer, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
 	var err error
 	rootKey := privateKey
 	if rootKey == nil {
-		rootKey, err = cert.NewPrivateKey()
+		rootKey, err = cert.NewPrivateKeyWithAlgorithm(cert.KeyAlgorithmRSA)
 		if err != nil {
 			return nil, nil, fmt.Errorf("Failed to generate private key for CA certificate: %v", err)
 		}
 	}
 	caConfig := cert.Config{
 		CommonName: commonName,
+		Validity:   validity,
 	}
 	kubeCACert, err := cert.NewSelfSignedCACert(caConfig, rootKey)
 	if err != nil {
@@ -198,6 +206,13 @@ func GetAltNames(cpHosts []*hosts.Host, clusterDomain string, KubernetesServiceI
 
 	ips = append(ips, net.ParseIP("127.0.0.1"))
 	ips = append(ips, KubernetesServiceIP...)
+	// the IPv6 loopback is only added with IPv6 addresses, the certificates of IPv4 clusters don't change
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			ips = append(ips, net.IPv6loopback)
+			break
+		}
+	}
 	dnsNames = append(dnsNames, []string{
 		"localhost",
 		"kubernetes",
@@ -227,7 +242,12 @@ func (c *CertificatePKI) ToEnv() []string {
 
 func (c *CertificatePKI) CertToEnv() string {
 	encodedCrt := cert.EncodeCertPEM(c.Certificate)
-	return fmt.Sprintf("%s=%s", c.EnvName, string(encodedCrt))
+	return fmt.Sprintf("%s=%s%s", c.EnvName, string(encodedCrt), c.ChainPEM)
+}
+
+// GetCACertsPEM returns the PEM encoded cluster CA certificate followed by the certificates trusted alongside it
+func GetCACertsPEM(certs map[string]CertificatePKI) string {
+	return string(cert.EncodeCertPEM(certs[CACertName].Certificate)) + certs[CACertName].ChainPEM
 }
 
 func (c *CertificatePKI) KeyToEnv() string {
@@ -285,7 +305,7 @@ func GetConfigTempPath(name string) string {
 	return TempCertPath + "kubecfg-" + name + ".yaml"
 }
 
-func ToCertObject(componentName, commonName, ouName string, certificate *x509.Certificate, key *rsa.PrivateKey, csrASN1 []byte) CertificatePKI {
+func ToCertObject(componentName, commonName, ouName string, certificate *x509.Certificate, key crypto.Signer, csrASN1 []byte) CertificatePKI {
 	var config, configPath, configEnvName, certificatePEM, keyPEM string
 	var csr *x509.CertificateRequest
 	var csrPEM []byte
@@ -382,7 +402,7 @@ func GetKubernetesServiceIP(serviceClusterRange string) ([]net.IP, error) {
 	var serviceIPs []net.IP
 	serviceClusterRanges := strings.Split(serviceClusterRange, ",")
 	for _, serviceClusterRange := range serviceClusterRanges {
-		ip, ipnet, err := net.ParseCIDR(serviceClusterRange)
+		ip, ipnet, err := net.ParseCIDR(strings.TrimSpace(serviceClusterRange))
 		if err != nil {
 			return nil, fmt.Errorf("Failed to get kubernetes service IP from Kube API option [service_cluster_ip_range]: %v", err)
 		}
@@ -440,8 +460,8 @@ func populateCertMap(tmpCerts map[string]CertificatePKI, localConfigPath string,
 	return certs
 }
 
-// Overriding k8s.io/client-go/util/cert.NewSignedCert function to extend the expiration date to 10 years instead of 1 year
-func newSignedCert(cfg cert.Config, key *rsa.PrivateKey, caCert *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, error) {
+// Overriding k8s.io/client-go/util/cert.NewSignedCert function to extend the default expiration date to 10 years instead of 1 year
+func newSignedCert(cfg cert.Config, key crypto.Signer, caCert *x509.Certificate, caKey crypto.Signer) (*x509.Certificate, error) {
 	serial, err := cryptorand.Int(cryptorand.Reader, new(big.Int).SetInt64(math.MaxInt64))
 	if err != nil {
 		return nil, err
@@ -452,6 +472,10 @@ func newSignedCert(cfg cert.Config, key *rsa.PrivateKey, caCert *x509.Certificat
 	if len(cfg.Usages) == 0 {
 		return nil, errors.New("must specify at least one ExtKeyUsage")
 	}
+	validity := cfg.Validity
+	if validity <= 0 {
+		validity = defaultCertificateValidity
+	}
 
 	certTmpl := x509.Certificate{
 		Subject: pkix.Name{
@@ -462,8 +486,8 @@ func newSignedCert(cfg cert.Config, key *rsa.PrivateKey, caCert *x509.Certificat
 		IPAddresses:  cfg.AltNames.IPs,
 		SerialNumber: serial,
 		NotBefore:    caCert.NotBefore,
-		NotAfter:     time.Now().Add(duration365d * 10).UTC(),
-		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		NotAfter:     time.Now().Add(validity).UTC(),
+		KeyUsage:     cert.KeyUsage(key),
 		ExtKeyUsage:  cfg.Usages,
 	}
 	certDERBytes, err := x509.CreateCertificate(cryptorand.Reader, &certTmpl, caCert, key.Public(), caKey)
@@ -473,7 +497,7 @@ func newSignedCert(cfg cert.Config, key *rsa.PrivateKey, caCert *x509.Certificat
 	return x509.ParseCertificate(certDERBytes)
 }
 
-func newCertSigningRequest(cfg cert.Config, key *rsa.PrivateKey, extensions []pkix.Extension) ([]byte, error) {
+func newCertSigningRequest(cfg cert.Config, key crypto.Signer, extensions []pkix.Extension) ([]byte, error) {
 	if len(cfg.CommonName) == 0 {
 		return nil, errors.New("must specify a CommonName")
 	}
@@ -524,9 +548,6 @@ func TransformPEMToObject(in map[string]CertificatePKI) map[string]CertificatePK
 		if len(certs) > 0 {
 			certificate = certs[0]
 		}
-		if key != nil {
-			key = key.(*rsa.PrivateKey)
-		}
 		o := CertificatePKI{
 			ConfigEnvName:  v.ConfigEnvName,
 			Name:           v.Name,
@@ -540,10 +561,11 @@ func TransformPEMToObject(in map[string]CertificatePKI) map[string]CertificatePK
 			ConfigPath:     v.ConfigPath,
 			Certificate:    certificate,
 			CertificatePEM: v.CertificatePEM,
+			ChainPEM:       v.ChainPEM,
 			KeyPEM:         v.KeyPEM,
 		}
-		if key != nil {
-			o.Key = key.(*rsa.PrivateKey)
+		if signer, ok := key.(crypto.Signer); ok {
+			o.Key = signer
 		}
 
 		out[k] = o
@@ -649,15 +671,19 @@ func getCertFromFile(certDir string, fileName string) (*x509.Certificate, error)
 	return certificate, nil
 }
 
-func getKeyFromFile(certDir string, fileName string) (*rsa.PrivateKey, error) {
-	var key *rsa.PrivateKey
+func getKeyFromFile(certDir string, fileName string) (crypto.Signer, error) {
+	var key crypto.Signer
 	keyPEM, _ := os.ReadFile(filepath.Join(certDir, fileName))
 	if len(keyPEM) > 0 {
 		keyInterface, err := cert.ParsePrivateKeyPEM(keyPEM)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read key [%s], make sure it is not encrypted: %v", fileName, err)
 		}
-		key = keyInterface.(*rsa.PrivateKey)
+		signer, ok := keyInterface.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("failed to read key [%s]: unsupported key type %T", fileName, keyInterface)
+		}
+		key = signer
 	}
 	return key, nil
 }
@@ -682,7 +708,7 @@ func WriteCertificates(certDirPath string, certBundle map[string]CertificatePKI)
 	for certName, cert := range certBundle {
 		if cert.CertificatePEM != "" {
 			certificatePath := filepath.Join(certDirPath, certName+".pem")
-			if err := os.WriteFile(certificatePath, []byte(cert.CertificatePEM), 0640); err != nil {
+			if err := os.WriteFile(certificatePath, []byte(cert.CertificatePEM+cert.ChainPEM), 0640); err != nil {
 				return fmt.Errorf("Failed to write certificate to path %v: %v", certificatePath, err)
 			}
 			logrus.Debugf("Successfully Deployed certificate file at [%s]", certificatePath)
@@ -746,10 +772,10 @@ func ValidateBundleContent(rkeConfig *v3.RancherKubernetesEngineConfig, certBund
 	if len(cpHosts) > 0 {
 		kubeAdminCertObj := certBundle[KubeAdminCertName]
 		kubeAdminConfig := GetKubeConfigX509WithData(
-			"https://"+cpHosts[0].Address+":6443",
+			"https://"+net.JoinHostPort(cpHosts[0].Address, "6443"),
 			rkeConfig.ClusterName,
 			KubeAdminCertName,
-			string(cert.EncodeCertPEM(certBundle[CACertName].Certificate)),
+			GetCACertsPEM(certBundle),
 			string(cert.EncodeCertPEM(certBundle[KubeAdminCertName].Certificate)),
 			string(cert.EncodePrivateKeyPEM(certBundle[KubeAdminCertName].Key)))
 		kubeAdminCertObj.Config = kubeAdminConfig
@@ -809,3 +835,98 @@ func IsKubeletGenerateServingCertificateEnabledinConfig(rkeConfig *v3.RancherKub
 	}
 	return false
 }
+
+// getKeyAlgorithm returns the configured algorithm of the generated private keys, defaults to RSA
+func getKeyAlgorithm(rkeConfig *v3.RancherKubernetesEngineConfig) string {
+	if rkeConfig.Certificates == nil || rkeConfig.Certificates.KeyAlgorithm == "" {
+		return cert.KeyAlgorithmRSA
+	}
+	return rkeConfig.Certificates.KeyAlgorithm
+}
+
+// getServiceKey returns the private key of a component certificate, the existing key is reused unless the certificate is
+// rotated so clusters keep their existing RSA keys until rotation when the key algorithm changes
+func getServiceKey(existingKey crypto.Signer, rkeConfig *v3.RancherKubernetesEngineConfig, rotate bool) (crypto.Signer, error) {
+	if existingKey != nil && !rotate {
+		return existingKey, nil
+	}
+	return cert.NewPrivateKeyWithAlgorithm(getKeyAlgorithm(rkeConfig))
+}
+
+// GetServiceAccountTokenKey returns the key used to sign service account tokens of clusters without one, the kube-apiserver key
+// signed the existing tokens so it is reused. Kubernetes only supports RSA and ECDSA keys to sign tokens so an ECDSA key is
+// generated for Ed25519 clusters, invalidating the existing tokens.
+func GetServiceAccountTokenKey(kubeAPIKey crypto.Signer) (crypto.Signer, error) {
+	switch kubeAPIKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return kubeAPIKey, nil
+	case ed25519.PrivateKey:
+		logrus.Warnf("[certificates] The kube-apiserver Ed25519 key can't sign service account tokens, generating a new service account token key: the existing service account tokens will be invalidated")
+		return cert.NewPrivateKeyWithAlgorithm(cert.KeyAlgorithmECDSAP256)
+	}
+	return nil, fmt.Errorf("unsupported service account token key type %T", kubeAPIKey)
+}
+
+// ParseCertificateValidity parses the validity of a certificate type in the certificates options, either a number of days (365d),
+// a number of years of 365 days (10y) or a Go duration (8760h). An empty validity returns the default validity of 10 years
+func ParseCertificateValidity(validity string) (time.Duration, error) {
+	if validity == "" {
+		return defaultCertificateValidity, nil
+	}
+	duration, err := parseCertificateValidityDuration(validity)
+	if err != nil {
+		return 0, fmt.Errorf("validity must be a number of days or years like 365d or 10y, or a duration like 8760h")
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("validity must be positive")
+	}
+	return duration, nil
+}
+
+func parseCertificateValidityDuration(validity string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "y": duration365d} {
+		if count, ok := strings.CutSuffix(validity, suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(validity)
+}
+
+// getCertificateValidity returns the configured validity of a certificate type, invalid validities are rejected during
+// cluster validation and fall back to the default validity. Leaf certificates without a validity don't outlive the CA
+func getCertificateValidity(rkeConfig *v3.RancherKubernetesEngineConfig, certType string) time.Duration {
+	if rkeConfig.Certificates == nil {
+		return defaultCertificateValidity
+	}
+	if certType != certTypeCA && getCertificateValidityOption(rkeConfig, certType) == "" {
+		caValidity := getCertificateValidity(rkeConfig, certTypeCA)
+		if caValidity < defaultCertificateValidity {
+			return caValidity
+		}
+		return defaultCertificateValidity
+	}
+	duration, err := ParseCertificateValidity(getCertificateValidityOption(rkeConfig, certType))
+	if err != nil {
+		return defaultCertificateValidity
+	}
+	return duration
+}
+
+func getCertificateValidityOption(rkeConfig *v3.RancherKubernetesEngineConfig, certType string) string {
+	var validity string
+	switch certType {
+	case certTypeCA:
+		validity = rkeConfig.Certificates.CAValidity
+	case certTypeServing:
+		validity = rkeConfig.Certificates.ServingValidity
+	case certTypeClient:
+		validity = rkeConfig.Certificates.ClientValidity
+	case certTypeEtcd:
+		validity = rkeConfig.Certificates.EtcdValidity
+	}
+	return validity
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"context"
+
+	"github.com/rancher/rke/hosts"
+)
+
+type hostRecorderKey struct{}
+
+// HostRecorder records the outcome of deploying a plane on each host, so a failed rke up can be resumed on the remaining hosts
+type HostRecorder interface {
+	RecordHost(address string, err error)
+}
+
+// WithHostRecorder returns a context recording the hosts processed by the planes deployed with it
+func WithHostRecorder(ctx context.Context, recorder HostRecorder) context.Context {
+	return context.WithValue(ctx, hostRecorderKey{}, recorder)
+}
+
+func recordHost(ctx context.Context, host *hosts.Host, err error) {
+	if recorder, ok := ctx.Value(hostRecorderKey{}).(HostRecorder); ok {
+		recorder.RecordHost(host.Address, err)
+	}
+}
@@ -3,7 +3,10 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"path"
 	"strings"
 	"time"
@@ -27,6 +30,8 @@ import (
 const (
 	EtcdSnapshotPath         = "/opt/rke/etcd-snapshots/"
 	EtcdRestorePath          = "/opt/rke/etcd-snapshots-restore/"
+	EtcdSnapshotVerifyPath   = "/opt/rke/etcd-snapshots-verify/"
+	EtcdSnapshotExtractPath  = "/opt/rke/etcd-snapshots-extract/"
 	EtcdDataDir              = "/var/lib/rancher/etcd/"
 	EtcdInitWaitTime         = 10
 	EtcdSnapshotWaitTime     = 5
@@ -182,7 +187,7 @@ func memberAdd(ctx context.Context, etcdClient *etcdclientv3.Client, peerURL str
 func AddEtcdMember(ctx context.Context, toAddEtcdHost *hosts.Host, etcdHosts []*hosts.Host, localConnDialerFactory hosts.DialerFactory,
 	k8sVersion string, cert, key []byte) error {
 	log.Infof(ctx, "[add/%s] Adding member [etcd-%s] to etcd cluster", ETCDRole, toAddEtcdHost.HostnameOverride)
-	peerURL := fmt.Sprintf("https://%s:2380", toAddEtcdHost.InternalAddress)
+	peerURL := fmt.Sprintf("https://%s", net.JoinHostPort(toAddEtcdHost.InternalAddress, "2380"))
 	added := false
 	for _, host := range etcdHosts {
 		if host.Address == toAddEtcdHost.Address {
@@ -368,7 +373,7 @@ func ReloadEtcdCluster(ctx context.Context, readyEtcdHosts []*hosts.Host, newHos
 func IsEtcdMember(ctx context.Context, etcdHost *hosts.Host, etcdHosts []*hosts.Host, localConnDialerFactory hosts.DialerFactory,
 	k8sVersion string, cert, key []byte) (bool, error) {
 	var listErr error
-	peerURL := fmt.Sprintf("https://%s:2380", etcdHost.InternalAddress)
+	peerURL := fmt.Sprintf("https://%s", net.JoinHostPort(etcdHost.InternalAddress, "2380"))
 	for _, host := range etcdHosts {
 		if host.Address == etcdHost.Address {
 			continue
@@ -436,7 +441,7 @@ func RunEtcdSnapshotSave(ctx context.Context, etcdHost *hosts.Host, prsMap map[s
 			"--cert", pki.GetCertPath(pki.KubeNodeCertName),
 			"--key", pki.GetKeyPath(pki.KubeNodeCertName),
 			"--name", name,
-			"--endpoints=" + etcdHost.InternalAddress + ":2379",
+			"--endpoints=" + net.JoinHostPort(etcdHost.InternalAddress, "2379"),
 		},
 		Image: etcdSnapshotImage,
 		Env:   es.ExtraEnv,
@@ -666,7 +671,7 @@ func DownloadEtcdSnapshotFromS3(ctx context.Context, etcdHost *hosts.Host, prsMa
 	status, _, stderr, err := docker.GetContainerOutput(ctx, etcdHost.DClient, EtcdDownloadBackupContainerName, etcdHost.Address, true)
 	if status != 0 || err != nil {
 		if removeErr := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdDownloadBackupContainerName); removeErr != nil {
-			log.Warnf(ctx, "Failed to remove container [%s]: %v", removeErr)
+			log.Warnf(ctx, "Failed to remove container [%s]: %v", EtcdDownloadBackupContainerName, removeErr)
 		}
 		if err != nil {
 			return err
@@ -688,7 +693,7 @@ func RestoreEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, prsMap map[s
 			"sh", "-c", strings.Join([]string{
 				"rm -rf", EtcdRestorePath,
 				"&& /usr/local/bin/etcdctl",
-				fmt.Sprintf("--endpoints=[%s:2379]", etcdHost.InternalAddress),
+				fmt.Sprintf("--endpoints=[%s]", net.JoinHostPort(etcdHost.InternalAddress, "2379")),
 				"--cacert", pki.GetCertPath(pki.CACertName),
 				"--cert", pki.GetCertPath(nodeName),
 				"--key", pki.GetKeyPath(nodeName),
@@ -697,7 +702,7 @@ func RestoreEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, prsMap map[s
 				"--name=etcd-" + etcdHost.HostnameOverride,
 				"--initial-cluster=" + initCluster,
 				"--initial-cluster-token=etcd-cluster-1",
-				"--initial-advertise-peer-urls=https://" + etcdHost.InternalAddress + ":2380",
+				"--initial-advertise-peer-urls=https://" + net.JoinHostPort(etcdHost.InternalAddress, "2380"),
 				"&& mv", EtcdRestorePath + "*", EtcdDataDir,
 				"&& rm -rf", EtcdRestorePath,
 			}, " "),
@@ -770,7 +775,7 @@ func RunEtcdSnapshotRemove(ctx context.Context, etcdHost *hosts.Host, prsMap map
 	if cleanupRestore {
 		imageCfg.Cmd = append(imageCfg.Cmd, "--cleanup")
 	}
-	if es.BackupConfig != nil && es.BackupConfig.S3BackupConfig != nil {
+	if IsS3HandledByRKETools(es.BackupConfig) {
 		s3cmd := []string{
 			"--s3-backup",
 			"--s3-endpoint=" + es.BackupConfig.S3BackupConfig.Endpoint,
@@ -827,7 +832,7 @@ func RunEtcdSnapshotRemove(ctx context.Context, etcdHost *hosts.Host, prsMap map
 	status, _, stderr, err := docker.GetContainerOutput(ctx, etcdHost.DClient, EtcdSnapshotRemoveContainerName, etcdHost.Address, true)
 	if status != 0 || err != nil {
 		if removeErr := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotRemoveContainerName); removeErr != nil {
-			log.Warnf(ctx, "Failed to remove container [%s]: %v", removeErr)
+			log.Warnf(ctx, "Failed to remove container [%s]: %v", EtcdSnapshotRemoveContainerName, removeErr)
 		}
 		if err != nil {
 			return err
@@ -893,13 +898,125 @@ func GetEtcdSnapshotChecksum(ctx context.Context, etcdHost *hosts.Host, prsMap m
 	return checksum, nil
 }
 
+// EtcdSnapshotStatus is the output of etcdctl snapshot status
+type EtcdSnapshotStatus struct {
+	Hash      uint32 `json:"hash"`
+	Revision  int64  `json:"revision"`
+	TotalKey  int64  `json:"totalKey"`
+	TotalSize int64  `json:"totalSize"`
+}
+
+// GetEtcdSnapshotStatus opens the snapshot on the etcd host with etcdctl to check that it is a valid etcd database.
+// Compressed snapshots are extracted to a temporary directory first.
+func GetEtcdSnapshotStatus(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdBackupImage, etcdRestoreImage, snapshotName, k8sVersion string) (*EtcdSnapshotStatus, error) {
+	log.Infof(ctx, "[etcd] Verifying snapshot [%s] on host [%s]", snapshotName, etcdHost.Address)
+	snapshotPath := fmt.Sprintf("%s%s", EtcdSnapshotPath, snapshotName)
+	if err := unzipEtcdSnapshot(ctx, etcdHost, prsMap, etcdBackupImage, snapshotName, EtcdSnapshotVerifyPath, EtcdSnapshotVerifyContainerName, k8sVersion); err != nil {
+		return nil, err
+	}
+	statusCmd := strings.Join([]string{
+		"f='" + snapshotPath + "';",
+		"[ -f \"$f\" ] || f=$(find", EtcdSnapshotVerifyPath, "-type f ! -name '*.rkestate' | head -n 1);",
+		"if [ -z \"$f\" ]; then echo 'snapshot file does not exist' >&2; rc=1;",
+		"else /usr/local/bin/etcdctl snapshot status \"$f\" -w json; rc=$?; fi;",
+		"rm -rf", EtcdSnapshotVerifyPath + ";",
+		"exit $rc",
+	}, " ")
+	status, stdout, stderr, err := runEtcdSnapshotToolContainer(ctx, etcdHost, prsMap, EtcdSnapshotVerifyContainerName, etcdRestoreImage, statusCmd, k8sVersion, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("snapshot [%s] on host [%s] is not a valid etcd database, exit code [%d]: %s", snapshotName, etcdHost.Address, status, strings.TrimSpace(stderr))
+	}
+	return parseEtcdSnapshotStatus(snapshotName, etcdHost.Address, stdout)
+}
+
+func parseEtcdSnapshotStatus(snapshotName, address, output string) (*EtcdSnapshotStatus, error) {
+	snapshotStatus := &EtcdSnapshotStatus{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), snapshotStatus); err != nil {
+		return nil, fmt.Errorf("failed to parse status of snapshot [%s] on host [%s]: %v", snapshotName, address, err)
+	}
+	if snapshotStatus.Revision == 0 || snapshotStatus.TotalKey == 0 {
+		return nil, fmt.Errorf("snapshot [%s] on host [%s] is empty, revision [%d] and key count [%d]", snapshotName, address, snapshotStatus.Revision, snapshotStatus.TotalKey)
+	}
+	return snapshotStatus, nil
+}
+
+// unzipEtcdSnapshot extracts the snapshot archive to dir if the uncompressed snapshot is not on the host. The restore image may not ship unzip,
+// so the archive is extracted with the backup image.
+func unzipEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdBackupImage, snapshotName, dir, containerName, k8sVersion string) error {
+	snapshotPath := fmt.Sprintf("%s%s", EtcdSnapshotPath, snapshotName)
+	compressedSnapshotPath := fmt.Sprintf("%s.%s", snapshotPath, EtcdSnapshotCompressedExtension)
+	extractCmd := strings.Join([]string{
+		"rm -rf", dir,
+		"&& mkdir -p", dir,
+		"&& if [ ! -f '" + snapshotPath + "' ] && [ -f '" + compressedSnapshotPath + "' ]; then",
+		"unzip -o -q '" + compressedSnapshotPath + "' -d", dir + "; fi",
+	}, " ")
+	status, _, stderr, err := runEtcdSnapshotToolContainer(ctx, etcdHost, prsMap, containerName, etcdBackupImage, extractCmd, k8sVersion, "", nil)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("failed to extract snapshot [%s] on host [%s], exit code [%d]: %s", snapshotName, etcdHost.Address, status, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// runEtcdSnapshotToolContainer runs cmd in a one-time container with /opt/rke mounted. If outputFile is set, the file is copied
+// from the container to output before the container is removed.
+func runEtcdSnapshotToolContainer(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, containerName, image, cmd, k8sVersion, outputFile string, output io.Writer) (int64, string, string, error) {
+	imageCfg := &container.Config{
+		Cmd:   []string{"sh", "-c", cmd},
+		Env:   []string{"ETCDCTL_API=3"},
+		Image: image,
+	}
+	hostCfg := &container.HostConfig{
+		RestartPolicy: container.RestartPolicy{Name: "no"},
+	}
+	binds := []string{
+		"/opt/rke/:/opt/rke/:z",
+	}
+
+	matchedRange, err := util.SemVerMatchRange(k8sVersion, util.SemVerK8sVersion122OrHigher)
+	if err != nil {
+		return 1, "", "", err
+	}
+
+	if matchedRange {
+		binds = util.RemoveZFromBinds(binds)
+
+		if hosts.IsDockerSELinuxEnabled(etcdHost) {
+			hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, SELinuxLabel)
+		}
+
+	}
+	hostCfg.Binds = binds
+
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, containerName, etcdHost.Address); err != nil {
+		return 1, "", "", err
+	}
+	if err := docker.DoRunContainer(ctx, etcdHost.DClient, imageCfg, hostCfg, containerName, etcdHost.Address, ETCDRole, prsMap); err != nil {
+		return 1, "", "", err
+	}
+	status, stdout, stderr, err := docker.GetContainerOutput(ctx, etcdHost.DClient, containerName, etcdHost.Address, false)
+	if err == nil && status == 0 && outputFile != "" {
+		err = docker.CopyFileFromContainer(ctx, etcdHost.DClient, etcdHost.Address, containerName, outputFile, output)
+	}
+	if removeErr := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, containerName); removeErr != nil {
+		log.Warnf(ctx, "[etcd] Failed to remove container [%s] on host [%s]: %v", containerName, etcdHost.Address, removeErr)
+	}
+	return status, stdout, stderr, err
+}
+
 func configS3BackupImgCmd(ctx context.Context, imageCfg *container.Config, bc *v3.BackupConfig) *container.Config {
 	cmd := []string{
 		"--creation=" + fmt.Sprintf("%dh", bc.IntervalHours),
 		"--retention=" + fmt.Sprintf("%dh", bc.Retention*bc.IntervalHours),
 	}
 
-	if bc.S3BackupConfig != nil {
+	if IsS3HandledByRKETools(bc) {
 		cmd = append(cmd, []string{
 			"--s3-backup=true",
 			"--s3-endpoint=" + bc.S3BackupConfig.Endpoint,
@@ -1047,7 +1164,7 @@ func DownloadEtcdSnapshotFromBackupServer(ctx context.Context, etcdHost *hosts.H
 	status, _, stderr, err := docker.GetContainerOutput(ctx, etcdHost.DClient, EtcdDownloadBackupContainerName, etcdHost.Address, true)
 	if status != 0 || err != nil {
 		if removeErr := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdDownloadBackupContainerName); removeErr != nil {
-			log.Warnf(ctx, "Failed to remove container [%s]: %v", removeErr)
+			log.Warnf(ctx, "Failed to remove container [%s]: %v", EtcdDownloadBackupContainerName, removeErr)
 		}
 		if err != nil {
 			return err
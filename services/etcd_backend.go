@@ -0,0 +1,724 @@
+package services
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/sftp"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	v3 "github.com/rancher/rke/types"
+	"github.com/rancher/rke/util"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	EtcdSnapshotCompressedExtension = "zip"
+
+	S3SnapshotBackendName       = "s3"
+	SFTPSnapshotBackendName     = "sftp"
+	LocalDirSnapshotBackendName = "local-dir"
+
+	sftpDialTimeout = 30 * time.Second
+
+	// rollingEtcdSnapshotSuffix ends the names rke-tools gives to rolling snapshots, after their creation time
+	rollingEtcdSnapshotSuffix = "_etcd"
+)
+
+// SnapshotInfo describes a snapshot archive stored on an etcd host or on a remote target
+type SnapshotInfo struct {
+	FileName string
+	Size     int64
+	ModTime  time.Time
+	// Checksum and KubernetesVersion are only known for snapshots stored on the etcd hosts
+	Checksum          string
+	KubernetesVersion string
+}
+
+// SnapshotBackend stores etcd snapshot archives outside of the etcd hosts.
+// Snapshots are taken on the etcd hosts by rke-tools and streamed by rke between the hosts and the backend.
+// Unencrypted S3 snapshots are uploaded and downloaded by rke-tools itself. Azure Blob Storage and Google Cloud Storage
+// have no backend, they can be reached through their S3 compatible APIs.
+type SnapshotBackend interface {
+	// Name of the backend, used in log and error messages
+	Name() string
+	Upload(ctx context.Context, fileName string, r io.Reader) error
+	Download(ctx context.Context, fileName string, w io.Writer) error
+	// Delete removes the snapshot archive, removing a missing archive is not an error
+	Delete(ctx context.Context, fileName string) error
+	List(ctx context.Context) ([]SnapshotInfo, error)
+}
+
+// NewSnapshotBackend returns the snapshot backend configured in the backup config, or nil if snapshots are only kept on the etcd hosts
+// or sent to S3 by rke-tools. S3 is only handled by rke when snapshots are encrypted, since rke-tools can't encrypt them.
+// The verifier checks the host key of the sftp server when no host key is configured for it.
+func NewSnapshotBackend(bc *v3.BackupConfig, verifier *hosts.HostKeyVerifier) (SnapshotBackend, error) {
+	if bc == nil {
+		return nil, nil
+	}
+	var backend SnapshotBackend
+	var err error
+	switch {
+	case bc.SFTPBackupConfig != nil:
+		backend, err = NewSFTPSnapshotBackend(bc.SFTPBackupConfig, verifier)
+	case bc.LocalDirBackupConfig != nil:
+		backend = NewLocalDirSnapshotBackend(bc.LocalDirBackupConfig)
+	case bc.S3BackupConfig != nil && bc.Encryption != nil:
+		backend, err = newS3SnapshotBackend(bc.S3BackupConfig)
+	}
+	if err != nil || backend == nil {
+		return nil, err
+	}
+	if bc.Encryption != nil {
+		return NewEncryptedSnapshotBackend(backend, bc.Encryption)
+	}
+	return backend, nil
+}
+
+// IsS3HandledByRKETools returns true if the rke-tools S3 flags must be passed to the etcd-backup containers
+func IsS3HandledByRKETools(bc *v3.BackupConfig) bool {
+	return bc != nil && bc.S3BackupConfig != nil && bc.Encryption == nil
+}
+
+// GetEtcdSnapshotFileName returns the name of the archive rke-tools creates for a snapshot
+func GetEtcdSnapshotFileName(name string) string {
+	return fmt.Sprintf("%s.%s", name, EtcdSnapshotCompressedExtension)
+}
+
+// UploadEtcdSnapshotToBackend copies the archive of the named snapshot from the etcd host to the snapshot backend
+func UploadEtcdSnapshotToBackend(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage, name string, backend SnapshotBackend, k8sVersion string) error {
+	fileName := GetEtcdSnapshotFileName(name)
+	log.Infof(ctx, "[etcd] Uploading snapshot [%s] from host [%s] to %s backend", name, etcdHost.Address, backend.Name())
+	if err := createEtcdSnapshotTransferContainer(ctx, etcdHost, prsMap, etcdSnapshotImage, k8sVersion); err != nil {
+		return err
+	}
+	defer removeEtcdSnapshotTransferContainer(ctx, etcdHost)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(docker.CopyFileFromContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName, path.Join("/backup", fileName), pw))
+	}()
+	if err := backend.Upload(ctx, fileName, pr); err != nil {
+		pr.CloseWithError(err)
+		return fmt.Errorf("failed to upload etcd snapshot file to %s backend on host [%s]: %v", backend.Name(), etcdHost.Address, err)
+	}
+	return nil
+}
+
+// DownloadEtcdSnapshotFromBackend copies the archive of the named snapshot from the snapshot backend to the etcd host
+func DownloadEtcdSnapshotFromBackend(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage, name string, backend SnapshotBackend, k8sVersion string) error {
+	fileName := GetEtcdSnapshotFileName(name)
+	log.Infof(ctx, "[etcd] Snapshot [%s] will be downloaded on host [%s] from %s backend", name, etcdHost.Address, backend.Name())
+	// the archive size is needed for the tar header, so it is buffered in a temporary file first
+	tmpFile, err := os.CreateTemp("", "rke-etcd-snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	if err := backend.Download(ctx, fileName, tmpFile); err != nil {
+		return fmt.Errorf("failed to download etcd snapshot [%s] from %s backend: %v", name, backend.Name(), err)
+	}
+	fileInfo, err := tmpFile.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := createEtcdSnapshotTransferContainer(ctx, etcdHost, prsMap, etcdSnapshotImage, k8sVersion); err != nil {
+		return err
+	}
+	defer removeEtcdSnapshotTransferContainer(ctx, etcdHost)
+
+	pr, pw := io.Pipe()
+	go func() {
+		tarWriter := tar.NewWriter(pw)
+		header := &tar.Header{
+			Name:    fileName,
+			Mode:    0600,
+			Size:    fileInfo.Size(),
+			ModTime: fileInfo.ModTime(),
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(tarWriter, tmpFile); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(tarWriter.Close())
+	}()
+	return docker.DoCopyToContainer(ctx, etcdHost.DClient, ETCDRole, EtcdSnapshotTransferContainerName, etcdHost.Address, "/backup", pr)
+}
+
+// SyncEtcdSnapshotsToBackend uploads the snapshot archives found on the etcd host that are missing from the snapshot backend.
+// The rolling snapshot container only writes to the host, its snapshots are shipped by rke etcd snapshot-sync and rke up.
+func SyncEtcdSnapshotsToBackend(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage string, backend SnapshotBackend, k8sVersion string) error {
+	hostFiles, err := GetEtcdSnapshotFilesOnHost(ctx, etcdHost, prsMap, etcdSnapshotImage, k8sVersion)
+	if err != nil {
+		return err
+	}
+	storedSnapshots, err := backend.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list etcd snapshots on %s backend: %v", backend.Name(), err)
+	}
+	for _, fileName := range getSnapshotFilesMissingFromBackend(hostFiles, storedSnapshots) {
+		if err := UploadEtcdSnapshotToBackend(ctx, etcdHost, prsMap, etcdSnapshotImage, GetEtcdSnapshotName(fileName), backend, k8sVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneEtcdSnapshotsOnBackend removes the rolling snapshots stored on the snapshot backend past the retention, like the rolling
+// snapshot container does on the etcd hosts. Snapshots taken with rke etcd snapshot-save are kept.
+func PruneEtcdSnapshotsOnBackend(ctx context.Context, backend SnapshotBackend, retention time.Duration) error {
+	storedSnapshots, err := backend.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list etcd snapshots on %s backend: %v", backend.Name(), err)
+	}
+	for _, fileName := range getRollingSnapshotFilesToPrune(storedSnapshots, retention, time.Now()) {
+		log.Infof(ctx, "[etcd] Removing rolling snapshot [%s] from %s backend", GetEtcdSnapshotName(fileName), backend.Name())
+		if err := backend.Delete(ctx, fileName); err != nil {
+			return fmt.Errorf("failed to remove snapshot [%s] from %s backend: %v", GetEtcdSnapshotName(fileName), backend.Name(), err)
+		}
+	}
+	return nil
+}
+
+// GetEtcdSnapshotRetention returns how long the rolling snapshot container keeps the snapshots it takes
+func GetEtcdSnapshotRetention(bc *v3.BackupConfig) time.Duration {
+	return time.Duration(bc.Retention*bc.IntervalHours) * time.Hour
+}
+
+func getRollingSnapshotFilesToPrune(snapshots []SnapshotInfo, retention time.Duration, now time.Time) []string {
+	var toPrune []string
+	for _, snapshot := range snapshots {
+		createdAt, ok := getRollingEtcdSnapshotTime(snapshot.FileName)
+		if ok && now.Sub(createdAt) > retention {
+			toPrune = append(toPrune, snapshot.FileName)
+		}
+	}
+	return toPrune
+}
+
+// getRollingEtcdSnapshotTime returns the creation time of a rolling snapshot from its name, e.g. 2024-01-01T00:00:00Z_etcd.zip
+func getRollingEtcdSnapshotTime(fileName string) (time.Time, bool) {
+	name := GetEtcdSnapshotName(fileName)
+	if !strings.HasSuffix(name, rollingEtcdSnapshotSuffix) {
+		return time.Time{}, false
+	}
+	createdAt, err := time.Parse(time.RFC3339, strings.TrimSuffix(name, rollingEtcdSnapshotSuffix))
+	return createdAt, err == nil
+}
+
+// GetEtcdSnapshotFilesOnHost returns the snapshot archives stored in the snapshot directory of the etcd host
+func GetEtcdSnapshotFilesOnHost(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage, k8sVersion string) ([]string, error) {
+	stdout, err := runEtcdSnapshotListContainer(ctx, etcdHost, prsMap, etcdSnapshotImage, "ls -1 /backup", k8sVersion)
+	if err != nil {
+		return nil, err
+	}
+	return parseEtcdSnapshotFiles(stdout), nil
+}
+
+func runEtcdSnapshotListContainer(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage, script, k8sVersion string) (string, error) {
+	imageCfg := &container.Config{
+		Cmd:   []string{"sh", "-c", script},
+		Image: etcdSnapshotImage,
+	}
+	hostCfg, err := getEtcdSnapshotDirHostConfig(etcdHost, k8sVersion)
+	if err != nil {
+		return "", err
+	}
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdSnapshotListContainerName, etcdHost.Address); err != nil {
+		return "", err
+	}
+	if err := docker.DoRunOnetimeContainer(ctx, etcdHost.DClient, imageCfg, hostCfg, EtcdSnapshotListContainerName, etcdHost.Address, ETCDRole, prsMap); err != nil {
+		return "", err
+	}
+	_, stdout, err := docker.GetContainerLogsStdoutStderr(ctx, etcdHost.DClient, EtcdSnapshotListContainerName, "all", false)
+	if err != nil {
+		return "", err
+	}
+	return stdout, docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdSnapshotListContainerName, etcdHost.Address)
+}
+
+func parseEtcdSnapshotFiles(output string) []string {
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "."+EtcdSnapshotCompressedExtension) {
+			files = append(files, line)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// etcdSnapshotListScript prints one line per snapshot in the snapshot directory: file name, size, modification time, md5 checksum and kubernetes version
+const etcdSnapshotListScript = `cd /backup || exit 0
+for f in *; do
+  [ -f "$f" ] || continue
+  case "$f" in *.rkestate|*.part*|*.tar.gz) continue;; esac
+  version=""
+  case "$f" in *.zip) version=$(unzip -p "$f" '*.rkestate' 2>/dev/null | grep -o '"kubernetesVersion": *"[^"]*"' | head -1 | cut -d'"' -f4);; esac
+  printf '%s|%s|%s|%s|%s\n' "$f" "$(stat -c %s "$f")" "$(stat -c %Y "$f")" "$(md5sum "$f" | cut -d' ' -f1)" "$version"
+done`
+
+// GetEtcdSnapshotsOnHost returns the snapshots stored in the snapshot directory of the etcd host with their metadata
+func GetEtcdSnapshotsOnHost(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage, k8sVersion string) ([]SnapshotInfo, error) {
+	stdout, err := runEtcdSnapshotListContainer(ctx, etcdHost, prsMap, etcdSnapshotImage, etcdSnapshotListScript, k8sVersion)
+	if err != nil {
+		return nil, err
+	}
+	return parseEtcdSnapshotList(stdout), nil
+}
+
+func parseEtcdSnapshotList(output string) []SnapshotInfo {
+	var snapshots []SnapshotInfo
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 5 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			logrus.Debugf("[etcd] Failed to parse size of snapshot [%s]: %v", fields[0], err)
+			continue
+		}
+		modTime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			logrus.Debugf("[etcd] Failed to parse modification time of snapshot [%s]: %v", fields[0], err)
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			FileName:          fields[0],
+			Size:              size,
+			ModTime:           time.Unix(modTime, 0).UTC(),
+			Checksum:          fields[3],
+			KubernetesVersion: fields[4],
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].FileName < snapshots[j].FileName
+	})
+	return snapshots
+}
+
+// GetEtcdSnapshotName returns the snapshot name of a snapshot archive, as used by the snapshot commands
+func GetEtcdSnapshotName(fileName string) string {
+	return strings.TrimSuffix(fileName, "."+EtcdSnapshotCompressedExtension)
+}
+
+// ListEtcdSnapshotsOnS3 lists the snapshot archives in the bucket folder of the S3 backup config
+func ListEtcdSnapshotsOnS3(ctx context.Context, s3Config *v3.S3BackupConfig) ([]SnapshotInfo, error) {
+	backend, err := newS3SnapshotBackend(s3Config)
+	if err != nil {
+		return nil, err
+	}
+	return backend.List(ctx)
+}
+
+func getSnapshotFilesMissingFromBackend(hostFiles []string, storedSnapshots []SnapshotInfo) []string {
+	stored := sets.NewString()
+	for _, snapshot := range storedSnapshots {
+		stored.Insert(snapshot.FileName)
+	}
+	var missing []string
+	for _, fileName := range hostFiles {
+		if !stored.Has(fileName) {
+			missing = append(missing, fileName)
+		}
+	}
+	return missing
+}
+
+// createEtcdSnapshotTransferContainer creates, without starting it, a container with the snapshot directory mounted to copy files through the docker API
+func createEtcdSnapshotTransferContainer(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdSnapshotImage, k8sVersion string) error {
+	imageCfg := &container.Config{
+		Cmd:   []string{"true"},
+		Image: etcdSnapshotImage,
+	}
+	hostCfg, err := getEtcdSnapshotDirHostConfig(etcdHost, k8sVersion)
+	if err != nil {
+		return err
+	}
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdSnapshotTransferContainerName, etcdHost.Address); err != nil {
+		return err
+	}
+	if err := docker.UseLocalOrPull(ctx, etcdHost.DClient, etcdHost.Address, etcdSnapshotImage, ETCDRole, prsMap); err != nil {
+		return err
+	}
+	_, err = docker.CreateContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName, imageCfg, hostCfg)
+	return err
+}
+
+func removeEtcdSnapshotTransferContainer(ctx context.Context, etcdHost *hosts.Host) {
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdSnapshotTransferContainerName, etcdHost.Address); err != nil {
+		log.Warnf(ctx, "[etcd] Failed to remove container [%s] on host [%s]: %v", EtcdSnapshotTransferContainerName, etcdHost.Address, err)
+	}
+}
+
+func getEtcdSnapshotDirHostConfig(etcdHost *hosts.Host, k8sVersion string) (*container.HostConfig, error) {
+	hostCfg := &container.HostConfig{
+		RestartPolicy: container.RestartPolicy{Name: "no"},
+	}
+	binds := []string{
+		fmt.Sprintf("%s:/backup:z", EtcdSnapshotPath),
+	}
+
+	matchedRange, err := util.SemVerMatchRange(k8sVersion, util.SemVerK8sVersion122OrHigher)
+	if err != nil {
+		return nil, err
+	}
+
+	if matchedRange {
+		binds = util.RemoveZFromBinds(binds)
+		if hosts.IsDockerSELinuxEnabled(etcdHost) {
+			hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, SELinuxLabel)
+		}
+	}
+	hostCfg.Binds = binds
+	return hostCfg, nil
+}
+
+type s3SnapshotBackend struct {
+	config *v3.S3BackupConfig
+	client *s3.S3
+}
+
+func newS3SnapshotBackend(s3Config *v3.S3BackupConfig) (*s3SnapshotBackend, error) {
+	region := s3Config.Region
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+	awsConfig := aws.NewConfig().
+		WithEndpoint(s3Config.Endpoint).
+		WithRegion(region).
+		WithS3ForcePathStyle(true)
+	if len(s3Config.AccessKey) > 0 || len(s3Config.SecretKey) > 0 {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(s3Config.AccessKey, s3Config.SecretKey, ""))
+	}
+	if len(s3Config.CustomCA) > 0 {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM([]byte(s3Config.CustomCA)) {
+			return nil, fmt.Errorf("failed to parse S3 endpoint CA certificate")
+		}
+		awsConfig = awsConfig.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: certPool},
+			},
+		})
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &s3SnapshotBackend{
+		config: s3Config,
+		client: s3.New(sess),
+	}, nil
+}
+
+func (b *s3SnapshotBackend) Name() string {
+	return S3SnapshotBackendName
+}
+
+func (b *s3SnapshotBackend) Upload(ctx context.Context, fileName string, r io.Reader) error {
+	_, err := s3manager.NewUploaderWithClient(b.client).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(b.config.BucketName),
+		Key:    aws.String(b.getPrefix() + fileName),
+		Body:   r,
+	})
+	return err
+}
+
+func (b *s3SnapshotBackend) Download(ctx context.Context, fileName string, w io.Writer) error {
+	object, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.config.BucketName),
+		Key:    aws.String(b.getPrefix() + fileName),
+	})
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+	_, err = io.Copy(w, object.Body)
+	return err
+}
+
+func (b *s3SnapshotBackend) Delete(ctx context.Context, fileName string) error {
+	_, err := b.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.config.BucketName),
+		Key:    aws.String(b.getPrefix() + fileName),
+	})
+	return err
+}
+
+func (b *s3SnapshotBackend) List(ctx context.Context) ([]SnapshotInfo, error) {
+	prefix := b.getPrefix()
+	var snapshots []SnapshotInfo
+	err := b.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.config.BucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			fileName := strings.TrimPrefix(aws.StringValue(object.Key), prefix)
+			if strings.Contains(fileName, "/") || !strings.HasSuffix(fileName, "."+EtcdSnapshotCompressedExtension) {
+				continue
+			}
+			snapshots = append(snapshots, SnapshotInfo{
+				FileName: fileName,
+				Size:     aws.Int64Value(object.Size),
+				ModTime:  aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list etcd snapshots in bucket [%s] at [%s]: %v", b.config.BucketName, b.config.Endpoint, err)
+	}
+	return snapshots, nil
+}
+
+func (b *s3SnapshotBackend) getPrefix() string {
+	if len(b.config.Folder) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(b.config.Folder, "/") + "/"
+}
+
+type sftpSnapshotBackend struct {
+	config       *v3.SFTPBackupConfig
+	clientConfig *ssh.ClientConfig
+}
+
+// NewSFTPSnapshotBackend returns a snapshot backend storing snapshots in a folder of an sftp server, the host key of the
+// server is checked against its configured host key or by the verifier
+func NewSFTPSnapshotBackend(config *v3.SFTPBackupConfig, verifier *hosts.HostKeyVerifier) (SnapshotBackend, error) {
+	clientConfig := &ssh.ClientConfig{
+		User:    config.User,
+		Timeout: sftpDialTimeout,
+	}
+	if len(config.SSHKey) > 0 {
+		signer, err := ssh.ParsePrivateKey([]byte(config.SSHKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp backup ssh key: %v", err)
+		}
+		clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(signer))
+	}
+	if len(config.Password) > 0 {
+		clientConfig.Auth = append(clientConfig.Auth, ssh.Password(config.Password))
+	}
+	if verifier == nil && len(config.HostKey) == 0 {
+		return nil, fmt.Errorf("sftp backup server [%s] has no host key to verify it against", config.Address)
+	}
+	hostKeyCallback, err := verifier.HostKeyCallback(config.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sftp backup host key: %v", err)
+	}
+	clientConfig.HostKeyCallback = hostKeyCallback
+	return &sftpSnapshotBackend{
+		config:       config,
+		clientConfig: clientConfig,
+	}, nil
+}
+
+func (b *sftpSnapshotBackend) Name() string {
+	return SFTPSnapshotBackendName
+}
+
+func (b *sftpSnapshotBackend) Upload(ctx context.Context, fileName string, r io.Reader) error {
+	return b.withClient(func(client *sftp.Client) error {
+		if len(b.config.Folder) > 0 {
+			if err := client.MkdirAll(b.config.Folder); err != nil {
+				return err
+			}
+		}
+		// write to a temporary file first so an interrupted upload never replaces a good snapshot
+		tmpPath := b.getPath(fileName) + ".part"
+		file, err := client.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		if _, err := file.ReadFrom(r); err != nil {
+			file.Close()
+			client.Remove(tmpPath)
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return client.PosixRename(tmpPath, b.getPath(fileName))
+	})
+}
+
+func (b *sftpSnapshotBackend) Download(ctx context.Context, fileName string, w io.Writer) error {
+	return b.withClient(func(client *sftp.Client) error {
+		file, err := client.Open(b.getPath(fileName))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = file.WriteTo(w)
+		return err
+	})
+}
+
+func (b *sftpSnapshotBackend) Delete(ctx context.Context, fileName string) error {
+	return b.withClient(func(client *sftp.Client) error {
+		if err := client.Remove(b.getPath(fileName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (b *sftpSnapshotBackend) List(ctx context.Context) ([]SnapshotInfo, error) {
+	var snapshots []SnapshotInfo
+	err := b.withClient(func(client *sftp.Client) error {
+		folder := b.config.Folder
+		if len(folder) == 0 {
+			folder = "."
+		}
+		files, err := client.ReadDir(folder)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		snapshots = getSnapshotInfos(files)
+		return nil
+	})
+	return snapshots, err
+}
+
+func (b *sftpSnapshotBackend) getPath(fileName string) string {
+	return path.Join(b.config.Folder, fileName)
+}
+
+func (b *sftpSnapshotBackend) withClient(f func(*sftp.Client) error) error {
+	sshClient, err := ssh.Dial("tcp", b.config.Address, b.clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to sftp server [%s]: %v", b.config.Address, err)
+	}
+	defer sshClient.Close()
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return fmt.Errorf("failed to start sftp session with server [%s]: %v", b.config.Address, err)
+	}
+	defer client.Close()
+	return f(client)
+}
+
+type localDirSnapshotBackend struct {
+	dir string
+}
+
+// NewLocalDirSnapshotBackend returns a snapshot backend storing snapshots in a directory of the machine running rke, e.g. an NFS mount
+func NewLocalDirSnapshotBackend(config *v3.LocalDirBackupConfig) SnapshotBackend {
+	return &localDirSnapshotBackend{dir: config.Path}
+}
+
+func (b *localDirSnapshotBackend) Name() string {
+	return LocalDirSnapshotBackendName
+}
+
+func (b *localDirSnapshotBackend) Upload(ctx context.Context, fileName string, r io.Reader) error {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(b.dir, fileName+".part-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmpFile, r); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filepath.Join(b.dir, fileName))
+}
+
+func (b *localDirSnapshotBackend) Download(ctx context.Context, fileName string, w io.Writer) error {
+	file, err := os.Open(filepath.Join(b.dir, fileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func (b *localDirSnapshotBackend) Delete(ctx context.Context, fileName string) error {
+	if err := os.Remove(filepath.Join(b.dir, fileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *localDirSnapshotBackend) List(ctx context.Context) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []os.FileInfo
+	for _, entry := range entries {
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fileInfo)
+	}
+	return getSnapshotInfos(files), nil
+}
+
+func getSnapshotInfos(files []os.FileInfo) []SnapshotInfo {
+	var snapshots []SnapshotInfo
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), "."+EtcdSnapshotCompressedExtension) {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			FileName: file.Name(),
+			Size:     file.Size(),
+			ModTime:  file.ModTime(),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].FileName < snapshots[j].FileName
+	})
+	return snapshots
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const fakeSnapshotBackendName = "fake"
+
+// fakeSnapshotBackend is an in-memory SnapshotBackend
+type fakeSnapshotBackend struct {
+	mu        sync.Mutex
+	snapshots map[string]fakeSnapshot
+}
+
+type fakeSnapshot struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newFakeSnapshotBackend() *fakeSnapshotBackend {
+	return &fakeSnapshotBackend{
+		snapshots: map[string]fakeSnapshot{},
+	}
+}
+
+func (b *fakeSnapshotBackend) Name() string {
+	return fakeSnapshotBackendName
+}
+
+func (b *fakeSnapshotBackend) Upload(ctx context.Context, fileName string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.Put(fileName, data, time.Now())
+	return nil
+}
+
+func (b *fakeSnapshotBackend) Download(ctx context.Context, fileName string, w io.Writer) error {
+	b.mu.Lock()
+	snapshot, ok := b.snapshots[fileName]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("snapshot file [%s]: %w", fileName, os.ErrNotExist)
+	}
+	_, err := io.Copy(w, bytes.NewReader(snapshot.data))
+	return err
+}
+
+func (b *fakeSnapshotBackend) Delete(ctx context.Context, fileName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.snapshots, fileName)
+	return nil
+}
+
+func (b *fakeSnapshotBackend) List(ctx context.Context) ([]SnapshotInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var snapshots []SnapshotInfo
+	for fileName, snapshot := range b.snapshots {
+		snapshots = append(snapshots, SnapshotInfo{
+			FileName: fileName,
+			Size:     int64(len(snapshot.data)),
+			ModTime:  snapshot.modTime,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].FileName < snapshots[j].FileName
+	})
+	return snapshots, nil
+}
+
+// Put stores a snapshot with the given modification time, to seed the backend in tests
+func (b *fakeSnapshotBackend) Put(fileName string, data []byte, modTime time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.snapshots[fileName] = fakeSnapshot{data: data, modTime: modTime}
+}
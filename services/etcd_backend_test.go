@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/rancher/rke/hosts"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSnapshotBackend(t *testing.T) {
+	backend, err := NewSnapshotBackend(nil, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, backend)
+
+	backend, err = NewSnapshotBackend(&v3.BackupConfig{S3BackupConfig: &v3.S3BackupConfig{}}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, backend)
+
+	backend, err = NewSnapshotBackend(&v3.BackupConfig{S3BackupConfig: &v3.S3BackupConfig{}, Encryption: &v3.BackupEncryptionConfig{Passphrase: "secret"}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, S3SnapshotBackendName, backend.Name())
+	assert.False(t, IsS3HandledByRKETools(&v3.BackupConfig{S3BackupConfig: &v3.S3BackupConfig{}, Encryption: &v3.BackupEncryptionConfig{Passphrase: "secret"}}))
+	assert.True(t, IsS3HandledByRKETools(&v3.BackupConfig{S3BackupConfig: &v3.S3BackupConfig{}}))
+
+	backend, err = NewSnapshotBackend(&v3.BackupConfig{LocalDirBackupConfig: &v3.LocalDirBackupConfig{Path: "/mnt/nfs"}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, LocalDirSnapshotBackendName, backend.Name())
+
+	verifier, err := hosts.NewHostKeyVerifier(hosts.HostKeyCheckingTrustOnFirstUse, "", nil, nil)
+	assert.Nil(t, err)
+	backend, err = NewSnapshotBackend(&v3.BackupConfig{SFTPBackupConfig: &v3.SFTPBackupConfig{Address: "backup:22", User: "rke", Password: "secret"}}, verifier)
+	assert.Nil(t, err)
+	assert.Equal(t, SFTPSnapshotBackendName, backend.Name())
+
+	// the sftp server identity must always be verified
+	_, err = NewSnapshotBackend(&v3.BackupConfig{SFTPBackupConfig: &v3.SFTPBackupConfig{Address: "backup:22", User: "rke", Password: "secret"}}, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewSnapshotBackend(&v3.BackupConfig{SFTPBackupConfig: &v3.SFTPBackupConfig{Address: "backup:22", User: "rke", SSHKey: "not a key"}}, verifier)
+	assert.NotNil(t, err)
+}
+
+func TestSnapshotBackends(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range []SnapshotBackend{
+		newFakeSnapshotBackend(),
+		NewLocalDirSnapshotBackend(&v3.LocalDirBackupConfig{Path: t.TempDir()}),
+	} {
+		t.Run(backend.Name(), func(t *testing.T) {
+			snapshots, err := backend.List(ctx)
+			assert.Nil(t, err)
+			assert.Empty(t, snapshots)
+
+			assert.Nil(t, backend.Upload(ctx, "b.zip", strings.NewReader("snapshot b")))
+			assert.Nil(t, backend.Upload(ctx, "a.zip", strings.NewReader("snapshot a")))
+
+			snapshots, err = backend.List(ctx)
+			assert.Nil(t, err)
+			assert.Len(t, snapshots, 2)
+			assert.Equal(t, "a.zip", snapshots[0].FileName)
+			assert.Equal(t, int64(len("snapshot a")), snapshots[0].Size)
+
+			var b bytes.Buffer
+			assert.Nil(t, backend.Download(ctx, "b.zip", &b))
+			assert.Equal(t, "snapshot b", b.String())
+
+			assert.Nil(t, backend.Delete(ctx, "b.zip"))
+			assert.Nil(t, backend.Delete(ctx, "b.zip"))
+			err = backend.Download(ctx, "b.zip", &b)
+			assert.True(t, errors.Is(err, os.ErrNotExist))
+		})
+	}
+}
+
+func TestEncryptedSnapshotBackend(t *testing.T) {
+	ctx := context.Background()
+	identity, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+
+	for _, config := range []*v3.BackupEncryptionConfig{
+		{Passphrase: "secret"},
+		{Recipients: []string{identity.Recipient().String()}, Identity: identity.String()},
+	} {
+		fake := newFakeSnapshotBackend()
+		backend, err := NewEncryptedSnapshotBackend(fake, config)
+		assert.Nil(t, err)
+		assert.Nil(t, backend.Upload(ctx, "a.zip", strings.NewReader("snapshot a")))
+
+		var stored bytes.Buffer
+		assert.Nil(t, fake.Download(ctx, "a.zip", &stored))
+		assert.True(t, strings.HasPrefix(stored.String(), ageHeader))
+		assert.NotContains(t, stored.String(), "snapshot a")
+
+		var b bytes.Buffer
+		assert.Nil(t, backend.Download(ctx, "a.zip", &b))
+		assert.Equal(t, "snapshot a", b.String())
+
+		// snapshots uploaded before encryption was enabled are only usable when allowed
+		fake.Put("b.zip", []byte("snapshot b"), time.Now())
+		assert.NotNil(t, backend.Download(ctx, "b.zip", &bytes.Buffer{}))
+		allowed := *config
+		allowed.AllowUnencrypted = true
+		backend, err = NewEncryptedSnapshotBackend(fake, &allowed)
+		assert.Nil(t, err)
+		b.Reset()
+		assert.Nil(t, backend.Download(ctx, "b.zip", &b))
+		assert.Equal(t, "snapshot b", b.String())
+	}
+
+	// recipient-encrypted snapshots can't be decrypted without the identity
+	fake := newFakeSnapshotBackend()
+	backend, err := NewEncryptedSnapshotBackend(fake, &v3.BackupEncryptionConfig{Recipients: []string{identity.Recipient().String()}})
+	assert.Nil(t, err)
+	assert.Nil(t, backend.Upload(ctx, "a.zip", strings.NewReader("snapshot a")))
+	assert.NotNil(t, backend.Download(ctx, "a.zip", &bytes.Buffer{}))
+
+	_, err = NewEncryptedSnapshotBackend(fake, &v3.BackupEncryptionConfig{Passphrase: "secret", Recipients: []string{identity.Recipient().String()}})
+	assert.NotNil(t, err)
+}
+
+func TestGetSnapshotFilesMissingFromBackend(t *testing.T) {
+	backend := newFakeSnapshotBackend()
+	backend.Put("2024-01-01T00:00:00Z_etcd.zip", []byte("old"), time.Now())
+
+	stored, err := backend.List(context.Background())
+	assert.Nil(t, err)
+	hostFiles := parseEtcdSnapshotFiles("2024-01-01T00:00:00Z_etcd.zip\n2024-01-01T12:00:00Z_etcd.zip\npki.bundle.tar.gz\n")
+	assert.Equal(t, []string{"2024-01-01T00:00:00Z_etcd.zip", "2024-01-01T12:00:00Z_etcd.zip"}, hostFiles)
+	assert.Equal(t, []string{"2024-01-01T12:00:00Z_etcd.zip"}, getSnapshotFilesMissingFromBackend(hostFiles, stored))
+}
+
+func TestPruneEtcdSnapshotsOnBackend(t *testing.T) {
+	now := time.Now().UTC()
+	rollingName := func(age time.Duration) string {
+		return now.Add(-age).Format(time.RFC3339) + rollingEtcdSnapshotSuffix + "." + EtcdSnapshotCompressedExtension
+	}
+	backend := newFakeSnapshotBackend()
+	backend.Put(rollingName(time.Hour), []byte("recent"), now)
+	backend.Put(rollingName(80*time.Hour), []byte("expired"), now)
+	// one-time snapshots are kept whatever their age
+	backend.Put("before-upgrade.zip", []byte("one-time"), now.Add(-100*time.Hour))
+
+	retention := GetEtcdSnapshotRetention(&v3.BackupConfig{IntervalHours: 12, Retention: 6})
+	assert.Equal(t, 72*time.Hour, retention)
+	assert.Nil(t, PruneEtcdSnapshotsOnBackend(context.Background(), backend, retention))
+
+	stored, err := backend.List(context.Background())
+	assert.Nil(t, err)
+	var files []string
+	for _, snapshot := range stored {
+		files = append(files, snapshot.FileName)
+	}
+	assert.ElementsMatch(t, []string{rollingName(time.Hour), "before-upgrade.zip"}, files)
+}
+
+func TestParseEtcdSnapshotList(t *testing.T) {
+	output := "rke_etcd_snapshot_1.zip|1024|1718000000|d41d8cd98f00b204e9800998ecf8427e|v1.30.2-rancher1\n" +
+		"legacy_snapshot|2048|1717000000|0cc175b9c0f1b6a831c399e269772661|\n" +
+		"garbage line\n"
+	snapshots := parseEtcdSnapshotList(output)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, SnapshotInfo{
+		FileName: "legacy_snapshot",
+		Size:     2048,
+		ModTime:  time.Unix(1717000000, 0).UTC(),
+		Checksum: "0cc175b9c0f1b6a831c399e269772661",
+	}, snapshots[0])
+	assert.Equal(t, "rke_etcd_snapshot_1", GetEtcdSnapshotName(snapshots[1].FileName))
+	assert.Equal(t, "v1.30.2-rancher1", snapshots[1].KubernetesVersion)
+}
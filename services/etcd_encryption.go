@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	v3 "github.com/rancher/rke/types"
+	"github.com/sirupsen/logrus"
+)
+
+const ageHeader = "age-encryption.org/v1"
+
+// encryptedSnapshotBackend encrypts snapshot archives with age before they leave the etcd hosts and decrypts them
+// when they are downloaded. File names are kept as is, so listing and pruning work the same on encrypted targets.
+type encryptedSnapshotBackend struct {
+	SnapshotBackend
+	recipients []age.Recipient
+	identities []age.Identity
+	// allowUnencrypted lets unencrypted snapshots be downloaded, they are rejected otherwise
+	allowUnencrypted bool
+}
+
+// NewEncryptedSnapshotBackend wraps backend so snapshots are encrypted with the passphrase or recipients of the encryption config
+func NewEncryptedSnapshotBackend(backend SnapshotBackend, config *v3.BackupEncryptionConfig) (SnapshotBackend, error) {
+	recipients, identities, err := GetSnapshotEncryptionKeys(config)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedSnapshotBackend{
+		SnapshotBackend:  backend,
+		recipients:       recipients,
+		identities:       identities,
+		allowUnencrypted: config.AllowUnencrypted,
+	}, nil
+}
+
+// GetSnapshotEncryptionKeys parses the encryption config into the age recipients used to encrypt snapshots and the identities used to decrypt them
+func GetSnapshotEncryptionKeys(config *v3.BackupEncryptionConfig) ([]age.Recipient, []age.Identity, error) {
+	if len(config.Passphrase) > 0 && len(config.Recipients) > 0 {
+		return nil, nil, fmt.Errorf("snapshot encryption passphrase and recipients can't be used together")
+	}
+	if len(config.Passphrase) > 0 {
+		recipient, err := age.NewScryptRecipient(config.Passphrase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot encryption passphrase: %v", err)
+		}
+		identity, err := age.NewScryptIdentity(config.Passphrase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot encryption passphrase: %v", err)
+		}
+		return []age.Recipient{recipient}, []age.Identity{identity}, nil
+	}
+	if len(config.Recipients) == 0 {
+		return nil, nil, fmt.Errorf("snapshot encryption requires a passphrase or at least one recipient")
+	}
+	var recipients []age.Recipient
+	for _, r := range config.Recipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot encryption recipient [%s]: %v", r, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	var identities []age.Identity
+	if len(config.Identity) > 0 {
+		identity, err := age.ParseX25519Identity(config.Identity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot encryption identity: %v", err)
+		}
+		identities = append(identities, identity)
+	}
+	return recipients, identities, nil
+}
+
+func (b *encryptedSnapshotBackend) Upload(ctx context.Context, fileName string, r io.Reader) error {
+	pr, pw := io.Pipe()
+	go func() {
+		encWriter, err := age.Encrypt(pw, b.recipients...)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(encWriter, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(encWriter.Close())
+	}()
+	err := b.SnapshotBackend.Upload(ctx, fileName, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return fmt.Errorf("failed to upload encrypted snapshot file [%s]: %v", fileName, err)
+	}
+	return nil
+}
+
+func (b *encryptedSnapshotBackend) Download(ctx context.Context, fileName string, w io.Writer) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.SnapshotBackend.Download(ctx, fileName, pw))
+	}()
+	defer pr.Close()
+	br := bufio.NewReader(pr)
+	header, err := br.Peek(len(ageHeader))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Equal(header, []byte(ageHeader)) {
+		if !b.allowUnencrypted {
+			return fmt.Errorf("snapshot file [%s] on %s backend is not encrypted, set allow_unencrypted in the encryption config to restore it", fileName, b.Name())
+		}
+		logrus.Warnf("Snapshot file [%s] on %s backend is not encrypted, using it as is", fileName, b.Name())
+		_, err = io.Copy(w, br)
+		return err
+	}
+	if len(b.identities) == 0 {
+		return fmt.Errorf("snapshot file [%s] is encrypted but no identity is configured to decrypt it", fileName)
+	}
+	decReader, err := age.Decrypt(br, b.identities...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt snapshot file [%s]: %v", fileName, err)
+	}
+	if _, err := io.Copy(w, decReader); err != nil {
+		return fmt.Errorf("failed to decrypt snapshot file [%s]: %v", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	v3 "github.com/rancher/rke/types"
+)
+
+const (
+	etcdExtractDataDir    = "/tmp/etcd-extract"
+	etcdExtractOutputFile = "/tmp/etcd-extract.json"
+	etcdExtractEndpoint   = "http://127.0.0.1:2379"
+)
+
+// EtcdKeyValue is a key read from an etcd snapshot, the value is stored as is and may be encrypted
+type EtcdKeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// ExtractEtcdSnapshotKeyValues restores the snapshot in a throwaway etcd running in a one-time container on the host and returns
+// the keys under prefix matching keyRegex. The cluster's etcd is not touched.
+func ExtractEtcdSnapshotKeyValues(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]v3.PrivateRegistry, etcdBackupImage, etcdRestoreImage, snapshotName, prefix, keyRegex, k8sVersion string) ([]EtcdKeyValue, error) {
+	log.Infof(ctx, "[etcd] Extracting keys from snapshot [%s] on host [%s]", snapshotName, etcdHost.Address)
+	if err := unzipEtcdSnapshot(ctx, etcdHost, prsMap, etcdBackupImage, snapshotName, EtcdSnapshotExtractPath, EtcdSnapshotExtractContainerName, k8sVersion); err != nil {
+		return nil, err
+	}
+	etcdctl := "/usr/local/bin/etcdctl --endpoints=" + etcdExtractEndpoint
+	extractCmd := strings.Join([]string{
+		"f='" + EtcdSnapshotPath + snapshotName + "';",
+		"[ -f \"$f\" ] || f=$(find", EtcdSnapshotExtractPath, "-type f ! -name '*.rkestate' | head -n 1);",
+		"if [ -z \"$f\" ]; then echo 'snapshot file does not exist' >&2; rm -rf", EtcdSnapshotExtractPath + "; exit 1; fi;",
+		"/usr/local/bin/etcdctl snapshot restore \"$f\" --data-dir=" + etcdExtractDataDir, ">/dev/null; rc=$?;",
+		"rm -rf", EtcdSnapshotExtractPath + ";",
+		"[ $rc -eq 0 ] || exit $rc;",
+		"/usr/local/bin/etcd --data-dir=" + etcdExtractDataDir,
+		"--listen-client-urls=" + etcdExtractEndpoint, "--advertise-client-urls=" + etcdExtractEndpoint,
+		"--listen-peer-urls=http://127.0.0.1:2380 >/tmp/etcd.log 2>&1 & pid=$!;",
+		"for i in $(seq 1 30); do", etcdctl, "endpoint health >/dev/null 2>&1 && break; sleep 1; done;",
+		etcdctl, "endpoint health >/dev/null 2>&1 || { tail -n 1 /tmp/etcd.log >&2; exit 1; };",
+		etcdctl, "get --prefix --keys-only '" + prefix + "/' | grep -E '" + keyRegex + "' |",
+		"while read -r k; do", etcdctl, "get \"$k\" -w json || exit 1; done >", etcdExtractOutputFile + "; rc=$?;",
+		"kill $pid;",
+		"exit $rc",
+	}, " ")
+	var output bytes.Buffer
+	status, _, stderr, err := runEtcdSnapshotToolContainer(ctx, etcdHost, prsMap, EtcdSnapshotExtractContainerName, etcdRestoreImage, extractCmd, k8sVersion, etcdExtractOutputFile, &output)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("failed to extract keys from snapshot [%s] on host [%s], exit code [%d]: %s", snapshotName, etcdHost.Address, status, strings.TrimSpace(stderr))
+	}
+	return parseEtcdKeyValues(&output)
+}
+
+// parseEtcdKeyValues parses the concatenated output of etcdctl get -w json, keys and values are base64 encoded by etcdctl
+func parseEtcdKeyValues(r io.Reader) ([]EtcdKeyValue, error) {
+	var keyValues []EtcdKeyValue
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		var response struct {
+			Kvs []struct {
+				Key   []byte `json:"key"`
+				Value []byte `json:"value"`
+			} `json:"kvs"`
+		}
+		if err := decoder.Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to parse etcd keys: %v", err)
+		}
+		for _, kv := range response.Kvs {
+			keyValues = append(keyValues, EtcdKeyValue{Key: string(kv.Key), Value: kv.Value})
+		}
+	}
+	return keyValues, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rancher/rke/docker/dockertest"
+	"github.com/rancher/rke/hosts"
+	v3 "github.com/rancher/rke/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEtcdSnapshotStatus(t *testing.T) {
+	status, err := parseEtcdSnapshotStatus("snapshot", "1.1.1.1", `{"hash":3405691582,"revision":1234,"totalKey":567,"totalSize":8388608}`+"\n")
+	assert.Nil(t, err)
+	assert.Equal(t, &EtcdSnapshotStatus{Hash: 3405691582, Revision: 1234, TotalKey: 567, TotalSize: 8388608}, status)
+
+	_, err = parseEtcdSnapshotStatus("snapshot", "1.1.1.1", `{"hash":0,"revision":0,"totalKey":0,"totalSize":0}`)
+	assert.NotNil(t, err)
+
+	_, err = parseEtcdSnapshotStatus("snapshot", "1.1.1.1", "Deprecated: Use `etcdutl snapshot status` instead.")
+	assert.NotNil(t, err)
+}
+
+func TestParseEtcdKeyValues(t *testing.T) {
+	output := `{"header":{"revision":10},"kvs":[{"key":"L3JlZ2lzdHJ5L3NlY3JldHMvdGVhbS1hL2Ri","create_revision":2,"mod_revision":3,"version":2,"value":"azhzAA=="}],"count":1}
+{"header":{"revision":10},"kvs":[{"key":"L3JlZ2lzdHJ5L25hbWVzcGFjZXMvdGVhbS1h","value":"e30="}],"count":1}
+`
+	keyValues, err := parseEtcdKeyValues(strings.NewReader(output))
+	assert.Nil(t, err)
+	assert.Equal(t, []EtcdKeyValue{
+		{Key: "/registry/secrets/team-a/db", Value: []byte("k8s\x00")},
+		{Key: "/registry/namespaces/team-a", Value: []byte("{}")},
+	}, keyValues)
+
+	_, err = parseEtcdKeyValues(strings.NewReader("Error: context deadline exceeded"))
+	assert.NotNil(t, err)
+}
+
+func TestGetEtcdURLsIPv6(t *testing.T) {
+	etcdHosts := []*hosts.Host{
+		{RKEConfigNode: v3.RKEConfigNode{HostnameOverride: "etcd-1", InternalAddress: "fd00::1"}},
+		{RKEConfigNode: v3.RKEConfigNode{HostnameOverride: "etcd-2", InternalAddress: "10.0.0.2"}},
+	}
+	assert.Equal(t, "etcd-etcd-1=https://[fd00::1]:2380,etcd-etcd-2=https://10.0.0.2:2380", GetEtcdInitialCluster(etcdHosts))
+	assert.Equal(t, "https://[fd00::1]:2379,https://10.0.0.2:2379", GetEtcdConnString(etcdHosts, ""))
+}
+
+func TestExtractEtcdSnapshotKeyValues(t *testing.T) {
+	var started []string
+	runtime := dockertest.NewRuntime(func(name string, c *dockertest.Container) {
+		started = append(started, name)
+		if strings.Contains(c.Config.Cmd[2], "snapshot restore") {
+			c.Files[etcdExtractOutputFile] = []byte(`{"kvs":[{"key":"L3JlZ2lzdHJ5L3NlY3JldHMvZGVmYXVsdC9h","value":"dmFsdWU="}]}` + "\n")
+		}
+	})
+	etcdHost := &hosts.Host{RKEConfigNode: v3.RKEConfigNode{Address: "1.1.1.1"}, DClient: runtime}
+	keyValues, err := ExtractEtcdSnapshotKeyValues(context.Background(), etcdHost, nil, "rancher/rke-tools:v0.1.100", "rancher/mirrored-coreos-etcd:v3.5.9",
+		"snapshot", "/registry/secrets", ".*", "v1.26.4-rancher2-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []EtcdKeyValue{{Key: "/registry/secrets/default/a", Value: []byte("value")}}, keyValues)
+	// the containers run under their own name and are removed
+	assert.Equal(t, []string{EtcdSnapshotExtractContainerName, EtcdSnapshotExtractContainerName}, started)
+	assert.Empty(t, runtime.Containers())
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	v3 "github.com/rancher/rke/types"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+const NetworkRole = "network"
+
+// MigrateNetworkPlugin moves the hosts to a new network plugin in batches of maxUnavailable hosts. Each host of a batch is cordoned,
+// drained and migrated by migrateHost, the next batch starts once every host of the batch is ready and uncordoned again.
+func MigrateNetworkPlugin(ctx context.Context, kubeClient *kubernetes.Clientset, allHosts []*hosts.Host, maxUnavailable int, upgradeStrategy *v3.NodeUpgradeStrategy,
+	cloudProviderName string, migrateHost func(*hosts.Host) error) error {
+	if maxUnavailable < 1 {
+		maxUnavailable = 1
+	}
+	// the pods keep the network of the old plugin until they are recreated, so the hosts are always drained
+	drainHelper := getDrainHelper(kubeClient, *upgradeStrategy)
+	for start := 0; start < len(allHosts); start += maxUnavailable {
+		batch := allHosts[start:min(start+maxUnavailable, len(allHosts))]
+		var hostnames []string
+		for _, host := range batch {
+			hostnames = append(hostnames, host.HostnameOverride)
+		}
+		log.Infof(ctx, "[%s] Migrating hosts [%s] to the new network plugin", NetworkRole, strings.Join(hostnames, ","))
+		var errgrp errgroup.Group
+		for _, host := range batch {
+			runHost := host
+			errgrp.Go(func() error {
+				err := migrateNetworkPluginHost(kubeClient, runHost, drainHelper, cloudProviderName, migrateHost)
+				recordHost(ctx, runHost, err)
+				return err
+			})
+		}
+		if err := errgrp.Wait(); err != nil {
+			return fmt.Errorf("[%s] Failed to migrate hosts [%s], the remaining hosts were not migrated: %v", NetworkRole, strings.Join(hostnames, ","), err)
+		}
+	}
+	return nil
+}
+
+func migrateNetworkPluginHost(kubeClient *kubernetes.Clientset, runHost *hosts.Host, drainHelper drain.Helper, cloudProviderName string, migrateHost func(*hosts.Host) error) error {
+	if err := cordonAndDrainNode(kubeClient, runHost, true, drainHelper, NetworkRole, cloudProviderName); err != nil {
+		return err
+	}
+	if err := migrateHost(runHost); err != nil {
+		return err
+	}
+	if err := CheckNodeReady(kubeClient, runHost, NetworkRole, cloudProviderName); err != nil {
+		return err
+	}
+	return k8s.CordonUncordon(kubeClient, runHost.HostnameOverride, runHost.InternalAddress, cloudProviderName, false)
+}
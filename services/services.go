@@ -36,6 +36,10 @@ const (
 	EtcdServeBackupContainerName                = "etcd-Serve-backup"
 	EtcdChecksumContainerName                   = "etcd-checksum-checker"
 	EtcdStateFileContainerName                  = "etcd-extract-statefile"
+	EtcdSnapshotTransferContainerName           = "etcd-snapshot-transfer"
+	EtcdSnapshotListContainerName               = "etcd-snapshot-list"
+	EtcdSnapshotVerifyContainerName             = "etcd-snapshot-verify"
+	EtcdSnapshotExtractContainerName            = "etcd-snapshot-extract"
 	ControlPlaneConfigMapStateFileContainerName = "extract-statefile-configmap"
 	NginxProxyContainerName                     = "nginx-proxy"
 	SidekickContainerName                       = "service-sidekick"
@@ -37,6 +37,7 @@ func RunWorkerPlane(ctx context.Context, allHosts []*hosts.Host, localConnDialer
 			for host := range hostsQueue {
 				runHost := host.(*hosts.Host)
 				err := doDeployWorkerPlaneHost(ctx, runHost, localConnDialerFactory, prsMap, workerNodePlanMap[runHost.Address].Processes, certMap, updateWorkersOnly, alpineImage, k8sVersion)
+				recordHost(ctx, runHost, err)
 				if err != nil {
 					errList = append(errList, err)
 				}
@@ -124,7 +125,9 @@ func processWorkerPlaneForUpgrade(ctx context.Context, kubeClient *kubernetes.Cl
 				runHost := host.(*hosts.Host)
 				logrus.Infof("[workerplane] Processing host %v", runHost.HostnameOverride)
 				if newHosts[runHost.HostnameOverride] {
-					if err := doDeployWorkerPlaneHost(ctx, runHost, localConnDialerFactory, prsMap, workerNodePlanMap[runHost.Address].Processes, certMap, updateWorkersOnly, alpineImage, k8sVersion); err != nil {
+					err := doDeployWorkerPlaneHost(ctx, runHost, localConnDialerFactory, prsMap, workerNodePlanMap[runHost.Address].Processes, certMap, updateWorkersOnly, alpineImage, k8sVersion)
+					recordHost(ctx, runHost, err)
+					if err != nil {
 						errList = append(errList, err)
 						hostsFailedToUpgrade <- runHost.HostnameOverride
 						hostsFailed.Store(runHost.HostnameOverride, true)
@@ -133,6 +136,7 @@ func processWorkerPlaneForUpgrade(ctx context.Context, kubeClient *kubernetes.Cl
 					continue
 				}
 				if err := CheckNodeReady(kubeClient, runHost, WorkerRole, cloudProviderName); err != nil {
+					recordHost(ctx, runHost, err)
 					errList = append(errList, err)
 					hostsFailed.Store(runHost.HostnameOverride, true)
 					hostsFailedToUpgrade <- runHost.HostnameOverride
@@ -160,6 +164,7 @@ func processWorkerPlaneForUpgrade(ctx context.Context, kubeClient *kubernetes.Cl
 				}
 				upgradable, err := isWorkerHostUpgradable(ctx, runHost, workerNodePlanMap[runHost.Address].Processes, k8sVersion)
 				if err != nil {
+					recordHost(ctx, runHost, err)
 					errList = append(errList, err)
 					hostsFailed.Store(runHost.HostnameOverride, true)
 					hostsFailedToUpgrade <- runHost.HostnameOverride
@@ -171,10 +176,13 @@ func processWorkerPlaneForUpgrade(ctx context.Context, kubeClient *kubernetes.Cl
 						// This node didn't undergo an upgrade, so RKE will only log any error after uncordoning it and won't count this in maxUnavailable
 						logrus.Errorf("[workerplane] Failed to uncordon node %v, error: %v", runHost.HostnameOverride, err)
 					}
+					recordHost(ctx, runHost, nil)
 					continue
 				}
-				if err := upgradeWorkerHost(ctx, kubeClient, runHost, upgradeStrategy.Drain != nil && *upgradeStrategy.Drain, drainHelper, localConnDialerFactory, prsMap, workerNodePlanMap, certMap,
-					updateWorkersOnly, alpineImage, k8sVersion, cloudProviderName); err != nil {
+				err = upgradeWorkerHost(ctx, kubeClient, runHost, upgradeStrategy.Drain != nil && *upgradeStrategy.Drain, drainHelper, localConnDialerFactory, prsMap, workerNodePlanMap, certMap,
+					updateWorkersOnly, alpineImage, k8sVersion, cloudProviderName)
+				recordHost(ctx, runHost, err)
+				if err != nil {
 					errList = append(errList, err)
 					hostsFailed.Store(runHost.HostnameOverride, true)
 					hostsFailedToUpgrade <- runHost.HostnameOverride
@@ -319,12 +327,27 @@ func doDeployWorkerPlane(ctx context.Context, host *hosts.Host,
 	if err := runKubelet(ctx, host, localConnDialerFactory, prsMap, processMap[KubeletContainerName], certMap, alpineImage, k8sVersion); err != nil {
 		return err
 	}
-	return runKubeproxy(ctx, host, localConnDialerFactory, prsMap, processMap[KubeproxyContainerName], alpineImage, k8sVersion)
+	kubeProxyProcess, ok := processMap[KubeproxyContainerName]
+	if !ok {
+		// kube-proxy is replaced by the network plugin
+		return removeKubeproxy(ctx, host)
+	}
+	return runKubeproxy(ctx, host, localConnDialerFactory, prsMap, kubeProxyProcess, alpineImage, k8sVersion)
 }
 
 func isWorkerHostUpgradable(ctx context.Context, host *hosts.Host, processMap map[string]v3.Process, k8sVersion string) (bool, error) {
 	for _, service := range []string{NginxProxyContainerName, SidekickContainerName, KubeletContainerName, KubeproxyContainerName} {
-		process := processMap[service]
+		process, ok := processMap[service]
+		if !ok && service == KubeproxyContainerName {
+			// kube-proxy is replaced by the network plugin, the host is upgraded to remove it
+			if _, err := docker.InspectContainer(ctx, host.DClient, host.Address, service); err == nil {
+				logrus.Debugf("[%s] Host %v is upgradable because %v needs to be removed", WorkerRole, host.HostnameOverride, service)
+				return true, nil
+			} else if !client.IsErrNotFound(err) {
+				return false, err
+			}
+			continue
+		}
 		imageCfg, hostCfg, _ := GetProcessConfig(process, host, k8sVersion)
 		upgradable, err := docker.IsContainerUpgradable(ctx, host.DClient, imageCfg, hostCfg, service, host.Address, WorkerRole)
 		if err != nil {
@@ -0,0 +1,445 @@
+package templates
+
+// CiliumTemplate is the Cilium network plugin manifest used when the metadata doesn't ship one for the cluster version
+const CiliumTemplate = `
+{{- if eq .RBACConfig "rbac"}}
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cilium
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cilium-operator
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cilium
+rules:
+- apiGroups: ["networking.k8s.io"]
+  resources: ["networkpolicies"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["discovery.k8s.io"]
+  resources: ["endpointslices"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["namespaces", "services", "pods", "endpoints", "nodes"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["nodes/status"]
+  verbs: ["patch"]
+- apiGroups: ["apiextensions.k8s.io"]
+  resources: ["customresourcedefinitions"]
+  verbs: ["list", "watch", "get"]
+- apiGroups: ["cilium.io"]
+  resources: ["*"]
+  verbs: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cilium-operator
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list", "watch", "delete"]
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["list", "watch"]
+- apiGroups: [""]
+  resources: ["nodes", "nodes/status"]
+  verbs: ["patch"]
+- apiGroups: [""]
+  resources: ["namespaces", "services", "endpoints"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["services/status"]
+  verbs: ["update", "patch"]
+- apiGroups: ["discovery.k8s.io"]
+  resources: ["endpointslices"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["apiextensions.k8s.io"]
+  resources: ["customresourcedefinitions"]
+  verbs: ["create", "get", "list", "watch", "update"]
+- apiGroups: ["cilium.io"]
+  resources: ["*"]
+  verbs: ["*"]
+- apiGroups: ["coordination.k8s.io"]
+  resources: ["leases"]
+  verbs: ["create", "get", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cilium
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cilium
+subjects:
+- kind: ServiceAccount
+  name: cilium
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cilium-operator
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cilium-operator
+subjects:
+- kind: ServiceAccount
+  name: cilium-operator
+  namespace: kube-system
+{{- end}}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cilium-config
+  namespace: kube-system
+data:
+  identity-allocation-mode: crd
+  cluster-name: default
+  cluster-id: "0"
+  ipam: "{{.IPAMMode}}"
+{{- if eq .IPAMMode "cluster-pool"}}
+{{- if .ClusterCIDRIPv4}}
+  cluster-pool-ipv4-cidr: "{{.ClusterCIDRIPv4}}"
+  cluster-pool-ipv4-mask-size: "24"
+{{- end}}
+{{- if .ClusterCIDRIPv6}}
+  cluster-pool-ipv6-cidr: "{{.ClusterCIDRIPv6}}"
+  cluster-pool-ipv6-mask-size: "64"
+{{- end}}
+{{- end}}
+  enable-ipv4: "{{if .ClusterCIDRIPv4}}true{{else}}false{{end}}"
+  enable-ipv6: "{{if .ClusterCIDRIPv6}}true{{else}}false{{end}}"
+{{- if eq .TunnelProtocol "disabled"}}
+  routing-mode: native
+{{- if .ClusterCIDRIPv4}}
+  ipv4-native-routing-cidr: "{{.ClusterCIDRIPv4}}"
+{{- end}}
+{{- if .ClusterCIDRIPv6}}
+  ipv6-native-routing-cidr: "{{.ClusterCIDRIPv6}}"
+{{- end}}
+  auto-direct-node-routes: "true"
+{{- else}}
+  routing-mode: tunnel
+  tunnel-protocol: "{{.TunnelProtocol}}"
+{{- end}}
+  kube-proxy-replacement: "{{.KubeProxyReplacement}}"
+  enable-ipv4-masquerade: "{{if .ClusterCIDRIPv4}}true{{else}}false{{end}}"
+  enable-ipv6-masquerade: "{{if .ClusterCIDRIPv6}}true{{else}}false{{end}}"
+  enable-bpf-masquerade: "false"
+  enable-health-checking: "true"
+  enable-endpoint-health-checking: "true"
+  agent-health-port: "9879"
+  cni-exclusive: "true"
+  write-cni-conf-when-ready: /host/etc/cni/net.d/05-cilium.conflist
+  bpf-root: /sys/fs/bpf
+  cgroup-root: /sys/fs/cgroup
+  enable-policy: default
+{{- if .MTU}}
+  mtu: "{{.MTU}}"
+{{- end}}
+{{- if eq .EnableHubble "true"}}
+  enable-hubble: "true"
+  hubble-socket-path: /var/run/cilium/hubble.sock
+  hubble-listen-address: ":4244"
+  hubble-disable-tls: "true"
+{{- else}}
+  enable-hubble: "false"
+{{- end}}
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: cilium
+  namespace: kube-system
+  labels:
+    k8s-app: cilium
+spec:
+  selector:
+    matchLabels:
+      k8s-app: cilium
+{{- if .UpdateStrategy}}
+  updateStrategy:
+{{ toYaml .UpdateStrategy | indent 4}}
+{{- end}}
+  template:
+    metadata:
+      labels:
+        k8s-app: cilium
+    spec:
+      hostNetwork: true
+{{- if eq .RBACConfig "rbac"}}
+      serviceAccountName: cilium
+{{- end}}
+      priorityClassName: {{if .CiliumPriorityClassName}}{{.CiliumPriorityClassName}}{{else}}system-node-critical{{end}}
+      terminationGracePeriodSeconds: 1
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+              - matchExpressions:
+                  - key: beta.kubernetes.io/os
+                    operator: NotIn
+                    values:
+                      - windows
+{{- if .NodeSelector}}
+      nodeSelector:
+      {{- range $k, $v := .NodeSelector}}
+        {{ $k }}: "{{ $v }}"
+      {{- end}}
+{{- end}}
+      tolerations:
+      - operator: Exists
+      initContainers:
+      - name: mount-bpf-fs
+        image: {{.Image}}
+        command: ["/bin/bash", "-c", "mount | grep '/sys/fs/bpf type bpf' || mount -t bpf bpf /sys/fs/bpf"]
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: bpf-maps
+          mountPath: /sys/fs/bpf
+          mountPropagation: Bidirectional
+      - name: clean-cilium-state
+        image: {{.Image}}
+        command: ["/init-container.sh"]
+        env:
+        - name: CILIUM_ALL_STATE
+          valueFrom:
+            configMapKeyRef:
+              name: cilium-config
+              key: clean-cilium-state
+              optional: true
+        - name: CILIUM_BPF_STATE
+          valueFrom:
+            configMapKeyRef:
+              name: cilium-config
+              key: clean-cilium-bpf-state
+              optional: true
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: bpf-maps
+          mountPath: /sys/fs/bpf
+        - name: cilium-cgroup
+          mountPath: /sys/fs/cgroup
+          mountPropagation: HostToContainer
+        - name: cilium-run
+          mountPath: /var/run/cilium
+      - name: install-cni-binaries
+        image: {{.Image}}
+        command: ["/install-plugin.sh"]
+        volumeMounts:
+        - name: cni-path
+          mountPath: /host/opt/cni/bin
+      containers:
+      - name: cilium-agent
+        image: {{.Image}}
+        command: ["cilium-agent"]
+        args: ["--config-dir=/tmp/cilium/config-map"]
+        env:
+        - name: K8S_NODE_NAME
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: spec.nodeName
+        - name: CILIUM_K8S_NAMESPACE
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: metadata.namespace
+{{- if eq .KubeProxyReplacement "true"}}
+        # the service addresses are served by Cilium, the API server is reached through the local proxy of the node
+        - name: KUBERNETES_SERVICE_HOST
+          value: "{{.K8sServiceHost}}"
+        - name: KUBERNETES_SERVICE_PORT
+          value: "{{.K8sServicePort}}"
+{{- end}}
+        livenessProbe:
+          httpGet:
+            host: "127.0.0.1"
+            path: /healthz
+            port: 9879
+            scheme: HTTP
+            httpHeaders:
+            - name: "brief"
+              value: "true"
+          periodSeconds: 30
+          failureThreshold: 10
+        readinessProbe:
+          httpGet:
+            host: "127.0.0.1"
+            path: /healthz
+            port: 9879
+            scheme: HTTP
+            httpHeaders:
+            - name: "brief"
+              value: "true"
+          periodSeconds: 30
+          failureThreshold: 3
+        startupProbe:
+          httpGet:
+            host: "127.0.0.1"
+            path: /healthz
+            port: 9879
+            scheme: HTTP
+            httpHeaders:
+            - name: "brief"
+              value: "true"
+          periodSeconds: 2
+          failureThreshold: 105
+        lifecycle:
+          preStop:
+            exec:
+              command: ["/cni-uninstall.sh"]
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: bpf-maps
+          mountPath: /sys/fs/bpf
+          mountPropagation: HostToContainer
+        - name: cilium-cgroup
+          mountPath: /sys/fs/cgroup
+          mountPropagation: HostToContainer
+        - name: cilium-run
+          mountPath: /var/run/cilium
+        - name: etc-cni-netd
+          mountPath: /host/etc/cni/net.d
+        - name: cilium-config-path
+          mountPath: /tmp/cilium/config-map
+          readOnly: true
+        - name: lib-modules
+          mountPath: /lib/modules
+          readOnly: true
+        - name: xtables-lock
+          mountPath: /run/xtables.lock
+      volumes:
+      - name: cilium-run
+        hostPath:
+          path: /var/run/cilium
+          type: DirectoryOrCreate
+      - name: bpf-maps
+        hostPath:
+          path: /sys/fs/bpf
+          type: DirectoryOrCreate
+      - name: cilium-cgroup
+        hostPath:
+          path: /sys/fs/cgroup
+          type: DirectoryOrCreate
+      - name: cni-path
+        hostPath:
+          path: /opt/cni/bin
+          type: DirectoryOrCreate
+      - name: etc-cni-netd
+        hostPath:
+          path: /etc/cni/net.d
+          type: DirectoryOrCreate
+      - name: lib-modules
+        hostPath:
+          path: /lib/modules
+      - name: xtables-lock
+        hostPath:
+          path: /run/xtables.lock
+          type: FileOrCreate
+      - name: cilium-config-path
+        configMap:
+          name: cilium-config
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cilium-operator
+  namespace: kube-system
+  labels:
+    io.cilium/app: operator
+    name: cilium-operator
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      io.cilium/app: operator
+      name: cilium-operator
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 25%
+      maxUnavailable: 100%
+  template:
+    metadata:
+      labels:
+        io.cilium/app: operator
+        name: cilium-operator
+    spec:
+      hostNetwork: true
+{{- if eq .RBACConfig "rbac"}}
+      serviceAccountName: cilium-operator
+{{- end}}
+      priorityClassName: system-cluster-critical
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+              - matchExpressions:
+                  - key: beta.kubernetes.io/os
+                    operator: NotIn
+                    values:
+                      - windows
+{{- if .NodeSelector}}
+      nodeSelector:
+      {{- range $k, $v := .NodeSelector}}
+        {{ $k }}: "{{ $v }}"
+      {{- end}}
+{{- end}}
+      tolerations:
+      - operator: Exists
+      containers:
+      - name: cilium-operator
+        image: {{.OperatorImage}}
+        command: ["cilium-operator-generic"]
+        args: ["--config-dir=/tmp/cilium/config-map"]
+        env:
+        - name: K8S_NODE_NAME
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: spec.nodeName
+        - name: CILIUM_K8S_NAMESPACE
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: metadata.namespace
+{{- if eq .KubeProxyReplacement "true"}}
+        - name: KUBERNETES_SERVICE_HOST
+          value: "{{.K8sServiceHost}}"
+        - name: KUBERNETES_SERVICE_PORT
+          value: "{{.K8sServicePort}}"
+{{- end}}
+        livenessProbe:
+          httpGet:
+            host: "127.0.0.1"
+            path: /healthz
+            port: 9234
+            scheme: HTTP
+          initialDelaySeconds: 60
+          periodSeconds: 10
+          timeoutSeconds: 3
+        volumeMounts:
+        - name: cilium-config-path
+          mountPath: /tmp/cilium/config-map
+          readOnly: true
+      volumes:
+      - name: cilium-config-path
+        configMap:
+          name: cilium-config
+`
@@ -0,0 +1,83 @@
+package templates
+
+// HardeningNetworkPolicyTemplate denies the ingress traffic to the pods of the system namespaces, except from their own namespace
+// and to the pods serving the whole cluster
+const HardeningNetworkPolicyTemplate = `
+{{- range $i, $namespace := .Namespaces}}
+{{- if $i}}
+---
+{{- end}}
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: default-deny-ingress
+  namespace: {{$namespace}}
+spec:
+  podSelector: {}
+  policyTypes:
+  - Ingress
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-same-namespace
+  namespace: {{$namespace}}
+spec:
+  podSelector: {}
+  policyTypes:
+  - Ingress
+  ingress:
+  - from:
+    - podSelector: {}
+{{- if eq $namespace "kube-system"}}
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-dns
+  namespace: kube-system
+spec:
+  podSelector:
+    matchLabels:
+      k8s-app: kube-dns
+  policyTypes:
+  - Ingress
+  ingress:
+  - ports:
+    - protocol: UDP
+      port: 53
+    - protocol: TCP
+      port: 53
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-metrics-server
+  namespace: kube-system
+spec:
+  podSelector:
+    matchLabels:
+      k8s-app: metrics-server
+  policyTypes:
+  - Ingress
+  ingress:
+  - {}
+{{- end}}
+{{- if eq $namespace "ingress-nginx"}}
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-ingress-nginx
+  namespace: ingress-nginx
+spec:
+  podSelector:
+    matchLabels:
+      app: ingress-nginx
+  policyTypes:
+  - Ingress
+  ingress:
+  - {}
+{{- end}}
+{{- end}}
+`
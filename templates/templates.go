@@ -16,6 +16,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// defaultTemplates are the templates used for the k8s versions the metadata has no template of the addon for
+var defaultTemplates = map[string]string{
+	kdm.Cilium: CiliumTemplate,
+}
+
 func CompileTemplateFromMap(tmplt string, configMap interface{}) (string, error) {
 	out := new(bytes.Buffer)
 	templateFuncMap := sprig.TxtFuncMap()
@@ -57,7 +62,10 @@ func ToYAML(v interface{}) string {
 }
 
 func getTemplate(templateName, k8sVersion string) (string, error) {
-	versionData := metadata.K8sVersionToTemplates[templateName]
+	versionData, ok := metadata.K8sVersionToTemplates[templateName]
+	if defaultTemplate, hasDefault := defaultTemplates[templateName]; hasDefault && (!ok || len(versionData) == 0) {
+		return defaultTemplate, nil
+	}
 	toMatch, err := semver.Make(k8sVersion[1:])
 	if err != nil {
 		return "", fmt.Errorf("k8sVersion not sem-ver %s %v", k8sVersion, err)
@@ -19,6 +19,12 @@ type BackupConfig struct {
 	Retention int `yaml:"retention" json:"retention,omitempty" norman:"default=6"`
 	// s3 target
 	S3BackupConfig *S3BackupConfig `yaml:",omitempty" json:"s3BackupConfig"`
+	// sftp target
+	SFTPBackupConfig *SFTPBackupConfig `yaml:"sftp_backup_config,omitempty" json:"sftpBackupConfig,omitempty"`
+	// local directory target, on the machine running rke
+	LocalDirBackupConfig *LocalDirBackupConfig `yaml:"local_dir_backup_config,omitempty" json:"localDirBackupConfig,omitempty"`
+	// encryption of the snapshots stored on the remote target, encrypted snapshots are uploaded to s3 by rke instead of rke-tools
+	Encryption *BackupEncryptionConfig `yaml:"encryption,omitempty" json:"encryption,omitempty"`
 	// replace special characters in snapshot names
 	SafeTimestamp bool `yaml:"safe_timestamp" json:"safeTimestamp,omitempty"`
 	// Backup execution timeout
@@ -42,6 +48,38 @@ type S3BackupConfig struct {
 	Folder string `yaml:"folder" json:"folder,omitempty"`
 }
 
+type SFTPBackupConfig struct {
+	// Address of the sftp server, in host:port format
+	Address string `yaml:"address" json:"address,omitempty"`
+	// User to authenticate with
+	User string `yaml:"user" json:"user,omitempty"`
+	// Password to authenticate with
+	Password string `yaml:"password" json:"password,omitempty" norman:"type=password"`
+	// SSH private key to authenticate with
+	SSHKey string `yaml:"ssh_key" json:"sshKey,omitempty" norman:"type=password"`
+	// Public key of the server in authorized_keys format, if empty the host key is checked against ssh_known_hosts_path
+	// and trusted on first use unless ssh_host_key_checking is strict
+	HostKey string `yaml:"host_key" json:"hostKey,omitempty"`
+	// Folder to place the files
+	Folder string `yaml:"folder" json:"folder,omitempty"`
+}
+
+type LocalDirBackupConfig struct {
+	// Directory to place the files, e.g. an NFS mount
+	Path string `yaml:"path" json:"path,omitempty"`
+}
+
+type BackupEncryptionConfig struct {
+	// Passphrase to encrypt and decrypt snapshots with
+	Passphrase string `yaml:"passphrase" json:"passphrase,omitempty" norman:"type=password"`
+	// age public keys to encrypt snapshots for, can't be used with a passphrase
+	Recipients []string `yaml:"recipients" json:"recipients,omitempty"`
+	// age private key to decrypt snapshots encrypted for recipients, only needed to restore
+	Identity string `yaml:"identity" json:"identity,omitempty" norman:"type=password"`
+	// restore snapshots stored unencrypted on the remote target, e.g. taken before encryption was enabled
+	AllowUnencrypted bool `yaml:"allow_unencrypted" json:"allowUnencrypted,omitempty"`
+}
+
 type EtcdBackupSpec struct {
 	// cluster ID
 	ClusterID string `json:"clusterId,omitempty" norman:"required,type=reference[cluster],noupdate"`
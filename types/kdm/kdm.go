@@ -12,6 +12,7 @@ const (
 	Flannel       = "flannel"
 	Weave         = "weave"
 	Aci           = "aci"
+	Cilium        = "cilium"
 	CoreDNS       = "coreDNS"
 	KubeDNS       = "kubeDNS"
 	MetricsServer = "metricsServer"
@@ -29,6 +29,15 @@ type RancherKubernetesEngineConfig struct {
 	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty" norman:"nocreate,noupdate"`
 	// SSH Agent Auth enable
 	SSHAgentAuth bool `yaml:"ssh_agent_auth" json:"sshAgentAuth"`
+	// Optional - Passphrase of the SSH Private Key
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase,omitempty" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// Optional - SSH host key checking mode, strict only accepts known host keys, trust-on-first-use records the host
+	// keys of new hosts in the state file and rejects changed host keys
+	SSHHostKeyChecking string `yaml:"ssh_host_key_checking,omitempty" json:"sshHostKeyChecking,omitempty" norman:"type=enum,options=strict|trust-on-first-use"`
+	// Optional - Path of a known_hosts file with the SSH host keys of the nodes and the bastion host
+	SSHKnownHostsPath string `yaml:"ssh_known_hosts_path,omitempty" json:"sshKnownHostsPath,omitempty"`
+	// Optional - Listener of the tunnels opened by the node agents of the nodes with connection_type agent
+	AgentTunnel *AgentTunnelConfig `yaml:"agent_tunnel,omitempty" json:"agentTunnel,omitempty"`
 	// Authorization mode configuration used in the cluster
 	Authorization AuthzConfig `yaml:"authorization" json:"authorization,omitempty"`
 	// Enable/disable strict docker version checking
@@ -69,6 +78,13 @@ type RancherKubernetesEngineConfig struct {
 	CRIDockerdStreamServerAddress string `yaml:"cri_dockerd_stream_server_address" json:"criDockerdStreamServerAddress,omitempty"`
 	// Stream Server Port for cri-dockerd
 	CRIDockerdStreamServerPort string `yaml:"cri_dockerd_stream_server_port" json:"criDockerdStreamServerPort,omitempty"`
+	// Number of hosts processed at the same time
+	Parallelism *ParallelismConfig `yaml:"parallelism,omitempty" json:"parallelism,omitempty"`
+	// Certificates generation options
+	Certificates *CertificatesConfig `yaml:"certificates,omitempty" json:"certificates,omitempty"`
+	// Hardening profile applied to the cluster, cis-1.<benchmark version> like cis-1.24. The kubelet protects the kernel defaults,
+	// the sysctls the benchmark lists must be set on the hosts
+	HardeningProfile string `yaml:"hardening_profile,omitempty" json:"hardeningProfile,omitempty"`
 }
 
 func (r *RancherKubernetesEngineConfig) ObjClusterName() string {
@@ -84,6 +100,77 @@ type NodeUpgradeStrategy struct {
 	DrainInput                 *NodeDrainInput `yaml:"node_drain_input" json:"nodeDrainInput,omitempty"`
 }
 
+type ParallelismConfig struct {
+	// Maximum number of hosts processed at the same time by any phase, defaults to 50
+	MaxHosts int `yaml:"max_hosts" json:"maxHosts,omitempty" norman:"min=1,default=50"`
+	// Maximum number of hosts connected to at the same time, limit it to stay under the MaxStartups of a bastion host
+	TunnelHosts int `yaml:"tunnel_hosts" json:"tunnelHosts,omitempty"`
+	// Maximum number of hosts files are deployed to at the same time
+	DeployFiles int `yaml:"deploy_files" json:"deployFiles,omitempty"`
+	// Maximum number of hosts certificates are deployed to at the same time
+	DeployCertificates int `yaml:"deploy_certificates" json:"deployCertificates,omitempty"`
+	// Maximum number of hosts pulling images at the same time
+	PullImages int `yaml:"pull_images" json:"pullImages,omitempty"`
+	// Maximum number of hosts cleaned up at the same time
+	Cleanup int `yaml:"cleanup" json:"cleanup,omitempty"`
+	// Maximum number of images pulled at the same time from the same registry, unlimited when not set
+	RegistryPulls int `yaml:"registry_pulls" json:"registryPulls,omitempty"`
+}
+
+type CertificatesConfig struct {
+	// Algorithm of the generated private keys, existing keys are kept until the certificates are rotated
+	KeyAlgorithm string `yaml:"key_algorithm" json:"keyAlgorithm,omitempty" norman:"type=enum,options=rsa|ecdsa-p256|ecdsa-p384|ed25519,default=rsa"`
+	// Validity of the generated CA certificates as a number of days (365d), years of 365 days (10y) or hours (87600h), defaults to 10 years
+	CAValidity string `yaml:"ca_validity" json:"caValidity,omitempty"`
+	// Validity of the generated kube-apiserver and kubelet serving certificates, in the format of ca_validity, defaults to the CA validity up to 10 years
+	ServingValidity string `yaml:"serving_validity" json:"servingValidity,omitempty"`
+	// Validity of the generated client certificates of the Kubernetes components, the API proxy and the admin, in the format of ca_validity,
+	// defaults to the CA validity up to 10 years
+	ClientValidity string `yaml:"client_validity" json:"clientValidity,omitempty"`
+	// Validity of the generated etcd peer and server certificates, in the format of ca_validity, defaults to the CA validity up to 10 years
+	EtcdValidity string `yaml:"etcd_validity" json:"etcdValidity,omitempty"`
+	// Intermediate CA used as the cluster CA instead of a self-signed CA
+	IntermediateCA *IntermediateCAConfig `yaml:"intermediate_ca,omitempty" json:"intermediateCa,omitempty"`
+	// Vault PKI secrets engine signing the cluster certificates instead of the cluster CA key
+	Vault *VaultSignerConfig `yaml:"vault,omitempty" json:"vault,omitempty"`
+}
+
+type AgentTunnelConfig struct {
+	// Address the rke process listens on for the tunnels of the node agents, defaults to 0.0.0.0:9443
+	ListenAddress string `yaml:"listen_address" json:"listenAddress,omitempty"`
+	// Token the tokens of the node agents are derived from, each node agent authenticates with the token of its node
+	// returned by rke util get-agent-token
+	Token string `yaml:"token" json:"token,omitempty" norman:"type=password"`
+	// Optional - TLS certificate and key of the listener, the tunnels are only encrypted by SSH when not set and
+	// ssh_host_key_checking is then required
+	TLSCertPath string `yaml:"tls_cert_path,omitempty" json:"tlsCertPath,omitempty"`
+	TLSKeyPath  string `yaml:"tls_key_path,omitempty" json:"tlsKeyPath,omitempty"`
+	// Timeout in seconds waiting for the node agent of a node to connect, defaults to 60
+	ConnectTimeout int `yaml:"connect_timeout,omitempty" json:"connectTimeout,omitempty"`
+}
+
+type IntermediateCAConfig struct {
+	// PEM encoded intermediate CA certificate followed by the certificates of its issuers up to the root CA
+	Certificate string `yaml:"certificate" json:"certificate,omitempty"`
+	// PEM encoded private key of the intermediate CA
+	Key string `yaml:"key" json:"key,omitempty" norman:"type=password"`
+}
+
+type VaultSignerConfig struct {
+	// Address of the Vault server (example, https://vault.example.com:8200)
+	Address string `yaml:"address" json:"address,omitempty"`
+	// Mount path of the PKI secrets engine, defaults to pki
+	Mount string `yaml:"mount" json:"mount,omitempty"`
+	// Role restricting the signed certificates, the certificates are signed with sign-verbatim to keep the subject of the components
+	Role string `yaml:"role" json:"role,omitempty"`
+	// Token used to authenticate, defaults to the VAULT_TOKEN environment variable
+	Token string `yaml:"token" json:"token,omitempty" norman:"type=password"`
+	// Vault Enterprise namespace
+	Namespace string `yaml:"namespace" json:"namespace,omitempty"`
+	// PEM encoded CA certificates used to verify the Vault server certificate
+	CACert string `yaml:"ca_cert" json:"caCert,omitempty"`
+}
+
 type BastionHost struct {
 	// Address of Bastion Host
 	Address string `yaml:"address" json:"address,omitempty"`
@@ -101,8 +188,39 @@ type BastionHost struct {
 	SSHCert string `yaml:"ssh_cert" json:"sshCert,omitempty"`
 	// SSH Certificate Path
 	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty"`
+	// Optional - Passphrase of the SSH Private Key
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase,omitempty" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// Optional - SSH host keys of the bastion host in authorized_keys format, host certificate authorities are prefixed with @cert-authority
+	HostKey string `yaml:"host_key,omitempty" json:"hostKey,omitempty"`
 	// Ignore proxy environment variables
 	IgnoreProxyEnvVars bool `yaml:"ignore_proxy_env_vars" json:"ignoreProxyEnvVars,omitempty"`
+	// Optional - Jump hosts to go through, in order, to reach the bastion host
+	Hops []BastionHop `yaml:"hops,omitempty" json:"hops,omitempty"`
+	// Optional - URL of the SOCKS5 or HTTP CONNECT proxy used to reach the first jump host or the bastion host
+	Proxy string `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+}
+
+type BastionHop struct {
+	// Address of the jump host
+	Address string `yaml:"address" json:"address,omitempty"`
+	// SSH Port of the jump host
+	Port string `yaml:"port" json:"port,omitempty"`
+	// ssh User to the jump host
+	User string `yaml:"user" json:"user,omitempty"`
+	// SSH Agent Auth enable
+	SSHAgentAuth bool `yaml:"ssh_agent_auth,omitempty" json:"sshAgentAuth,omitempty"`
+	// SSH Private Key
+	SSHKey string `yaml:"ssh_key" json:"sshKey,omitempty" norman:"type=password"`
+	// SSH Private Key Path
+	SSHKeyPath string `yaml:"ssh_key_path" json:"sshKeyPath,omitempty"`
+	// SSH Certificate
+	SSHCert string `yaml:"ssh_cert" json:"sshCert,omitempty"`
+	// SSH Certificate Path
+	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty"`
+	// Optional - Passphrase of the SSH Private Key
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase,omitempty" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// Optional - SSH host keys of the jump host in authorized_keys format, host certificate authorities are prefixed with @cert-authority
+	HostKey string `yaml:"host_key,omitempty" json:"hostKey,omitempty"`
 }
 
 type PrivateRegistry struct {
@@ -173,6 +291,10 @@ type RKESystemImages struct {
 	WeaveNode string `yaml:"weave_node" json:"weaveNode,omitempty"`
 	// Weave CNI image
 	WeaveCNI string `yaml:"weave_cni" json:"weaveCni,omitempty"`
+	// Cilium agent image
+	Cilium string `yaml:"cilium" json:"cilium,omitempty"`
+	// Cilium operator image
+	CiliumOperator string `yaml:"cilium_operator" json:"ciliumOperator,omitempty"`
 	// Pod infra container image
 	PodInfraContainer string `yaml:"pod_infra_container" json:"podInfraContainer,omitempty"`
 	// Ingress Controller image
@@ -220,6 +342,8 @@ type RKEConfigNode struct {
 	User string `yaml:"user" json:"user,omitempty"`
 	// Optional - Docker socket on the node that will be used in tunneling
 	DockerSocket string `yaml:"docker_socket" json:"dockerSocket,omitempty"`
+	// Optional - Container runtime used on the node, docker (default) or containerd
+	ContainerRuntime string `yaml:"container_runtime,omitempty" json:"containerRuntime,omitempty" norman:"type=enum,options=docker|containerd"`
 	// SSH Agent Auth enable
 	SSHAgentAuth bool `yaml:"ssh_agent_auth,omitempty" json:"sshAgentAuth,omitempty"`
 	// SSH Private Key
@@ -230,6 +354,17 @@ type RKEConfigNode struct {
 	SSHCert string `yaml:"ssh_cert" json:"sshCert,omitempty"`
 	// SSH Certificate Path
 	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty"`
+	// Optional - Passphrase of the SSH Private Key
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase,omitempty" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// Optional - SSH host keys of the node in authorized_keys format, host certificate authorities are prefixed with @cert-authority
+	HostKey string `yaml:"host_key,omitempty" json:"hostKey,omitempty"`
+	// Optional - Bastion/Jump Host used to reach the node instead of the cluster bastion host, the node is reached directly
+	// when its address is empty
+	BastionHost *BastionHost `yaml:"bastion_host,omitempty" json:"bastionHost,omitempty"`
+	// Optional - URL of the SOCKS5 or HTTP CONNECT proxy used to reach the node when it isn't reached through a bastion host
+	Proxy string `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+	// Optional - How the node is reached, ssh (default) or agent when the node agent opens a tunnel to the rke process
+	ConnectionType string `yaml:"connection_type,omitempty" json:"connectionType,omitempty" norman:"type=enum,options=ssh|agent"`
 	// Node Labels
 	Labels map[string]string `yaml:"labels" json:"labels,omitempty"`
 	// Node Taints
@@ -403,6 +538,8 @@ type NetworkConfig struct {
 	WeaveNetworkProvider *WeaveNetworkProvider `yaml:"weave_network_provider,omitempty" json:"weaveNetworkProvider,omitempty"`
 	// AciNetworkProvider
 	AciNetworkProvider *AciNetworkProvider `yaml:"aci_network_provider,omitempty" json:"aciNetworkProvider,omitempty"`
+	// CiliumNetworkProvider
+	CiliumNetworkProvider *CiliumNetworkProvider `yaml:"cilium_network_provider,omitempty" json:"ciliumNetworkProvider,omitempty"`
 	// NodeSelector key pair
 	NodeSelector map[string]string `yaml:"node_selector" json:"nodeSelector,omitempty"`
 	// Network plugin daemonset upgrade strategy
@@ -592,6 +729,17 @@ type WeaveNetworkProvider struct {
 	Password string `yaml:"password,omitempty" json:"password,omitempty" norman:"type=password"`
 }
 
+type CiliumNetworkProvider struct {
+	// Cilium replaces kube-proxy for the service load-balancing, kube-proxy isn't deployed on the hosts
+	KubeProxyReplacement bool `yaml:"kube_proxy_replacement,omitempty" json:"kubeProxyReplacement,omitempty"`
+	// Encapsulation of the pod traffic between the nodes (vxlan, geneve or disabled for native routing)
+	TunnelProtocol string `yaml:"tunnel_protocol,omitempty" json:"tunnelProtocol,omitempty"`
+	// IPAM mode allocating the pod addresses (kubernetes or cluster-pool)
+	IPAMMode string `yaml:"ipam_mode,omitempty" json:"ipamMode,omitempty"`
+	// Enable the Hubble observability layer
+	EnableHubble bool `yaml:"enable_hubble,omitempty" json:"enableHubble,omitempty"`
+}
+
 type AciNetworkProvider struct {
 	SystemIdentifier                     string              `yaml:"system_id,omitempty" json:"systemId,omitempty"`
 	ApicHosts                            []string            `yaml:"apic_hosts" json:"apicHosts,omitempty"`
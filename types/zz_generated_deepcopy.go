@@ -110,6 +110,22 @@ func (in *AciNetworkProvider) DeepCopy() *AciNetworkProvider {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentTunnelConfig) DeepCopyInto(out *AgentTunnelConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentTunnelConfig.
+func (in *AgentTunnelConfig) DeepCopy() *AgentTunnelConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentTunnelConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AuditLog) DeepCopyInto(out *AuditLog) {
 	*out = *in
@@ -251,6 +267,21 @@ func (in *BackupConfig) DeepCopyInto(out *BackupConfig) {
 		*out = new(S3BackupConfig)
 		**out = **in
 	}
+	if in.SFTPBackupConfig != nil {
+		in, out := &in.SFTPBackupConfig, &out.SFTPBackupConfig
+		*out = new(SFTPBackupConfig)
+		**out = **in
+	}
+	if in.LocalDirBackupConfig != nil {
+		in, out := &in.LocalDirBackupConfig, &out.LocalDirBackupConfig
+		*out = new(LocalDirBackupConfig)
+		**out = **in
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(BackupEncryptionConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -264,6 +295,27 @@ func (in *BackupConfig) DeepCopy() *BackupConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupEncryptionConfig) DeepCopyInto(out *BackupEncryptionConfig) {
+	*out = *in
+	if in.Recipients != nil {
+		in, out := &in.Recipients, &out.Recipients
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupEncryptionConfig.
+func (in *BackupEncryptionConfig) DeepCopy() *BackupEncryptionConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupEncryptionConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BaseService) DeepCopyInto(out *BaseService) {
 	*out = *in
@@ -344,9 +396,30 @@ func (in *BaseService) DeepCopy() *BaseService {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BastionHop) DeepCopyInto(out *BastionHop) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BastionHop.
+func (in *BastionHop) DeepCopy() *BastionHop {
+	if in == nil {
+		return nil
+	}
+	out := new(BastionHop)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BastionHost) DeepCopyInto(out *BastionHost) {
 	*out = *in
+	if in.Hops != nil {
+		in, out := &in.Hops, &out.Hops
+		*out = make([]BastionHop, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -409,6 +482,48 @@ func (in *CanalNetworkProvider) DeepCopy() *CanalNetworkProvider {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificatesConfig) DeepCopyInto(out *CertificatesConfig) {
+	*out = *in
+	if in.IntermediateCA != nil {
+		in, out := &in.IntermediateCA, &out.IntermediateCA
+		*out = new(IntermediateCAConfig)
+		**out = **in
+	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultSignerConfig)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificatesConfig.
+func (in *CertificatesConfig) DeepCopy() *CertificatesConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificatesConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CiliumNetworkProvider) DeepCopyInto(out *CiliumNetworkProvider) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CiliumNetworkProvider.
+func (in *CiliumNetworkProvider) DeepCopy() *CiliumNetworkProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(CiliumNetworkProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudProvider) DeepCopyInto(out *CloudProvider) {
 	*out = *in
@@ -956,6 +1071,22 @@ func (in *IngressConfig) DeepCopy() *IngressConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntermediateCAConfig) DeepCopyInto(out *IntermediateCAConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntermediateCAConfig.
+func (in *IntermediateCAConfig) DeepCopy() *IntermediateCAConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IntermediateCAConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *K8sVersionInfo) DeepCopyInto(out *K8sVersionInfo) {
 	*out = *in
@@ -1150,6 +1281,22 @@ func (in *LoadBalancerOpenstackOpts) DeepCopy() *LoadBalancerOpenstackOpts {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalDirBackupConfig) DeepCopyInto(out *LocalDirBackupConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalDirBackupConfig.
+func (in *LocalDirBackupConfig) DeepCopy() *LocalDirBackupConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalDirBackupConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetadataOpenstackOpts) DeepCopyInto(out *MetadataOpenstackOpts) {
 	*out = *in
@@ -1248,6 +1395,11 @@ func (in *NetworkConfig) DeepCopyInto(out *NetworkConfig) {
 		*out = new(AciNetworkProvider)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CiliumNetworkProvider != nil {
+		in, out := &in.CiliumNetworkProvider, &out.CiliumNetworkProvider
+		*out = new(CiliumNetworkProvider)
+		**out = **in
+	}
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make(map[string]string, len(*in))
@@ -1392,6 +1544,22 @@ func (in *OpenstackCloudProvider) DeepCopy() *OpenstackCloudProvider {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParallelismConfig) DeepCopyInto(out *ParallelismConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParallelismConfig.
+func (in *ParallelismConfig) DeepCopy() *ParallelismConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ParallelismConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PortCheck) DeepCopyInto(out *PortCheck) {
 	*out = *in
@@ -1491,6 +1659,11 @@ func (in *RKEConfigNode) DeepCopyInto(out *RKEConfigNode) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.BastionHost != nil {
+		in, out := &in.BastionHost, &out.BastionHost
+		*out = new(BastionHost)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Labels != nil {
 		in, out := &in.Labels, &out.Labels
 		*out = make(map[string]string, len(*in))
@@ -1672,6 +1845,11 @@ func (in *RancherKubernetesEngineConfig) DeepCopyInto(out *RancherKubernetesEngi
 		copy(*out, *in)
 	}
 	out.SystemImages = in.SystemImages
+	if in.AgentTunnel != nil {
+		in, out := &in.AgentTunnel, &out.AgentTunnel
+		*out = new(AgentTunnelConfig)
+		**out = **in
+	}
 	in.Authorization.DeepCopyInto(&out.Authorization)
 	if in.IgnoreDockerVersion != nil {
 		in, out := &in.IgnoreDockerVersion, &out.IgnoreDockerVersion
@@ -1692,7 +1870,7 @@ func (in *RancherKubernetesEngineConfig) DeepCopyInto(out *RancherKubernetesEngi
 	}
 	in.Ingress.DeepCopyInto(&out.Ingress)
 	in.CloudProvider.DeepCopyInto(&out.CloudProvider)
-	out.BastionHost = in.BastionHost
+	in.BastionHost.DeepCopyInto(&out.BastionHost)
 	in.Monitoring.DeepCopyInto(&out.Monitoring)
 	out.Restore = in.Restore
 	if in.RotateCertificates != nil {
@@ -1710,6 +1888,16 @@ func (in *RancherKubernetesEngineConfig) DeepCopyInto(out *RancherKubernetesEngi
 		*out = new(NodeUpgradeStrategy)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Parallelism != nil {
+		in, out := &in.Parallelism, &out.Parallelism
+		*out = new(ParallelismConfig)
+		**out = **in
+	}
+	if in.Certificates != nil {
+		in, out := &in.Certificates, &out.Certificates
+		*out = new(CertificatesConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1792,6 +1980,22 @@ func (in *S3BackupConfig) DeepCopy() *S3BackupConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SFTPBackupConfig) DeepCopyInto(out *SFTPBackupConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFTPBackupConfig.
+func (in *SFTPBackupConfig) DeepCopy() *SFTPBackupConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SFTPBackupConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SchedulerService) DeepCopyInto(out *SchedulerService) {
 	*out = *in
@@ -1846,6 +2050,22 @@ func (in *ServiceOverride) DeepCopy() *ServiceOverride {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultSignerConfig) DeepCopyInto(out *VaultSignerConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultSignerConfig.
+func (in *VaultSignerConfig) DeepCopy() *VaultSignerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultSignerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualCenterConfig) DeepCopyInto(out *VirtualCenterConfig) {
 	*out = *in